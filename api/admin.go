@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/state"
+)
+
+//This file contains the API methods for instance administrators. Note that
+//only the lobbies of the instance handling the request are summarized, see
+//GetRemoteLobbies for the others. Requests concerning a specific lobby are
+//forwarded to the instance owning it.
+
+func requireAdmin(a *auth.Service, h func(http.ResponseWriter, *http.Request, auth.User)) http.HandlerFunc {
+	return a.RequireAdmin(h, func(w http.ResponseWriter, r *http.Request, err error) {
+		if err == auth.ErrNotAdmin {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			HttpUnauthorized(w, r, err)
+		}
+	})
+}
+
+// GetLobbySummaries returns the summaries of all lobbies of this instance.
+func GetLobbySummaries() []*game.LobbySummary {
+	lobbies := state.GetLobbies()
+	summaries := make([]*game.LobbySummary, 0, len(lobbies))
+	for _, lobby := range lobbies {
+		summaries = append(summaries, lobby.Summarize())
+	}
+
+	return summaries
+}
+
+// GetRemoteLobbies returns the registrations of all lobbies owned by other
+// instances. Their summaries are only available from the owning instance.
+func GetRemoteLobbies() []database.LobbyRegistration {
+	registrations, err := state.GetRemoteLobbies()
+	if err != nil {
+		logging.Error("Failed getting remote lobbies", logging.KeyError, err)
+	}
+
+	return registrations
+}
+
+func writeJSONResponse(w http.ResponseWriter, object interface{}) {
+	w.Header().Add("Content-Type", "application/json")
+	encodingError := json.NewEncoder(w).Encode(object)
+	if encodingError != nil {
+		http.Error(w, encodingError.Error(), http.StatusInternalServerError)
+	}
+}
+
+func adminLobbiesEndpoint(w http.ResponseWriter, r *http.Request, u auth.User) {
+	writeJSONResponse(w, GetLobbySummaries())
+}
+
+func adminErrorsEndpoint(w http.ResponseWriter, r *http.Request, u auth.User) {
+	writeJSONResponse(w, logging.RecentErrors())
+}
+
+func adminCloseLobbyEndpoint(w http.ResponseWriter, r *http.Request, u auth.User) {
+	lobby, success := getLobbyWithErrorHandling(w, r)
+	if !success {
+		return
+	}
+
+	if !state.CloseLobby(lobby.LobbyID) {
+		http.Error(w, ErrLobbyNotExistent.Error(), http.StatusNotFound)
+		return
+	}
+
+	lobby.Logger().Info("Lobby closed by admin", logging.KeyUser, u.Id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminKickEndpoint(w http.ResponseWriter, r *http.Request, u auth.User) {
+	lobby, success := getLobbyWithErrorHandling(w, r)
+	if !success {
+		return
+	}
+
+	userID := strings.TrimSpace(r.FormValue("user_id"))
+	if userID == "" {
+		http.Error(w, "please supply the user to kick via the 'user_id' parameter", http.StatusBadRequest)
+		return
+	}
+
+	if !lobby.KickUser(userID) {
+		http.Error(w, "the user isn't part of the lobby", http.StatusNotFound)
+		return
+	}
+
+	lobby.Logger().Info("Player kicked by admin", logging.KeyUser, userID, "kicked_by", u.Id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseSystemMessage(w http.ResponseWriter, r *http.Request) (string, bool) {
+	message := strings.TrimSpace(r.FormValue("message"))
+	if message == "" {
+		http.Error(w, "please supply a non-empty 'message' parameter", http.StatusBadRequest)
+		return "", false
+	}
+
+	return message, true
+}
+
+func adminLobbyMessageEndpoint(w http.ResponseWriter, r *http.Request, u auth.User) {
+	lobby, success := getLobbyWithErrorHandling(w, r)
+	if !success {
+		return
+	}
+
+	message, success := parseSystemMessage(w, r)
+	if !success {
+		return
+	}
+
+	lobby.SendSystemMessage(message)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminMessageEndpoint sends a message to all lobbies of all instances.
+func adminMessageEndpoint(w http.ResponseWriter, r *http.Request, u auth.User) {
+	message, success := parseSystemMessage(w, r)
+	if !success {
+		return
+	}
+
+	if err := state.BroadcastSystemMessage(message); err != nil {
+		logging.Error("Failed broadcasting system message", logging.KeyUser, u.Id, logging.KeyError, err)
+		http.Error(w, "the message has only been sent to the lobbies of this instance", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminRevokeSessionsEndpoint logs a user out everywhere, for example if
+// their cookie has been stolen.
+func adminRevokeSessionsEndpoint(a *auth.Service) func(http.ResponseWriter, *http.Request, auth.User) {
+	return func(w http.ResponseWriter, r *http.Request, u auth.User) {
+		userID := strings.TrimSpace(r.FormValue("user_id"))
+		if userID == "" {
+			http.Error(w, "please supply the user to log out via the 'user_id' parameter", http.StatusBadRequest)
+			return
+		}
+
+		if err := a.RevokeSessions(userID); err != nil {
+			logging.Error("Failed revoking sessions", logging.KeyUser, userID, logging.KeyError, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		logging.Info("Sessions revoked by admin", logging.KeyUser, userID, "revoked_by", u.Id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
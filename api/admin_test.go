@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+)
+
+func createAuthenticatedRequest(t *testing.T, a *auth.Service, user *auth.User) *http.Request {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodGet, "/admin/lobbies", nil)
+	if user != nil {
+		recorder := httptest.NewRecorder()
+		if err := a.SetUserCookie(recorder, user); err != nil {
+			t.Fatalf("Couldn't create cookie: %s", err)
+		}
+		for _, cookie := range recorder.Result().Cookies() {
+			request.AddCookie(cookie)
+		}
+	}
+
+	return request
+}
+
+func Test_requireAdmin(t *testing.T) {
+	a := &auth.Service{
+		JwtKey:        []byte("test"),
+		JwtCookieName: "usertoken",
+		AdminIds:      []string{"1"},
+	}
+	handler := requireAdmin(a, adminLobbiesEndpoint)
+
+	users := map[string]struct {
+		user           *auth.User
+		expectedStatus int
+	}{
+		"anonymous": {nil, http.StatusUnauthorized},
+		"user":      {&auth.User{Id: "2", Name: "User"}, http.StatusForbidden},
+		"admin":     {&auth.User{Id: "1", Name: "Admin"}, http.StatusOK},
+	}
+	for name, testCase := range users {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, createAuthenticatedRequest(t, a, testCase.user))
+			if recorder.Code != testCase.expectedStatus {
+				t.Errorf("Expected status %d, but got %d", testCase.expectedStatus, recorder.Code)
+			}
+		})
+	}
+}
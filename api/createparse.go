@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -93,6 +94,14 @@ func ParseCustomWordsChance(value string) (int, error) {
 	return parseIntValue(value, 0, 100, "custom word chance")
 }
 
+// ParseObserverDelay checks whether the given value is an integer between
+// the lower and upper bound of the observer delay in seconds. All other
+// invalid input, including empty strings, will return an error.
+func ParseObserverDelay(value string) (int, error) {
+	return parseIntValue(value, game.LobbySettingBounds.MinObserverDelay,
+		game.LobbySettingBounds.MaxObserverDelay, "observer delay")
+}
+
 func parseIntValue(value string, lower, upper int64, valueName string) (int, error) {
 	result, parseErr := strconv.ParseInt(value, 10, 64)
 	if parseErr != nil {
@@ -128,3 +137,61 @@ func ParseBoolean(valueName string, value string) (bool, error) {
 
 	return false, fmt.Errorf("the %s value must be a boolean value ('true' or 'false)", valueName)
 }
+
+// ParseJoinRule checks whether the given value is one of the game.JoinRule
+// values. The check is case-insensitive.
+func ParseJoinRule(value string) (game.JoinRule, error) {
+	for _, rule := range []game.JoinRule{game.JoinRuleAll, game.JoinRuleAny} {
+		if strings.EqualFold(value, string(rule)) {
+			return rule, nil
+		}
+	}
+
+	return "", fmt.Errorf("the join rule must be either '%s' or '%s'", game.JoinRuleAll, game.JoinRuleAny)
+}
+
+// ParseJoinRules parses all join rule parameters. Parameters that are
+// missing or empty keep the value of current, which allows editing single
+// rules.
+func ParseJoinRules(values url.Values, current game.JoinRules) (game.JoinRules, []error) {
+	rules := current
+	var errs []error
+	parse := func(key string, parse func(string) error) {
+		if value := values.Get(key); value != "" {
+			if err := parse(value); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	parse("followers_only", func(value string) (err error) {
+		rules.RequireFollow, err = ParseBoolean("followers_only", value)
+		return
+	})
+	parse("min_follow_days", func(value string) (err error) {
+		rules.MinFollowDays, err = parseIntValue(value, 0, game.LobbySettingBounds.MaxFollowDays, "minimum follow days")
+		return
+	})
+	parse("subs_only", func(value string) (err error) {
+		rules.RequireSubscribed, err = ParseBoolean("subs_only", value)
+		return
+	})
+	parse("min_sub_tier", func(value string) (err error) {
+		rules.MinSubTier, err = parseIntValue(value, 0, 3, "minimum subscription tier")
+		return
+	})
+	parse("vips_only", func(value string) (err error) {
+		rules.RequireVIP, err = ParseBoolean("vips_only", value)
+		return
+	})
+	parse("allowlist_only", func(value string) (err error) {
+		rules.RequireAllowlist, err = ParseBoolean("allowlist_only", value)
+		return
+	})
+	parse("join_rule", func(value string) (err error) {
+		rules.Rule, err = ParseJoinRule(value)
+		return
+	})
+
+	return rules, errs
+}
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"net/url"
 	"reflect"
 	"testing"
+
+	"github.com/scribble-rs/scribble.rs/game"
 )
 
 func Test_parsePlayerName(t *testing.T) {
@@ -209,3 +212,32 @@ func Test_parseBoolean(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseJoinRules(t *testing.T) {
+	current := game.JoinRules{RequireFollow: true, MinFollowDays: 30, Rule: game.JoinRuleAny}
+	tests := []struct {
+		name      string
+		values    url.Values
+		want      game.JoinRules
+		wantCount int
+	}{
+		{"nothing changed", url.Values{}, current, 0},
+		{"single rule changed", url.Values{"subs_only": {"true"}, "min_sub_tier": {"2"}},
+			game.JoinRules{RequireFollow: true, MinFollowDays: 30, RequireSubscribed: true, MinSubTier: 2, Rule: game.JoinRuleAny}, 0},
+		{"rule disabled", url.Values{"followers_only": {"false"}, "join_rule": {"ALL"}},
+			game.JoinRules{MinFollowDays: 30, Rule: game.JoinRuleAll}, 0},
+		{"invalid values", url.Values{"min_sub_tier": {"4"}, "min_follow_days": {"-1"}, "join_rule": {"some"}}, current, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := ParseJoinRules(tt.values, current)
+			if len(errs) != tt.wantCount {
+				t.Errorf("ParseJoinRules() errors = %v, want %d errors", errs, tt.wantCount)
+				return
+			}
+			if tt.wantCount == 0 && got != tt.want {
+				t.Errorf("ParseJoinRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,4 +3,12 @@
 // party clients. On top of that this package contains some util code regarding
 // http/ws that can be used by other packages. In order to register the
 // endpoints you have to call SetupRoutes.
+//
+// Third party clients can authenticate via personal API tokens, passed as
+// "Authorization: Bearer <token>". Tokens are created in the settings and are
+// restricted to the scopes chosen by the user.
+//
+// New clients should use /api/v2, which accepts JSON bodies as well as form
+// values and always answers with JSON, including errors. Its OpenAPI document
+// is served at /api/v2/openapi.json.
 package api
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/state"
+	"github.com/scribble-rs/scribble.rs/twitch"
+)
+
+// eventSubEndpoint receives the EventSub notifications of all channels.
+// Since redemptions have to be applied to a lobby in memory, notifications
+// concerning a lobby of another instance are forwarded to that instance,
+// which verifies them on its own. Unverified messages are never forwarded.
+func (h *Handler) eventSubEndpoint(eventSub *twitch.EventSub) http.Handler {
+	handler := eventSub.Handler(h.redeem, h.syncModerators)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		//Otherwise anyone could make us look up channels and forward
+		//arbitrary messages to other instances.
+		if err := eventSub.VerifySignature(r.Header, body); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if r.Header.Get(forwardedHeader) == "" {
+			var message struct {
+				Event struct {
+					BroadcasterUserId string `json:"broadcaster_user_id"`
+				} `json:"event"`
+			}
+			if json.Unmarshal(body, &message) == nil && message.Event.BroadcasterUserId != "" {
+				lobbyID, err := h.Db.GetLastLobbyForChannel(message.Event.BroadcasterUserId)
+				if err == nil {
+					if proxy := proxyForLobby(lobbyID); proxy != nil {
+						//The path has been stripped by the API router, but
+						//the other instance expects the full path.
+						if requestURI, err := url.ParseRequestURI(r.RequestURI); err == nil {
+							r.URL.Path = requestURI.Path
+						}
+						proxy.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// redeem applies a channel point redemption to the last lobby of the
+// broadcaster. Twitch user IDs are used as user IDs, so the lobby can be
+// looked up by the broadcaster's ID.
+func (h *Handler) redeem(redemption *twitch.Redemption) {
+	logger := logging.With(logging.KeyUser, redemption.BroadcasterUserId, "reward", redemption.Reward.Title)
+
+	lobbyID, err := h.Db.GetLastLobbyForChannel(redemption.BroadcasterUserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Info("Redemption for channel without lobby")
+		return
+	} else if err != nil {
+		logger.Error("Failed looking up lobby for redemption", logging.KeyError, err)
+		return
+	}
+
+	lobby := state.GetLobby(lobbyID)
+	if lobby == nil {
+		logger.Info("Redemption for closed lobby", logging.KeyLobby, lobbyID)
+		return
+	}
+
+	viewer := &auth.User{
+		Id:       redemption.UserId,
+		Name:     redemption.UserName,
+		Provider: auth.ProviderTwitch,
+	}
+	if err := lobby.Redeem(redemption.Reward.Title, viewer, redemption.UserInput); err != nil {
+		if err != game.ErrUnknownReward {
+			logger.Info("Redemption not applied", logging.KeyLobby, lobbyID, logging.KeyError, err)
+		}
+		return
+	}
+
+	logger.Info("Redemption applied", logging.KeyLobby, lobbyID, "viewer", viewer.Id)
+}
+
+// syncModerators syncs the channel whose moderators changed. The sync runs
+// in the background, as Twitch expects a timely answer.
+func (h *Handler) syncModerators(change *twitch.ModeratorChange) {
+	channel := &auth.User{
+		Id:       change.BroadcasterUserId,
+		Name:     change.BroadcasterUserName,
+		Provider: auth.ProviderTwitch,
+	}
+	go func() {
+		if err := h.moderation.SyncChannel(channel); err != nil {
+			logging.Warn("Failed syncing channel after moderator change", logging.KeyUser, channel.Id, logging.KeyError, err)
+		}
+	}()
+}
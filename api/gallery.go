@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/state"
+)
+
+var ErrDrawingNotExistent = errors.New("the requested drawing doesn't exist")
+
+// GetGallery returns the drawings of all finished turns of the given lobby.
+// While the lobby is still open, the drawings are taken from memory and are
+// held back for the ObserverDelay, unless the user is the creator or the
+// observer token is supplied. Once the lobby has been cleaned up, only
+// drawings that have been persisted are available.
+func GetGallery(db *database.DB, lobbyID string, user *auth.User, observerToken string) ([]*game.GalleryEntry, error) {
+	lobby := state.GetLobby(lobbyID)
+	if lobby != nil {
+		return lobby.GetGallery(user, observerToken), nil
+	}
+
+	if db == nil {
+		return nil, ErrLobbyNotExistent
+	}
+
+	drawings, err := db.GetDrawingsForLobby(lobbyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(drawings) == 0 {
+		return nil, ErrLobbyNotExistent
+	}
+
+	gallery := make([]*game.GalleryEntry, 0, len(drawings))
+	for index := range drawings {
+		entry, err := game.GalleryEntryFromDrawing(&drawings[index])
+		if err != nil {
+			return nil, err
+		}
+		gallery = append(gallery, entry)
+	}
+
+	return gallery, nil
+}
+
+// GetGalleryEntry returns a single drawing of the given lobby. While the
+// lobby is still open, the drawing is taken from memory, with the same
+// restrictions as in GetGallery. Otherwise it has to have been persisted.
+func GetGalleryEntry(db *database.DB, lobbyID, drawingID string, user *auth.User, observerToken string) (*game.GalleryEntry, error) {
+	lobby := state.GetLobby(lobbyID)
+	if lobby != nil {
+		//Persisted drawings of open lobbies aren't consulted, as they'd
+		//bypass the ObserverDelay.
+		if entry := lobby.GetGalleryEntry(drawingID, user, observerToken); entry != nil {
+			return entry, nil
+		}
+		return nil, ErrDrawingNotExistent
+	}
+
+	if db == nil {
+		return nil, ErrDrawingNotExistent
+	}
+
+	drawing, err := db.GetDrawing(drawingID)
+	if err != nil {
+		return nil, err
+	}
+
+	if drawing == nil || drawing.LobbyId != lobbyID {
+		return nil, ErrDrawingNotExistent
+	}
+
+	return game.GalleryEntryFromDrawing(drawing)
+}
+
+// galleryEndpoint returns the gallery of a lobby. Observers may supply the
+// observer token via the "token" parameter, just like for the websocket.
+func (h *Handler) galleryEndpoint(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	lobbyID := httprouter.ParamsFromContext(r.Context()).ByName("lobbyId")
+	gallery, err := GetGallery(h.Db, lobbyID, user, r.URL.Query().Get("token"))
+	if err == ErrLobbyNotExistent {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		logging.Error("Failed getting gallery", logging.KeyLobby, lobbyID, logging.KeyError, err)
+		writeAPIError(w, http.StatusInternalServerError, "an error occurred")
+		return
+	}
+
+	writeJSONStatus(w, http.StatusOK, gallery)
+}
+
+func (h *Handler) drawingEndpoint(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	params := httprouter.ParamsFromContext(r.Context())
+	entry, err := GetGalleryEntry(h.Db, params.ByName("lobbyId"), params.ByName("drawingId"), user, r.URL.Query().Get("token"))
+	if err == ErrDrawingNotExistent {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		logging.Error("Failed getting drawing", "drawing_id", params.ByName("drawingId"), logging.KeyError, err)
+		writeAPIError(w, http.StatusInternalServerError, "an error occurred")
+		return
+	}
+
+	writeJSONStatus(w, http.StatusOK, entry)
+}
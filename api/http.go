@@ -4,6 +4,9 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/scribble-rs/scribble.rs/auth"
 	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/moderation"
+	"github.com/scribble-rs/scribble.rs/twitch"
 	"net/http"
 	"os"
 )
@@ -24,9 +27,10 @@ func init() {
 	}
 }
 
-// SetupRoutes registers the /api/v1/ endpoints with the router.
-func SetupRoutes(r *httprouter.Router, a *auth.Service, db *database.DB) {
-	handler := &Handler{Db: db}
+// SetupRoutes registers the /api/v1/ and /api/v2/ endpoints with the router.
+// The EventSub callback is only registered if eventSub isn't nil.
+func SetupRoutes(r *httprouter.Router, a *auth.Service, db *database.DB, g *game.Service, eventSub *twitch.EventSub, moderationSync *moderation.Sync) {
+	handler := &Handler{Db: db, gameService: g, moderation: moderationSync}
 
 	// We version the API in order to ensure
 	// backwards compatibility as far as possible.
@@ -36,19 +40,46 @@ func SetupRoutes(r *httprouter.Router, a *auth.Service, db *database.DB) {
 	apiRouter.HandlerFunc("GET", "/stats", handler.statsEndpoint)
 
 	//The websocket is shared between the public API and the official client
-	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId/ws/play", requireUserOrUnauthorized(a, wsLobbyEndpoint))
-	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId/ws/observe", wsObserveEndpoint)
+	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId/ws/play", requireScopeOrUnauthorized(a, auth.ScopeLobbyPlay, wsLobbyEndpoint))
+	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId/ws/observe", a.CheckScope(auth.ScopeLobbyPlay, wsObserveEndpoint))
 
 	//These exist only for the public API.
-	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId", requireUserOrUnauthorized(a, handler.lobbyEndpoint))
-	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId/player", requireUserOrUnauthorized(a, handler.enterLobbyEndpoint))
+	apiRouter.HandlerFunc("POST", "/lobbies", requireScopeOrUnauthorized(a, auth.ScopeLobbyCreate, handler.createLobby))
+	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId", requireScopeOrUnauthorized(a, auth.ScopeLobbyPlay, handler.lobbyEndpoint))
+	apiRouter.HandlerFunc("PATCH", "/lobbies/:lobbyId", requireScopeOrUnauthorized(a, auth.ScopeLobbyEdit, handler.editLobby))
+	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId/player", requireScopeOrUnauthorized(a, auth.ScopeLobbyPlay, handler.enterLobbyEndpoint))
+	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId/gallery", a.CheckScope(auth.ScopeLobbyPlay, handler.galleryEndpoint))
+	apiRouter.HandlerFunc("GET", "/lobbies/:lobbyId/drawings/:drawingId", a.CheckScope(auth.ScopeLobbyPlay, handler.drawingEndpoint))
+
+	apiRouter.HandlerFunc("GET", "/admin/lobbies", requireAdmin(a, adminLobbiesEndpoint))
+	apiRouter.HandlerFunc("POST", "/admin/lobbies/:lobbyId/close", requireAdmin(a, adminCloseLobbyEndpoint))
+	apiRouter.HandlerFunc("POST", "/admin/lobbies/:lobbyId/kick", requireAdmin(a, adminKickEndpoint))
+	apiRouter.HandlerFunc("POST", "/admin/lobbies/:lobbyId/message", requireAdmin(a, adminLobbyMessageEndpoint))
+	apiRouter.HandlerFunc("POST", "/admin/message", requireAdmin(a, adminMessageEndpoint))
+	apiRouter.HandlerFunc("GET", "/admin/errors", requireAdmin(a, adminErrorsEndpoint))
+	apiRouter.HandlerFunc("POST", "/admin/sessions/revoke", requireAdmin(a, adminRevokeSessionsEndpoint(a)))
+
+	if eventSub != nil {
+		apiRouter.Handler("POST", "/eventsub", handler.eventSubEndpoint(eventSub))
+	}
 
 	r.Handler("GET", apiPrefix+"/*path", http.StripPrefix(apiPrefix, apiRouter))
 	r.Handler("POST", apiPrefix+"/*path", http.StripPrefix(apiPrefix, apiRouter))
+	r.Handler("PATCH", apiPrefix+"/*path", http.StripPrefix(apiPrefix, apiRouter))
+
+	handler.setupV2Routes(r, a)
 }
 
-func requireUserOrUnauthorized(a *auth.Service, h func(http.ResponseWriter, *http.Request, auth.User)) http.HandlerFunc {
-	return a.RequireUser(h, HttpUnauthorized)
+// requireScopeOrUnauthorized accepts users authenticated via the cookie or
+// via an API token that has been granted the given scope.
+func requireScopeOrUnauthorized(a *auth.Service, scope string, h func(http.ResponseWriter, *http.Request, auth.User)) http.HandlerFunc {
+	return a.RequireScope(scope, h, func(w http.ResponseWriter, r *http.Request, err error) {
+		if err == auth.ErrMissingScope {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			HttpUnauthorized(w, r, err)
+		}
+	})
 }
 
 func HttpUnauthorized(w http.ResponseWriter, r *http.Request, e error) {
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/metrics"
+)
+
+var (
+	messagesReceived = metrics.NewCounter("scribblers_websocket_messages_received_total",
+		"Websocket events received from clients.", "type")
+	messagesSent = metrics.NewCounter("scribblers_websocket_messages_sent_total",
+		"Websocket events queued for clients.", "type")
+)
+
+// knownReceivedTypes are the event types clients may send. Since clients
+// choose the type, it can't be used as label as is, as every distinct
+// label value creates a new series.
+var knownReceivedTypes = map[string]bool{
+	"keep-alive":          true,
+	"message":             true,
+	"line":                true,
+	"fill":                true,
+	"clear-drawing-board": true,
+	"undo":                true,
+	"redo":                true,
+	"choose-word":         true,
+	"request-drawing":     true,
+	"start":               true,
+	"skip":                true,
+	"pause":               true,
+	"kick":                true,
+	"mute":                true,
+}
+
+// receivedType determines the label of an incoming event for the metrics.
+func receivedType(eventType string) string {
+	if knownReceivedTypes[eventType] {
+		return eventType
+	}
+	return "unknown"
+}
+
+// eventType determines the type of an outgoing event for the metrics.
+func eventType(object interface{}) string {
+	switch event := object.(type) {
+	case *game.GameEvent:
+		return event.Type
+	case game.GameEvent:
+		return event.Type
+	case *game.LineEvent:
+		return event.Type
+	case *game.FillEvent:
+		return event.Type
+	case *game.DrawingBatch:
+		return "drawing-batch"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//This file generates the OpenAPI document of the v2 API from its route
+//table, so that the documentation can't diverge from the implementation.
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Servers    []openAPIServer                         `json:"servers"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]*openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type openAPIOperation struct {
+	Summary     string                      `json:"summary"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+var pathParameterPattern = regexp.MustCompile(`:([a-zA-Z]+)`)
+
+func generateOpenAPI(routes []*v2Route, cookieName string) *openAPIDocument {
+	schemas := make(map[string]*openAPISchema)
+	document := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:   "Scribble.rs API",
+			Version: "2",
+		},
+		Servers: []openAPIServer{{URL: RootPath + v2Prefix}},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: schemas,
+			SecuritySchemes: map[string]*openAPISecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer"},
+				"cookieAuth": {Type: "apiKey", In: "cookie", Name: cookieName},
+			},
+		},
+	}
+
+	errorResponse := &openAPIResponse{
+		Description: "Error",
+		Content: map[string]*openAPIMediaType{
+			"application/json": {Schema: schemaFor(reflect.TypeOf(apiError{}), schemas)},
+		},
+	}
+
+	for _, route := range routes {
+		operation := &openAPIOperation{
+			Summary:   route.summary,
+			Responses: map[string]*openAPIResponse{"default": errorResponse},
+		}
+
+		for _, match := range pathParameterPattern.FindAllStringSubmatch(route.path, -1) {
+			operation.Parameters = append(operation.Parameters, &openAPIParameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &openAPISchema{Type: "string"},
+			})
+		}
+
+		if route.request != nil {
+			schema := schemaFor(reflect.TypeOf(route.request), schemas)
+			operation.RequestBody = &openAPIRequestBody{
+				Required: route.method == http.MethodPost,
+				Content: map[string]*openAPIMediaType{
+					"application/json":                  {Schema: schema},
+					"application/x-www-form-urlencoded": {Schema: schema},
+				},
+			}
+		}
+
+		success := &openAPIResponse{Description: http.StatusText(route.status)}
+		if route.response != nil {
+			success.Content = map[string]*openAPIMediaType{
+				"application/json": {Schema: schemaFor(reflect.TypeOf(route.response), schemas)},
+			}
+		}
+		operation.Responses[strconv.Itoa(route.status)] = success
+
+		if route.scope != "" {
+			operation.Security = []map[string][]string{
+				{"bearerAuth": {route.scope}},
+				{"cookieAuth": {}},
+			}
+		}
+
+		path := pathParameterPattern.ReplaceAllString(route.path, "{$1}")
+		if document.Paths[path] == nil {
+			document.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		document.Paths[path][strings.ToLower(route.method)] = operation
+	}
+
+	return document
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor describes the JSON encoding of the given type. Named structs are
+// added to the components and referenced.
+func schemaFor(t reflect.Type, schemas map[string]*openAPISchema) *openAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t == timeType {
+			return &openAPISchema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+
+		ref := &openAPISchema{Ref: "#/components/schemas/" + t.Name()}
+		if _, exists := schemas[t.Name()]; !exists {
+			//The placeholder prevents endless recursion on recursive types.
+			schemas[t.Name()] = &openAPISchema{}
+			*schemas[t.Name()] = *structSchema(t, schemas)
+		}
+		return ref
+	default:
+		return &openAPISchema{}
+	}
+}
+
+func structSchema(t reflect.Type, schemas map[string]*openAPISchema) *openAPISchema {
+	schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	addStructProperties(schema, t, schemas)
+	return schema
+}
+
+// addStructProperties adds the fields of the struct, including the ones of
+// embedded structs, the same way encoding/json would.
+func addStructProperties(schema *openAPISchema, t reflect.Type, schemas map[string]*openAPISchema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			addStructProperties(schema, fieldType, schemas)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = schemaFor(field.Type, schemas)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/state"
+)
+
+// forwardedHeader marks requests that have already been forwarded by another
+// instance. Those are never forwarded again, preventing loops in case two
+// instances disagree about who owns a lobby.
+const forwardedHeader = "X-Scribblers-Forwarded"
+
+// proxies caches one reverse proxy per instance URL, so that connections to
+// other instances can be reused.
+var proxies sync.Map
+
+// RouteToLobbyOwner forwards all requests concerning a lobby to the instance
+// that owns the lobby, unless it is owned by this instance. This includes
+// websocket connections and the frontend pages. Requests not concerning a
+// lobby are always handled by the given handler.
+func RouteToLobbyOwner(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(forwardedHeader) == "" {
+			if proxy := proxyForLobby(lobbyIDFromPath(r.URL.Path)); proxy != nil {
+				proxy.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func proxyForLobby(lobbyID string) *httputil.ReverseProxy {
+	if lobbyID == "" || state.GetLobby(lobbyID) != nil {
+		return nil
+	}
+
+	registration, err := state.LocateLobby(lobbyID)
+	if err != nil {
+		logging.Error("Failed locating lobby", logging.KeyLobby, lobbyID, logging.KeyError, err)
+		return nil
+	}
+	if registration == nil {
+		return nil
+	}
+
+	if proxy, isCached := proxies.Load(registration.InstanceUrl); isCached {
+		return proxy.(*httputil.ReverseProxy)
+	}
+
+	target, err := url.Parse(registration.InstanceUrl)
+	if err != nil {
+		logging.Error("Invalid instance URL", "instance_id", registration.InstanceId, logging.KeyError, err)
+		return nil
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	defaultDirector := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		defaultDirector(r)
+		r.Header.Set(forwardedHeader, "1")
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logging.Error("Failed forwarding request", logging.KeyLobby, lobbyID, "target", target, logging.KeyError, err)
+		http.Error(w, "the lobby is currently unavailable", http.StatusBadGateway)
+	}
+
+	actual, _ := proxies.LoadOrStore(registration.InstanceUrl, proxy)
+	return actual.(*httputil.ReverseProxy)
+}
+
+// lobbyIDFromPath extracts the lobby ID from paths such as
+// /lobbies/:lobbyId/play or /api/v1/lobbies/:lobbyId/ws/play, regardless of
+// the RootPath.
+func lobbyIDFromPath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for index := 0; index < len(segments)-1; index++ {
+		if segments[index] == "lobbies" {
+			return segments[index+1]
+		}
+	}
+
+	return ""
+}
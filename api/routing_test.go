@@ -0,0 +1,131 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/state"
+	"github.com/scribble-rs/scribble.rs/twitch"
+)
+
+func Test_lobbyIDFromPath(t *testing.T) {
+	paths := map[string]string{
+		"/lobbies/abc/play":               "abc",
+		"/api/v1/lobbies/abc/ws/play":     "abc",
+		"/scribblers/lobbies/abc/gallery": "abc",
+		"/lobbies/abc/drawings/def":       "abc",
+		"/lobbies":                        "",
+		"/lobbies/":                       "",
+		"/resources/lobbies.js":           "",
+		"/api/v1/stats":                   "",
+	}
+
+	for path, expected := range paths {
+		if lobbyID := lobbyIDFromPath(path); lobbyID != expected {
+			t.Errorf("Expected lobby ID '%s' for path %s, but got '%s'", expected, path, lobbyID)
+		}
+	}
+}
+
+// remoteRegistry pretends that all lobbies are owned by another instance.
+type remoteRegistry struct {
+	instanceURL string
+}
+
+func (remoteRegistry) Claim(*game.Lobby) error     { return nil }
+func (remoteRegistry) Release(string) error        { return nil }
+func (remoteRegistry) Refresh([]*game.Lobby) error { return nil }
+func (remoteRegistry) ChannelChanged(string) error { return nil }
+func (remoteRegistry) Broadcast(string) error      { return nil }
+
+func (r remoteRegistry) Locate(lobbyID string) (*database.LobbyRegistration, error) {
+	return &database.LobbyRegistration{LobbyId: lobbyID, InstanceId: "remote", InstanceUrl: r.instanceURL}, nil
+}
+
+func (remoteRegistry) RemotePublicLobbies() ([]database.LobbyRegistration, error) {
+	return nil, nil
+}
+
+func (remoteRegistry) RemoteLobbies() ([]database.LobbyRegistration, error) {
+	return nil, nil
+}
+
+func Test_routeToLobbyOwner(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(forwardedHeader) == "" {
+			t.Error("Forwarded request wasn't marked as such")
+		}
+		io.WriteString(w, "remote "+r.URL.Path)
+	}))
+	defer remote.Close()
+
+	state.SetRegistry(remoteRegistry{instanceURL: remote.URL})
+	defer state.SetRegistry(nil)
+
+	local := RouteToLobbyOwner(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "local "+r.URL.Path)
+	}))
+
+	requests := map[string]string{
+		"/lobbies/abc/play": "remote /lobbies/abc/play",
+		"/api/v1/stats":     "local /api/v1/stats",
+	}
+	for path, expected := range requests {
+		recorder := httptest.NewRecorder()
+		local.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if body := recorder.Body.String(); body != expected {
+			t.Errorf("Expected response '%s' for %s, but got '%s'", expected, path, body)
+		}
+	}
+
+	//Requests that have already been forwarded must never be forwarded
+	//again, even if the registry claims that another instance is the owner.
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/lobbies/abc/play", nil)
+	request.Header.Set(forwardedHeader, "1")
+	local.ServeHTTP(recorder, request)
+	if body := recorder.Body.String(); body != "local /lobbies/abc/play" {
+		t.Errorf("Forwarded request should've been handled locally, but got '%s'", body)
+	}
+}
+
+func Test_eventSubEndpointVerifiesBeforeForwarding(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Unverified message has been forwarded")
+	}))
+	defer remote.Close()
+
+	state.SetRegistry(remoteRegistry{instanceURL: remote.URL})
+	defer state.SetRegistry(nil)
+
+	//Without a database, looking up the channel would fail loudly.
+	handler := (&Handler{}).eventSubEndpoint(&twitch.EventSub{Secret: "0123456789"})
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	newRequest := func(secret, body string) *http.Request {
+		request := httptest.NewRequest(http.MethodPost, "/eventsub", strings.NewReader(body))
+		request.Header.Set("Twitch-Eventsub-Message-Id", "1")
+		request.Header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+		request.Header.Set("Twitch-Eventsub-Message-Type", "webhook_callback_verification")
+		request.Header.Set("Twitch-Eventsub-Message-Signature", twitch.SignEventSubMessage(secret, "1", timestamp, []byte(body)))
+		return request
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newRequest("wrong secret", `{"event":{"broadcaster_user_id":"1"}}`))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected unverified message to be rejected, got %d", recorder.Code)
+	}
+
+	//Verifying up front mustn't make the handler treat messages as duplicates.
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newRequest("0123456789", `{"challenge":"pogchamp"}`))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "pogchamp" {
+		t.Errorf("Expected challenge to be echoed, got %d '%s'", recorder.Code, recorder.Body.String())
+	}
+}
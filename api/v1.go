@@ -7,7 +7,10 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/scribble-rs/scribble.rs/auth"
 	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/moderation"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/scribble-rs/scribble.rs/game"
@@ -37,32 +40,109 @@ type LobbyEntry struct {
 type Handler struct {
 	Db          *database.DB
 	gameService *game.Service
+	moderation  *moderation.Sync
 }
 
 func (h *Handler) publicLobbies(w http.ResponseWriter, r *http.Request) {
+	encodingError := json.NewEncoder(w).Encode(getPublicLobbyEntries())
+	if encodingError != nil {
+		http.Error(w, encodingError.Error(), http.StatusInternalServerError)
+	}
+}
+
+// getPublicLobbyEntries lists the public lobbies of all instances.
+func getPublicLobbyEntries() []*LobbyEntry {
 	//REMARK: If paging is ever implemented, we might want to maintain order
 	//when deleting lobbies from state in the state package.
 
 	lobbies := state.GetPublicLobbies()
 	lobbyEntries := make([]*LobbyEntry, 0, len(lobbies))
 	for _, lobby := range lobbies {
-		//While one would expect locking the lobby here, it's not very
-		//important to get 100% consistent results here.
+		lobby.Synchronized(func() {
+			lobbyEntries = append(lobbyEntries, &LobbyEntry{
+				LobbyID:     lobby.LobbyID,
+				PlayerCount: lobby.GetOccupiedPlayerSlots(),
+				MaxPlayers:  lobby.MaxPlayers,
+				Round:       lobby.Round,
+				Rounds:      lobby.Rounds,
+				DrawingTime: lobby.DrawingTime,
+				CustomWords: len(lobby.CustomWords) > 0,
+				Wordpack:    lobby.Wordpack,
+			})
+		})
+	}
+
+	//If other instances are unavailable, it's still better to show our own
+	//lobbies than nothing at all.
+	remoteLobbies, err := state.GetRemotePublicLobbies()
+	if err != nil {
+		logging.Error("Failed getting public lobbies of other instances", logging.KeyError, err)
+	}
+	for _, registration := range remoteLobbies {
 		lobbyEntries = append(lobbyEntries, &LobbyEntry{
-			LobbyID:     lobby.LobbyID,
-			PlayerCount: lobby.GetOccupiedPlayerSlots(),
-			MaxPlayers:  lobby.MaxPlayers,
-			Round:       lobby.Round,
-			Rounds:      lobby.Rounds,
-			DrawingTime: lobby.DrawingTime,
-			CustomWords: len(lobby.CustomWords) > 0,
-			Wordpack:    lobby.Wordpack,
+			LobbyID:     registration.LobbyId,
+			PlayerCount: registration.PlayerCount,
+			MaxPlayers:  registration.MaxPlayers,
+			Round:       registration.Round,
+			Rounds:      registration.Rounds,
+			DrawingTime: registration.DrawingTime,
+			CustomWords: registration.CustomWords,
+			Wordpack:    registration.Wordpack,
 		})
 	}
-	encodingError := json.NewEncoder(w).Encode(lobbyEntries)
-	if encodingError != nil {
-		http.Error(w, encodingError.Error(), http.StatusInternalServerError)
+
+	return lobbyEntries
+}
+
+// lobbyCreation holds the validated parameters for creating a lobby.
+type lobbyCreation struct {
+	language          string
+	drawingTime       int
+	rounds            int
+	maxPlayers        int
+	customWords       []string
+	customWordsChance int
+	public            bool
+	joinRules         game.JoinRules
+	saveDrawings      bool
+}
+
+// parseLobbyCreation validates the given values, returning all problems found.
+func parseLobbyCreation(values url.Values) (*lobbyCreation, []string) {
+	var creation lobbyCreation
+	var languageInvalid, drawingTimeInvalid, roundsInvalid, maxPlayersInvalid, customWordsInvalid,
+		customWordChanceInvalid, publicLobbyInvalid, saveDrawingsInvalid error
+	var joinRulesInvalid []error
+	creation.language, languageInvalid = ParseLanguage(values.Get("language"))
+	creation.drawingTime, drawingTimeInvalid = ParseDrawingTime(values.Get("drawing_time"))
+	creation.rounds, roundsInvalid = ParseRounds(values.Get("rounds"))
+	creation.maxPlayers, maxPlayersInvalid = ParseMaxPlayers(values.Get("max_players"))
+	creation.customWords, customWordsInvalid = ParseCustomWords(values.Get("custom_words"))
+	creation.customWordsChance, customWordChanceInvalid = ParseCustomWordsChance(values.Get("custom_words_chance"))
+	creation.public, publicLobbyInvalid = ParseBoolean("public", values.Get("public"))
+	creation.joinRules, joinRulesInvalid = ParseJoinRules(values, game.JoinRules{})
+	creation.saveDrawings, saveDrawingsInvalid = ParseBoolean("save_drawings", values.Get("save_drawings"))
+
+	var requestErrors []string
+	for _, err := range append([]error{languageInvalid, drawingTimeInvalid, roundsInvalid, maxPlayersInvalid, customWordsInvalid,
+		customWordChanceInvalid, publicLobbyInvalid, saveDrawingsInvalid}, joinRulesInvalid...) {
+		if err != nil {
+			requestErrors = append(requestErrors, err.Error())
+		}
+	}
+
+	return &creation, requestErrors
+}
+
+func (c *lobbyCreation) createLobby(db *database.DB, user *auth.User) (*game.Lobby, error) {
+	_, lobby, err := game.CreateLobby(db, user, c.language, c.public, c.drawingTime, c.rounds, c.maxPlayers,
+		c.customWordsChance, c.customWords, c.joinRules, c.saveDrawings)
+	if err != nil {
+		return nil, err
 	}
+
+	lobby.WriteJSON = WriteJSON
+	return lobby, nil
 }
 
 func (h *Handler) createLobby(w http.ResponseWriter, r *http.Request, user auth.User) {
@@ -72,57 +152,18 @@ func (h *Handler) createLobby(w http.ResponseWriter, r *http.Request, user auth.
 		return
 	}
 
-	language, languageInvalid := ParseLanguage(r.Form.Get("language"))
-	drawingTime, drawingTimeInvalid := ParseDrawingTime(r.Form.Get("drawing_time"))
-	rounds, roundsInvalid := ParseRounds(r.Form.Get("rounds"))
-	maxPlayers, maxPlayersInvalid := ParseMaxPlayers(r.Form.Get("max_players"))
-	customWords, customWordsInvalid := ParseCustomWords(r.Form.Get("custom_words"))
-	customWordChance, customWordChanceInvalid := ParseCustomWordsChance(r.Form.Get("custom_words_chance"))
-	publicLobby, publicLobbyInvalid := ParseBoolean("public", r.Form.Get("public"))
-	followersOnly, followersOnlyInvalid := ParseBoolean("followers_only", r.Form.Get("followers_only"))
-	subsOnly, subsOnlyInvalid := ParseBoolean("subs_only", r.Form.Get("subs_only"))
-
-	var requestErrors []string
-	if languageInvalid != nil {
-		requestErrors = append(requestErrors, languageInvalid.Error())
-	}
-	if drawingTimeInvalid != nil {
-		requestErrors = append(requestErrors, drawingTimeInvalid.Error())
-	}
-	if roundsInvalid != nil {
-		requestErrors = append(requestErrors, roundsInvalid.Error())
-	}
-	if maxPlayersInvalid != nil {
-		requestErrors = append(requestErrors, maxPlayersInvalid.Error())
-	}
-	if customWordsInvalid != nil {
-		requestErrors = append(requestErrors, customWordsInvalid.Error())
-	}
-	if customWordChanceInvalid != nil {
-		requestErrors = append(requestErrors, customWordChanceInvalid.Error())
-	}
-	if publicLobbyInvalid != nil {
-		requestErrors = append(requestErrors, publicLobbyInvalid.Error())
-	}
-	if followersOnlyInvalid != nil {
-		requestErrors = append(requestErrors, followersOnlyInvalid.Error())
-	}
-	if subsOnlyInvalid != nil {
-		requestErrors = append(requestErrors, subsOnlyInvalid.Error())
-	}
-
+	creation, requestErrors := parseLobbyCreation(r.Form)
 	if len(requestErrors) != 0 {
 		http.Error(w, strings.Join(requestErrors, ";"), http.StatusBadRequest)
 		return
 	}
 
-	_, lobby, createError := game.CreateLobby(h.Db, &user, language, publicLobby, drawingTime, rounds, maxPlayers, customWordChance, customWords, followersOnly, subsOnly)
+	lobby, createError := creation.createLobby(h.Db, &user)
 	if createError != nil {
 		http.Error(w, createError.Error(), http.StatusBadRequest)
 		return
 	}
 
-	lobby.WriteJSON = WriteJSON
 	lobbyData := CreateLobbyData(lobby)
 
 	encodingError := json.NewEncoder(w).Encode(lobbyData)
@@ -132,80 +173,137 @@ func (h *Handler) createLobby(w http.ResponseWriter, r *http.Request, user auth.
 
 	//We only add the lobby if everything else was successful.
 	state.AddLobby(lobby)
-	//h.Db.AddLobby(&user, lobby.LobbyID)
+	if err := h.Db.AddLobby(&user, lobby.LobbyID); err != nil {
+		lobby.Logger().Error("Failed persisting lobby", logging.KeyUser, user.Id, logging.KeyError, err)
+	}
 }
 
-func (h *Handler) enterLobbyEndpoint(w http.ResponseWriter, r *http.Request, user auth.User) {
-	lobby, success := getLobbyWithErrorHandling(w, r)
-	if !success {
-		return
-	}
+// joinForbiddenError is returned if a user isn't allowed to join a lobby.
+type joinForbiddenError struct {
+	reason string
+}
 
+func (e *joinForbiddenError) Error() string {
+	return "You're not allowed to join: " + e.reason
+}
+
+// enterLobby joins the user to the lobby, unless they're already a player.
+func (h *Handler) enterLobby(lobby *game.Lobby, user *auth.User) (*LobbyData, error) {
 	var lobbyData *LobbyData
+	var joinError error
 
 	lobby.Synchronized(func() {
-		player := lobby.GetPlayer(&user)
+		player := lobby.GetPlayer(user)
 
 		if player == nil {
-			canJoin, reason, err := h.gameService.CanJoin(&user, lobby)
+			canJoin, reason, err := h.gameService.CanJoin(user, lobby)
 			if err != nil {
-				http.Error(w, "An error occurred", http.StatusInternalServerError)
+				joinError = err
 				return
 			}
 
 			if !canJoin {
-				http.Error(w, "You're not allowed to join: "+reason, http.StatusForbidden)
+				joinError = &joinForbiddenError{reason: reason}
 				return
 			}
 
-			lobby.JoinPlayer(&user)
+			lobby.JoinPlayer(user)
 		}
 
 		lobbyData = CreateLobbyData(lobby)
 	})
 
-	if lobbyData != nil {
-		encodingError := json.NewEncoder(w).Encode(lobbyData)
-		if encodingError != nil {
-			http.Error(w, encodingError.Error(), http.StatusInternalServerError)
-		}
-	}
+	return lobbyData, joinError
 }
 
-func (h *Handler) editLobby(w http.ResponseWriter, r *http.Request, user auth.User) {
+func (h *Handler) enterLobbyEndpoint(w http.ResponseWriter, r *http.Request, user auth.User) {
 	lobby, success := getLobbyWithErrorHandling(w, r)
 	if !success {
 		return
 	}
 
-	parseError := r.ParseForm()
-	if parseError != nil {
-		http.Error(w, fmt.Sprintf("error parsing request query into form (%s)", parseError), http.StatusBadRequest)
+	lobbyData, err := h.enterLobby(lobby, &user)
+	if forbidden, isForbidden := err.(*joinForbiddenError); isForbidden {
+		http.Error(w, forbidden.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "An error occurred", http.StatusInternalServerError)
 		return
 	}
 
+	encodingError := json.NewEncoder(w).Encode(lobbyData)
+	if encodingError != nil {
+		http.Error(w, encodingError.Error(), http.StatusInternalServerError)
+	}
+}
+
+// lobbyEdit holds the validated new settings of a lobby.
+type lobbyEdit struct {
+	maxPlayers            int
+	drawingTime           int
+	rounds                int
+	customWordsChance     int
+	public                bool
+	observerDelay         int
+	observerParticipation bool
+	joinRules             game.JoinRules
+}
+
+// lobbySnapshot holds the state of a lobby that edits are validated against.
+type lobbySnapshot struct {
+	round                 int
+	observerDelay         int
+	observerParticipation bool
+	joinRules             game.JoinRules
+	twitchCreator         bool
+}
+
+// snapshotLobby has to be called while the lobby is locked. The edit has to
+// be applied within the same lock, as it might be invalid otherwise.
+func snapshotLobby(lobby *game.Lobby) *lobbySnapshot {
+	return &lobbySnapshot{
+		round:                 lobby.Round,
+		observerDelay:         lobby.ObserverDelay,
+		observerParticipation: lobby.ObserverParticipation,
+		joinRules:             lobby.JoinRules,
+		twitchCreator:         lobby.GetCreator().IsTwitch(),
+	}
+}
+
+// parseLobbyEdit validates the given values, returning all problems found.
+func parseLobbyEdit(current *lobbySnapshot, values url.Values) (*lobbyEdit, []string) {
 	var requestErrors []string
 
 	//Uneditable properties
-	if r.Form.Get("custom_words") != "" {
+	if values.Get("custom_words") != "" {
 		requestErrors = append(requestErrors, "can't modify custom_words in existing lobby")
 	}
-	if r.Form.Get("language") != "" {
+	if values.Get("language") != "" {
 		requestErrors = append(requestErrors, "can't modify language in existing lobby")
 	}
 
 	//Editable properties
-	maxPlayers, maxPlayersInvalid := ParseMaxPlayers(r.Form.Get("max_players"))
-	drawingTime, drawingTimeInvalid := ParseDrawingTime(r.Form.Get("drawing_time"))
-	rounds, roundsInvalid := ParseRounds(r.Form.Get("rounds"))
-	customWordChance, customWordChanceInvalid := ParseCustomWordsChance(r.Form.Get("custom_words_chance"))
-	publicLobby, publicLobbyInvalid := ParseBoolean("public", r.Form.Get("public"))
-
-	owner := lobby.Owner
-	if owner == nil || owner.GetUser().Id != user.Id {
-		http.Error(w, "only the lobby owner can edit the lobby", http.StatusForbidden)
-		return
-	}
+	var edit lobbyEdit
+	var maxPlayersInvalid, drawingTimeInvalid, roundsInvalid, customWordChanceInvalid, publicLobbyInvalid error
+	edit.maxPlayers, maxPlayersInvalid = ParseMaxPlayers(values.Get("max_players"))
+	edit.drawingTime, drawingTimeInvalid = ParseDrawingTime(values.Get("drawing_time"))
+	edit.rounds, roundsInvalid = ParseRounds(values.Get("rounds"))
+	edit.customWordsChance, customWordChanceInvalid = ParseCustomWordsChance(values.Get("custom_words_chance"))
+	edit.public, publicLobbyInvalid = ParseBoolean("public", values.Get("public"))
+	//The observer settings are optional, as older clients don't know about them.
+	var observerDelayInvalid, observerParticipationInvalid error
+	edit.observerDelay = current.observerDelay
+	if value := values.Get("observer_delay"); value != "" {
+		edit.observerDelay, observerDelayInvalid = ParseObserverDelay(value)
+	}
+	edit.observerParticipation = current.observerParticipation
+	if value := values.Get("observer_participation"); value != "" {
+		edit.observerParticipation, observerParticipationInvalid = ParseBoolean("observer participation", value)
+	}
+
+	//The join rules are optional as well, missing ones are kept.
+	var joinRulesInvalid []error
+	edit.joinRules, joinRulesInvalid = ParseJoinRules(values, current.joinRules)
 
 	if maxPlayersInvalid != nil {
 		requestErrors = append(requestErrors, maxPlayersInvalid.Error())
@@ -216,8 +314,8 @@ func (h *Handler) editLobby(w http.ResponseWriter, r *http.Request, user auth.Us
 	if roundsInvalid != nil {
 		requestErrors = append(requestErrors, roundsInvalid.Error())
 	} else {
-		currentRound := lobby.Round
-		if rounds < currentRound {
+		currentRound := current.round
+		if edit.rounds < currentRound {
 			requestErrors = append(requestErrors, fmt.Sprintf("rounds must be greater than or equal to the current round (%d)", currentRound))
 		}
 	}
@@ -227,33 +325,72 @@ func (h *Handler) editLobby(w http.ResponseWriter, r *http.Request, user auth.Us
 	if publicLobbyInvalid != nil {
 		requestErrors = append(requestErrors, publicLobbyInvalid.Error())
 	}
+	if observerDelayInvalid != nil {
+		requestErrors = append(requestErrors, observerDelayInvalid.Error())
+	}
+	if observerParticipationInvalid != nil {
+		requestErrors = append(requestErrors, observerParticipationInvalid.Error())
+	}
+	for _, err := range joinRulesInvalid {
+		requestErrors = append(requestErrors, err.Error())
+	}
+	if edit.joinRules.Restricted() && !current.twitchCreator {
+		requestErrors = append(requestErrors, game.ErrTwitchRequired.Error())
+	}
 
-	if len(requestErrors) != 0 {
-		http.Error(w, strings.Join(requestErrors, ";"), http.StatusBadRequest)
+	return &edit, requestErrors
+}
+
+// apply has to be called while the lobby is locked.
+func (edit *lobbyEdit) apply(lobby *game.Lobby) {
+	//While changing maxClientsPerIP and maxPlayers to a value lower than
+	//is currently being used makes little sense, we'll allow it, as it doesn't
+	//really break anything.
+
+	lobby.MaxPlayers = edit.maxPlayers
+	lobby.CustomWordsChance = edit.customWordsChance
+	lobby.Public = edit.public
+	lobby.Rounds = edit.rounds
+	lobby.ObserverDelay = edit.observerDelay
+	lobby.ObserverParticipation = edit.observerParticipation
+	lobby.JoinRules = edit.joinRules
+
+	if lobby.State == game.Ongoing {
+		lobby.DrawingTimeNew = edit.drawingTime
+	} else {
+		lobby.DrawingTime = edit.drawingTime
+	}
+
+	lobbySettingsCopy := *lobby.EditableLobbySettings
+	lobbySettingsCopy.DrawingTime = edit.drawingTime
+	lobby.TriggerUpdateEvent("lobby-settings-changed", lobbySettingsCopy)
+}
+
+func (h *Handler) editLobby(w http.ResponseWriter, r *http.Request, user auth.User) {
+	lobby, success := getLobbyWithErrorHandling(w, r)
+	if !success {
 		return
 	}
 
-	//We synchronize as late as possible to avoid unnecessary lags.
-	//The previous code here isn't really prone to bugs due to lack of sync.
-	lobby.Synchronized(func() {
-		//While changing maxClientsPerIP and maxPlayers to a value lower than
-		//is currently being used makes little sense, we'll allow it, as it doesn't
-		//really break anything.
+	parseError := r.ParseForm()
+	if parseError != nil {
+		http.Error(w, fmt.Sprintf("error parsing request query into form (%s)", parseError), http.StatusBadRequest)
+		return
+	}
 
-		lobby.MaxPlayers = maxPlayers
-		lobby.CustomWordsChance = customWordChance
-		lobby.Public = publicLobby
-		lobby.Rounds = rounds
+	if !lobby.IsAllowed(&user, game.ActionEditSettings) {
+		http.Error(w, "you aren't allowed to edit the lobby", http.StatusForbidden)
+		return
+	}
 
-		if lobby.State == game.Ongoing {
-			lobby.DrawingTimeNew = drawingTime
-		} else {
-			lobby.DrawingTime = drawingTime
+	lobby.Synchronized(func() {
+		edit, requestErrors := parseLobbyEdit(snapshotLobby(lobby), r.Form)
+		if len(requestErrors) != 0 {
+			http.Error(w, strings.Join(requestErrors, ";"), http.StatusBadRequest)
+			return
 		}
 
-		lobbySettingsCopy := *lobby.EditableLobbySettings
-		lobbySettingsCopy.DrawingTime = drawingTime
-		lobby.TriggerUpdateEvent("lobby-settings-changed", lobbySettingsCopy)
+		edit.apply(lobby)
 	})
 }
 
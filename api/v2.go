@@ -0,0 +1,437 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/state"
+)
+
+//This file contains the second version of the public API. In contrast to the
+//first version, all routes are described by v2Routes, which is also used for
+//generating the OpenAPI document. Requests may either be sent as JSON or as
+//form values and all responses, including errors, are JSON.
+
+const v2Prefix = "/api/v2"
+
+// maxRequestBodySize limits JSON request bodies, as they are read into memory.
+const maxRequestBodySize = 1 << 20
+
+// v2Route describes a single route of the v2 API.
+type v2Route struct {
+	method  string
+	path    string
+	summary string
+	// scope is required for calling the route. Routes without a scope are
+	// public.
+	scope string
+	// request and response are only used for documenting the route. They
+	// are either nil or a value of the respective type.
+	request  interface{}
+	response interface{}
+	// status is the status code of successful responses.
+	status  int
+	handler func(w http.ResponseWriter, r *http.Request, user *auth.User)
+}
+
+// apiError is the body of all error responses of the v2 API.
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	// Details lists all problems found, for example when validating a
+	// request.
+	Details []string `json:"details,omitempty"`
+}
+
+// lobbyCreationRequest documents the parameters of POST /lobbies, see
+// parseLobbyCreation.
+type lobbyCreationRequest struct {
+	Language          string `json:"language"`
+	DrawingTime       int    `json:"drawing_time"`
+	Rounds            int    `json:"rounds"`
+	MaxPlayers        int    `json:"max_players"`
+	CustomWords       string `json:"custom_words,omitempty"`
+	CustomWordsChance int    `json:"custom_words_chance"`
+	Public            bool   `json:"public,omitempty"`
+	FollowersOnly     bool   `json:"followers_only,omitempty"`
+	MinFollowDays     int    `json:"min_follow_days,omitempty"`
+	SubsOnly          bool   `json:"subs_only,omitempty"`
+	MinSubTier        int    `json:"min_sub_tier,omitempty"`
+	VipsOnly          bool   `json:"vips_only,omitempty"`
+	AllowlistOnly     bool   `json:"allowlist_only,omitempty"`
+	JoinRule          string `json:"join_rule,omitempty"`
+	SaveDrawings      bool   `json:"save_drawings,omitempty"`
+}
+
+// lobbyEditRequest documents the parameters of PATCH /lobbies/:lobbyId, see
+// parseLobbyEdit. Omitted parameters keep their current value.
+type lobbyEditRequest struct {
+	DrawingTime           int  `json:"drawing_time,omitempty"`
+	Rounds                int  `json:"rounds,omitempty"`
+	MaxPlayers            int  `json:"max_players,omitempty"`
+	CustomWordsChance     int  `json:"custom_words_chance,omitempty"`
+	Public                bool `json:"public,omitempty"`
+	ObserverDelay         int  `json:"observer_delay,omitempty"`
+	ObserverParticipation bool `json:"observer_participation,omitempty"`
+	// The join rules apply to players joining after the edit.
+	FollowersOnly bool   `json:"followers_only,omitempty"`
+	MinFollowDays int    `json:"min_follow_days,omitempty"`
+	SubsOnly      bool   `json:"subs_only,omitempty"`
+	MinSubTier    int    `json:"min_sub_tier,omitempty"`
+	VipsOnly      bool   `json:"vips_only,omitempty"`
+	AllowlistOnly bool   `json:"allowlist_only,omitempty"`
+	JoinRule      string `json:"join_rule,omitempty"`
+}
+
+func (h *Handler) v2Routes() []*v2Route {
+	return []*v2Route{
+		{
+			method: http.MethodGet, path: "/lobbies", summary: "List all public lobbies",
+			response: []*LobbyEntry{}, status: http.StatusOK, handler: h.v2ListLobbies,
+		},
+		{
+			method: http.MethodPost, path: "/lobbies", summary: "Create a lobby owned by the user",
+			scope: auth.ScopeLobbyCreate, request: lobbyCreationRequest{}, response: &LobbyData{},
+			status: http.StatusCreated, handler: h.v2CreateLobby,
+		},
+		{
+			method: http.MethodGet, path: "/lobbies/:lobbyId", summary: "Get the settings of a lobby",
+			response: &LobbyData{}, status: http.StatusOK, handler: h.v2GetLobby,
+		},
+		{
+			method: http.MethodPatch, path: "/lobbies/:lobbyId", summary: "Edit the settings of a lobby",
+			scope: auth.ScopeLobbyEdit, request: lobbyEditRequest{}, response: &LobbyData{},
+			status: http.StatusOK, handler: h.v2EditLobby,
+		},
+		{
+			method: http.MethodDelete, path: "/lobbies/:lobbyId", summary: "Close a lobby",
+			scope: auth.ScopeLobbyEdit, status: http.StatusNoContent, handler: h.v2CloseLobby,
+		},
+		{
+			method: http.MethodGet, path: "/lobbies/:lobbyId/players", summary: "List the players of a lobby",
+			response: []game.PlayerSummary{}, status: http.StatusOK, handler: h.v2ListPlayers,
+		},
+		{
+			method: http.MethodPost, path: "/lobbies/:lobbyId/players", summary: "Join a lobby as the user",
+			scope: auth.ScopeLobbyPlay, response: &LobbyData{}, status: http.StatusOK, handler: h.v2JoinLobby,
+		},
+		{
+			method: http.MethodDelete, path: "/lobbies/:lobbyId/players/:userId", summary: "Kick a player from a lobby",
+			scope: auth.ScopeLobbyEdit, status: http.StatusNoContent, handler: h.v2KickPlayer,
+		},
+	}
+}
+
+// setupV2Routes registers the v2 API and its OpenAPI document.
+func (h *Handler) setupV2Routes(r *httprouter.Router, a *auth.Service) {
+	routes := h.v2Routes()
+	apiRouter := httprouter.New()
+	apiRouter.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "route not found")
+	})
+	apiRouter.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not supported", r.Method))
+	})
+
+	for _, route := range routes {
+		apiRouter.HandlerFunc(route.method, route.path, v2Handler(a, route))
+	}
+
+	openAPIDocument := generateOpenAPI(routes, a.JwtCookieName)
+	apiRouter.HandlerFunc(http.MethodGet, "/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, openAPIDocument)
+	})
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		r.Handler(method, v2Prefix+"/*path", http.StripPrefix(v2Prefix, apiRouter))
+	}
+}
+
+// v2Handler authenticates requests to routes requiring a scope.
+func v2Handler(a *auth.Service, route *v2Route) http.HandlerFunc {
+	if route.scope == "" {
+		return func(w http.ResponseWriter, r *http.Request) {
+			route.handler(w, r, nil)
+		}
+	}
+
+	return a.RequireScope(route.scope, func(w http.ResponseWriter, r *http.Request, user auth.User) {
+		route.handler(w, r, &user)
+	}, func(w http.ResponseWriter, r *http.Request, err error) {
+		if err == auth.ErrMissingScope {
+			writeAPIError(w, http.StatusForbidden, err.Error())
+		} else {
+			writeAPIError(w, http.StatusUnauthorized, err.Error())
+		}
+	})
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string, details ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&apiError{
+		Status:  status,
+		Message: message,
+		Details: details,
+	})
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, object interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(object); err != nil {
+		logging.Error("Failed encoding response", logging.KeyError, err)
+	}
+}
+
+// requestValues returns the parameters of the request, which are either sent
+// as a JSON object or as form values. JSON values are converted to their
+// form equivalent, arrays are joined by commas.
+func requestValues(r *http.Request) (url.Values, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		return r.Form, nil
+	}
+
+	var object map[string]interface{}
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	values := url.Values{}
+	for key, value := range object {
+		if value == nil {
+			continue
+		}
+
+		if array, isArray := value.([]interface{}); isArray {
+			items := make([]string, 0, len(array))
+			for _, item := range array {
+				itemString, err := jsonValueToString(key, item)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, itemString)
+			}
+			values.Set(key, strings.Join(items, ","))
+			continue
+		}
+
+		valueString, err := jsonValueToString(key, value)
+		if err != nil {
+			return nil, err
+		}
+		values.Set(key, valueString)
+	}
+
+	return values, nil
+}
+
+func jsonValueToString(key string, value interface{}) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case json.Number:
+		return typed.String(), nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	default:
+		return "", fmt.Errorf("unsupported value for '%s'", key)
+	}
+}
+
+// v2Lobby looks up the lobby of the request, writing an error if it doesn't
+// exist.
+func v2Lobby(w http.ResponseWriter, r *http.Request) (*game.Lobby, bool) {
+	lobbyID := httprouter.ParamsFromContext(r.Context()).ByName("lobbyId")
+	lobby := state.GetLobby(lobbyID)
+	if lobby == nil {
+		writeAPIError(w, http.StatusNotFound, ErrLobbyNotExistent.Error())
+		return nil, false
+	}
+
+	return lobby, true
+}
+
+// v2AuthorizedLobby additionally requires the user to be allowed to perform
+// the action in the lobby.
+func v2AuthorizedLobby(w http.ResponseWriter, r *http.Request, user *auth.User, action game.Action) (*game.Lobby, bool) {
+	lobby, found := v2Lobby(w, r)
+	if !found {
+		return nil, false
+	}
+
+	if !lobby.IsAllowed(user, action) {
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("you aren't allowed to %s in this lobby", action))
+		return nil, false
+	}
+
+	return lobby, true
+}
+
+func (h *Handler) v2ListLobbies(w http.ResponseWriter, r *http.Request, _ *auth.User) {
+	writeJSONStatus(w, http.StatusOK, getPublicLobbyEntries())
+}
+
+func (h *Handler) v2CreateLobby(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	values, err := requestValues(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	creation, requestErrors := parseLobbyCreation(values)
+	if len(requestErrors) != 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid lobby settings", requestErrors...)
+		return
+	}
+
+	lobby, err := creation.createLobby(h.Db, user)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	state.AddLobby(lobby)
+	logger := lobby.Logger().With(logging.KeyUser, user.Id)
+	if err := h.Db.AddLobby(user, lobby.LobbyID); err != nil {
+		logger.Error("Failed persisting lobby", logging.KeyError, err)
+	}
+	logger.Info("Lobby created via API")
+
+	writeJSONStatus(w, http.StatusCreated, CreateLobbyData(lobby))
+}
+
+func (h *Handler) v2GetLobby(w http.ResponseWriter, r *http.Request, _ *auth.User) {
+	lobby, found := v2Lobby(w, r)
+	if !found {
+		return
+	}
+
+	writeJSONStatus(w, http.StatusOK, CreateLobbyData(lobby))
+}
+
+// currentLobbyValues returns the editable settings of the lobby as request
+// values, so that edits may omit settings that shouldn't change. The lobby
+// has to be locked.
+func currentLobbyValues(lobby *game.Lobby) url.Values {
+	drawingTime := lobby.DrawingTime
+	if lobby.DrawingTimeNew != 0 {
+		drawingTime = lobby.DrawingTimeNew
+	}
+
+	values := url.Values{}
+	values.Set("drawing_time", strconv.Itoa(drawingTime))
+	values.Set("rounds", strconv.Itoa(lobby.Rounds))
+	values.Set("max_players", strconv.Itoa(lobby.MaxPlayers))
+	values.Set("custom_words_chance", strconv.Itoa(lobby.CustomWordsChance))
+	values.Set("public", strconv.FormatBool(lobby.Public))
+	values.Set("observer_delay", strconv.Itoa(lobby.ObserverDelay))
+	values.Set("observer_participation", strconv.FormatBool(lobby.ObserverParticipation))
+	return values
+}
+
+func (h *Handler) v2EditLobby(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	lobby, found := v2AuthorizedLobby(w, r, user, game.ActionEditSettings)
+	if !found {
+		return
+	}
+
+	requested, err := requestValues(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	//Concurrent edits could otherwise invalidate what we've validated.
+	lobby.Synchronized(func() {
+		values := currentLobbyValues(lobby)
+		for key := range requested {
+			values.Set(key, requested.Get(key))
+		}
+
+		edit, requestErrors := parseLobbyEdit(snapshotLobby(lobby), values)
+		if len(requestErrors) != 0 {
+			writeAPIError(w, http.StatusBadRequest, "invalid lobby settings", requestErrors...)
+			return
+		}
+
+		edit.apply(lobby)
+		writeJSONStatus(w, http.StatusOK, CreateLobbyData(lobby))
+	})
+}
+
+func (h *Handler) v2CloseLobby(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	lobby, found := v2AuthorizedLobby(w, r, user, game.ActionClose)
+	if !found {
+		return
+	}
+
+	if !state.CloseLobby(lobby.LobbyID) {
+		writeAPIError(w, http.StatusNotFound, ErrLobbyNotExistent.Error())
+		return
+	}
+
+	lobby.Logger().Info("Lobby closed via API", logging.KeyUser, user.Id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) v2ListPlayers(w http.ResponseWriter, r *http.Request, _ *auth.User) {
+	lobby, found := v2Lobby(w, r)
+	if !found {
+		return
+	}
+
+	writeJSONStatus(w, http.StatusOK, lobby.Summarize().Players)
+}
+
+func (h *Handler) v2JoinLobby(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	lobby, found := v2Lobby(w, r)
+	if !found {
+		return
+	}
+
+	lobbyData, err := h.enterLobby(lobby, user)
+	if forbidden, isForbidden := err.(*joinForbiddenError); isForbidden {
+		writeAPIError(w, http.StatusForbidden, forbidden.Error())
+		return
+	} else if err != nil {
+		lobby.Logger().Error("Failed joining lobby", logging.KeyUser, user.Id, logging.KeyError, err)
+		writeAPIError(w, http.StatusInternalServerError, "an error occurred")
+		return
+	}
+
+	writeJSONStatus(w, http.StatusOK, lobbyData)
+}
+
+func (h *Handler) v2KickPlayer(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	lobby, found := v2AuthorizedLobby(w, r, user, game.ActionKick)
+	if !found {
+		return
+	}
+
+	userID := httprouter.ParamsFromContext(r.Context()).ByName("userId")
+	switch err := lobby.Kick(user, userID); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case game.ErrKickSelf:
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+	case game.ErrProtectedPlayer:
+		writeAPIError(w, http.StatusForbidden, err.Error())
+	case game.ErrPlayerNotFound:
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	}
+}
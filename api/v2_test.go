@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/state"
+)
+
+func Test_requestValues(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(
+		`{"rounds": 5, "public": true, "language": "english", "custom_words": ["a", "b"], "max_players": null}`))
+	request.Header.Set("Content-Type", "application/json")
+	values, err := requestValues(request)
+	if err != nil {
+		t.Fatalf("Couldn't parse JSON body: %s", err)
+	}
+
+	expected := map[string]string{
+		"rounds":       "5",
+		"public":       "true",
+		"language":     "english",
+		"custom_words": "a,b",
+	}
+	for key, value := range expected {
+		if values.Get(key) != value {
+			t.Errorf("Expected '%s' for %s, but got '%s'", value, key, values.Get(key))
+		}
+	}
+	if _, exists := values["max_players"]; exists {
+		t.Error("null values should be omitted")
+	}
+
+	request = httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"rounds": {"value": 5}}`))
+	request.Header.Set("Content-Type", "application/json")
+	if _, err := requestValues(request); err == nil {
+		t.Error("Expected nested objects to be rejected")
+	}
+
+	request = httptest.NewRequest(http.MethodPatch, "/", strings.NewReader("rounds=5"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	values, err = requestValues(request)
+	if err != nil || values.Get("rounds") != "5" {
+		t.Errorf("Expected form values to be parsed, got %v (%v)", values, err)
+	}
+}
+
+func Test_generateOpenAPI(t *testing.T) {
+	document := generateOpenAPI((&Handler{}).v2Routes(), "usertoken")
+
+	operation := document.Paths["/lobbies/{lobbyId}/players/{userId}"]["delete"]
+	if operation == nil {
+		t.Fatal("Kick operation is missing")
+	}
+	if len(operation.Parameters) != 2 || len(operation.Security) == 0 {
+		t.Errorf("Expected two parameters and security, got %+v", operation)
+	}
+
+	//All references have to point to an existing component.
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		t.Fatalf("Couldn't encode document: %s", err)
+	}
+	for _, part := range strings.Split(string(encoded), `"$ref":"#/components/schemas/`)[1:] {
+		name := part[:strings.Index(part, `"`)]
+		if schema := document.Components.Schemas[name]; schema == nil || len(schema.Properties) == 0 {
+			t.Errorf("Schema %s is missing or empty", name)
+		}
+	}
+}
+
+type v2TestClient struct {
+	t       *testing.T
+	handler http.Handler
+	a       *auth.Service
+}
+
+func (c *v2TestClient) do(user *auth.User, method, path, body string) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	request := createAuthenticatedRequest(c.t, c.a, user)
+	request.Method = method
+	request.URL.Path = v2Prefix + path
+	if body != "" {
+		request.Body = io.NopCloser(strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	recorder := httptest.NewRecorder()
+	c.handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (c *v2TestClient) expectError(recorder *httptest.ResponseRecorder, status int) *apiError {
+	c.t.Helper()
+
+	if recorder.Code != status {
+		c.t.Fatalf("Expected status %d, but got %d: %s", status, recorder.Code, recorder.Body.String())
+	}
+	var body apiError
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil || body.Status != status || body.Message == "" {
+		c.t.Errorf("Expected JSON error, got '%s'", recorder.Body.String())
+	}
+	return &body
+}
+
+func Test_v2Lobby(t *testing.T) {
+	a := &auth.Service{
+		JwtKey:        []byte("test"),
+		JwtCookieName: "usertoken",
+		APITokens:     auth.NewMemoryAPITokenStore(),
+	}
+	router := httprouter.New()
+	(&Handler{gameService: &game.Service{}}).setupV2Routes(router, a)
+	client := &v2TestClient{t: t, handler: router, a: a}
+
+	owner := &auth.User{Id: "guest:owner", Name: "Owner", Provider: auth.ProviderGuest}
+	player := &auth.User{Id: "guest:player", Name: "Player", Provider: auth.ProviderGuest}
+
+	_, lobby, err := game.CreateLobby(nil, owner, "english", false, 120, 4, 12, 0, nil, game.JoinRules{}, false)
+	if err != nil {
+		t.Fatalf("Couldn't create lobby: %s", err)
+	}
+	lobby.WriteJSON = func(_ *game.SocketConnection, _ interface{}) error {
+		return nil
+	}
+	state.AddLobby(lobby)
+	defer state.RemoveLobby(lobby.LobbyID)
+	lobbyPath := "/lobbies/" + lobby.LobbyID
+
+	client.expectError(client.do(nil, http.MethodGet, "/lobbies/unknown", ""), http.StatusNotFound)
+	client.expectError(client.do(nil, http.MethodPatch, lobbyPath, `{"rounds": 6}`), http.StatusUnauthorized)
+
+	if recorder := client.do(player, http.MethodPost, lobbyPath+"/players", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("Couldn't join lobby: %s", recorder.Body.String())
+	}
+	client.expectError(client.do(player, http.MethodPatch, lobbyPath, `{"rounds": 6}`), http.StatusForbidden)
+
+	playToken, _, err := a.CreateAPIToken(owner, "bot", []string{auth.ScopeLobbyPlay})
+	if err != nil {
+		t.Fatalf("Couldn't create token: %s", err)
+	}
+	request := httptest.NewRequest(http.MethodDelete, v2Prefix+lobbyPath, nil)
+	request.Header.Set("Authorization", "Bearer "+playToken)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	client.expectError(recorder, http.StatusForbidden)
+
+	//Edits only change the given settings.
+	if recorder := client.do(owner, http.MethodPatch, lobbyPath, `{"rounds": 6}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Couldn't edit lobby: %s", recorder.Body.String())
+	}
+	if lobby.Rounds != 6 || lobby.DrawingTime != 120 || lobby.MaxPlayers != 12 {
+		t.Errorf("Unexpected settings after edit: %+v", lobby.EditableLobbySettings)
+	}
+	invalid := client.expectError(client.do(owner, http.MethodPatch, lobbyPath, `{"rounds": "many", "max_players": 0}`), http.StatusBadRequest)
+	if len(invalid.Details) != 2 {
+		t.Errorf("Expected two details, got %v", invalid.Details)
+	}
+
+	//Players allowed to kick still can't kick the creator, just like mods.
+	lobby.SetPermissions(game.Permissions{game.ActionKick: {game.RolePlayer}})
+	client.expectError(client.do(player, http.MethodDelete, lobbyPath+"/players/"+owner.Id, ""), http.StatusForbidden)
+	client.expectError(client.do(player, http.MethodDelete, lobbyPath+"/players/"+player.Id, ""), http.StatusBadRequest)
+	if len(lobby.KickedUsers) != 0 {
+		t.Errorf("Expected nobody to be kicked, got %v", lobby.KickedUsers)
+	}
+
+	if recorder := client.do(owner, http.MethodDelete, lobbyPath+"/players/"+player.Id, ""); recorder.Code != http.StatusNoContent {
+		t.Fatalf("Couldn't kick player: %s", recorder.Body.String())
+	}
+	var players []game.PlayerSummary
+	if err := json.NewDecoder(client.do(nil, http.MethodGet, lobbyPath+"/players", "").Body).Decode(&players); err != nil || len(players) != 1 {
+		t.Errorf("Expected only the owner to be left, got %v (%v)", players, err)
+	}
+
+	if recorder := client.do(owner, http.MethodDelete, lobbyPath, ""); recorder.Code != http.StatusNoContent {
+		t.Fatalf("Couldn't close lobby: %s", recorder.Body.String())
+	}
+	client.expectError(client.do(nil, http.MethodGet, lobbyPath, ""), http.StatusNotFound)
+}
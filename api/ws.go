@@ -5,10 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/scribble-rs/scribble.rs/auth"
-	"log"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 
@@ -19,6 +22,8 @@ var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin:     func(r *http.Request) bool { return true },
+	//Clients that don't request any sub-protocol keep using JSON only.
+	Subprotocols: []string{game.BinaryProtocol},
 }
 
 func wsLobbyEndpoint(w http.ResponseWriter, r *http.Request, user auth.User) {
@@ -41,9 +46,10 @@ func wsLobbyEndpoint(w http.ResponseWriter, r *http.Request, user auth.User) {
 			return
 		}
 
-		log.Printf("[INFO] %s connected to lobby %s", player, lobby)
+		lobby.PlayerLogger(player).Info("Player connected")
 
 		player.SetWebsocket(ws)
+		player.SetBinaryProtocol(ws.Subprotocol() == game.BinaryProtocol)
 		lobby.OnPlayerConnectUnsynchronized(player)
 
 		ws.SetCloseHandler(func(code int, text string) error {
@@ -56,12 +62,14 @@ func wsLobbyEndpoint(w http.ResponseWriter, r *http.Request, user auth.User) {
 }
 
 func wsListenToPlayer(lobby *game.Lobby, player *game.Player, socket *websocket.Conn) {
+	logger := lobby.PlayerLogger(player)
+
 	//Workaround to prevent crash, since not all kind of
 	//disconnect errors are cleanly caught by gorilla websockets.
 	defer func() {
 		err := recover()
 		if err != nil {
-			log.Printf("Error occurred in wsListen.\n\tError: %s\n\tPlayer: %s(%s)\nStack %s\n", err, player.Name, player.ID, string(debug.Stack()))
+			logger.Error("Panic while listening to player", logging.KeyError, err, "stack", string(debug.Stack()))
 			lobby.OnPlayerDisconnect(player)
 		}
 	}()
@@ -69,16 +77,14 @@ func wsListenToPlayer(lobby *game.Lobby, player *game.Player, socket *websocket.
 	for {
 		messageType, data, err := socket.ReadMessage()
 		if err != nil {
-			if websocket.IsCloseError(err) || websocket.IsUnexpectedCloseError(err) ||
-				//This happens when the server closes the connection. It will cause 1000 retries followed by a panic.
-				strings.Contains(err.Error(), "use of closed network connection") {
+			if isFatalReadError(err) {
 				//Make sure that the sockethandler is called
 				lobby.OnPlayerDisconnect(player)
 				//If the error is fatal, we stop listening for more messages.
 				return
 			}
 
-			log.Printf("Error reading from socket: %s\n", err)
+			logger.Warn("Failed reading from socket", logging.KeyError, err)
 			//If the error doesn't seem fatal we attempt listening for more messages.
 			continue
 		}
@@ -87,40 +93,86 @@ func wsListenToPlayer(lobby *game.Lobby, player *game.Player, socket *websocket.
 			received := &game.GameEvent{}
 			err := json.Unmarshal(data, received)
 			if err != nil {
-				log.Printf("Error unmarshalling message: %s\n", err)
+				logger.Warn("Failed unmarshalling message", logging.KeyError, err)
 				sendError := WriteJSON(player.SocketConnection, game.GameEvent{Type: "system-message", Data: fmt.Sprintf("An error occurred trying to read your request, please report the error via GitHub: %s!", err)})
 				if sendError != nil {
-					log.Printf("Error sending errormessage: %s\n", sendError)
+					logger.Warn("Failed sending error message", logging.KeyError, sendError)
 				}
 				continue
 			}
 
+			messagesReceived.Inc(receivedType(received.Type))
 			handleError := lobby.HandleEvent(data, received, player)
 			if handleError != nil {
-				log.Printf("Error handling event: %s\n", handleError)
+				logger.Warn("Failed handling event", logging.KeyEvent, received.Type, logging.KeyError, handleError)
+			}
+		} else if messageType == websocket.BinaryMessage && player.UsesBinaryProtocol() {
+			events, err := game.DecodeBinaryMessage(data)
+			if err != nil {
+				logger.Warn("Failed decoding binary message", logging.KeyError, err)
+				continue
+			}
+
+			for _, received := range events {
+				messagesReceived.Inc(receivedType(received.Type))
+				handleError := lobby.HandleEvent(data, received, player)
+				if handleError != nil {
+					logger.Warn("Failed handling event", logging.KeyEvent, received.Type, logging.KeyError, handleError)
+					break
+				}
 			}
 		}
 	}
 }
 
-func wsObserveEndpoint(w http.ResponseWriter, r *http.Request) {
+// wsObserveEndpoint connects an observer. Observers may ask for a delay via
+// the "delay" parameter, but never get less than the lobbies ObserverDelay,
+// unless they are the creator or supply the lobbies observer token via the
+// "token" parameter. The user is optional, unless the observer asks to be a
+// caster via "role=caster", which requires the user to be allowed to cast or
+// the observer token.
+func wsObserveEndpoint(w http.ResponseWriter, r *http.Request, user *auth.User) {
 	lobby, lobbyError := GetLobby(r)
 	if lobbyError != nil {
 		http.Error(w, lobbyError.Error(), http.StatusNotFound)
 		return
 	}
 
+	delay, _ := strconv.Atoi(r.URL.Query().Get("delay"))
+	if delay < 0 {
+		delay = 0
+	}
+
+	caster := r.URL.Query().Get("role") == "caster"
+
 	lobby.Synchronized(func() {
+		validToken := lobby.IsObserverToken(r.URL.Query().Get("token"))
+		trusted := validToken || lobby.IsCreator(user)
+		if !trusted && delay < lobby.ObserverDelay {
+			delay = lobby.ObserverDelay
+		}
+
+		if caster && !validToken && !lobby.CanCast(user) {
+			http.Error(w, "you aren't allowed to observe as caster", http.StatusForbidden)
+			return
+		}
+
 		ws, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		log.Println("Anonymous observer has connected")
+		if caster {
+			lobby.Logger().Info("Caster connected", logging.KeyUser, userID(user), "delay", delay)
+		} else {
+			lobby.Logger().Info("Anonymous observer connected", "delay", delay)
+		}
 
-		observer := lobby.JoinObserver()
+		observer := lobby.JoinObserver(user, caster)
+		observer.SetDelay(time.Duration(delay) * time.Second)
 		observer.SetWebsocket(ws)
+		observer.SetBinaryProtocol(ws.Subprotocol() == game.BinaryProtocol)
 		lobby.OnObserverConnectUnsynchronized(observer)
 
 		ws.SetCloseHandler(func(code int, text string) error {
@@ -132,46 +184,123 @@ func wsObserveEndpoint(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// userID returns the ID of the given user, or an empty string if there's no
+// user.
+func userID(user *auth.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Id
+}
+
 func wsListenToObserver(lobby *game.Lobby, observer *game.Observer, socket *websocket.Conn) {
+	logger := lobby.Logger()
+
 	//Workaround to prevent crash, since not all kind of
 	//disconnect errors are cleanly caught by gorilla websockets.
 	defer func() {
 		err := recover()
 		if err != nil {
-			log.Printf("Error occurred in wsListen.\n\tError: %s\n\tStack %s\n", err, string(debug.Stack()))
+			logger.Error("Panic while listening to observer", logging.KeyError, err, "stack", string(debug.Stack()))
 			lobby.OnObserverDisconnect(observer)
 		}
 	}()
 
 	for {
-		_, _, err := socket.ReadMessage()
+		messageType, data, err := socket.ReadMessage()
 		if err != nil {
-			if websocket.IsCloseError(err) || websocket.IsUnexpectedCloseError(err) ||
-				//This happens when the server closes the connection. It will cause 1000 retries followed by a panic.
-				strings.Contains(err.Error(), "use of closed network connection") {
+			if isFatalReadError(err) {
 				//Make sure that the sockethandler is called
 				lobby.OnObserverDisconnect(observer)
 				//If the error is fatal, we stop listening for more messages.
 				return
 			}
 
-			log.Printf("Error reading from socket: %s\n", err)
+			logger.Warn("Failed reading from socket", logging.KeyError, err)
 			//If the error doesn't seem fatal we attempt listening for more messages.
 			continue
 		}
+
+		//Observers only ever send chat messages, which are always JSON.
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		received := &game.GameEvent{}
+		if err := json.Unmarshal(data, received); err != nil {
+			logger.Warn("Failed unmarshalling observer message", logging.KeyError, err)
+			continue
+		}
+
+		messagesReceived.Inc(receivedType(received.Type))
+		handleError := lobby.HandleObserverEvent(received, observer)
+		if handleError != nil {
+			logger.Debug("Failed handling observer event", logging.KeyEvent, received.Type, logging.KeyError, handleError)
+		}
 	}
 }
 
-// WriteJSON marshals the given input into a JSON string and sends it to the
-// player using the currently established websocket connection.
+func isFatalReadError(err error) bool {
+	var netError net.Error
+	return websocket.IsCloseError(err) || websocket.IsUnexpectedCloseError(err) ||
+		//This happens when the server closes the connection. It will cause 1000 retries followed by a panic.
+		strings.Contains(err.Error(), "use of closed network connection") ||
+		//The read deadline is exceeded if the client stops answering pings.
+		(errors.As(err, &netError) && netError.Timeout())
+}
+
+// writeDrawingBatch sends the already encoded drawing events.
+func writeDrawingBatch(player *game.SocketConnection, batch *game.DrawingBatch) error {
+	if player.UsesBinaryProtocol() {
+		return player.Send(websocket.BinaryMessage, batch.Binary)
+	}
+
+	for _, data := range batch.JSON {
+		if err := player.Send(websocket.TextMessage, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// immediateEvents skip the delay of observers. Delayed observers need to
+// know about kicks early, so that they can drop the kicked players' messages
+// that are yet to arrive. Guess results refer to the turn the observer is
+// seeing at the moment of guessing.
+var immediateEvents = map[string]bool{
+	"kick":        true,
+	"close-guess": true,
+	"reveal-word": true,
+}
+
+// WriteJSON marshals the given input into a JSON string and queues it for
+// the player's currently established websocket connection. If the player
+// uses the binary protocol, drawing events are sent in binary form instead.
+// Marshalling happens right away, so the caller may modify the object
+// afterwards.
 func WriteJSON(player *game.SocketConnection, object interface{}) error {
-	player.GetWebsocketMutex().Lock()
-	defer player.GetWebsocketMutex().Unlock()
+	if !player.Connected {
+		return game.ErrNotConnected
+	}
+	messagesSent.Inc(eventType(object))
 
-	socket := player.GetWebsocket()
-	if socket == nil || !player.Connected {
-		return errors.New("player not connected")
+	if batch, isBatch := object.(*game.DrawingBatch); isBatch {
+		return writeDrawingBatch(player, batch)
 	}
 
-	return socket.WriteJSON(object)
+	if player.UsesBinaryProtocol() {
+		if data, isBinary := game.EncodeBinaryEvent(object); isBinary {
+			return player.Send(websocket.BinaryMessage, data)
+		}
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+
+	if immediateEvents[eventType(object)] {
+		return player.SendImmediately(websocket.TextMessage, data)
+	}
+	return player.Send(websocket.TextMessage, data)
 }
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// Scopes that can be granted to API tokens. Users authenticated via the
+// cookie implicitly have all scopes.
+const (
+	ScopeLobbyCreate = "lobby:create"
+	ScopeLobbyEdit   = "lobby:edit"
+	ScopeLobbyPlay   = "lobby:play"
+)
+
+// Scopes are all scopes that can be granted to API tokens.
+var Scopes = []string{ScopeLobbyCreate, ScopeLobbyEdit, ScopeLobbyPlay}
+
+const (
+	// apiTokenPrefix makes tokens recognizable, for example for secret
+	// scanners.
+	apiTokenPrefix        = "srs_"
+	maxAPITokenNameLength = 50
+	// MaxAPITokens is the maximum amount of tokens a single user can have.
+	MaxAPITokens = 20
+)
+
+var (
+	ErrInvalidAPIToken = errors.New("invalid API token")
+	// ErrMissingScope is passed to error handlers if an API token lacks the
+	// scope required by a route.
+	ErrMissingScope = errors.New("the API token lacks the required scope")
+	// ErrAPITokenNotAllowed is passed to error handlers of routes that can
+	// only be used with the cookie.
+	ErrAPITokenNotAllowed = errors.New("API tokens can't be used here")
+	ErrTooManyAPITokens   = fmt.Errorf("a user can't have more than %d API tokens", MaxAPITokens)
+)
+
+// APIToken is a named token that allows bots and third-party clients to act
+// on behalf of a user, restricted to the given scopes. Only the hash of the
+// token itself is stored.
+type APIToken struct {
+	Id        string
+	User      User
+	Name      string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type APITokenStore interface {
+	Create(token *APIToken, hash string) error
+	// GetByHash returns nil if no token has the given hash.
+	GetByHash(hash string) (*APIToken, error)
+	// List returns the tokens of the given user, oldest first.
+	List(userId string) ([]*APIToken, error)
+	// Delete deletes the token, if it belongs to the given user.
+	Delete(userId, id string) error
+}
+
+// HashAPIToken hashes a token for storage. As tokens are random, a salt
+// isn't necessary.
+func HashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateAPIToken creates a token for the given user and returns it. The
+// token can't be retrieved again later on.
+func (a Service) CreateAPIToken(user *User, name string, scopes []string) (string, *APIToken, error) {
+	if a.APITokens == nil {
+		return "", nil, errors.New("API tokens aren't supported")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("the name must not be empty")
+	}
+	if utf8.RuneCountInString(name) > maxAPITokenNameLength {
+		return "", nil, fmt.Errorf("the name must not be longer than %d characters", maxAPITokenNameLength)
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !isScope(scope) {
+			return "", nil, fmt.Errorf("unknown scope '%s'", scope)
+		}
+	}
+
+	existing, err := a.APITokens.List(user.Id)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(existing) >= MaxAPITokens {
+		return "", nil, ErrTooManyAPITokens
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	plainToken := apiTokenPrefix + hex.EncodeToString(secret)
+
+	token := &APIToken{
+		Id:        uuid.Must(uuid.NewV4()).String(),
+		User:      *user,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if err := a.APITokens.Create(token, HashAPIToken(plainToken)); err != nil {
+		return "", nil, err
+	}
+
+	return plainToken, token, nil
+}
+
+func isScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getAPIToken returns the token passed via the Authorization header. If the
+// header is absent, nil is returned.
+func (a Service) getAPIToken(r *http.Request) (*APIToken, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+
+	plainToken := strings.TrimPrefix(header, "Bearer ")
+	if plainToken == header || !strings.HasPrefix(plainToken, apiTokenPrefix) || a.APITokens == nil {
+		return nil, ErrInvalidAPIToken
+	}
+
+	token, err := a.APITokens.GetByHash(HashAPIToken(plainToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidAPIToken
+	}
+
+	return token, nil
+}
+
+// RequireScope works like RequireUser, but additionally accepts API tokens
+// that have been granted the given scope.
+func (a Service) RequireScope(scope string, successHandler func(http.ResponseWriter, *http.Request, User), errorhandler func(http.ResponseWriter, *http.Request, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := a.getAPIToken(r)
+		if err != nil {
+			errorhandler(w, r, err)
+			return
+		}
+		if token == nil {
+			a.RequireUser(successHandler, errorhandler)(w, r)
+			return
+		}
+
+		if !token.HasScope(scope) {
+			errorhandler(w, r, ErrMissingScope)
+			return
+		}
+
+		successHandler(w, r, token.User)
+	}
+}
+
+// CheckScope works like CheckUser, but only accepts API tokens that have
+// been granted the given scope. Requests using other tokens are handled as
+// anonymous.
+func (a *Service) CheckScope(scope string, handler func(w http.ResponseWriter, r *http.Request, user *User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := a.getAPIToken(r)
+		if err != nil || (token != nil && !token.HasScope(scope)) {
+			handler(w, r, nil)
+		} else if token != nil {
+			handler(w, r, &token.User)
+		} else {
+			a.CheckUser(handler)(w, r)
+		}
+	}
+}
+
+func NewMemoryAPITokenStore() APITokenStore {
+	return &memoryAPITokenStore{
+		tokens: make(map[string]*APIToken),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+type memoryAPITokenStore struct {
+	// tokens are mapped by their hash.
+	tokens map[string]*APIToken
+	mutex  *sync.Mutex
+}
+
+func (s *memoryAPITokenStore) Create(token *APIToken, hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens[hash] = token
+	return nil
+}
+
+func (s *memoryAPITokenStore) GetByHash(hash string) (*APIToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.tokens[hash], nil
+}
+
+func (s *memoryAPITokenStore) List(userId string) ([]*APIToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var tokens []*APIToken
+	for _, token := range s.tokens {
+		if token.User.Id == userId {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(a, b int) bool {
+		return tokens[a].CreatedAt.Before(tokens[b].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (s *memoryAPITokenStore) Delete(userId, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.Id == id && token.User.Id == userId {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_apiTokens(t *testing.T) {
+	a := &Service{
+		JwtKey:        []byte("test"),
+		JwtCookieName: "usertoken",
+		APITokens:     NewMemoryAPITokenStore(),
+	}
+	user := &User{Id: "1", Name: "User", Provider: ProviderTwitch}
+
+	plainToken, _, err := a.CreateAPIToken(user, "Bot", []string{ScopeLobbyPlay})
+	if err != nil {
+		t.Fatalf("Couldn't create token: %s", err)
+	}
+
+	bearerRequest := func(token string) *http.Request {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		return request
+	}
+
+	authenticated, err := a.GetUser(bearerRequest(plainToken))
+	if err != nil || authenticated.Id != user.Id {
+		t.Errorf("Expected user %s, got %v (%v)", user.Id, authenticated, err)
+	}
+	if _, err := a.GetUser(bearerRequest("srs_unknown")); err != ErrInvalidAPIToken {
+		t.Errorf("Expected invalid token, got %v", err)
+	}
+
+	var receivedError error
+	success := func(w http.ResponseWriter, r *http.Request, u User) {}
+	failure := func(w http.ResponseWriter, r *http.Request, err error) { receivedError = err }
+	routes := map[string]struct {
+		handler       http.HandlerFunc
+		expectedError error
+	}{
+		"granted scope": {a.RequireScope(ScopeLobbyPlay, success, failure), nil},
+		"missing scope": {a.RequireScope(ScopeLobbyCreate, success, failure), ErrMissingScope},
+		"cookie only":   {a.RequireUser(success, failure), ErrAPITokenNotAllowed},
+	}
+	for name, route := range routes {
+		receivedError = nil
+		route.handler(httptest.NewRecorder(), bearerRequest(plainToken))
+		if receivedError != route.expectedError {
+			t.Errorf("%s: expected error %v, got %v", name, route.expectedError, receivedError)
+		}
+	}
+
+	var checkedUser *User
+	check := func(w http.ResponseWriter, r *http.Request, u *User) { checkedUser = u }
+	a.CheckScope(ScopeLobbyPlay, check)(httptest.NewRecorder(), bearerRequest(plainToken))
+	if checkedUser == nil || checkedUser.Id != user.Id {
+		t.Errorf("Expected token with granted scope to be accepted, got %v", checkedUser)
+	}
+	a.CheckScope(ScopeLobbyCreate, check)(httptest.NewRecorder(), bearerRequest(plainToken))
+	if checkedUser != nil {
+		t.Errorf("Expected token lacking the scope to be anonymous, got %v", checkedUser)
+	}
+	//Pages that don't check scopes must not treat tokens as logins.
+	a.CheckUser(check)(httptest.NewRecorder(), bearerRequest(plainToken))
+	if checkedUser != nil {
+		t.Errorf("Expected token to be ignored without checking scopes, got %v", checkedUser)
+	}
+
+	tokens, _ := a.APITokens.List(user.Id)
+	if len(tokens) != 1 {
+		t.Fatalf("Expected one token, got %d", len(tokens))
+	}
+	//Other users can't delete the token.
+	a.APITokens.Delete("2", tokens[0].Id)
+	if _, err := a.GetUser(bearerRequest(plainToken)); err != nil {
+		t.Errorf("Token was deleted by another user: %v", err)
+	}
+	a.APITokens.Delete(user.Id, tokens[0].Id)
+	if _, err := a.GetUser(bearerRequest(plainToken)); err != ErrInvalidAPIToken {
+		t.Errorf("Expected deleted token to be invalid, got %v", err)
+	}
+}
+
+func Test_createAPITokenValidation(t *testing.T) {
+	a := &Service{APITokens: NewMemoryAPITokenStore()}
+	user := &User{Id: "1", Name: "User"}
+
+	invalid := map[string][]string{
+		"":         {ScopeLobbyPlay},
+		"No scope": {},
+		"Unknown":  {"admin"},
+	}
+	for name, scopes := range invalid {
+		if _, _, err := a.CreateAPIToken(user, name, scopes); err == nil {
+			t.Errorf("Expected token '%s' with scopes %v to be rejected", name, scopes)
+		}
+	}
+
+	for i := 0; i < MaxAPITokens; i++ {
+		if _, _, err := a.CreateAPIToken(user, "Bot", Scopes); err != nil {
+			t.Fatalf("Couldn't create token: %s", err)
+		}
+	}
+	if _, _, err := a.CreateAPIToken(user, "Bot", Scopes); err != ErrTooManyAPITokens {
+		t.Errorf("Expected too many tokens, got %v", err)
+	}
+}
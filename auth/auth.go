@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"github.com/gofrs/uuid"
 	"github.com/golang-jwt/jwt"
 	"net/http"
 	"time"
@@ -10,6 +12,14 @@ import (
 type User struct {
 	Id   string
 	Name string
+	// Provider is the name of the Provider the user logged in with.
+	Provider string
+}
+
+// IsTwitch indicates whether the user logged in via Twitch. Only Twitch
+// users can be checked for follows, subscriptions and moderation status.
+func (u User) IsTwitch() bool {
+	return u.Provider == ProviderTwitch
 }
 
 func (u User) String() string {
@@ -21,13 +31,66 @@ type UserClaims struct {
 	jwt.StandardClaims
 }
 
+// ErrNotAdmin is passed to error handlers if an authenticated user lacks
+// administrative rights.
+var ErrNotAdmin = errors.New("administrative rights required")
+
 type Service struct {
 	JwtKey        []byte
 	JwtCookieName string
+	// AdminIds are the Twitch user IDs of the users allowed to administrate
+	// this instance.
+	AdminIds []string
+	// Sessions allows revoking tokens. If it's nil, tokens stay valid until
+	// they expire.
+	Sessions SessionStore
+	// SessionLifetime is the time after which inactive users are logged
+	// out. If it's zero, DefaultSessionLifetime is used.
+	SessionLifetime time.Duration
+	// SecureCookies restricts the cookie to HTTPS connections.
+	SecureCookies bool
+	// HttpOnlyCookies hides the cookie from scripts, which should only be
+	// disabled if custom scripts need to read it.
+	HttpOnlyCookies bool
+	// APITokens stores the personal API tokens of users. If it's nil, API
+	// tokens are rejected.
+	APITokens APITokenStore
 }
 
+func (a Service) sessionLifetime() time.Duration {
+	if a.SessionLifetime <= 0 {
+		return DefaultSessionLifetime
+	}
+	return a.SessionLifetime
+}
+
+// SetUserCookie starts a new session for the given user.
 func (a Service) SetUserCookie(w http.ResponseWriter, user *User) error {
-	tokenString, err := a.generateToken(user)
+	now := time.Now()
+	session := &Session{
+		Id:        uuid.Must(uuid.NewV4()).String(),
+		UserId:    user.Id,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.sessionLifetime()),
+	}
+	if a.Sessions != nil {
+		if err := a.Sessions.Create(session); err != nil {
+			return err
+		}
+	}
+
+	return a.setTokenCookie(w, UserClaims{
+		User: *user,
+		StandardClaims: jwt.StandardClaims{
+			Id:        session.Id,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+		},
+	})
+}
+
+func (a Service) setTokenCookie(w http.ResponseWriter, claims UserClaims) error {
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.JwtKey)
 	if err != nil {
 		return err
 	}
@@ -37,7 +100,9 @@ func (a Service) SetUserCookie(w http.ResponseWriter, user *User) error {
 		Value:    tokenString,
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Now().Add(time.Hour * 12),
+		HttpOnly: a.HttpOnlyCookies,
+		Secure:   a.SecureCookies,
+		Expires:  time.Unix(claims.ExpiresAt, 0),
 	})
 
 	return nil
@@ -49,19 +114,29 @@ func (a Service) RemoveUserCookie(w http.ResponseWriter) error {
 		Value:    "",
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
+		HttpOnly: a.HttpOnlyCookies,
+		Secure:   a.SecureCookies,
 		Expires:  time.Unix(0, 0),
 	})
 
 	return nil
 }
 
-func (a Service) generateToken(user *User) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaims{
-		User:           *user,
-		StandardClaims: jwt.StandardClaims{},
-	})
+// Logout revokes the session of the request, or all sessions of its user if
+// everywhere is set, and removes the cookie.
+func (a Service) Logout(w http.ResponseWriter, r *http.Request, everywhere bool) error {
+	_ = a.RemoveUserCookie(w)
 
-	return token.SignedString(a.JwtKey)
+	claims, err := a.getClaims(r)
+	if err != nil || a.Sessions == nil {
+		//Invalid tokens don't need to be revoked.
+		return nil
+	}
+
+	if everywhere {
+		return a.Sessions.RevokeAll(claims.User.Id)
+	}
+	return a.Sessions.Revoke(claims.StandardClaims.Id)
 }
 
 func (a Service) IsAuthenticated(r *http.Request) bool {
@@ -69,7 +144,56 @@ func (a Service) IsAuthenticated(r *http.Request) bool {
 	return user != nil
 }
 
+// GetUser returns the user authenticated via an API token or the cookie. As
+// API tokens are restricted to their scopes, handlers that don't check scopes
+// should use GetSessionUser or RequireUser instead.
 func (a Service) GetUser(r *http.Request) (*User, error) {
+	token, err := a.getAPIToken(r)
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		return &token.User, nil
+	}
+
+	return a.GetSessionUser(r)
+}
+
+// GetSessionUser returns the user authenticated via the cookie.
+func (a Service) GetSessionUser(r *http.Request) (*User, error) {
+	claims, err := a.getClaims(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims.User, nil
+}
+
+func (a Service) getClaims(r *http.Request) (*UserClaims, error) {
+	claims, err := a.parseToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Sessions != nil {
+		session, err := a.Sessions.Get(claims.StandardClaims.Id)
+		if err != nil {
+			return nil, err
+		}
+		if session == nil || session.UserId != claims.User.Id {
+			return nil, ErrSessionRevoked
+		}
+		if time.Now().After(session.ExpiresAt) {
+			return nil, ErrSessionExpired
+		}
+	}
+
+	return claims, nil
+}
+
+// parseToken verifies the token of the request without checking whether its
+// session has been revoked.
+func (a Service) parseToken(r *http.Request) (*UserClaims, error) {
 	userCookie, cookieError := r.Cookie(a.JwtCookieName)
 	if cookieError != nil {
 		return nil, cookieError
@@ -86,16 +210,70 @@ func (a Service) GetUser(r *http.Request) (*User, error) {
 		return nil, jwtParseError
 	}
 
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return &claims.User, nil
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("unknown JWT parsing error")
+	}
+
+	//Tokens issued before sessions existed never expire, so we don't
+	//accept them anymore.
+	if claims.ExpiresAt == 0 || claims.StandardClaims.Id == "" {
+		return nil, ErrSessionExpired
+	}
+
+	//Tokens issued before there were multiple providers lack the
+	//provider, but could've only been issued via Twitch.
+	if claims.User.Provider == "" {
+		claims.User.Provider = ProviderTwitch
+	}
+	return claims, nil
+}
+
+// RenewSessions extends the session of every request that has used up half
+// of its lifetime, so that active users aren't logged out.
+func (a Service) RenewSessions(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//The session is only looked up if it's due, as this is done for
+		//every single request.
+		lifetime := a.sessionLifetime()
+		now := time.Now()
+		if claims, err := a.parseToken(r); err == nil && time.Unix(claims.ExpiresAt, 0).Sub(now) < lifetime/2 {
+			if claims, err = a.getClaims(r); err == nil {
+				a.renewSession(w, claims, now.Add(lifetime))
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (a Service) renewSession(w http.ResponseWriter, claims *UserClaims, expiresAt time.Time) {
+	if a.Sessions != nil {
+		if err := a.Sessions.Extend(claims.StandardClaims.Id, expiresAt); err != nil {
+			//The old token is still valid, so we can try again later.
+			return
+		}
 	}
 
-	return nil, fmt.Errorf("unknown JWT parsing error")
+	claims.ExpiresAt = expiresAt.Unix()
+	_ = a.setTokenCookie(w, *claims)
 }
 
+// RevokeSessions logs the given user out everywhere.
+func (a Service) RevokeSessions(userId string) error {
+	if a.Sessions == nil {
+		return errors.New("sessions can't be revoked without a session store")
+	}
+
+	return a.Sessions.RevokeAll(userId)
+}
+
+// CheckUser passes the user authenticated via the cookie to the handler, or
+// nil for anonymous users. API tokens are ignored, use CheckScope in order to
+// accept them.
 func (a *Service) CheckUser(handler func(w http.ResponseWriter, r *http.Request, user *User)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user, err := a.GetUser(r)
+		user, err := a.GetSessionUser(r)
 		if err != nil {
 			handler(w, r, nil)
 		} else {
@@ -104,9 +282,16 @@ func (a *Service) CheckUser(handler func(w http.ResponseWriter, r *http.Request,
 	}
 }
 
+// RequireUser only accepts users authenticated via the cookie. Use
+// RequireScope in order to allow API tokens.
 func (a Service) RequireUser(successHandler func(http.ResponseWriter, *http.Request, User), errorhandler func(http.ResponseWriter, *http.Request, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user, err := a.GetUser(r)
+		if r.Header.Get("Authorization") != "" {
+			errorhandler(w, r, ErrAPITokenNotAllowed)
+			return
+		}
+
+		user, err := a.GetSessionUser(r)
 		if err != nil {
 			errorhandler(w, r, err)
 			return
@@ -115,3 +300,26 @@ func (a Service) RequireUser(successHandler func(http.ResponseWriter, *http.Requ
 		successHandler(w, r, *user)
 	}
 }
+
+func (a Service) IsAdmin(user *User) bool {
+	for _, adminId := range a.AdminIds {
+		if adminId == user.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequireAdmin works like RequireUser, but additionally passes ErrNotAdmin to
+// the error handler if the user isn't an administrator.
+func (a Service) RequireAdmin(successHandler func(http.ResponseWriter, *http.Request, User), errorhandler func(http.ResponseWriter, *http.Request, error)) http.HandlerFunc {
+	return a.RequireUser(func(w http.ResponseWriter, r *http.Request, user User) {
+		if !a.IsAdmin(&user) {
+			errorhandler(w, r, ErrNotAdmin)
+			return
+		}
+
+		successHandler(w, r, user)
+	}, errorhandler)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// maxNicknameLength is the maximum amount of characters in a guest nickname.
+const maxNicknameLength = 25
+
+// GuestProvider lets users log in by choosing a nickname. Guests get a new
+// identity on every login and can't join lobbies that require Twitch.
+type GuestProvider struct{}
+
+func (GuestProvider) Name() string {
+	return ProviderGuest
+}
+
+// Callback expects the nickname in the "nickname" form value and passes the
+// "state" form value on.
+func (GuestProvider) Callback(w http.ResponseWriter, r *http.Request, redirectURI string) (*Login, error) {
+	if r.Method != http.MethodPost {
+		return nil, errors.New("guest logins have to be submitted via POST")
+	}
+
+	nickname := strings.TrimSpace(r.FormValue("nickname"))
+	if nickname == "" {
+		return nil, errors.New("the nickname must not be empty")
+	}
+	if utf8.RuneCountInString(nickname) > maxNicknameLength {
+		return nil, errors.New("the nickname must not be longer than 25 characters")
+	}
+
+	return &Login{
+		User: &User{
+			Id:       ProviderGuest + ":" + uuid.Must(uuid.NewV4()).String(),
+			Name:     nickname,
+			Provider: ProviderGuest,
+		},
+		State: r.FormValue("state"),
+	}, nil
+}
@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// oidcNonceCookie binds the ID token to the browser that started the login,
+// preventing replayed or injected callbacks.
+const oidcNonceCookie = "oidc_nonce"
+
+// keysRefetchInterval limits how often the keys are fetched because of an
+// unknown key ID, as anyone can send tokens with made up key IDs.
+const keysRefetchInterval = time.Minute
+
+// OIDCProvider logs users in via any OpenID Connect provider supporting the
+// authorization code flow and RS256 signed ID tokens.
+type OIDCProvider struct {
+	clientId     string
+	clientSecret string
+	client       *http.Client
+
+	issuer                string
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+
+	keysMutex *sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	// keysFetchedAt is the time of the last attempt to fetch the keys.
+	keysFetchedAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider fetches the configuration of the given issuer via OpenID
+// Connect Discovery.
+func NewOIDCProvider(issuer, clientId, clientSecret string) (*OIDCProvider, error) {
+	provider := &OIDCProvider{
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		keysMutex:    &sync.Mutex{},
+	}
+
+	issuer = strings.TrimSuffix(issuer, "/")
+	var discovery oidcDiscovery
+	if err := provider.getJSON(issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("error discovering OpenID configuration: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovered issuer %s doesn't match %s", discovery.Issuer, issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, errors.New("the OpenID configuration is incomplete")
+	}
+
+	provider.issuer = discovery.Issuer
+	provider.authorizationEndpoint = discovery.AuthorizationEndpoint
+	provider.tokenEndpoint = discovery.TokenEndpoint
+	provider.jwksURI = discovery.JwksURI
+	return provider, nil
+}
+
+func (p *OIDCProvider) Name() string {
+	return ProviderOIDC
+}
+
+func (p *OIDCProvider) AuthURI(w http.ResponseWriter, redirectURI, state string) (string, error) {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcNonceCookie,
+		Value:    nonce,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   600,
+	})
+
+	params := url.Values{}
+	params.Add("client_id", p.clientId)
+	params.Add("redirect_uri", redirectURI)
+	params.Add("response_type", "code")
+	params.Add("scope", "openid profile")
+	params.Add("nonce", nonce)
+	if state != "" {
+		params.Add("state", state)
+	}
+
+	separator := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.authorizationEndpoint + separator + params.Encode(), nil
+}
+
+func (p *OIDCProvider) Callback(w http.ResponseWriter, r *http.Request, redirectURI string) (*Login, error) {
+	query := r.URL.Query()
+	if errorCode := query.Get("error"); errorCode != "" {
+		return nil, fmt.Errorf("login failed: %s", errorCode)
+	}
+	code := query.Get("code")
+	if code == "" {
+		return nil, errors.New("no code present in callback")
+	}
+
+	nonceCookie, err := r.Cookie(oidcNonceCookie)
+	if err != nil || nonceCookie.Value == "" {
+		return nil, errors.New("login wasn't started in this browser")
+	}
+	//The nonce must only be used once.
+	http.SetCookie(w, &http.Cookie{Name: oidcNonceCookie, Path: "/", MaxAge: -1})
+
+	idToken, err := p.exchangeCode(code, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.verifyIDToken(idToken, nonceCookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("ID token lacks a subject")
+	}
+
+	return &Login{
+		User: &User{
+			Id:       ProviderOIDC + ":" + subject,
+			Name:     displayName(claims, subject),
+			Provider: ProviderOIDC,
+		},
+		State: query.Get("state"),
+	}, nil
+}
+
+// displayName picks the most suitable of the standard profile claims.
+func displayName(claims jwt.MapClaims, fallback string) string {
+	for _, claim := range []string{"preferred_username", "nickname", "name"} {
+		if value, _ := claims[claim].(string); strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+
+	return fallback
+}
+
+func (p *OIDCProvider) exchangeCode(code, redirectURI string) (string, error) {
+	form := url.Values{}
+	form.Add("grant_type", "authorization_code")
+	form.Add("code", code)
+	form.Add("redirect_uri", redirectURI)
+	form.Add("client_id", p.clientId)
+	form.Add("client_secret", p.clientSecret)
+
+	response, err := p.client.PostForm(p.tokenEndpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint responded with status %d", response.StatusCode)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint didn't return an ID token")
+	}
+
+	return tokens.IDToken, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+
+		keyId, _ := token.Header["kid"].(string)
+		return p.key(keyId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(p.issuer, true) {
+		return nil, errors.New("ID token has an unexpected issuer")
+	}
+	if !claims.VerifyAudience(p.clientId, true) {
+		return nil, errors.New("ID token has an unexpected audience")
+	}
+	if !claims.VerifyExpiresAt(jwt.TimeFunc().Unix(), true) {
+		return nil, errors.New("ID token is expired")
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("ID token has an unexpected nonce")
+	}
+
+	return claims, nil
+}
+
+// key returns the public key with the given ID. Keys are cached, but
+// refetched if the key is unknown, as providers rotate their keys.
+func (p *OIDCProvider) key(keyId string) (*rsa.PublicKey, error) {
+	p.keysMutex.Lock()
+	defer p.keysMutex.Unlock()
+
+	if key, known := p.keys[keyId]; known {
+		return key, nil
+	}
+
+	//Keys are rotated rarely, so refetching them once in a while suffices.
+	if time.Since(p.keysFetchedAt) < keysRefetchInterval {
+		return nil, fmt.Errorf("unknown key '%s'", keyId)
+	}
+	p.keysFetchedAt = time.Now()
+
+	keys, err := p.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+
+	if key, known := p.keys[keyId]; known {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key '%s'", keyId)
+}
+
+func (p *OIDCProvider) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyId   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(p.jwksURI, &jwks); err != nil {
+		return nil, fmt.Errorf("error fetching keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		if key.KeyType != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		modulus, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key '%s': %w", key.KeyId, err)
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key '%s': %w", key.KeyId, err)
+		}
+
+		keys[key.KeyId] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+func (p *OIDCProvider) getJSON(uri string, target interface{}) error {
+	response, err := p.client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", uri, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// fakeIdP is a minimal OpenID Connect provider that issues an ID token with
+// the configured claims for every code.
+type fakeIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// keyId is sent in the header of the ID token.
+	keyId  string
+	claims jwt.MapClaims
+	// keyFetches counts the requests for the keys.
+	keyFetches int
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %s", err)
+	}
+
+	idp := &fakeIdP{key: key, keyId: "test-key"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JwksURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.keyFetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "valid-code" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = idp.keyId
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *fakeIdP) validClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                idp.server.URL,
+		"aud":                "client",
+		"sub":                "1234",
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"nonce":              nonce,
+		"preferred_username": "marcel",
+	}
+}
+
+// startLogin runs AuthURI and returns the nonce cookie and the nonce sent to
+// the provider.
+func startLogin(t *testing.T, provider *OIDCProvider) (*http.Cookie, string) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	authURI, err := provider.AuthURI(recorder, "http://localhost/login/oidc/callback", "/lobbies/abc")
+	if err != nil {
+		t.Fatalf("Couldn't create auth URI: %s", err)
+	}
+
+	parsed, err := url.Parse(authURI)
+	if err != nil {
+		t.Fatalf("Invalid auth URI: %s", err)
+	}
+	if parsed.Query().Get("state") != "/lobbies/abc" {
+		t.Errorf("State wasn't passed on: %s", authURI)
+	}
+
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcNonceCookie {
+		t.Fatalf("Expected nonce cookie, got %v", cookies)
+	}
+	return cookies[0], parsed.Query().Get("nonce")
+}
+
+func Test_oidcProvider(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider, err := NewOIDCProvider(idp.server.URL, "client", "secret")
+	if err != nil {
+		t.Fatalf("Couldn't discover provider: %s", err)
+	}
+
+	callback := func(cookie *http.Cookie, code string) (*Login, error) {
+		request := httptest.NewRequest(http.MethodGet,
+			"/login/oidc/callback?state=%2Flobbies%2Fabc&code="+code, nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		return provider.Callback(httptest.NewRecorder(), request, "http://localhost/login/oidc/callback")
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		cookie, nonce := startLogin(t, provider)
+		idp.claims = idp.validClaims(nonce)
+
+		login, err := callback(cookie, "valid-code")
+		if err != nil {
+			t.Fatalf("Login failed: %s", err)
+		}
+		if login.User.Id != "oidc:1234" || login.User.Name != "marcel" || login.User.Provider != ProviderOIDC {
+			t.Errorf("Unexpected user %+v", login.User)
+		}
+		if login.State != "/lobbies/abc" {
+			t.Errorf("Unexpected state %s", login.State)
+		}
+	})
+
+	invalidClaims := map[string]func(claims jwt.MapClaims){
+		"wrong nonce":    func(claims jwt.MapClaims) { claims["nonce"] = "other" },
+		"wrong audience": func(claims jwt.MapClaims) { claims["aud"] = "other" },
+		"wrong issuer":   func(claims jwt.MapClaims) { claims["iss"] = "https://example.com" },
+		"expired":        func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no expiry":      func(claims jwt.MapClaims) { delete(claims, "exp") },
+	}
+	for name, modify := range invalidClaims {
+		t.Run(name, func(t *testing.T) {
+			cookie, nonce := startLogin(t, provider)
+			idp.claims = idp.validClaims(nonce)
+			modify(idp.claims)
+
+			if _, err := callback(cookie, "valid-code"); err == nil {
+				t.Error("Expected login to fail")
+			}
+		})
+	}
+
+	t.Run("missing nonce cookie", func(t *testing.T) {
+		_, nonce := startLogin(t, provider)
+		idp.claims = idp.validClaims(nonce)
+
+		if _, err := callback(nil, "valid-code"); err == nil {
+			t.Error("Expected login to fail")
+		}
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		cookie, nonce := startLogin(t, provider)
+		idp.claims = idp.validClaims(nonce)
+
+		if _, err := callback(cookie, "invalid-code"); err == nil {
+			t.Error("Expected login to fail")
+		}
+	})
+
+	t.Run("unknown key ID", func(t *testing.T) {
+		idp.keyId = "unknown-key"
+		defer func() { idp.keyId = "test-key" }()
+
+		//The keys have just been fetched for the valid login, so made up
+		//key IDs must not cause requests to the provider.
+		fetches := idp.keyFetches
+		for i := 0; i < 3; i++ {
+			cookie, nonce := startLogin(t, provider)
+			idp.claims = idp.validClaims(nonce)
+			if _, err := callback(cookie, "valid-code"); err == nil {
+				t.Error("Expected login to fail")
+			}
+		}
+		if idp.keyFetches != fetches {
+			t.Errorf("Expected no refetch of the keys, but got %d", idp.keyFetches-fetches)
+		}
+	})
+
+	t.Run("foreign key", func(t *testing.T) {
+		cookie, nonce := startLogin(t, provider)
+		idp.claims = idp.validClaims(nonce)
+		//An attacker can't sign tokens with the providers key.
+		realKey := idp.key
+		foreignKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Couldn't generate key: %s", err)
+		}
+		idp.key = foreignKey
+		defer func() { idp.key = realKey }()
+
+		if _, err := callback(cookie, "valid-code"); err == nil {
+			t.Error("Expected login to fail")
+		}
+	})
+}
+
+func Test_guestProvider(t *testing.T) {
+	nicknames := map[string]bool{
+		"Marcel":                         true,
+		"  padded  ":                     true,
+		"":                               false,
+		"   ":                            false,
+		"abcdefghijklmnopqrstuvwxyz0123": false,
+	}
+	for nickname, valid := range nicknames {
+		form := url.Values{"nickname": {nickname}, "state": {"/"}}
+		request := httptest.NewRequest(http.MethodPost, "/login/guest/callback", nil)
+		request.Form = form
+
+		login, err := GuestProvider{}.Callback(httptest.NewRecorder(), request, "")
+		if valid != (err == nil) {
+			t.Errorf("Nickname '%s': expected valid=%v, got error %v", nickname, valid, err)
+			continue
+		}
+		if valid && (login.User.Provider != ProviderGuest || login.State != "/") {
+			t.Errorf("Unexpected login %+v", login)
+		}
+	}
+}
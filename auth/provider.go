@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Names of the built-in providers. User IDs of all providers except Twitch
+// are prefixed with the provider name, so that they can't collide.
+const (
+	ProviderTwitch = "twitch"
+	ProviderOIDC   = "oidc"
+	ProviderGuest  = "guest"
+)
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// Provider is a source of user identities. A login ends with a request to
+// the providers callback, which is turned into a user by Callback.
+type Provider interface {
+	// Name identifies the provider. It's stored in User.Provider.
+	Name() string
+	// Callback verifies the request to the providers callback route. The
+	// redirectURI is the URI of that route.
+	Callback(w http.ResponseWriter, r *http.Request, redirectURI string) (*Login, error)
+}
+
+// RedirectProvider is a provider that needs to send the user elsewhere in
+// order to log in, such as an OAuth server.
+type RedirectProvider interface {
+	Provider
+	// AuthURI returns the URI to redirect the user to. Once logged in, the
+	// user is sent to redirectURI, retaining the given state.
+	AuthURI(w http.ResponseWriter, redirectURI, state string) (string, error)
+}
+
+// Login is the result of a successful callback.
+type Login struct {
+	User *User
+	// State is the state passed to AuthURI.
+	State string
+	// Persisted is called after the user has been stored, so that data
+	// referencing the user, such as tokens, can be stored as well. It may
+	// be nil.
+	Persisted func() error
+}
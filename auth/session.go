@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSessionRevoked is returned for tokens whose session has been logged
+	// out or revoked by an administrator.
+	ErrSessionRevoked = errors.New("session has been revoked")
+	// ErrSessionExpired is returned for tokens whose session has expired.
+	ErrSessionExpired = errors.New("session has expired")
+)
+
+// DefaultSessionLifetime is used if Service.SessionLifetime isn't set.
+const DefaultSessionLifetime = 12 * time.Hour
+
+// Session is a single login of a user. Its ID is the jti claim of the token
+// stored in the users cookie.
+type Session struct {
+	Id        string
+	UserId    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// SessionStore keeps track of all sessions, so that they can be revoked
+// before they expire.
+type SessionStore interface {
+	Create(session *Session) error
+	// Get returns nil if the session doesn't exist or has been revoked.
+	Get(id string) (*Session, error)
+	// Extend moves the expiry of the session, allowing active users to stay
+	// logged in.
+	Extend(id string, expiresAt time.Time) error
+	Revoke(id string) error
+	// RevokeAll revokes all sessions of the given user.
+	RevokeAll(userId string) error
+}
+
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{
+		sessions: make(map[string]*Session),
+		mutex:    &sync.Mutex{},
+	}
+}
+
+type memorySessionStore struct {
+	sessions map[string]*Session
+	mutex    *sync.Mutex
+}
+
+func (s *memorySessionStore) Create(session *Session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	//Expired sessions are useless, so we get rid of them here.
+	now := time.Now()
+	for id, existing := range s.sessions {
+		if now.After(existing.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+
+	copied := *session
+	s.sessions[session.Id] = &copied
+	return nil
+}
+
+func (s *memorySessionStore) Get(id string) (*Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists {
+		return nil, nil
+	}
+
+	copied := *session
+	return &copied, nil
+}
+
+func (s *memorySessionStore) Extend(id string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if session, exists := s.sessions[id]; exists {
+		session.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (s *memorySessionStore) Revoke(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *memorySessionStore) RevokeAll(userId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserId == userId {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
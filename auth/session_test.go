@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func requestWithCookies(cookies []*http.Cookie) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	return request
+}
+
+func login(t *testing.T, a *Service, user *User) []*http.Cookie {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	if err := a.SetUserCookie(recorder, user); err != nil {
+		t.Fatalf("Couldn't set cookie: %s", err)
+	}
+	return recorder.Result().Cookies()
+}
+
+func Test_sessionRevocation(t *testing.T) {
+	a := &Service{
+		JwtKey:          []byte("test"),
+		JwtCookieName:   "usertoken",
+		Sessions:        NewMemorySessionStore(),
+		SecureCookies:   true,
+		HttpOnlyCookies: true,
+	}
+	user := &User{Id: "1", Name: "User", Provider: ProviderTwitch}
+
+	first := login(t, a, user)
+	second := login(t, a, user)
+	if !first[0].HttpOnly || !first[0].Secure {
+		t.Errorf("Expected secure HttpOnly cookie, got %+v", first[0])
+	}
+
+	//Logging out only ends the current session.
+	if err := a.Logout(httptest.NewRecorder(), requestWithCookies(first), false); err != nil {
+		t.Fatalf("Couldn't log out: %s", err)
+	}
+	if _, err := a.GetUser(requestWithCookies(first)); err != ErrSessionRevoked {
+		t.Errorf("Expected revoked session, got %v", err)
+	}
+	if _, err := a.GetUser(requestWithCookies(second)); err != nil {
+		t.Errorf("Expected other session to stay valid, got %v", err)
+	}
+
+	third := login(t, a, user)
+	if err := a.RevokeSessions(user.Id); err != nil {
+		t.Fatalf("Couldn't revoke sessions: %s", err)
+	}
+	for _, cookies := range [][]*http.Cookie{second, third} {
+		if _, err := a.GetUser(requestWithCookies(cookies)); err != ErrSessionRevoked {
+			t.Errorf("Expected revoked session, got %v", err)
+		}
+	}
+}
+
+func Test_tokenWithoutExpiry(t *testing.T) {
+	a := &Service{JwtKey: []byte("test"), JwtCookieName: "usertoken"}
+
+	//Tokens like these were issued before sessions existed.
+	recorder := httptest.NewRecorder()
+	if err := a.setTokenCookie(recorder, UserClaims{User: User{Id: "1", Name: "User"}}); err != nil {
+		t.Fatalf("Couldn't set cookie: %s", err)
+	}
+	if _, err := a.GetUser(requestWithCookies(recorder.Result().Cookies())); err == nil {
+		t.Error("Expected token without expiry to be rejected")
+	}
+}
+
+func Test_renewSessions(t *testing.T) {
+	sessions := NewMemorySessionStore()
+	a := &Service{
+		JwtKey:          []byte("test"),
+		JwtCookieName:   "usertoken",
+		Sessions:        sessions,
+		SessionLifetime: time.Hour,
+	}
+	user := &User{Id: "1", Name: "User", Provider: ProviderTwitch}
+	handler := a.RenewSessions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	fresh := login(t, a, user)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, requestWithCookies(fresh))
+	if len(recorder.Result().Cookies()) != 0 {
+		t.Error("Fresh session shouldn't be renewed")
+	}
+
+	//Simulate a session that has used up most of its lifetime.
+	now := time.Now()
+	const sessionId = "old-session"
+	sessions.Create(&Session{Id: sessionId, UserId: user.Id, CreatedAt: now, ExpiresAt: now.Add(10 * time.Minute)})
+	old := httptest.NewRecorder()
+	a.setTokenCookie(old, UserClaims{User: *user, StandardClaims: jwt.StandardClaims{
+		Id:        sessionId,
+		ExpiresAt: now.Add(10 * time.Minute).Unix(),
+	}})
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, requestWithCookies(old.Result().Cookies()))
+	renewed := recorder.Result().Cookies()
+	if len(renewed) != 1 {
+		t.Fatalf("Expected renewed cookie, got %v", renewed)
+	}
+	if _, err := a.GetUser(requestWithCookies(renewed)); err != nil {
+		t.Errorf("Renewed token is invalid: %v", err)
+	}
+
+	session, _ := sessions.Get(sessionId)
+	if session.ExpiresAt.Before(now.Add(50 * time.Minute)) {
+		t.Errorf("Session wasn't extended, expires at %s", session.ExpiresAt)
+	}
+}
@@ -0,0 +1,442 @@
+// Package chatbot announces lobbies in the Twitch chat of the streamers that
+// created them. Streamers have to enable the bot in their settings. The bot
+// either uses a dedicated bot account or the tokens of the streamer, in which
+// case the messages are sent in their name.
+package chatbot
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/clock"
+	"github.com/scribble-rs/scribble.rs/config"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/twitch"
+)
+
+const (
+	// Command makes the bot answer with the link to the current lobby.
+	Command = "!scribble"
+	// idleTimeout is the time after the last announcement after which the
+	// bot leaves a channel.
+	idleTimeout = 2 * time.Hour
+	// commandCooldown is the time during which the bot doesn't answer the
+	// Command again in the same channel, so that it can't be used to spam.
+	commandCooldown = 30 * time.Second
+	// queueSize limits the events waiting to be announced. Further events
+	// are dropped, as announcing them late isn't useful anyway.
+	queueSize = 100
+	// maxStandings limits the players listed in announcements, as chat
+	// messages can't be longer than 500 characters.
+	maxStandings = 5
+)
+
+// Scopes are required for sending messages via the tokens of the streamer.
+var Scopes = []string{"chat:read", "chat:edit"}
+
+var errMissingScopes = errors.New("the channel's tokens lack the chat scopes")
+
+// Settings tells which channels have enabled the bot.
+type Settings interface {
+	IsChatBotEnabled(userId string) (bool, error)
+}
+
+// Bot announces the events of lobbies in the chat of their channel. The
+// zero value isn't usable, Launch has to be called first.
+type Bot struct {
+	Twitch      *twitch.Client
+	Tokens      twitch.TokenStore
+	Settings    Settings
+	GenerateUrl config.UrlGeneratorFunc
+	// Login and Token belong to a dedicated bot account. If they aren't
+	// set, the bot uses the tokens of the streamer, which requires Scopes.
+	Login string
+	Token string
+	// Dial opens connections to the chat. If nil, twitch.DialChat is used.
+	Dial func() (net.Conn, error)
+
+	resolveLogin func(channelId string) (string, error)
+	clock        clock.Clock
+	events       chan *game.Event
+
+	mutex    *sync.Mutex
+	channels map[string]*channel
+	// shared is the connection of the dedicated bot account, which is used
+	// for all channels.
+	shared *twitch.ChatConn
+}
+
+// channel is a Twitch channel that the bot has joined.
+type channel struct {
+	id    string
+	login string
+	// lobbyID is the latest lobby of the channel, older ones aren't
+	// announced anymore.
+	lobbyID   string
+	conn      *twitch.ChatConn
+	idleTimer clock.Timer
+	// answeredAt is when the Command was last answered.
+	answeredAt time.Time
+}
+
+// RequiredScopes returns the scopes streamers have to grant in order to
+// enable the bot.
+func (b *Bot) RequiredScopes() []string {
+	if b.Login != "" {
+		return []string{}
+	}
+	return Scopes
+}
+
+// Launch starts announcing the events passed to HandleEvent.
+func (b *Bot) Launch() {
+	if b.Dial == nil {
+		b.Dial = twitch.DialChat
+	}
+	if b.resolveLogin == nil {
+		b.resolveLogin = b.lookupLogin
+	}
+	if b.clock == nil {
+		b.clock = clock.Real
+	}
+	b.mutex = &sync.Mutex{}
+	b.channels = make(map[string]*channel)
+	b.events = make(chan *game.Event, queueSize)
+
+	go func() {
+		for event := range b.events {
+			b.handle(event)
+		}
+	}()
+}
+
+// HandleEvent queues the event for announcement. It doesn't block and can
+// therefore be used as game.EventListener.
+func (b *Bot) HandleEvent(event *game.Event) {
+	select {
+	case b.events <- event:
+	default:
+		logging.Warn("Dropped chat bot event, as the queue is full", logging.KeyLobby, event.LobbyID, "event", event.Type)
+	}
+}
+
+func (b *Bot) handle(event *game.Event) {
+	logger := logging.With(logging.KeyLobby, event.LobbyID, logging.KeyUser, event.ChannelID)
+
+	b.mutex.Lock()
+	joined := b.channels[event.ChannelID]
+	b.mutex.Unlock()
+
+	if event.Type == game.EventLobbyOpened {
+		enabled, err := b.Settings.IsChatBotEnabled(event.ChannelID)
+		if err != nil {
+			logger.Error("Failed checking chat bot settings", logging.KeyError, err)
+			return
+		}
+		if !enabled {
+			return
+		}
+
+		//Events are handled one after another, so nobody else joins the
+		//channel in the meantime.
+		if joined == nil {
+			joined, err = b.join(event.ChannelID)
+			if err != nil {
+				logger.Warn("Failed joining chat", logging.KeyError, err)
+				return
+			}
+		}
+		b.mutex.Lock()
+		joined.lobbyID = event.LobbyID
+		b.mutex.Unlock()
+	} else if joined == nil {
+		return
+	}
+
+	message := b.announcement(event)
+	if message == "" {
+		return
+	}
+
+	//Results would spoil the word for viewers watching the stream with a
+	//delay, so they are held back accordingly.
+	if delay := time.Duration(event.ObserverDelay) * time.Second; delay > 0 && revealsResults(event) {
+		b.clock.AfterFunc(delay, func() {
+			b.say(joined, event.LobbyID, message, logger)
+		})
+		return
+	}
+	b.say(joined, event.LobbyID, message, logger)
+}
+
+// revealsResults indicates whether the announcement of the event contains
+// the word or scores.
+func revealsResults(event *game.Event) bool {
+	return event.Type == game.EventTurnOver || event.Type == game.EventGameOver
+}
+
+// say sends the message to the channel, unless the bot has left it or a
+// newer lobby has been opened since.
+func (b *Bot) say(joined *channel, lobbyID, message string, logger *logging.Logger) {
+	b.mutex.Lock()
+	current := b.channels[joined.id] == joined && joined.lobbyID == lobbyID
+	b.mutex.Unlock()
+	if !current {
+		return
+	}
+
+	if err := joined.conn.Say(joined.login, message); err != nil {
+		logger.Warn("Failed sending chat message", logging.KeyError, err)
+		b.leave(joined)
+		return
+	}
+
+	b.mutex.Lock()
+	b.resetIdleTimer(joined)
+	b.mutex.Unlock()
+}
+
+func (b *Bot) link(lobbyID string) string {
+	return b.GenerateUrl("/lobbies/" + lobbyID + "/play")
+}
+
+// announcement returns the chat message for the event. Events that aren't
+// announced result in an empty message.
+func (b *Bot) announcement(event *game.Event) string {
+	switch data := event.Data.(type) {
+	case *game.LobbyOpenedEvent:
+		return "A Scribble.rs lobby has been opened, join at " + b.link(event.LobbyID)
+	case *game.GameStartedEvent:
+		return fmt.Sprintf("The game has started with %d players and %d rounds! Join at %s",
+			len(data.Players), data.Rounds, b.link(event.LobbyID))
+	case *game.TurnOverEventData:
+		return fmt.Sprintf("Round %d: %s drew \"%s\". Standings: %s", data.Round, data.Drawer, data.Word, standings(data.Players))
+	case *game.GameOverEventData:
+		winners := make([]string, 0, len(data.Winners))
+		for _, winner := range data.Winners {
+			winners = append(winners, winner.Name)
+		}
+		return fmt.Sprintf("Game over, congratulations %s! Final standings: %s", strings.Join(winners, ", "), standings(data.Players))
+	}
+
+	return ""
+}
+
+// standings lists the best players, where players with the same score
+// share their rank.
+func standings(players []game.PlayerSummary) string {
+	sorted := make([]game.PlayerSummary, len(players))
+	copy(sorted, players)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Score > sorted[b].Score
+	})
+
+	entries := make([]string, 0, maxStandings)
+	rank := 0
+	for index, player := range sorted {
+		if index == maxStandings {
+			break
+		}
+		if index == 0 || player.Score != sorted[index-1].Score {
+			rank = index + 1
+		}
+		entries = append(entries, fmt.Sprintf("%d. %s (%d)", rank, player.Name, player.Score))
+	}
+	return strings.Join(entries, ", ")
+}
+
+// join joins the chat of the given channel. Connecting happens without
+// locking the bot, so that commands can be answered in the meantime.
+func (b *Bot) join(channelID string) (*channel, error) {
+	login, err := b.resolveLogin(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn *twitch.ChatConn
+	if b.Login != "" {
+		if conn, err = b.sharedConn(); err != nil {
+			return nil, err
+		}
+	} else {
+		tokens, err := b.Tokens.Get(&auth.User{Id: channelID})
+		if err != nil {
+			return nil, err
+		}
+		if tokens == nil || !tokens.HasScope("chat:read") || !tokens.HasScope("chat:edit") {
+			return nil, errMissingScopes
+		}
+		if conn, err = b.connect(login, tokens.AccessToken); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := conn.Join(login); err != nil {
+		b.mutex.Lock()
+		b.drop(conn)
+		b.mutex.Unlock()
+		return nil, err
+	}
+
+	joined := &channel{id: channelID, login: login, conn: conn}
+	b.mutex.Lock()
+	b.channels[channelID] = joined
+	b.mutex.Unlock()
+	return joined, nil
+}
+
+// sharedConn returns the connection of the dedicated bot account,
+// connecting if necessary.
+func (b *Bot) sharedConn() (*twitch.ChatConn, error) {
+	b.mutex.Lock()
+	shared := b.shared
+	b.mutex.Unlock()
+	if shared != nil {
+		return shared, nil
+	}
+
+	shared, err := b.connect(b.Login, b.Token)
+	if err != nil {
+		return nil, err
+	}
+	b.mutex.Lock()
+	b.shared = shared
+	b.mutex.Unlock()
+	return shared, nil
+}
+
+// leave leaves the chat of the channel, unless that already happened.
+func (b *Bot) leave(joined *channel) {
+	b.mutex.Lock()
+	if b.channels[joined.id] != joined {
+		b.mutex.Unlock()
+		return
+	}
+	if joined.idleTimer != nil {
+		joined.idleTimer.Stop()
+	}
+	delete(b.channels, joined.id)
+	shared := joined.conn == b.shared
+	b.mutex.Unlock()
+
+	if !shared {
+		joined.conn.Close()
+	} else if err := joined.conn.Part(joined.login); err != nil {
+		b.mutex.Lock()
+		b.drop(joined.conn)
+		b.mutex.Unlock()
+	}
+}
+
+// resetIdleTimer requires the bot to be locked.
+func (b *Bot) resetIdleTimer(joined *channel) {
+	if joined.idleTimer != nil {
+		joined.idleTimer.Stop()
+	}
+	joined.idleTimer = b.clock.AfterFunc(idleTimeout, func() {
+		b.leave(joined)
+	})
+}
+
+func (b *Bot) connect(login, accessToken string) (*twitch.ChatConn, error) {
+	netConn, err := b.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := twitch.NewChatConn(netConn, login, accessToken)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	go b.read(conn)
+	return conn, nil
+}
+
+// read answers commands until the connection fails. Each channel is only
+// answered once per commandCooldown.
+func (b *Bot) read(conn *twitch.ChatConn) {
+	for {
+		message, err := conn.Read()
+		if err != nil {
+			b.mutex.Lock()
+			b.drop(conn)
+			b.mutex.Unlock()
+			return
+		}
+
+		if strings.TrimSpace(message.Text) != Command {
+			continue
+		}
+
+		var answered *channel
+		var lobbyID string
+		b.mutex.Lock()
+		now := b.clock.Now()
+		for _, joined := range b.channels {
+			if joined.conn == conn && joined.login == message.Channel &&
+				now.Sub(joined.answeredAt) >= commandCooldown {
+				joined.answeredAt = now
+				answered, lobbyID = joined, joined.lobbyID
+			}
+		}
+		b.mutex.Unlock()
+
+		if answered != nil {
+			if err := conn.Say(answered.login, "Join the game at "+b.link(lobbyID)); err != nil {
+				logging.Warn("Failed answering chat command", logging.KeyUser, answered.id, logging.KeyError, err)
+			}
+		}
+	}
+}
+
+// drop closes the connection and forgets all channels using it, so that
+// they are joined again on the next lobby. The bot has to be locked.
+func (b *Bot) drop(conn *twitch.ChatConn) {
+	conn.Close()
+	if b.shared == conn {
+		b.shared = nil
+	}
+	for id, joined := range b.channels {
+		if joined.conn == conn {
+			if joined.idleTimer != nil {
+				joined.idleTimer.Stop()
+			}
+			delete(b.channels, id)
+		}
+	}
+}
+
+// lookupLogin returns the login of the channel, which is required for
+// joining its chat. The display name can't be used, as it may be localized.
+func (b *Bot) lookupLogin(channelID string) (string, error) {
+	tokens, err := b.Tokens.Get(&auth.User{Id: channelID})
+	if err != nil {
+		return "", err
+	}
+	if tokens == nil {
+		if b.Token == "" {
+			return "", errMissingScopes
+		}
+		tokens = &twitch.TokenSet{AccessToken: b.Token}
+	}
+
+	result, err := b.Twitch.GetUsers(tokens, url.Values{"id": {channelID}})
+	if err != nil {
+		return "", err
+	}
+	if len(result.Data) != 1 {
+		return "", fmt.Errorf("expected one user with ID %s, got %d", channelID, len(result.Data))
+	}
+
+	return result.Data[0].Login, nil
+}
@@ -0,0 +1,207 @@
+package chatbot
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/clock"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/twitch"
+)
+
+// chatServer is a stand-in for the Twitch chat, which accepts any login
+// and records the lines sent by the clients.
+type chatServer struct {
+	listener net.Listener
+	lines    chan string
+	conns    chan net.Conn
+}
+
+func newChatServer(t *testing.T) *chatServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't listen: %s", err)
+	}
+
+	server := &chatServer{
+		listener: listener,
+		lines:    make(chan string, 100),
+		conns:    make(chan net.Conn, 10),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.conns <- conn
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *chatServer) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "NICK ") {
+			conn.Write([]byte(":tmi.twitch.tv 001 " + strings.TrimPrefix(line, "NICK ") + " :Welcome, GLHF!\r\n"))
+		}
+		s.lines <- line
+	}
+}
+
+func (s *chatServer) dial() (net.Conn, error) {
+	return net.Dial("tcp", s.listener.Addr().String())
+}
+
+func (s *chatServer) expect(t *testing.T, expected string) {
+	t.Helper()
+
+	select {
+	case line := <-s.lines:
+		if line != expected {
+			t.Fatalf("Expected '%s', got '%s'", expected, line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected '%s', got nothing", expected)
+	}
+}
+
+func (s *chatServer) expectNothing(t *testing.T) {
+	t.Helper()
+
+	select {
+	case line := <-s.lines:
+		t.Fatalf("Unexpected line '%s'", line)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type enabledChannels map[string]bool
+
+func (e enabledChannels) IsChatBotEnabled(userId string) (bool, error) {
+	return e[userId], nil
+}
+
+func newTestBot(server *chatServer, fakeClock clock.Clock, tokens twitch.TokenStore) *Bot {
+	bot := &Bot{
+		Tokens:   tokens,
+		Settings: enabledChannels{"1": true},
+		GenerateUrl: func(path string) string {
+			return "https://scribble.rs" + path
+		},
+		Dial: server.dial,
+		resolveLogin: func(channelId string) (string, error) {
+			return "streamer" + channelId, nil
+		},
+		clock: fakeClock,
+	}
+	bot.Launch()
+	return bot
+}
+
+func Test_dedicatedBot(t *testing.T) {
+	server := newChatServer(t)
+	defer server.listener.Close()
+
+	fakeClock := clock.NewFake(time.Now())
+	bot := newTestBot(server, fakeClock, twitch.NewMemoryTokenStore())
+	bot.Login, bot.Token = "ScribbleBot", "secret"
+
+	bot.HandleEvent(&game.Event{Type: game.EventLobbyOpened, LobbyID: "old", ChannelID: "1", Data: &game.LobbyOpenedEvent{}})
+	server.expect(t, "PASS oauth:secret")
+	server.expect(t, "NICK scribblebot")
+	server.expect(t, "JOIN #streamer1")
+	server.expect(t, "PRIVMSG #streamer1 :A Scribble.rs lobby has been opened, join at https://scribble.rs/lobbies/old/play")
+
+	//Channels without the bot and lobbies replaced by a newer one are ignored.
+	bot.HandleEvent(&game.Event{Type: game.EventLobbyOpened, LobbyID: "other", ChannelID: "2", Data: &game.LobbyOpenedEvent{}})
+	bot.HandleEvent(&game.Event{Type: game.EventLobbyOpened, LobbyID: "new", ChannelID: "1", Data: &game.LobbyOpenedEvent{}})
+	server.expect(t, "PRIVMSG #streamer1 :A Scribble.rs lobby has been opened, join at https://scribble.rs/lobbies/new/play")
+	bot.HandleEvent(&game.Event{Type: game.EventGameStarted, LobbyID: "old", ChannelID: "1", Data: &game.GameStartedEvent{}})
+	server.expectNothing(t)
+
+	//Results are held back until viewers of the delayed stream saw them.
+	bot.HandleEvent(&game.Event{Type: game.EventTurnOver, LobbyID: "new", ChannelID: "1", ObserverDelay: 30, Data: &game.TurnOverEventData{
+		Round: 1, Word: "apple", Drawer: "Marcel", Players: []game.PlayerSummary{{Name: "Marcel", Score: 100}},
+	}})
+	server.expectNothing(t)
+	fakeClock.Advance(30 * time.Second)
+	server.expect(t, "PRIVMSG #streamer1 :Round 1: Marcel drew \"apple\". Standings: 1. Marcel (100)")
+
+	bot.HandleEvent(&game.Event{Type: game.EventGameOver, LobbyID: "new", ChannelID: "1", Data: &game.GameOverEventData{
+		Winners: []game.PlayerSummary{{Name: "Marcel", Score: 300}},
+		Players: []game.PlayerSummary{{Name: "Bob", Score: 120}, {Name: "Marcel", Score: 300}, {Name: "Alice", Score: 120}},
+	}})
+	server.expect(t, "PRIVMSG #streamer1 :Game over, congratulations Marcel! Final standings: 1. Marcel (300), 2. Bob (120), 2. Alice (120)")
+
+	conn := <-server.conns
+	conn.Write([]byte("PING :tmi.twitch.tv\r\n"))
+	server.expect(t, "PONG :tmi.twitch.tv")
+	conn.Write([]byte(":viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #streamer1 :!scribble\r\n"))
+	server.expect(t, "PRIVMSG #streamer1 :Join the game at https://scribble.rs/lobbies/new/play")
+
+	fakeClock.Advance(idleTimeout)
+	server.expect(t, "PART #streamer1")
+}
+
+func Test_commandCooldown(t *testing.T) {
+	server := newChatServer(t)
+	defer server.listener.Close()
+
+	fakeClock := clock.NewFake(time.Now())
+	bot := newTestBot(server, fakeClock, twitch.NewMemoryTokenStore())
+	bot.Login, bot.Token = "ScribbleBot", "secret"
+
+	bot.HandleEvent(&game.Event{Type: game.EventLobbyOpened, LobbyID: "abc", ChannelID: "1", Data: &game.LobbyOpenedEvent{}})
+	server.expect(t, "PASS oauth:secret")
+	server.expect(t, "NICK scribblebot")
+	server.expect(t, "JOIN #streamer1")
+	server.expect(t, "PRIVMSG #streamer1 :A Scribble.rs lobby has been opened, join at https://scribble.rs/lobbies/abc/play")
+
+	conn := <-server.conns
+	command := []byte(":viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #streamer1 :!scribble\r\n")
+	conn.Write(command)
+	server.expect(t, "PRIVMSG #streamer1 :Join the game at https://scribble.rs/lobbies/abc/play")
+
+	//Viewers spamming the command only get a single answer.
+	conn.Write(command)
+	server.expectNothing(t)
+	fakeClock.Advance(commandCooldown - time.Second)
+	conn.Write(command)
+	server.expectNothing(t)
+
+	fakeClock.Advance(time.Second)
+	conn.Write(command)
+	server.expect(t, "PRIVMSG #streamer1 :Join the game at https://scribble.rs/lobbies/abc/play")
+}
+
+func Test_streamerTokens(t *testing.T) {
+	server := newChatServer(t)
+	defer server.listener.Close()
+
+	tokens := twitch.NewMemoryTokenStore()
+	bot := newTestBot(server, clock.NewFake(time.Now()), tokens)
+
+	//Without the chat scopes, the bot can't act on behalf of the streamer.
+	tokens.Set(&auth.User{Id: "1"}, &twitch.TokenSet{AccessToken: "streamer", Scopes: []string{"user:read:email"}})
+	bot.HandleEvent(&game.Event{Type: game.EventLobbyOpened, LobbyID: "abc", ChannelID: "1", Data: &game.LobbyOpenedEvent{}})
+	server.expectNothing(t)
+
+	tokens.Set(&auth.User{Id: "1"}, &twitch.TokenSet{AccessToken: "streamer", Scopes: Scopes})
+	bot.HandleEvent(&game.Event{Type: game.EventLobbyOpened, LobbyID: "abc", ChannelID: "1", Data: &game.LobbyOpenedEvent{}})
+	server.expect(t, "PASS oauth:streamer")
+	server.expect(t, "NICK streamer1")
+	server.expect(t, "JOIN #streamer1")
+	server.expect(t, "PRIVMSG #streamer1 :A Scribble.rs lobby has been opened, join at https://scribble.rs/lobbies/abc/play")
+}
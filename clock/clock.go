@@ -0,0 +1,119 @@
+// Package clock abstracts the passing of time, so that timing dependent
+// logic, such as turn timers, can be tested without actually waiting.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the current time and schedules functions to be run later.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls the given function in its own goroutine once the
+	// duration has passed. See time.AfterFunc.
+	AfterFunc(duration time.Duration, function func()) Timer
+}
+
+// Timer is a function scheduled via Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the function from being called. The return value
+	// indicates whether the call has been prevented.
+	Stop() bool
+}
+
+// Real is the Clock backed by the time package.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(duration time.Duration, function func()) Timer {
+	return time.AfterFunc(duration, function)
+}
+
+// Fake is a Clock that only moves when told to. Scheduled functions are run
+// synchronously by Advance, which makes tests deterministic.
+type Fake struct {
+	mutex  *sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake creates a Fake that starts at the given time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		mutex: &sync.Mutex{},
+		now:   now,
+	}
+}
+
+func (clock *Fake) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.now
+}
+
+func (clock *Fake) AfterFunc(duration time.Duration, function func()) Timer {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	timer := &fakeTimer{
+		clock:    clock,
+		due:      clock.now.Add(duration),
+		function: function,
+	}
+	clock.timers = append(clock.timers, timer)
+	//Timers that are due at the same time run in the order of scheduling.
+	sort.SliceStable(clock.timers, func(a, b int) bool {
+		return clock.timers[a].due.Before(clock.timers[b].due)
+	})
+
+	return timer
+}
+
+// Advance moves the clock forward by the given duration. All functions that
+// are due in the meantime are called in the calling goroutine, including
+// functions that have been scheduled by those functions. When a function is
+// called, Now returns the time it was due at.
+func (clock *Fake) Advance(duration time.Duration) {
+	clock.mutex.Lock()
+	target := clock.now.Add(duration)
+	for len(clock.timers) > 0 && !clock.timers[0].due.After(target) {
+		timer := clock.timers[0]
+		clock.timers = clock.timers[1:]
+		clock.now = timer.due
+
+		//The function may use the clock, so we mustn't hold the lock.
+		clock.mutex.Unlock()
+		timer.function()
+		clock.mutex.Lock()
+	}
+	clock.now = target
+	clock.mutex.Unlock()
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	due      time.Time
+	function func()
+}
+
+func (timer *fakeTimer) Stop() bool {
+	timer.clock.mutex.Lock()
+	defer timer.clock.mutex.Unlock()
+
+	for index, scheduled := range timer.clock.timers {
+		if scheduled == timer {
+			timer.clock.timers = append(timer.clock.timers[:index], timer.clock.timers[index+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
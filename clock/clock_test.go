@@ -0,0 +1,48 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeRunsDueFunctionsInOrder(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFake(start)
+
+	var calls []time.Duration
+	record := func() {
+		calls = append(calls, clock.Now().Sub(start))
+	}
+	clock.AfterFunc(2*time.Second, record)
+	clock.AfterFunc(time.Second, func() {
+		record()
+		//Functions scheduled while advancing run too, if they are due.
+		clock.AfterFunc(500*time.Millisecond, record)
+	})
+	stopped := clock.AfterFunc(time.Second, record)
+	clock.AfterFunc(3*time.Second, record)
+
+	if !stopped.Stop() {
+		t.Error("Stopping a scheduled function should've succeeded")
+	}
+
+	clock.Advance(2 * time.Second)
+
+	expected := []time.Duration{time.Second, 1500 * time.Millisecond, 2 * time.Second}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected calls at %v, but got %v", expected, calls)
+	}
+	for index := range expected {
+		if calls[index] != expected[index] {
+			t.Errorf("Expected calls at %v, but got %v", expected, calls)
+			break
+		}
+	}
+
+	if now := clock.Now(); !now.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("Clock should be at %s, but was at %s", start.Add(2*time.Second), now)
+	}
+	if stopped.Stop() {
+		t.Error("Stopping a function twice should've failed")
+	}
+}
@@ -1,9 +1,10 @@
 package config
 
 import (
-	"log"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"os"
 	"strings"
+	"time"
 )
 
 type UrlGeneratorFunc func(path string) string
@@ -17,6 +18,51 @@ type Config struct {
 	TwitchRedirectURI  string
 	DatabaseUrl        string
 	GenerateUrl        UrlGeneratorFunc
+	// TurnIntermission is the time results are shown between two turns.
+	TurnIntermission time.Duration
+	// InstanceId uniquely identifies this instance if multiple instances
+	// share the same database.
+	InstanceId string
+	// InstanceUrl is the URL other instances use to reach this instance.
+	// If it is empty, only a single instance is supported.
+	InstanceUrl string
+	// TokenEncryptionKey encrypts the Twitch tokens of users, which are
+	// stored in the database if multiple instances are used.
+	TokenEncryptionKey string
+	// MetricsToken protects the /metrics endpoint. If it is empty, the
+	// metrics are public.
+	MetricsToken string
+	LogLevel     logging.Level
+	LogFormat    logging.Format
+	// AdminIds are the Twitch user IDs of the instance administrators.
+	AdminIds []string
+	// OIDCIssuer enables logging in via the given OpenID Connect provider
+	// in addition to Twitch, if set.
+	OIDCIssuer       string
+	OIDCClientId     string
+	OIDCClientSecret string
+	// GuestLogin allows users to log in by just choosing a nickname.
+	GuestLogin bool
+	// SessionLifetime is the time after which inactive users are logged out.
+	SessionLifetime time.Duration
+	// SecureCookies should be enabled if the instance is served via HTTPS.
+	SecureCookies bool
+	// HttpOnlyCookies hides the session cookie from scripts. It's enabled
+	// unless explicitly disabled.
+	HttpOnlyCookies bool
+	// WebhookPrivateIPs allows delivering webhooks to loopback and private
+	// addresses, which is only useful for development.
+	WebhookPrivateIPs bool
+	// TwitchBotLogin and TwitchBotToken belong to the account the chat bot
+	// uses. If they are empty, the bot uses the tokens of the streamers.
+	TwitchBotLogin string
+	TwitchBotToken string
+	// EventSubSecret enables channel point redemptions via EventSub. It
+	// signs all notifications Twitch sends to us.
+	EventSubSecret string
+	// ModSyncInterval is the time between two syncs of the moderators and
+	// bans of channels with recent lobbies. Zero disables the sync.
+	ModSyncInterval time.Duration
 }
 
 func FromEnv() Config {
@@ -27,17 +73,45 @@ func FromEnv() Config {
 	twitchClientId, twitchClientIdSet := os.LookupEnv("TWITCH_CLIENT_ID")
 	twitchClientSecret, twitchClientSecretSet := os.LookupEnv("TWITCH_CLIENT_SECRET")
 	twitchRedirectURI, twitchRedirectURISet := os.LookupEnv("TWITCH_REDIRECT_URI")
+	turnIntermission, turnIntermissionSet := os.LookupEnv("TURN_INTERMISSION")
+	instanceId, instanceIdSet := os.LookupEnv("INSTANCE_ID")
+	instanceUrl := os.Getenv("INSTANCE_URL")
+	tokenEncryptionKey := os.Getenv("TOKEN_ENCRYPTION_KEY")
+	metricsToken := os.Getenv("METRICS_TOKEN")
+	logLevel, logLevelSet := os.LookupEnv("LOG_LEVEL")
+	logFormat, logFormatSet := os.LookupEnv("LOG_FORMAT")
+	adminIds := os.Getenv("ADMIN_IDS")
+	oidcIssuer := os.Getenv("OIDC_ISSUER")
+	oidcClientId := os.Getenv("OIDC_CLIENT_ID")
+	oidcClientSecret := os.Getenv("OIDC_CLIENT_SECRET")
+	guestLogin := os.Getenv("GUEST_LOGIN")
+	sessionLifetime, sessionLifetimeSet := os.LookupEnv("SESSION_LIFETIME")
+	secureCookies := os.Getenv("SECURE_COOKIES")
+	httpOnlyCookies := os.Getenv("HTTP_ONLY_COOKIES")
+	webhookPrivateIPs := os.Getenv("WEBHOOK_PRIVATE_IPS")
+	twitchBotLogin := os.Getenv("TWITCH_BOT_LOGIN")
+	twitchBotToken := os.Getenv("TWITCH_BOT_TOKEN")
+	eventSubSecret := os.Getenv("EVENTSUB_SECRET")
+	modSyncInterval, modSyncIntervalSet := os.LookupEnv("MOD_SYNC_INTERVAL")
 
 	if !rootUrlSet {
-		log.Fatalln("ROOT_URL not set")
+		logging.Fatal("ROOT_URL not set")
 	} else if !dbUrlSet {
-		log.Fatalln("DATABASE_URL not set")
+		logging.Fatal("DATABASE_URL not set")
 	} else if !jwtKeySet {
-		log.Fatalln("JWT_KEY not set")
+		logging.Fatal("JWT_KEY not set")
 	} else if !twitchClientIdSet {
-		log.Fatalln("TWITCH_CLIENT_ID not set")
+		logging.Fatal("TWITCH_CLIENT_ID not set")
 	} else if !twitchClientSecretSet {
-		log.Fatalln("TWITCH_CLIENT_SECRET not set")
+		logging.Fatal("TWITCH_CLIENT_SECRET not set")
+	} else if oidcIssuer != "" && (oidcClientId == "" || oidcClientSecret == "") {
+		logging.Fatal("OIDC_CLIENT_ID and OIDC_CLIENT_SECRET must be set if OIDC_ISSUER is set")
+	} else if (twitchBotLogin == "") != (twitchBotToken == "") {
+		logging.Fatal("TWITCH_BOT_LOGIN and TWITCH_BOT_TOKEN must be set together")
+	} else if instanceUrl != "" && len(tokenEncryptionKey) < 16 {
+		logging.Fatal("TOKEN_ENCRYPTION_KEY must be set to at least 16 characters if INSTANCE_URL is set")
+	} else if eventSubSecret != "" && (len(eventSubSecret) < 10 || len(eventSubSecret) > 100) {
+		logging.Fatal("EVENTSUB_SECRET must be between 10 and 100 characters")
 	}
 	if !jwtCookieNameSet {
 		jwtCookieName = "usertoken"
@@ -45,6 +119,50 @@ func FromEnv() Config {
 	if !twitchRedirectURISet {
 		twitchRedirectURI = "http://localhost:8080/login_twitch_callback"
 	}
+	if !instanceIdSet {
+		//Hostnames are unique per container, which is usually good enough.
+		instanceId, _ = os.Hostname()
+	}
+	parsedTurnIntermission := 5 * time.Second
+	if turnIntermissionSet {
+		var err error
+		parsedTurnIntermission, err = time.ParseDuration(turnIntermission)
+		if err != nil || parsedTurnIntermission < 0 {
+			logging.Fatal("TURN_INTERMISSION must be a positive duration, such as 5s")
+		}
+	}
+	parsedSessionLifetime := 12 * time.Hour
+	if sessionLifetimeSet {
+		var err error
+		parsedSessionLifetime, err = time.ParseDuration(sessionLifetime)
+		if err != nil || parsedSessionLifetime <= 0 {
+			logging.Fatal("SESSION_LIFETIME must be a positive duration, such as 12h")
+		}
+	}
+	parsedModSyncInterval := 30 * time.Minute
+	if modSyncIntervalSet {
+		var err error
+		parsedModSyncInterval, err = time.ParseDuration(modSyncInterval)
+		if err != nil || parsedModSyncInterval < 0 {
+			logging.Fatal("MOD_SYNC_INTERVAL must be a positive duration, such as 30m, or 0 to disable it")
+		}
+	}
+	parsedLogLevel := logging.LevelInfo
+	if logLevelSet {
+		var err error
+		parsedLogLevel, err = logging.ParseLevel(logLevel)
+		if err != nil {
+			logging.Fatal("LOG_LEVEL must be one of debug, info, warn or error")
+		}
+	}
+	parsedLogFormat := logging.FormatText
+	if logFormatSet {
+		var err error
+		parsedLogFormat, err = logging.ParseFormat(logFormat)
+		if err != nil {
+			logging.Fatal("LOG_FORMAT must be either text or json")
+		}
+	}
 
 	return Config{
 		JwtKey:             jwtKey,
@@ -53,8 +171,40 @@ func FromEnv() Config {
 		TwitchClientSecret: twitchClientSecret,
 		TwitchRedirectURI:  twitchRedirectURI,
 		DatabaseUrl:        dbUrl,
+		TurnIntermission:   parsedTurnIntermission,
+		InstanceId:         instanceId,
+		InstanceUrl:        instanceUrl,
+		TokenEncryptionKey: tokenEncryptionKey,
+		MetricsToken:       metricsToken,
+		LogLevel:           parsedLogLevel,
+		LogFormat:          parsedLogFormat,
+		AdminIds:           splitList(adminIds),
+		OIDCIssuer:         oidcIssuer,
+		OIDCClientId:       oidcClientId,
+		OIDCClientSecret:   oidcClientSecret,
+		GuestLogin:         guestLogin == "true",
+		SessionLifetime:    parsedSessionLifetime,
+		SecureCookies:      secureCookies == "true",
+		HttpOnlyCookies:    httpOnlyCookies != "false",
+		WebhookPrivateIPs:  webhookPrivateIPs == "true",
+		TwitchBotLogin:     twitchBotLogin,
+		TwitchBotToken:     twitchBotToken,
+		EventSubSecret:     eventSubSecret,
+		ModSyncInterval:    parsedModSyncInterval,
 		GenerateUrl: func(path string) string {
 			return strings.TrimSuffix(rootUrl, "/") + "/" + strings.TrimPrefix(path, "/")
 		},
 	}
 }
+
+// splitList splits a comma separated list, ignoring empty entries.
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
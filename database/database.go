@@ -2,11 +2,16 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
 	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"github.com/scribble-rs/scribble.rs/twitch"
+	"github.com/scribble-rs/scribble.rs/webhook"
+	"time"
 )
 
 const Type = "postgres"
@@ -21,6 +26,9 @@ type Executor interface {
 
 type DB struct {
 	Executor *sqlx.DB
+	// url is required for opening dedicated connections, such as the ones
+	// used for LISTEN.
+	url string
 }
 
 type UserDigest struct {
@@ -28,33 +36,53 @@ type UserDigest struct {
 	Name string
 }
 
+type Drawing struct {
+	Id         string    `db:"id"`
+	LobbyId    string    `db:"lobby_id"`
+	ChannelId  string    `db:"channel_id"`
+	Round      int       `db:"round"`
+	Word       string    `db:"word"`
+	DrawerId   string    `db:"drawer_id"`
+	DrawerName string    `db:"drawer_name"`
+	Drawing    []byte    `db:"drawing"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
 func FromDatabaseUrl(databaseUrl string) (*DB, error) {
 	db, err := sqlx.Open(Type, databaseUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DB{Executor: db}, nil
+	return &DB{Executor: db, url: databaseUrl}, nil
 }
 
 func (d *DB) UpsertUser(user *auth.User) error {
-	_, err := d.Executor.NamedQuery(`INSERT INTO users (id, name, created_at, updated_at) VALUES (:id, :name, NOW(), NOW()) ON CONFLICT (id) DO UPDATE SET name = :name, updated_at = NOW()`, struct {
-		Id   string `db:"id"`
-		Name string `db:"name"`
+	defer queryDuration.ObserveSince(time.Now(), "upsert_user")
+
+	_, err := d.Executor.NamedQuery(`INSERT INTO users (id, name, provider, created_at, updated_at) VALUES (:id, :name, :provider, NOW(), NOW()) ON CONFLICT (id) DO UPDATE SET name = :name, updated_at = NOW()`, struct {
+		Id       string `db:"id"`
+		Name     string `db:"name"`
+		Provider string `db:"provider"`
 	}{
-		Id:   user.Id,
-		Name: user.Name,
+		Id:       user.Id,
+		Name:     user.Name,
+		Provider: user.Provider,
 	})
 
 	return err
 }
 
 func (d *DB) AddLobby(user *auth.User, lobbyId string) error {
+	defer queryDuration.ObserveSince(time.Now(), "add_lobby")
+
 	_, err := d.Executor.Exec("INSERT INTO lobbies (id, user_id, created_at) VALUES ($1, $2, NOW())", lobbyId, user.Id)
 	return err
 }
 
 func (d *DB) GetModsForChannel(channelId string) (*[]UserDigest, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_mods_for_channel")
+
 	var rows []struct {
 		ModId   string `db:"mod_id"`
 		ModName string `db:"mod_name"`
@@ -77,6 +105,8 @@ func (d *DB) GetModsForChannel(channelId string) (*[]UserDigest, error) {
 }
 
 func (d *DB) SetModsForChannel(channelId string, mods []twitch.ModeratorEntry) error {
+	defer queryDuration.ObserveSince(time.Now(), "set_mods_for_channel")
+
 	if len(mods) == 0 {
 		_, err := d.Executor.Exec("DELETE FROM mods WHERE channel_id = $1", channelId)
 		return err
@@ -92,12 +122,12 @@ func (d *DB) SetModsForChannel(channelId string, mods []twitch.ModeratorEntry) e
 
 	modIdArray := pq.Array(modIds)
 	modNameArray := pq.Array(modNames)
-	_, err := d.Executor.Exec("DELETE FROM mods WHERE channel_id = $1 AND mod_id NOT IN ($2)", channelId, modIdArray)
+	_, err := d.Executor.Exec("DELETE FROM mods WHERE channel_id = $1 AND mod_id <> ALL($2::varchar[])", channelId, modIdArray)
 	if err != nil {
 		return err
 	}
 
-	_, err = d.Executor.Exec("INSERT INTO mods (channel_id, mod_id, mod_name, created_at) SELECT $1, UNNEST($2::varchar[]), UNNEST($3::varchar[]), NOW() ON CONFLICT (channel_id, mod_id) DO NOTHING", channelId, modIdArray, modNameArray)
+	_, err = d.Executor.Exec("INSERT INTO mods (channel_id, mod_id, mod_name, created_at) SELECT $1, UNNEST($2::varchar[]), UNNEST($3::varchar[]), NOW() ON CONFLICT (channel_id, mod_id) DO UPDATE SET mod_name = EXCLUDED.mod_name", channelId, modIdArray, modNameArray)
 	if err != nil {
 		return err
 	}
@@ -105,11 +135,696 @@ func (d *DB) SetModsForChannel(channelId string, mods []twitch.ModeratorEntry) e
 	return nil
 }
 
+// SetBansForChannel replaces the users banned from the channel.
+func (d *DB) SetBansForChannel(channelId string, bans []twitch.BannedUserEntry) error {
+	defer queryDuration.ObserveSince(time.Now(), "set_bans_for_channel")
+
+	bannedIds := make([]string, len(bans))
+	bannedNames := make([]string, len(bans))
+	for i, entry := range bans {
+		bannedIds[i] = entry.UserId
+		bannedNames[i] = entry.UserName
+	}
+
+	bannedIdArray := pq.Array(bannedIds)
+	_, err := d.Executor.Exec("DELETE FROM bans WHERE channel_id = $1 AND banned_id <> ALL($2::varchar[])", channelId, bannedIdArray)
+	if err != nil || len(bans) == 0 {
+		return err
+	}
+
+	_, err = d.Executor.Exec("INSERT INTO bans (channel_id, banned_id, banned_name, created_at) SELECT $1, UNNEST($2::varchar[]), UNNEST($3::varchar[]), NOW() ON CONFLICT (channel_id, banned_id) DO UPDATE SET banned_name = EXCLUDED.banned_name", channelId, bannedIdArray, pq.Array(bannedNames))
+	return err
+}
+
+// IsBannedFromChannel checks the bans as of the last sync.
+func (d *DB) IsBannedFromChannel(channelId string, userId string) (bool, error) {
+	defer queryDuration.ObserveSince(time.Now(), "is_banned_from_channel")
+
+	var banned bool
+	err := d.Executor.Get(&banned, "SELECT EXISTS (SELECT 1 FROM bans WHERE channel_id = $1 AND banned_id = $2)", channelId, userId)
+	return banned, err
+}
+
+// ClaimTaskRun records that this instance runs the task, unless any
+// instance started it within the given interval. This allows running
+// periodic tasks on a single instance only.
+func (d *DB) ClaimTaskRun(task string, interval time.Duration) (bool, error) {
+	defer queryDuration.ObserveSince(time.Now(), "claim_task_run")
+
+	result, err := d.Executor.Exec(`INSERT INTO task_runs (task, started_at) VALUES ($1, NOW())
+		ON CONFLICT (task) DO UPDATE SET started_at = NOW() WHERE task_runs.started_at < NOW() - make_interval(secs => $2)`, task, interval.Seconds())
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := result.RowsAffected()
+	return claimed > 0, err
+}
+
+// GetRecentTwitchChannels returns the Twitch users that created a lobby
+// after the given time.
+func (d *DB) GetRecentTwitchChannels(since time.Time) ([]auth.User, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_recent_twitch_channels")
+
+	var rows []struct {
+		Id   string `db:"id"`
+		Name string `db:"name"`
+	}
+	err := d.Executor.Select(&rows, "SELECT id, name FROM users WHERE provider = 'twitch' AND id IN (SELECT user_id FROM lobbies WHERE created_at > $1)", since)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]auth.User, len(rows))
+	for i, row := range rows {
+		channels[i] = auth.User{
+			Id:       row.Id,
+			Name:     row.Name,
+			Provider: auth.ProviderTwitch,
+		}
+	}
+	return channels, nil
+}
+
+// IsChatBotEnabled indicates whether the user wants their lobbies to be
+// announced in their Twitch chat.
+func (d *DB) IsChatBotEnabled(userId string) (bool, error) {
+	defer queryDuration.ObserveSince(time.Now(), "is_chat_bot_enabled")
+
+	var enabled bool
+	err := d.Executor.Get(&enabled, "SELECT chat_bot FROM users WHERE id = $1", userId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return enabled, err
+}
+
+func (d *DB) SetChatBotEnabled(userId string, enabled bool) error {
+	defer queryDuration.ObserveSince(time.Now(), "set_chat_bot_enabled")
+
+	_, err := d.Executor.Exec("UPDATE users SET chat_bot = $2 WHERE id = $1", userId, enabled)
+	return err
+}
+
+// GetPermissions returns the roles allowed to perform each action in the
+// lobbies of the channel. It's nil if the channel never changed them.
+func (d *DB) GetPermissions(channelId string) (map[string][]string, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_permissions")
+
+	var raw []byte
+	err := d.Executor.Get(&raw, "SELECT permissions FROM users WHERE id = $1", channelId)
+	if err == sql.ErrNoRows || (err == nil && raw == nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var permissions map[string][]string
+	if err := json.Unmarshal(raw, &permissions); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (d *DB) SetPermissions(channelId string, permissions map[string][]string) error {
+	defer queryDuration.ObserveSince(time.Now(), "set_permissions")
+
+	raw, err := json.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Executor.Exec("UPDATE users SET permissions = $2 WHERE id = $1", channelId, raw)
+	return err
+}
+
+// ChannelList is a list of users that a channel maintains for the join
+// rules and permissions of its lobbies.
+type ChannelList string
+
+const (
+	// ListAllow contains the users that fulfil the allowlist requirement.
+	ListAllow ChannelList = "allow"
+	// ListBlock contains the users that may never join.
+	ListBlock ChannelList = "block"
+	// ListVIP contains the VIPs of the channel. It's synced from Twitch
+	// and therefore can't be edited by the channel.
+	ListVIP ChannelList = "vip"
+)
+
+func (d *DB) GetChannelList(channelId string, list ChannelList) ([]UserDigest, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_channel_list")
+
+	var rows []struct {
+		UserId   string `db:"user_id"`
+		UserName string `db:"user_name"`
+	}
+	err := d.Executor.Select(&rows, "SELECT user_id, user_name FROM channel_lists WHERE channel_id = $1 AND list = $2 ORDER BY created_at", channelId, list)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]UserDigest, len(rows))
+	for i, row := range rows {
+		users[i] = UserDigest{
+			Id:   row.UserId,
+			Name: row.UserName,
+		}
+	}
+
+	return users, nil
+}
+
+// AddToChannelList adds the user to the list. Adding a user twice only
+// updates their name.
+func (d *DB) AddToChannelList(channelId string, list ChannelList, user UserDigest) error {
+	defer queryDuration.ObserveSince(time.Now(), "add_to_channel_list")
+
+	_, err := d.Executor.Exec("INSERT INTO channel_lists (channel_id, list, user_id, user_name, created_at) VALUES ($1, $2, $3, $4, NOW()) ON CONFLICT (channel_id, list, user_id) DO UPDATE SET user_name = EXCLUDED.user_name",
+		channelId, list, user.Id, user.Name)
+	return err
+}
+
+func (d *DB) RemoveFromChannelList(channelId string, list ChannelList, userId string) error {
+	defer queryDuration.ObserveSince(time.Now(), "remove_from_channel_list")
+
+	_, err := d.Executor.Exec("DELETE FROM channel_lists WHERE channel_id = $1 AND list = $2 AND user_id = $3", channelId, list, userId)
+	return err
+}
+
+// SetChannelList replaces all users on the list.
+func (d *DB) SetChannelList(channelId string, list ChannelList, users []UserDigest) error {
+	defer queryDuration.ObserveSince(time.Now(), "set_channel_list")
+
+	userIds := make([]string, len(users))
+	userNames := make([]string, len(users))
+	for i, user := range users {
+		userIds[i] = user.Id
+		userNames[i] = user.Name
+	}
+
+	userIdArray := pq.Array(userIds)
+	_, err := d.Executor.Exec("DELETE FROM channel_lists WHERE channel_id = $1 AND list = $2 AND user_id <> ALL($3::varchar[])", channelId, list, userIdArray)
+	if err != nil || len(users) == 0 {
+		return err
+	}
+
+	_, err = d.Executor.Exec("INSERT INTO channel_lists (channel_id, list, user_id, user_name, created_at) SELECT $1, $2, UNNEST($3::varchar[]), UNNEST($4::varchar[]), NOW() ON CONFLICT (channel_id, list, user_id) DO UPDATE SET user_name = EXCLUDED.user_name",
+		channelId, list, userIdArray, pq.Array(userNames))
+	return err
+}
+
+func (d *DB) IsOnChannelList(channelId string, list ChannelList, userId string) (bool, error) {
+	defer queryDuration.ObserveSince(time.Now(), "is_on_channel_list")
+
+	var onList bool
+	err := d.Executor.Get(&onList, "SELECT EXISTS (SELECT 1 FROM channel_lists WHERE channel_id = $1 AND list = $2 AND user_id = $3)", channelId, list, userId)
+	return onList, err
+}
+
+// GetLastLobbyForUser looks up the last lobby of the Twitch user with the
+// given name. Other providers don't guarantee unique names, so their users
+// can't be looked up by name.
 func (d *DB) GetLastLobbyForUser(username string) (string, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_last_lobby_for_user")
+
 	var row struct {
 		LobbyId string `db:"id"`
 	}
 
-	err := d.Executor.Get(&row, "SELECT id FROM lobbies WHERE user_id = (SELECT id FROM users WHERE name ILIKE $1 ORDER BY updated_at DESC LIMIT 1) ORDER BY created_at DESC LIMIT 1", username)
+	err := d.Executor.Get(&row, "SELECT id FROM lobbies WHERE user_id = (SELECT id FROM users WHERE name ILIKE $1 AND provider = 'twitch' ORDER BY updated_at DESC LIMIT 1) ORDER BY created_at DESC LIMIT 1", username)
 	return row.LobbyId, err
 }
+
+// GetLastLobbyForChannel looks up the last lobby created by the user with
+// the given ID.
+func (d *DB) GetLastLobbyForChannel(channelId string) (string, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_last_lobby_for_channel")
+
+	var lobbyId string
+	err := d.Executor.Get(&lobbyId, "SELECT id FROM lobbies WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1", channelId)
+	return lobbyId, err
+}
+
+func (d *DB) AddDrawing(drawing *Drawing) error {
+	defer queryDuration.ObserveSince(time.Now(), "add_drawing")
+
+	_, err := d.Executor.NamedExec(`INSERT INTO drawings (id, lobby_id, channel_id, round, word, drawer_id, drawer_name, drawing, created_at) VALUES (:id, :lobby_id, :channel_id, :round, :word, :drawer_id, :drawer_name, :drawing, :created_at)`, drawing)
+	return err
+}
+
+func (d *DB) GetDrawing(id string) (*Drawing, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_drawing")
+
+	var drawing Drawing
+	err := d.Executor.Get(&drawing, "SELECT id, lobby_id, channel_id, round, word, drawer_id, drawer_name, drawing, created_at FROM drawings WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &drawing, nil
+}
+
+func (d *DB) GetDrawingsForLobby(lobbyId string) ([]Drawing, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_drawings_for_lobby")
+
+	var drawings []Drawing
+	err := d.Executor.Select(&drawings, "SELECT id, lobby_id, channel_id, round, word, drawer_id, drawer_name, drawing, created_at FROM drawings WHERE lobby_id = $1 ORDER BY created_at", lobbyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return drawings, nil
+}
+
+// LobbyRegistration records which instance owns a lobby. The remaining fields
+// are required for listing public lobbies without asking the owner.
+type LobbyRegistration struct {
+	LobbyId     string    `db:"lobby_id"`
+	InstanceId  string    `db:"instance_id"`
+	InstanceUrl string    `db:"instance_url"`
+	Public      bool      `db:"public"`
+	PlayerCount int       `db:"player_count"`
+	MaxPlayers  int       `db:"max_players"`
+	Round       int       `db:"round"`
+	Rounds      int       `db:"rounds"`
+	DrawingTime int       `db:"drawing_time"`
+	CustomWords bool      `db:"custom_words"`
+	Wordpack    string    `db:"wordpack"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+const lobbyRegistrationColumns = "lobby_id, instance_id, instance_url, public, player_count, max_players, round, rounds, drawing_time, custom_words, wordpack, updated_at"
+
+func (d *DB) UpsertLobbyRegistration(registration *LobbyRegistration) error {
+	defer queryDuration.ObserveSince(time.Now(), "upsert_lobby_registration")
+
+	_, err := d.Executor.NamedExec(`INSERT INTO lobby_registry (`+lobbyRegistrationColumns+`) VALUES (:lobby_id, :instance_id, :instance_url, :public, :player_count, :max_players, :round, :rounds, :drawing_time, :custom_words, :wordpack, :updated_at)
+ON CONFLICT (lobby_id) DO UPDATE SET instance_id = :instance_id, instance_url = :instance_url, public = :public, player_count = :player_count, max_players = :max_players, round = :round, rounds = :rounds, drawing_time = :drawing_time, custom_words = :custom_words, wordpack = :wordpack, updated_at = :updated_at`, registration)
+	return err
+}
+
+func (d *DB) DeleteLobbyRegistration(lobbyId string) error {
+	defer queryDuration.ObserveSince(time.Now(), "delete_lobby_registration")
+
+	_, err := d.Executor.Exec("DELETE FROM lobby_registry WHERE lobby_id = $1", lobbyId)
+	return err
+}
+
+// GetLobbyRegistration returns the registration of a lobby, unless it hasn't
+// been updated since the given time. In that case nil is returned.
+func (d *DB) GetLobbyRegistration(lobbyId string, updatedAfter time.Time) (*LobbyRegistration, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_lobby_registration")
+
+	var registration LobbyRegistration
+	err := d.Executor.Get(&registration, "SELECT "+lobbyRegistrationColumns+" FROM lobby_registry WHERE lobby_id = $1 AND updated_at > $2", lobbyId, updatedAfter)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &registration, nil
+}
+
+// GetPublicLobbyRegistrations returns the public lobbies of all instances
+// except the given one, ignoring registrations not updated since the given
+// time.
+func (d *DB) GetPublicLobbyRegistrations(excludedInstanceId string, updatedAfter time.Time) ([]LobbyRegistration, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_public_lobby_registrations")
+
+	var registrations []LobbyRegistration
+	err := d.Executor.Select(&registrations, "SELECT "+lobbyRegistrationColumns+" FROM lobby_registry WHERE public AND instance_id != $1 AND updated_at > $2", excludedInstanceId, updatedAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	return registrations, nil
+}
+
+// GetLobbyRegistrations returns the lobbies of all instances except the given
+// one, including private ones, ignoring registrations not updated since the
+// given time.
+func (d *DB) GetLobbyRegistrations(excludedInstanceId string, updatedAfter time.Time) ([]LobbyRegistration, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_lobby_registrations")
+
+	var registrations []LobbyRegistration
+	err := d.Executor.Select(&registrations, "SELECT "+lobbyRegistrationColumns+" FROM lobby_registry WHERE instance_id != $1 AND updated_at > $2 ORDER BY instance_id, lobby_id", excludedInstanceId, updatedAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	return registrations, nil
+}
+
+// Listen subscribes to the given notification channel. The payloads are
+// delivered via the returned channel. An empty payload means that the
+// connection has been re-established and notifications might have been
+// missed.
+func (d *DB) Listen(channel string) (<-chan string, error) {
+	listener := pq.NewListener(d.url, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logging.Error("Database listener failed", "channel", channel, logging.KeyError, err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	payloads := make(chan string)
+	go func() {
+		for notification := range listener.Notify {
+			if notification == nil {
+				payloads <- ""
+			} else {
+				payloads <- notification.Extra
+			}
+		}
+	}()
+
+	return payloads, nil
+}
+
+// Notify sends a notification to everyone listening on the given channel.
+func (d *DB) Notify(channel, payload string) error {
+	defer queryDuration.ObserveSince(time.Now(), "notify")
+
+	_, err := d.Executor.Exec("SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// TokenStore persists Twitch tokens, so that they are available to all
+// instances. The users have to exist already.
+type TokenStore struct {
+	DB *DB
+	// EncryptionKey is used for encrypting the tokens at rest.
+	EncryptionKey []byte
+}
+
+func (s *TokenStore) Get(user *auth.User) (*twitch.TokenSet, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_twitch_tokens")
+
+	var row struct {
+		AccessToken          string         `db:"access_token"`
+		RefreshToken         string         `db:"refresh_token"`
+		FetchedAt            time.Time      `db:"fetched_at"`
+		AccessTokenExpiresAt time.Time      `db:"access_token_expires_at"`
+		Scopes               pq.StringArray `db:"scopes"`
+	}
+
+	err := s.DB.Executor.Get(&row, "SELECT access_token, refresh_token, fetched_at, access_token_expires_at, scopes FROM twitch_tokens WHERE user_id = $1", user.Id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := decrypt(s.EncryptionKey, row.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := decrypt(s.EncryptionKey, row.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &twitch.TokenSet{
+		AccessToken:          accessToken,
+		RefreshToken:         refreshToken,
+		FetchedAt:            row.FetchedAt,
+		AccessTokenExpiresAt: row.AccessTokenExpiresAt,
+		Scopes:               row.Scopes,
+	}, nil
+}
+
+func (s *TokenStore) Set(user *auth.User, tokens *twitch.TokenSet) error {
+	defer queryDuration.ObserveSince(time.Now(), "set_twitch_tokens")
+
+	accessToken, err := encrypt(s.EncryptionKey, tokens.AccessToken)
+	if err != nil {
+		return err
+	}
+	refreshToken, err := encrypt(s.EncryptionKey, tokens.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.Executor.Exec(`INSERT INTO twitch_tokens (user_id, access_token, refresh_token, fetched_at, access_token_expires_at, scopes) VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id) DO UPDATE SET access_token = $2, refresh_token = $3, fetched_at = $4, access_token_expires_at = $5, scopes = $6`,
+		user.Id, accessToken, refreshToken, tokens.FetchedAt, tokens.AccessTokenExpiresAt, pq.Array(tokens.Scopes))
+	return err
+}
+
+// SessionStore persists sessions, so that they can be revoked on all
+// instances and survive restarts. The users have to exist already.
+type SessionStore struct {
+	DB *DB
+}
+
+func (s *SessionStore) Create(session *auth.Session) error {
+	defer queryDuration.ObserveSince(time.Now(), "create_session")
+
+	//Expired sessions are useless, so we get rid of them here.
+	if _, err := s.DB.Executor.Exec("DELETE FROM sessions WHERE expires_at < NOW()"); err != nil {
+		return err
+	}
+	//Guests get a new identity on every login, so their users are useless
+	//once logged out, unless they created lobbies. Recently updated guests
+	//might be logging in right now and don't have a session yet.
+	if _, err := s.DB.Executor.Exec(`DELETE FROM users WHERE provider = 'guest' AND updated_at < NOW() - INTERVAL '1 hour'
+		AND NOT EXISTS (SELECT 1 FROM sessions WHERE user_id = users.id)
+		AND NOT EXISTS (SELECT 1 FROM lobbies WHERE user_id = users.id)`); err != nil {
+		return err
+	}
+
+	_, err := s.DB.Executor.Exec("INSERT INTO sessions (id, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)",
+		session.Id, session.UserId, session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+func (s *SessionStore) Get(id string) (*auth.Session, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_session")
+
+	var row struct {
+		Id        string    `db:"id"`
+		UserId    string    `db:"user_id"`
+		CreatedAt time.Time `db:"created_at"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+
+	err := s.DB.Executor.Get(&row, "SELECT id, user_id, created_at, expires_at FROM sessions WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &auth.Session{
+		Id:        row.Id,
+		UserId:    row.UserId,
+		CreatedAt: row.CreatedAt,
+		ExpiresAt: row.ExpiresAt,
+	}, nil
+}
+
+func (s *SessionStore) Extend(id string, expiresAt time.Time) error {
+	defer queryDuration.ObserveSince(time.Now(), "extend_session")
+
+	_, err := s.DB.Executor.Exec("UPDATE sessions SET expires_at = $2 WHERE id = $1", id, expiresAt)
+	return err
+}
+
+func (s *SessionStore) Revoke(id string) error {
+	defer queryDuration.ObserveSince(time.Now(), "revoke_session")
+
+	_, err := s.DB.Executor.Exec("DELETE FROM sessions WHERE id = $1", id)
+	return err
+}
+
+func (s *SessionStore) RevokeAll(userId string) error {
+	defer queryDuration.ObserveSince(time.Now(), "revoke_all_sessions")
+
+	_, err := s.DB.Executor.Exec("DELETE FROM sessions WHERE user_id = $1", userId)
+	return err
+}
+
+// APITokenStore persists the personal API tokens of users.
+type APITokenStore struct {
+	DB *DB
+}
+
+type apiTokenRow struct {
+	Id           string         `db:"id"`
+	UserId       string         `db:"user_id"`
+	UserName     string         `db:"user_name"`
+	UserProvider string         `db:"user_provider"`
+	Name         string         `db:"name"`
+	Scopes       pq.StringArray `db:"scopes"`
+	CreatedAt    time.Time      `db:"created_at"`
+}
+
+func (row *apiTokenRow) toAPIToken() *auth.APIToken {
+	return &auth.APIToken{
+		Id: row.Id,
+		User: auth.User{
+			Id:       row.UserId,
+			Name:     row.UserName,
+			Provider: row.UserProvider,
+		},
+		Name:      row.Name,
+		Scopes:    row.Scopes,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+const selectAPITokens = `SELECT t.id, t.user_id, u.name AS user_name, u.provider AS user_provider, t.name, t.scopes, t.created_at
+FROM api_tokens t JOIN users u ON u.id = t.user_id`
+
+func (s *APITokenStore) Create(token *auth.APIToken, hash string) error {
+	defer queryDuration.ObserveSince(time.Now(), "create_api_token")
+
+	_, err := s.DB.Executor.Exec("INSERT INTO api_tokens (id, user_id, name, token_hash, scopes, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		token.Id, token.User.Id, token.Name, hash, pq.Array(token.Scopes), token.CreatedAt)
+	return err
+}
+
+func (s *APITokenStore) GetByHash(hash string) (*auth.APIToken, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_api_token")
+
+	var row apiTokenRow
+	err := s.DB.Executor.Get(&row, selectAPITokens+" WHERE t.token_hash = $1", hash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return row.toAPIToken(), nil
+}
+
+func (s *APITokenStore) List(userId string) ([]*auth.APIToken, error) {
+	defer queryDuration.ObserveSince(time.Now(), "list_api_tokens")
+
+	var rows []apiTokenRow
+	if err := s.DB.Executor.Select(&rows, selectAPITokens+" WHERE t.user_id = $1 ORDER BY t.created_at", userId); err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*auth.APIToken, 0, len(rows))
+	for i := range rows {
+		tokens = append(tokens, rows[i].toAPIToken())
+	}
+	return tokens, nil
+}
+
+func (s *APITokenStore) Delete(userId, id string) error {
+	defer queryDuration.ObserveSince(time.Now(), "delete_api_token")
+
+	_, err := s.DB.Executor.Exec("DELETE FROM api_tokens WHERE id = $1 AND user_id = $2", id, userId)
+	return err
+}
+
+// WebhookStore persists webhooks and their delivery log.
+type WebhookStore struct {
+	DB *DB
+}
+
+// deliveryRetention is how long the delivery log is kept.
+const deliveryRetention = 7 * 24 * time.Hour
+
+type webhookRow struct {
+	Id        string         `db:"id"`
+	UserId    string         `db:"user_id"`
+	URL       string         `db:"url"`
+	Secret    string         `db:"secret"`
+	Events    pq.StringArray `db:"events"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (s *WebhookStore) Create(hook *webhook.Webhook) error {
+	defer queryDuration.ObserveSince(time.Now(), "create_webhook")
+
+	_, err := s.DB.Executor.Exec("INSERT INTO webhooks (id, user_id, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		hook.Id, hook.UserId, hook.URL, hook.Secret, pq.Array(hook.Events), hook.CreatedAt)
+	return err
+}
+
+func (s *WebhookStore) List(userId string) ([]*webhook.Webhook, error) {
+	defer queryDuration.ObserveSince(time.Now(), "list_webhooks")
+
+	var rows []webhookRow
+	if err := s.DB.Executor.Select(&rows, "SELECT id, user_id, url, secret, events, created_at FROM webhooks WHERE user_id = $1 ORDER BY created_at", userId); err != nil {
+		return nil, err
+	}
+
+	hooks := make([]*webhook.Webhook, 0, len(rows))
+	for _, row := range rows {
+		hooks = append(hooks, &webhook.Webhook{
+			Id:        row.Id,
+			UserId:    row.UserId,
+			URL:       row.URL,
+			Secret:    row.Secret,
+			Events:    row.Events,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return hooks, nil
+}
+
+func (s *WebhookStore) Delete(userId, id string) error {
+	defer queryDuration.ObserveSince(time.Now(), "delete_webhook")
+
+	_, err := s.DB.Executor.Exec("DELETE FROM webhooks WHERE id = $1 AND user_id = $2", id, userId)
+	return err
+}
+
+func (s *WebhookStore) AddDelivery(delivery *webhook.Delivery) error {
+	defer queryDuration.ObserveSince(time.Now(), "add_webhook_delivery")
+
+	//Old entries aren't interesting anymore, so we get rid of them here.
+	if _, err := s.DB.Executor.Exec("DELETE FROM webhook_deliveries WHERE created_at < $1", time.Now().Add(-deliveryRetention)); err != nil {
+		return err
+	}
+
+	_, err := s.DB.Executor.Exec(`INSERT INTO webhook_deliveries (id, attempt, webhook_id, event, status_code, error, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		delivery.Id, delivery.Attempt, delivery.WebhookId, delivery.Event, delivery.StatusCode, delivery.Error, delivery.CreatedAt)
+	return err
+}
+
+func (s *WebhookStore) ListDeliveries(userId string, limit int) ([]*webhook.Delivery, error) {
+	defer queryDuration.ObserveSince(time.Now(), "list_webhook_deliveries")
+
+	var rows []struct {
+		Id         string    `db:"id"`
+		WebhookId  string    `db:"webhook_id"`
+		Event      string    `db:"event"`
+		Attempt    int       `db:"attempt"`
+		StatusCode int       `db:"status_code"`
+		Error      string    `db:"error"`
+		CreatedAt  time.Time `db:"created_at"`
+	}
+	err := s.DB.Executor.Select(&rows, `SELECT d.id, d.webhook_id, d.event, d.attempt, d.status_code, d.error, d.created_at
+FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+WHERE w.user_id = $1 ORDER BY d.created_at DESC LIMIT $2`, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*webhook.Delivery, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, &webhook.Delivery{
+			Id:         row.Id,
+			WebhookId:  row.WebhookId,
+			Event:      row.Event,
+			Attempt:    row.Attempt,
+			StatusCode: row.StatusCode,
+			Error:      row.Error,
+			CreatedAt:  row.CreatedAt,
+		})
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// encryptedPrefix marks encrypted values. Values without it have been
+// stored before encryption was introduced and are returned as is.
+const encryptedPrefix = "enc1:"
+
+// newCipher derives an AES-256-GCM cipher from the configured key, so that
+// keys of any length can be used.
+func newCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, errors.New("no encryption key configured")
+	}
+
+	hashedKey := sha256.Sum256(key)
+	block, err := aes.NewCipher(hashedKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt returns the value encrypted with the key, encoded as text.
+func encrypt(key []byte, value string) (string, error) {
+	aead, err := newCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt reverses encrypt. Values that haven't been encrypted yet are
+// returned unchanged.
+func decrypt(key []byte, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+
+	aead, err := newCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
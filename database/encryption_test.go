@@ -0,0 +1,31 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_encrypt(t *testing.T) {
+	key := []byte("secret")
+	encrypted, err := encrypt(key, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted, "token") {
+		t.Error("Expected the value not to be stored in plaintext")
+	}
+
+	decrypted, err := decrypt(key, encrypted)
+	if err != nil || decrypted != "token" {
+		t.Errorf("Expected the value to be decrypted, but got '%s' (%v)", decrypted, err)
+	}
+
+	if _, err := decrypt([]byte("other"), encrypted); err == nil {
+		t.Error("Expected decrypting with another key to fail")
+	}
+
+	//Tokens stored before encryption was introduced stay readable.
+	if plain, err := decrypt(key, "token"); err != nil || plain != "token" {
+		t.Errorf("Expected unencrypted values to be returned as is, but got '%s' (%v)", plain, err)
+	}
+}
@@ -0,0 +1,7 @@
+package database
+
+import "github.com/scribble-rs/scribble.rs/metrics"
+
+var queryDuration = metrics.NewHistogram("scribblers_db_query_duration_seconds",
+	"Duration of database operations, including errors.",
+	metrics.LatencyBuckets, "query")
@@ -0,0 +1,9 @@
+CREATE TABLE channel_lists (
+    channel_id VARCHAR(100) NOT NULL,
+    list VARCHAR(10) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    user_name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (channel_id, list, user_id),
+    CONSTRAINT foreign_channel_id FOREIGN KEY (channel_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
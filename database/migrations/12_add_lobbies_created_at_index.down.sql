@@ -0,0 +1 @@
+DROP INDEX lobbies_created_at;
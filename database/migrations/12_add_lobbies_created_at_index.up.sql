@@ -0,0 +1 @@
+CREATE INDEX lobbies_created_at ON lobbies (created_at);
@@ -0,0 +1,4 @@
+CREATE TABLE task_runs (
+    task VARCHAR(100) PRIMARY KEY,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,14 @@
+CREATE TABLE drawings (
+    id VARCHAR(50) PRIMARY KEY NOT NULL,
+    lobby_id VARCHAR(50) NOT NULL,
+    channel_id VARCHAR(100) NOT NULL,
+    round INTEGER NOT NULL,
+    word VARCHAR NOT NULL,
+    drawer_id VARCHAR(100) NOT NULL,
+    drawer_name VARCHAR NOT NULL,
+    drawing JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT foreign_channel_id FOREIGN KEY (channel_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX drawings_lobby_id ON drawings (lobby_id);
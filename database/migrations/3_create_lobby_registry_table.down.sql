@@ -0,0 +1 @@
+DROP TABLE lobby_registry;
@@ -0,0 +1,16 @@
+CREATE TABLE lobby_registry (
+    lobby_id VARCHAR(50) PRIMARY KEY NOT NULL,
+    instance_id VARCHAR(100) NOT NULL,
+    instance_url VARCHAR NOT NULL,
+    public BOOLEAN NOT NULL,
+    player_count INTEGER NOT NULL,
+    max_players INTEGER NOT NULL,
+    round INTEGER NOT NULL,
+    rounds INTEGER NOT NULL,
+    drawing_time INTEGER NOT NULL,
+    custom_words BOOLEAN NOT NULL,
+    wordpack VARCHAR NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX lobby_registry_public ON lobby_registry (public, updated_at);
@@ -0,0 +1 @@
+DROP TABLE twitch_tokens;
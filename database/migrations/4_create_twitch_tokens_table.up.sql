@@ -0,0 +1,9 @@
+CREATE TABLE twitch_tokens (
+    user_id VARCHAR(100) PRIMARY KEY NOT NULL,
+    access_token VARCHAR NOT NULL,
+    refresh_token VARCHAR NOT NULL,
+    fetched_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    access_token_expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    scopes VARCHAR[] NOT NULL,
+    CONSTRAINT foreign_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN provider VARCHAR(20) NOT NULL DEFAULT 'twitch';
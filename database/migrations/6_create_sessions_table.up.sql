@@ -0,0 +1,8 @@
+CREATE TABLE sessions (
+    id VARCHAR(36) PRIMARY KEY NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT foreign_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX sessions_user_id_index ON sessions (user_id);
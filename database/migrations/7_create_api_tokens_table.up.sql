@@ -0,0 +1,10 @@
+CREATE TABLE api_tokens (
+    id VARCHAR(36) PRIMARY KEY NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes VARCHAR[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT foreign_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX api_tokens_user_id_index ON api_tokens (user_id);
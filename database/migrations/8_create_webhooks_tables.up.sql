@@ -0,0 +1,23 @@
+CREATE TABLE webhooks (
+    id VARCHAR(36) PRIMARY KEY NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    url VARCHAR(500) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events VARCHAR[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT foreign_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX webhooks_user_id_index ON webhooks (user_id);
+
+CREATE TABLE webhook_deliveries (
+    id VARCHAR(36) NOT NULL,
+    attempt INTEGER NOT NULL,
+    webhook_id VARCHAR(36) NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    status_code INTEGER NOT NULL,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (id, attempt),
+    CONSTRAINT foreign_webhook_id FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+CREATE INDEX webhook_deliveries_webhook_id_index ON webhook_deliveries (webhook_id, created_at);
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN chat_bot;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN chat_bot BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,50 @@
+package frontend
+
+import (
+	"net/http"
+
+	"github.com/scribble-rs/scribble.rs/api"
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+type adminPageData struct {
+	*AuthenticatedBasePageData
+	Locale  string
+	Lobbies []*game.LobbySummary
+	// RemoteLobbies are owned by other instances, requests concerning them
+	// are forwarded by the admin API.
+	RemoteLobbies []database.LobbyRegistration
+	RecentErrors  []logging.Entry
+}
+
+// ssrAdmin renders the dashboard for instance administrators. All actions
+// offered by the dashboard are performed via the admin API.
+func ssrAdmin(w http.ResponseWriter, r *http.Request, u auth.User) {
+	_, locale := determineTranslation(r)
+	pageData := &adminPageData{
+		AuthenticatedBasePageData: NewAuthenticatedBasePageData(api.RootPath, &u),
+		Locale:                    locale,
+		Lobbies:                   api.GetLobbySummaries(),
+		RemoteLobbies:             api.GetRemoteLobbies(),
+		RecentErrors:              logging.RecentErrors(),
+	}
+
+	templateError := pageTemplates.ExecuteTemplate(w, "admin-page", pageData)
+	if templateError != nil {
+		logging.Error("Failed templating admin page", logging.KeyUser, u.Id, logging.KeyError, templateError)
+	}
+}
+
+func requireAdminOrRedirect(a *auth.Service, h func(http.ResponseWriter, *http.Request, auth.User)) http.HandlerFunc {
+	return a.RequireAdmin(h, func(w http.ResponseWriter, r *http.Request, err error) {
+		if err == auth.ErrNotAdmin {
+			w.WriteHeader(http.StatusForbidden)
+			userFacingError(w, "You're not an administrator of this instance.")
+		} else {
+			loginPageRedirect(w, r, err)
+		}
+	})
+}
@@ -1,22 +1,24 @@
 package frontend
 
 import (
+	"github.com/julienschmidt/httprouter"
 	"github.com/scribble-rs/scribble.rs/api"
 	"github.com/scribble-rs/scribble.rs/auth"
 	"github.com/scribble-rs/scribble.rs/config"
 	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"github.com/scribble-rs/scribble.rs/translations"
-	"github.com/scribble-rs/scribble.rs/twitch"
-	"log"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 type AuthHandler struct {
-	db           *database.DB
-	authService  *auth.Service
-	twitchClient *twitch.Client
-	generateUrl  config.UrlGeneratorFunc
-	tokens       twitch.TokenStore
+	db          *database.DB
+	authService *auth.Service
+	generateUrl config.UrlGeneratorFunc
+	// providers are the enabled identity providers by name.
+	providers map[string]auth.Provider
 }
 
 type AuthenticatedBasePageData struct {
@@ -35,14 +37,24 @@ func NewAuthenticatedBasePageData(rootPath string, user *auth.User) *Authenticat
 
 type loginPageData struct {
 	BasePageConfig
-	Translation    translations.Translation
-	Locale         string
+	Translation translations.Translation
+	Locale      string
+	// Intended is the path to return to after logging in.
+	Intended string
+	// TwitchLoginURI and OIDCLoginURI are empty if the provider is disabled.
 	TwitchLoginURI string
+	OIDCLoginURI   string
+	// GuestLoginURI is the target of the guest login form. It's empty if
+	// guest logins are disabled.
+	GuestLoginURI string
+	Error         string
 }
 
 func (h *AuthHandler) ssrLogin(w http.ResponseWriter, r *http.Request) {
 	if h.authService.IsAuthenticated(r) {
-		h.authService.RemoveUserCookie(w)
+		if err := h.authService.Logout(w, r, false); err != nil {
+			logging.Error("Failed revoking session", logging.KeyError, err)
+		}
 	}
 
 	intended := ""
@@ -50,20 +62,73 @@ func (h *AuthHandler) ssrLogin(w http.ResponseWriter, r *http.Request) {
 		intended = r.URL.Query().Get("intended")
 	}
 
-	var authURI = h.twitchClient.GetAuthURI(h.generateUrl("/login_twitch_callback"), intended, &[]string{"user:read:subscriptions"})
+	h.renderLogin(w, r, intended, "")
+}
 
+func (h *AuthHandler) renderLogin(w http.ResponseWriter, r *http.Request, intended, errorMessage string) {
 	translation, locale := determineTranslation(r)
-	templateError := pageTemplates.ExecuteTemplate(w, "login-page", &loginPageData{
+	pageData := &loginPageData{
 		BasePageConfig: BasePageConfig{
 			RootPath: api.RootPath,
 		},
-		Translation:    translation,
-		Locale:         locale,
-		TwitchLoginURI: authURI,
-	})
+		Translation: translation,
+		Locale:      locale,
+		Intended:    intended,
+		Error:       errorMessage,
+	}
+
+	//Twitch is linked directly, as it doesn't require any state.
+	if provider, enabled := h.providers[auth.ProviderTwitch].(auth.RedirectProvider); enabled {
+		authURI, err := provider.AuthURI(w, h.callbackURI(auth.ProviderTwitch), intended)
+		if err != nil {
+			logging.Error("Failed creating Twitch auth URI", logging.KeyError, err)
+		} else {
+			pageData.TwitchLoginURI = authURI
+		}
+	}
+	if _, enabled := h.providers[auth.ProviderOIDC]; enabled {
+		params := url.Values{}
+		params.Add("intended", intended)
+		pageData.OIDCLoginURI = api.RootPath + "/login/" + auth.ProviderOIDC + "?" + params.Encode()
+	}
+	if _, enabled := h.providers[auth.ProviderGuest]; enabled {
+		pageData.GuestLoginURI = api.RootPath + "/login/" + auth.ProviderGuest + "/callback"
+	}
+
+	templateError := pageTemplates.ExecuteTemplate(w, "login-page", pageData)
 	if templateError != nil {
-		log.Println(templateError.Error())
+		logging.Error("Failed templating login page", logging.KeyError, templateError)
+	}
+}
+
+// callbackURI is the URI providers send the user back to. Twitch keeps its
+// original route, as it has to match the URI registered with Twitch.
+func (h *AuthHandler) callbackURI(providerName string) string {
+	if providerName == auth.ProviderTwitch {
+		return h.generateUrl("/login_twitch_callback")
 	}
+
+	return h.generateUrl("/login/" + providerName + "/callback")
+}
+
+// redirectToProvider starts the login at a provider that authenticates the
+// user on a different site.
+func (h *AuthHandler) redirectToProvider(w http.ResponseWriter, r *http.Request) {
+	providerName := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+	provider, isRedirectProvider := h.providers[providerName].(auth.RedirectProvider)
+	if !isRedirectProvider {
+		userFacingError(w, auth.ErrUnknownProvider.Error())
+		return
+	}
+
+	authURI, err := provider.AuthURI(w, h.callbackURI(providerName), r.URL.Query().Get("intended"))
+	if err != nil {
+		logging.Error("Failed creating auth URI", "provider", providerName, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	http.Redirect(w, r, authURI, http.StatusFound)
 }
 
 type logoutPageData struct {
@@ -72,8 +137,13 @@ type logoutPageData struct {
 	Locale      string
 }
 
+// ssrLogout ends the current session. If the "everywhere" form value is
+// posted, all sessions of the user are ended.
 func (h *AuthHandler) ssrLogout(w http.ResponseWriter, r *http.Request) {
-	_ = h.authService.RemoveUserCookie(w)
+	everywhere := r.Method == http.MethodPost && r.PostFormValue("everywhere") == "true"
+	if err := h.authService.Logout(w, r, everywhere); err != nil {
+		logging.Error("Failed revoking session", logging.KeyError, err)
+	}
 
 	pageTemplates.ExecuteTemplate(w, "logged-out", &logoutPageData{
 		BasePageConfig: BasePageConfig{
@@ -83,43 +153,59 @@ func (h *AuthHandler) ssrLogout(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) ssrTwitchCallback(w http.ResponseWriter, r *http.Request) {
-	if !r.URL.Query().Has("code") {
-		userFacingError(w, "No Twitch Code present in auth callback")
+	h.completeLogin(w, r, auth.ProviderTwitch)
+}
+
+func (h *AuthHandler) ssrCallback(w http.ResponseWriter, r *http.Request) {
+	h.completeLogin(w, r, httprouter.ParamsFromContext(r.Context()).ByName("provider"))
+}
+
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, providerName string) {
+	provider, enabled := h.providers[providerName]
+	if !enabled {
+		userFacingError(w, auth.ErrUnknownProvider.Error())
 		return
 	}
 
-	twitchUser, userTokens, verificationError := h.twitchClient.GetUserFromCode(r.URL.Query().Get("code"))
-	if verificationError != nil {
-		userFacingError(w, "Could not get user from Twitch Auth Code")
+	login, err := provider.Callback(w, r, h.callbackURI(providerName))
+	if err != nil {
+		logging.Warn("Login failed", "provider", providerName, logging.KeyError, err)
+		//Guests entered their nickname on our page, so they get to retry.
+		if providerName == auth.ProviderGuest {
+			h.renderLogin(w, r, r.FormValue("state"), err.Error())
+		} else {
+			userFacingError(w, "Could not log in: "+err.Error())
+		}
 		return
 	}
 
-	user := auth.User{
-		Id:   twitchUser.Id,
-		Name: twitchUser.DisplayName,
-	}
+	user := login.User
+	logger := logging.With(logging.KeyUser, user.Id, "provider", providerName)
 
-	err := h.tokens.Set(&user, userTokens)
-	if err != nil {
-		log.Printf("[ERR][tokens] Failed setting tokens for user %s", user)
+	//The user has to exist before the tokens, as they might be persisted.
+	upsertError := h.db.UpsertUser(user)
+	if upsertError != nil {
+		logger.Error("Failed upserting user", logging.KeyError, upsertError)
 	}
 
-	upsertError := h.db.UpsertUser(&user)
-	if upsertError != nil {
-		log.Printf("[ERR][DB] Failed upserting user %s: %v", user, upsertError)
+	if login.Persisted != nil {
+		if err := login.Persisted(); err != nil {
+			logger.Error("Failed persisting login", logging.KeyError, err)
+		}
 	}
 
-	cookieError := h.authService.SetUserCookie(w, &user)
+	cookieError := h.authService.SetUserCookie(w, user)
 	if cookieError != nil {
 		http.Error(w, cookieError.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("[INFO][AUTH] %s logged in successfully", user)
+	logger.Info("User logged in", "user_name", user.Name)
 
+	//Only local paths are allowed, as the state could be forged.
 	redirectPath := "/"
-	if r.URL.Query().Has("state") {
-		redirectPath = api.RootPath + r.URL.Query().Get("state")
+	if strings.HasPrefix(login.State, "/") && !strings.HasPrefix(login.State, "//") {
+		redirectPath = api.RootPath + login.State
 	}
 	http.Redirect(w, r, redirectPath, http.StatusFound)
 }
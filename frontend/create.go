@@ -5,11 +5,11 @@ import (
 	"github.com/scribble-rs/scribble.rs/config"
 	"github.com/scribble-rs/scribble.rs/database"
 	"github.com/scribble-rs/scribble.rs/twitch"
-	"log"
 	"net/http"
 
 	"github.com/scribble-rs/scribble.rs/api"
 	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"github.com/scribble-rs/scribble.rs/state"
 	"github.com/scribble-rs/scribble.rs/translations"
 )
@@ -32,7 +32,7 @@ func (h *CreateHandler) ssrCreateForm(w http.ResponseWriter, r *http.Request, u
 
 	err := pageTemplates.ExecuteTemplate(w, "lobby-create-page", createPageData)
 	if err != nil {
-		log.Printf("Error templating home page: %s\n", err)
+		logging.Error("Failed templating lobby creation page", logging.KeyUser, u.Id, logging.KeyError, err)
 	}
 }
 
@@ -47,6 +47,9 @@ func createDefaultLobbyCreatePageData(user *auth.User) *LobbyCreatePageData {
 		MaxPlayers:                "12",
 		CustomWordsChance:         "50",
 		Language:                  "swedish",
+		MinFollowDays:             "0",
+		MinSubTier:                "1",
+		JoinRule:                  string(game.JoinRuleAll),
 	}
 }
 
@@ -66,7 +69,13 @@ type LobbyCreatePageData struct {
 	CustomWordsChance string
 	Language          string
 	FollowersOnly     string
+	MinFollowDays     string
 	SubsOnly          string
+	MinSubTier        string
+	VipsOnly          string
+	AllowlistOnly     string
+	JoinRule          string
+	SaveDrawings      string
 }
 
 // ssrCreateLobby allows creating a lobby, optionally returning errors that
@@ -85,8 +94,8 @@ func (h *CreateHandler) ssrCreateLobby(w http.ResponseWriter, r *http.Request, u
 	customWords, customWordsInvalid := api.ParseCustomWords(r.Form.Get("custom_words"))
 	customWordChance, customWordChanceInvalid := api.ParseCustomWordsChance(r.Form.Get("custom_words_chance"))
 	publicLobby, publicLobbyInvalid := api.ParseBoolean("public", r.Form.Get("public"))
-	followersOnly, followersOnlyInvalid := api.ParseBoolean("followers_only", r.Form.Get("followers_only"))
-	subsOnly, subsOnlyInvalid := api.ParseBoolean("subs_only", r.Form.Get("subs_only"))
+	joinRules, joinRulesInvalid := api.ParseJoinRules(r.Form, game.JoinRules{})
+	saveDrawings, saveDrawingsInvalid := api.ParseBoolean("save_drawings", r.Form.Get("save_drawings"))
 
 	//Prevent resetting the form, since that would be annoying as hell.
 	pageData := LobbyCreatePageData{
@@ -101,7 +110,13 @@ func (h *CreateHandler) ssrCreateLobby(w http.ResponseWriter, r *http.Request, u
 		CustomWordsChance:         r.Form.Get("custom_words_chance"),
 		Language:                  r.Form.Get("language"),
 		FollowersOnly:             r.Form.Get("followers_only"),
+		MinFollowDays:             r.Form.Get("min_follow_days"),
 		SubsOnly:                  r.Form.Get("subs_only"),
+		MinSubTier:                r.Form.Get("min_sub_tier"),
+		VipsOnly:                  r.Form.Get("vips_only"),
+		AllowlistOnly:             r.Form.Get("allowlist_only"),
+		JoinRule:                  r.Form.Get("join_rule"),
+		SaveDrawings:              r.Form.Get("save_drawings"),
 	}
 
 	if languageInvalid != nil {
@@ -125,11 +140,11 @@ func (h *CreateHandler) ssrCreateLobby(w http.ResponseWriter, r *http.Request, u
 	if publicLobbyInvalid != nil {
 		pageData.Errors = append(pageData.Errors, publicLobbyInvalid.Error())
 	}
-	if followersOnlyInvalid != nil {
-		pageData.Errors = append(pageData.Errors, followersOnlyInvalid.Error())
+	for _, err := range joinRulesInvalid {
+		pageData.Errors = append(pageData.Errors, err.Error())
 	}
-	if subsOnlyInvalid != nil {
-		pageData.Errors = append(pageData.Errors, subsOnlyInvalid.Error())
+	if saveDrawingsInvalid != nil {
+		pageData.Errors = append(pageData.Errors, saveDrawingsInvalid.Error())
 	}
 
 	translation, locale := determineTranslation(r)
@@ -144,7 +159,7 @@ func (h *CreateHandler) ssrCreateLobby(w http.ResponseWriter, r *http.Request, u
 		return
 	}
 
-	_, lobby, createError := game.CreateLobby(h.db, &u, language, publicLobby, drawingTime, rounds, maxPlayers, customWordChance, customWords, followersOnly, subsOnly)
+	_, lobby, createError := game.CreateLobby(h.db, &u, language, publicLobby, drawingTime, rounds, maxPlayers, customWordChance, customWords, joinRules, saveDrawings)
 	if createError != nil {
 		pageData.Errors = append(pageData.Errors, createError.Error())
 		_ = pageTemplates.ExecuteTemplate(w, "lobby-create-page", pageData)
@@ -155,12 +170,13 @@ func (h *CreateHandler) ssrCreateLobby(w http.ResponseWriter, r *http.Request, u
 
 	//We only add the lobby if we could do all necessary pre-steps successfully.
 	state.AddLobby(lobby)
+	logger := lobby.Logger().With(logging.KeyUser, u.Id)
 	addLobbyErr := h.db.AddLobby(&u, lobby.LobbyID)
 	if addLobbyErr != nil {
-		log.Println(addLobbyErr.Error())
+		logger.Error("Failed persisting lobby", logging.KeyError, addLobbyErr)
 	}
 
-	log.Printf("[INFO] %s created lobby %v", u, lobby)
+	logger.Info("Lobby created")
 
 	http.Redirect(w, r, currentBasePageConfig.RootPath+"/lobbies/"+lobby.LobbyID+"/play", http.StatusFound)
 }
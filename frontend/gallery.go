@@ -0,0 +1,89 @@
+package frontend
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/scribble-rs/scribble.rs/api"
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/translations"
+)
+
+type GalleryHandler struct {
+	db *database.DB
+}
+
+type galleryPageData struct {
+	*BasePageConfig
+	Translation translations.Translation
+	Locale      string
+	LobbyID     string
+	Entries     []*game.GalleryEntry
+}
+
+type drawingPageData struct {
+	*BasePageConfig
+	Translation translations.Translation
+	Locale      string
+	Entry       *game.GalleryEntry
+}
+
+// ssrGallery shows all drawings of a lobby. This page stays available after
+// the lobby has been closed, as long as the drawings have been persisted.
+// While the lobby is open, recent drawings are only shown to the creator or
+// with the observer token in the "token" parameter.
+func (h *GalleryHandler) ssrGallery(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	lobbyID := httprouter.ParamsFromContext(r.Context()).ByName("lobbyId")
+	entries, err := api.GetGallery(h.db, lobbyID, user, r.URL.Query().Get("token"))
+	if err != nil {
+		if err == api.ErrLobbyNotExistent {
+			userFacingError(w, err.Error())
+		} else {
+			logging.Error("Failed getting gallery", logging.KeyLobby, lobbyID, logging.KeyError, err)
+			generalUserFacingError(w)
+		}
+		return
+	}
+
+	translation, locale := determineTranslation(r)
+	templateError := pageTemplates.ExecuteTemplate(w, "gallery-page", &galleryPageData{
+		BasePageConfig: currentBasePageConfig,
+		Translation:    translation,
+		Locale:         locale,
+		LobbyID:        lobbyID,
+		Entries:        entries,
+	})
+	if templateError != nil {
+		logging.Error("Failed templating gallery", logging.KeyError, templateError)
+	}
+}
+
+// ssrDrawing is the permalink page of a single drawing.
+func (h *GalleryHandler) ssrDrawing(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	params := httprouter.ParamsFromContext(r.Context())
+	drawingID := params.ByName("drawingId")
+	entry, err := api.GetGalleryEntry(h.db, params.ByName("lobbyId"), drawingID, user, r.URL.Query().Get("token"))
+	if err != nil {
+		if err == api.ErrDrawingNotExistent {
+			userFacingError(w, err.Error())
+		} else {
+			logging.Error("Failed getting drawing", "drawing_id", drawingID, logging.KeyError, err)
+			generalUserFacingError(w)
+		}
+		return
+	}
+
+	translation, locale := determineTranslation(r)
+	templateError := pageTemplates.ExecuteTemplate(w, "drawing-page", &drawingPageData{
+		BasePageConfig: currentBasePageConfig,
+		Translation:    translation,
+		Locale:         locale,
+		Entry:          entry,
+	})
+	if templateError != nil {
+		logging.Error("Failed templating drawing", "drawing_id", drawingID, logging.KeyError, templateError)
+	}
+}
@@ -4,17 +4,20 @@ import (
 	"embed"
 	"github.com/julienschmidt/httprouter"
 	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/chatbot"
 	"github.com/scribble-rs/scribble.rs/config"
 	"github.com/scribble-rs/scribble.rs/database"
 	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/moderation"
 	"github.com/scribble-rs/scribble.rs/twitch"
+	"github.com/scribble-rs/scribble.rs/webhook"
 	"html/template"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/scribble-rs/scribble.rs/api"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"github.com/scribble-rs/scribble.rs/translations"
 )
 
@@ -53,13 +56,16 @@ type BasePageConfig struct {
 }
 
 // SetupRoutes registers the official webclient endpoints with the router.
-func SetupRoutes(generateUrl config.UrlGeneratorFunc, r *httprouter.Router, a *auth.Service, t *twitch.Client, db *database.DB, g *game.Service, tokens twitch.TokenStore) {
+// Users can log in via any of the given providers.
+func SetupRoutes(generateUrl config.UrlGeneratorFunc, r *httprouter.Router, a *auth.Service, t *twitch.Client, db *database.DB, g *game.Service, tokens twitch.TokenStore, providers []auth.Provider, webhooks *webhook.Service, chatBot *chatbot.Bot, eventSub *twitch.EventSub, moderationSync *moderation.Sync) {
 	authHandler := &AuthHandler{
-		db:           db,
-		authService:  a,
-		twitchClient: t,
-		generateUrl:  generateUrl,
-		tokens:       tokens,
+		db:          db,
+		authService: a,
+		generateUrl: generateUrl,
+		providers:   make(map[string]auth.Provider, len(providers)),
+	}
+	for _, provider := range providers {
+		authHandler.providers[provider.Name()] = provider
 	}
 
 	createHandler := &CreateHandler{
@@ -68,15 +74,24 @@ func SetupRoutes(generateUrl config.UrlGeneratorFunc, r *httprouter.Router, a *a
 
 	settingsHandler := &SettingsHandler{
 		db:          db,
+		authService: a,
 		twitch:      t,
 		generateUrl: generateUrl,
 		tokens:      tokens,
+		webhooks:    webhooks,
+		chatBot:     chatBot,
+		eventSub:    eventSub,
+		moderation:  moderationSync,
 	}
 
 	joinHandler := &JoinHandler{
 		db: db,
 	}
 
+	galleryHandler := &GalleryHandler{
+		db: db,
+	}
+
 	lobbyHandler := &LobbyHandler{
 		gameService: g,
 	}
@@ -93,15 +108,40 @@ func SetupRoutes(generateUrl config.UrlGeneratorFunc, r *httprouter.Router, a *a
 
 	r.HandlerFunc("GET", "/login", authHandler.ssrLogin)
 	r.HandlerFunc("GET", "/logout", authHandler.ssrLogout)
+	r.HandlerFunc("POST", "/logout", authHandler.ssrLogout)
 	r.HandlerFunc("GET", "/login_twitch_callback", authHandler.ssrTwitchCallback)
+	r.HandlerFunc("GET", "/login/:provider", authHandler.redirectToProvider)
+	r.HandlerFunc("GET", "/login/:provider/callback", authHandler.ssrCallback)
+	r.HandlerFunc("POST", "/login/:provider/callback", authHandler.ssrCallback)
 
-	r.HandlerFunc("GET", "/lobbies", requireScopeMiddleware.Handler([]string{"user:read:subscriptions", "moderation:read"}, createHandler.ssrCreateForm))
-	r.HandlerFunc("POST", "/lobbies", requireScopeMiddleware.Handler([]string{"user:read:subscriptions", "moderation:read"}, createHandler.ssrCreateLobby))
+	r.HandlerFunc("GET", "/lobbies", requireScopeMiddleware.Handler([]string{"user:read:subscriptions", twitch.ModerationScope, twitch.VIPScope, twitch.FollowersScope}, createHandler.ssrCreateForm))
+	r.HandlerFunc("POST", "/lobbies", requireScopeMiddleware.Handler([]string{"user:read:subscriptions", twitch.ModerationScope, twitch.VIPScope, twitch.FollowersScope}, createHandler.ssrCreateLobby))
 	r.HandlerFunc("GET", "/lobbies/:lobbyId/play", requireScopeMiddleware.Handler([]string{"user:read:subscriptions"}, lobbyHandler.ssrEnterLobby))
 	r.HandlerFunc("GET", "/lobbies/:lobbyId/observe", lobbyHandler.ssrObserveLobby)
+	r.HandlerFunc("GET", "/lobbies/:lobbyId/overlay/:widget", lobbyHandler.ssrOverlay)
+	r.HandlerFunc("GET", "/lobbies/:lobbyId/gallery", a.CheckUser(galleryHandler.ssrGallery))
+	r.HandlerFunc("GET", "/lobbies/:lobbyId/drawings/:drawingId", a.CheckUser(galleryHandler.ssrDrawing))
+
+	r.HandlerFunc("GET", "/admin", requireAdminOrRedirect(a, ssrAdmin))
 
 	r.HandlerFunc("GET", "/settings", requireScopeMiddleware.Handler([]string{}, settingsHandler.ssrSettings))
-	r.HandlerFunc("GET", "/settings/sync", requireScopeMiddleware.Handler([]string{"moderation:read"}, settingsHandler.syncTwitchModSettings))
+	r.HandlerFunc("GET", "/settings/sync", requireScopeMiddleware.Handler([]string{twitch.ModerationScope, twitch.VIPScope}, settingsHandler.syncTwitchModSettings))
+	r.HandlerFunc("POST", "/settings/tokens", requireScopeMiddleware.Handler([]string{}, settingsHandler.createAPIToken))
+	r.HandlerFunc("POST", "/settings/tokens/:tokenId/delete", requireScopeMiddleware.Handler([]string{}, settingsHandler.deleteAPIToken))
+	r.HandlerFunc("POST", "/settings/webhooks", requireScopeMiddleware.Handler([]string{}, settingsHandler.createWebhook))
+	r.HandlerFunc("POST", "/settings/webhooks/:webhookId/delete", requireScopeMiddleware.Handler([]string{}, settingsHandler.deleteWebhook))
+	r.HandlerFunc("POST", "/settings/lists/:list", requireScopeMiddleware.Handler([]string{}, settingsHandler.addToChannelList))
+	r.HandlerFunc("POST", "/settings/lists/:list/:userId/delete", requireScopeMiddleware.Handler([]string{}, settingsHandler.removeFromChannelList))
+	r.HandlerFunc("POST", "/settings/permissions", requireScopeMiddleware.Handler([]string{}, settingsHandler.setPermissions))
+	//GET only exists as the target of the scope grant redirect and leads back to the settings.
+	r.HandlerFunc("GET", "/settings/chatbot/enable", requireScopeMiddleware.Handler(chatBot.RequiredScopes(), settingsHandler.redirectToSettings))
+	r.HandlerFunc("POST", "/settings/chatbot/enable", requireScopeMiddleware.Handler(chatBot.RequiredScopes(), settingsHandler.enableChatBot))
+	r.HandlerFunc("POST", "/settings/chatbot/disable", requireScopeMiddleware.Handler([]string{}, settingsHandler.disableChatBot))
+	if eventSub != nil {
+		r.HandlerFunc("GET", "/settings/channelpoints/enable", requireScopeMiddleware.Handler([]string{twitch.RedemptionScope}, settingsHandler.redirectToSettings))
+		r.HandlerFunc("POST", "/settings/channelpoints/enable", requireScopeMiddleware.Handler([]string{twitch.RedemptionScope}, settingsHandler.enableChannelPoints))
+		r.HandlerFunc("POST", "/settings/channelpoints/disable", requireScopeMiddleware.Handler([]string{}, settingsHandler.disableChannelPoints))
+	}
 
 	r.Handler("GET", "/resources/*path", http.StripPrefix(api.RootPath, http.FileServer(http.FS(frontendResourcesFS))))
 }
@@ -145,15 +185,21 @@ type RequireScopeMiddleware struct {
 
 func (m *RequireScopeMiddleware) Handler(scopes []string, nextHandler func(http.ResponseWriter, *http.Request, auth.User)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user, err := m.auth.GetUser(r)
+		user, err := m.auth.GetSessionUser(r)
 		if err != nil {
-			m.redirectAuth(w, r, scopes)
+			loginPageRedirect(w, r, err)
+			return
+		}
+
+		//Scopes only exist for Twitch, other users have nothing to grant.
+		if !user.IsTwitch() {
+			nextHandler(w, r, *user)
 			return
 		}
 
 		tokens, err := m.tokens.Get(user)
 		if err != nil {
-			log.Printf("[frontend/http][ERR] Failed getting tokens for user %s: %v", user, err)
+			logging.Error("Failed getting tokens", logging.KeyUser, user.Id, logging.KeyError, err)
 			userFacingError(w, "an error occurred")
 			return
 		} else if tokens == nil {
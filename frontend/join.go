@@ -5,9 +5,9 @@ import (
 	"github.com/scribble-rs/scribble.rs/api"
 	"github.com/scribble-rs/scribble.rs/auth"
 	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"github.com/scribble-rs/scribble.rs/state"
 	"github.com/scribble-rs/scribble.rs/translations"
-	"log"
 	"net/http"
 )
 
@@ -35,7 +35,7 @@ func (h JoinHandler) ssrJoinForm(w http.ResponseWriter, r *http.Request, u *auth
 
 	err := pageTemplates.ExecuteTemplate(w, "join-page", pageData)
 	if err != nil {
-		log.Println(err.Error())
+		logging.Error("Failed templating join page", logging.KeyError, err)
 	}
 }
 
@@ -54,11 +54,18 @@ func (h JoinHandler) join(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lobby := state.GetLobby(lobbyId)
-	if lobby == nil {
-		userFacingError(w, "User or lobby not found")
-		return
+	//Lobbies of other instances are handled by forwarding the redirected
+	//request to the owner.
+	if state.GetLobby(lobbyId) == nil {
+		registration, err := state.LocateLobby(lobbyId)
+		if err != nil {
+			logging.Error("Failed locating lobby", logging.KeyLobby, lobbyId, logging.KeyError, err)
+		}
+		if registration == nil {
+			userFacingError(w, "User or lobby not found")
+			return
+		}
 	}
 
-	http.Redirect(w, r, "/lobbies/"+lobby.LobbyID+"/play", http.StatusFound)
+	http.Redirect(w, r, "/lobbies/"+lobbyId+"/play", http.StatusFound)
 }
@@ -3,12 +3,11 @@ package frontend
 import (
 	"github.com/scribble-rs/scribble.rs/auth"
 	"github.com/scribble-rs/scribble.rs/game"
-	"log"
 	"net/http"
-	"strconv"
 	"strings"
 
 	"github.com/scribble-rs/scribble.rs/api"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"github.com/scribble-rs/scribble.rs/translations"
 	"golang.org/x/text/language"
 )
@@ -23,11 +22,12 @@ type lobbyPageData struct {
 
 	Translation translations.Translation
 	Locale      string
-}
-
-type observePageData struct {
-	*lobbyPageData
-	DelaySeconds int
+	// ObserverToken is only set for the creator, allowing them to observe
+	// the lobby without the observer delay.
+	ObserverToken string
+	// CanCast indicates whether the user may open the caster view, which
+	// reveals the word.
+	CanCast bool
 }
 
 type robotPageData struct {
@@ -49,30 +49,22 @@ func (h *LobbyHandler) ssrObserveLobby(w http.ResponseWriter, r *http.Request) {
 			LobbyData:      api.CreateLobbyData(lobby),
 		})
 		if templatingError != nil {
-			log.Printf("error templating robot page: %d\n", templatingError)
+			lobby.Logger().Error("Failed templating robot page", logging.KeyError, templatingError)
 		}
 		return
 	}
 
 	translation, locale := determineTranslation(r)
 
-	var delaySeconds int
-	delaySeconds, _ = strconv.Atoi(r.URL.Query().Get("delay"))
-
-	if delaySeconds < 0 {
-		delaySeconds = 0
-	}
-
-	var pageData *observePageData
+	//The delay and the observer token are passed to the websocket as they
+	//are, as the delay is applied by the server.
+	var pageData *lobbyPageData
 	lobby.Synchronized(func() {
-		pageData = &observePageData{
-			lobbyPageData: &lobbyPageData{
-				BasePageConfig: currentBasePageConfig,
-				LobbyData:      api.CreateLobbyData(lobby),
-				Translation:    translation,
-				Locale:         locale,
-			},
-			DelaySeconds: delaySeconds,
+		pageData = &lobbyPageData{
+			BasePageConfig: currentBasePageConfig,
+			LobbyData:      api.CreateLobbyData(lobby),
+			Translation:    translation,
+			Locale:         locale,
 		}
 	})
 
@@ -82,7 +74,7 @@ func (h *LobbyHandler) ssrObserveLobby(w http.ResponseWriter, r *http.Request) {
 	if pageData != nil {
 		templateError := pageTemplates.ExecuteTemplate(w, "lobby-observe-page", pageData)
 		if templateError != nil {
-			log.Printf("Error templating lobby: %s\n", templateError)
+			lobby.Logger().Error("Failed templating lobby page", logging.KeyError, templateError)
 		}
 	}
 }
@@ -102,7 +94,7 @@ func (h *LobbyHandler) ssrEnterLobby(w http.ResponseWriter, r *http.Request, u a
 			LobbyData:      api.CreateLobbyData(lobby),
 		})
 		if templatingError != nil {
-			log.Printf("error templating robot page: %d\n", templatingError)
+			lobby.Logger().Error("Failed templating robot page", logging.KeyError, templatingError)
 		}
 		return
 	}
@@ -116,13 +108,13 @@ func (h *LobbyHandler) ssrEnterLobby(w http.ResponseWriter, r *http.Request, u a
 		if player == nil {
 			canJoin, reason, err := h.gameService.CanJoin(&u, lobby)
 			if err != nil {
-				log.Printf("[ERR] Failed checking if %s can join %s: %v", u, lobby, err)
+				lobby.Logger().Error("Failed checking whether user can join", logging.KeyUser, u.Id, logging.KeyError, err)
 				userFacingError(w, "An error occurred")
 				return
 			}
 
 			if !canJoin {
-				log.Printf("[WARN] %s denied to join %s: %s", u, lobby, reason)
+				lobby.Logger().Warn("User denied to join", logging.KeyUser, u.Id, "reason", reason)
 				userFacingError(w, "You're not allowed to join: "+reason)
 				return
 			}
@@ -141,6 +133,10 @@ func (h *LobbyHandler) ssrEnterLobby(w http.ResponseWriter, r *http.Request, u a
 			Translation:    translation,
 			Locale:         locale,
 		}
+		if lobby.IsCreator(&u) {
+			pageData.ObserverToken = lobby.GetObserverToken()
+		}
+		pageData.CanCast = lobby.CanCast(&u)
 	})
 
 	//If the pagedata isn't initialized, it means the synchronized block has exited.
@@ -149,7 +145,7 @@ func (h *LobbyHandler) ssrEnterLobby(w http.ResponseWriter, r *http.Request, u a
 	if pageData != nil {
 		templateError := pageTemplates.ExecuteTemplate(w, "lobby-page", pageData)
 		if templateError != nil {
-			log.Printf("Error templating lobby: %s\n", templateError)
+			lobby.Logger().Error("Failed templating lobby page", logging.KeyError, templateError)
 		}
 	}
 }
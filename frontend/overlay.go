@@ -0,0 +1,122 @@
+package frontend
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/scribble-rs/scribble.rs/api"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/translations"
+)
+
+//Overlays are small pages meant to be used as browser sources in streaming
+//software. Each overlay shows a single widget on a transparent background
+//and is driven by the observer websocket. The query string is passed to the
+//websocket as it is, so "delay", "token" and "role" work the same way as for
+//the observe page.
+
+// overlayWidgets are all widgets that can be requested via the overlay route.
+var overlayWidgets = map[string]bool{
+	"scoreboard": true,
+	"timer":      true,
+	"wordhint":   true,
+	"guesses":    true,
+	"round":      true,
+}
+
+var (
+	namedColorPattern = regexp.MustCompile(`^[a-zA-Z]{1,32}$`)
+	hexColorPattern   = regexp.MustCompile(`^#?([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	fontPattern       = regexp.MustCompile(`^[a-zA-Z0-9 \-]{1,64}$`)
+)
+
+// overlayTheme is the styling of an overlay. All values are validated, as
+// they are inserted into CSS unescaped.
+type overlayTheme struct {
+	Color      template.CSS
+	Accent     template.CSS
+	Background template.CSS
+	Font       template.CSS
+	FontSize   int
+}
+
+type overlayPageData struct {
+	*BasePageConfig
+
+	LobbyID string
+	Widget  string
+	Theme   overlayTheme
+
+	Translation translations.Translation
+	Locale      string
+}
+
+// parseOverlayColor accepts hex colors, with or without a leading "#", and
+// named colors. Invalid values result in the fallback.
+func parseOverlayColor(value string, fallback template.CSS) template.CSS {
+	if hexColorPattern.MatchString(value) {
+		if value[0] != '#' {
+			value = "#" + value
+		}
+		return template.CSS(value)
+	}
+	if namedColorPattern.MatchString(value) {
+		return template.CSS(value)
+	}
+
+	return fallback
+}
+
+// parseOverlayTheme reads the theme from the query parameters "color",
+// "accent", "background", "font" and "size". Invalid values are ignored.
+func parseOverlayTheme(query url.Values) overlayTheme {
+	theme := overlayTheme{
+		Color:      parseOverlayColor(query.Get("color"), "white"),
+		Accent:     parseOverlayColor(query.Get("accent"), "#f8b500"),
+		Background: parseOverlayColor(query.Get("background"), "transparent"),
+		Font:       "Montserrat",
+		FontSize:   32,
+	}
+
+	if font := query.Get("font"); fontPattern.MatchString(font) {
+		theme.Font = template.CSS(font)
+	}
+	if size, err := strconv.Atoi(query.Get("size")); err == nil && size >= 8 && size <= 200 {
+		theme.FontSize = size
+	}
+
+	return theme
+}
+
+func (h *LobbyHandler) ssrOverlay(w http.ResponseWriter, r *http.Request) {
+	widget := httprouter.ParamsFromContext(r.Context()).ByName("widget")
+	if !overlayWidgets[widget] {
+		http.Error(w, "unknown overlay widget", http.StatusNotFound)
+		return
+	}
+
+	lobby, err := api.GetLobby(r)
+	if err != nil {
+		userFacingError(w, err.Error())
+		return
+	}
+
+	translation, locale := determineTranslation(r)
+	pageData := &overlayPageData{
+		BasePageConfig: currentBasePageConfig,
+		LobbyID:        lobby.LobbyID,
+		Widget:         widget,
+		Theme:          parseOverlayTheme(r.URL.Query()),
+		Translation:    translation,
+		Locale:         locale,
+	}
+
+	templateError := pageTemplates.ExecuteTemplate(w, "overlay-page", pageData)
+	if templateError != nil {
+		lobby.Logger().Error("Failed templating overlay page", "widget", widget, logging.KeyError, templateError)
+	}
+}
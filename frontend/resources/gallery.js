@@ -0,0 +1,108 @@
+//Renders finished drawings for the gallery pages. The drawing logic mirrors
+//the one of the lobby page, so that fills end up looking exactly the same.
+var gallery = (function () {
+    function renderDrawing(canvas, drawElements) {
+        const context = canvas.getContext("2d");
+        const scale = canvas.width / 1600;
+
+        context.fillStyle = "#FFFFFF";
+        context.fillRect(0, 0, canvas.width, canvas.height);
+
+        drawElements.forEach(drawElement => {
+            const drawData = drawElement.data;
+            if (drawElement.type === "fill") {
+                context.fillFlood(drawData.x * scale, drawData.y * scale, drawData.color);
+            } else if (drawElement.type === "line") {
+                drawLine(context, drawData.fromX * scale, drawData.fromY * scale,
+                    drawData.toX * scale, drawData.toY * scale, drawData.color, drawData.lineWidth * scale);
+            } else {
+                console.log("Unknown draw element type: " + drawElement.type);
+            }
+        });
+    }
+
+    function drawLine(context, x1, y1, x2, y2, color, lineWidth) {
+        x1 = Math.floor(x1);
+        y1 = Math.floor(y1);
+        x2 = Math.floor(x2);
+        y2 = Math.floor(y2);
+        lineWidth = Math.ceil(lineWidth);
+
+        const left = Math.max(0, Math.min(context.canvas.width, Math.min(x1, x2) - lineWidth));
+        const top = Math.max(0, Math.min(context.canvas.height, Math.min(y1, y2) - lineWidth));
+        const right = Math.max(0, Math.min(context.canvas.width, Math.max(x1, x2) + lineWidth));
+        const bottom = Math.max(0, Math.min(context.canvas.height, Math.max(y1, y2) + lineWidth));
+
+        if (right - left === 0 || bottom - top === 0) {
+            return;
+        }
+
+        const circleMap = generateCircleMap(Math.floor(lineWidth / 2));
+        const offset = Math.floor(circleMap.length / 2);
+        const imageData = context.getImageData(left, top, right - left, bottom - top);
+
+        for (let ix = 0; ix < circleMap.length; ix++) {
+            for (let iy = 0; iy < circleMap[ix].length; iy++) {
+                if (circleMap[ix][iy] === 1 || (x1 === x2 && y1 === y2 && circleMap[ix][iy] === 2)) {
+                    drawBresenhamLine(imageData, x1 + ix - offset - left, y1 + iy - offset - top,
+                        x2 + ix - offset - left, y2 + iy - offset - top, color);
+                }
+            }
+        }
+        context.putImageData(imageData, left, top);
+    }
+
+    function drawBresenhamLine(imageData, x1, y1, x2, y2, color) {
+        const dx = Math.abs(x2 - x1);
+        const dy = Math.abs(y2 - y1);
+        const sx = (x1 < x2) ? 1 : -1;
+        const sy = (y1 < y2) ? 1 : -1;
+        let err = dx - dy;
+
+        while (true) {
+            if (!(x1 < 0 || x1 >= imageData.width || y1 < 0 || y1 >= imageData.height)) {
+                const offset = (y1 * imageData.width + x1) * 4;
+                imageData.data[offset] = color.r;
+                imageData.data[offset + 1] = color.g;
+                imageData.data[offset + 2] = color.b;
+                imageData.data[offset + 3] = 255;
+            }
+
+            if ((x1 === x2) && (y1 === y2)) break;
+            const e2 = 2 * err;
+            if (e2 > -dy) {
+                err -= dy;
+                x1 += sx;
+            }
+            if (e2 < dx) {
+                err += dx;
+                y1 += sy;
+            }
+        }
+    }
+
+    function generateCircleMap(radius) {
+        const diameter = 2 * radius;
+        const circleData = new Array(diameter);
+
+        for (let x = 0; x < diameter; x++) {
+            circleData[x] = new Array(diameter);
+            for (let y = 0; y < diameter; y++) {
+                const distanceToRadius = Math.sqrt(Math.pow(radius - x, 2) + Math.pow(radius - y, 2));
+                if (distanceToRadius > radius) {
+                    circleData[x][y] = 0;
+                } else if (distanceToRadius < radius - 2) {
+                    circleData[x][y] = 2;
+                } else {
+                    circleData[x][y] = 1;
+                }
+            }
+        }
+
+        return circleData;
+    }
+
+    return {
+        renderDrawing: renderDrawing,
+    };
+})();
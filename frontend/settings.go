@@ -1,21 +1,39 @@
 package frontend
 
 import (
+	"fmt"
+	"github.com/julienschmidt/httprouter"
 	"github.com/scribble-rs/scribble.rs/api"
 	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/chatbot"
 	"github.com/scribble-rs/scribble.rs/config"
 	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/moderation"
+	"github.com/scribble-rs/scribble.rs/state"
 	"github.com/scribble-rs/scribble.rs/translations"
 	"github.com/scribble-rs/scribble.rs/twitch"
-	"log"
+	"github.com/scribble-rs/scribble.rs/webhook"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
+// maxListedDeliveries is the amount of webhook deliveries shown in the
+// settings.
+const maxListedDeliveries = 20
+
 type SettingsHandler struct {
 	db          *database.DB
+	authService *auth.Service
 	twitch      *twitch.Client
 	generateUrl config.UrlGeneratorFunc
 	tokens      twitch.TokenStore
+	webhooks    *webhook.Service
+	chatBot     *chatbot.Bot
+	eventSub    *twitch.EventSub
+	moderation  *moderation.Sync
 }
 
 type settingsPageData struct {
@@ -24,15 +42,128 @@ type settingsPageData struct {
 	Locale        string
 	Mods          *[]database.UserDigest
 	SyncTwitchUrl string
+	APITokens     []*auth.APIToken
+	// Scopes are the scopes that can be granted to API tokens.
+	Scopes     []string
+	Webhooks   []*webhook.Webhook
+	Deliveries []*webhook.Delivery
+	// WebhookEvents are the events webhooks can subscribe to.
+	WebhookEvents []string
+	// ChatBotEnabled is only relevant for Twitch users, as only their
+	// lobbies can be announced in a chat.
+	ChatBotEnabled bool
+	ChatBotCommand string
+	// ChannelPoints is nil if EventSub isn't configured or the user didn't
+	// log in via Twitch.
+	ChannelPoints *channelPointsSettings
+	// Allowlist and Blocklist are only relevant for Twitch users, as they
+	// are matched against Twitch users joining the lobbies of the channel.
+	Allowlist []database.UserDigest
+	Blocklist []database.UserDigest
+	// Permissions decide who may perform which action in the lobbies of
+	// the user.
+	Permissions game.Permissions
+	Actions     []game.Action
+	Roles       []game.Role
+	settingsFeedback
+}
+
+type channelPointsSettings struct {
+	Enabled bool
+	// Rewards are the titles of the rewards streamers have to create.
+	Rewards []string
+}
+
+// settingsFeedback is the result of a form submitted on the settings page.
+type settingsFeedback struct {
+	// NewAPIToken is only set right after creating a token, as it can't be
+	// retrieved later on.
+	NewAPIToken   string
+	APITokenError string
+	// NewWebhook is only set right after creating a webhook, so that its
+	// secret is only shown once.
+	NewWebhook   *webhook.Webhook
+	WebhookError string
+	// ChannelListError is set if a user couldn't be added to the allowlist
+	// or blocklist.
+	ChannelListError string
 }
 
 func (h *SettingsHandler) ssrSettings(w http.ResponseWriter, r *http.Request, u auth.User) {
+	h.renderSettings(w, r, u, settingsFeedback{})
+}
+
+func (h *SettingsHandler) renderSettings(w http.ResponseWriter, r *http.Request, u auth.User, feedback settingsFeedback) {
 	mods, err := h.db.GetModsForChannel(u.Id)
 	if err != nil {
 		generalUserFacingError(w)
 		return
 	}
 
+	var apiTokens []*auth.APIToken
+	if h.authService.APITokens != nil {
+		apiTokens, err = h.authService.APITokens.List(u.Id)
+		if err != nil {
+			logging.Error("Failed listing API tokens", logging.KeyUser, u.Id, logging.KeyError, err)
+			generalUserFacingError(w)
+			return
+		}
+	}
+
+	var webhooks []*webhook.Webhook
+	var deliveries []*webhook.Delivery
+	if h.webhooks != nil {
+		webhooks, err = h.webhooks.Store.List(u.Id)
+		if err == nil {
+			deliveries, err = h.webhooks.Store.ListDeliveries(u.Id, maxListedDeliveries)
+		}
+		if err != nil {
+			logging.Error("Failed listing webhooks", logging.KeyUser, u.Id, logging.KeyError, err)
+			generalUserFacingError(w)
+			return
+		}
+	}
+
+	var chatBotEnabled bool
+	if u.IsTwitch() {
+		chatBotEnabled, err = h.db.IsChatBotEnabled(u.Id)
+		if err != nil {
+			logging.Error("Failed checking chat bot settings", logging.KeyUser, u.Id, logging.KeyError, err)
+			generalUserFacingError(w)
+			return
+		}
+	}
+
+	var allowlist, blocklist []database.UserDigest
+	if u.IsTwitch() {
+		allowlist, err = h.db.GetChannelList(u.Id, database.ListAllow)
+		if err == nil {
+			blocklist, err = h.db.GetChannelList(u.Id, database.ListBlock)
+		}
+		if err != nil {
+			logging.Error("Failed listing channel lists", logging.KeyUser, u.Id, logging.KeyError, err)
+			generalUserFacingError(w)
+			return
+		}
+	}
+
+	permissions, err := game.LoadPermissions(h.db, u.Id)
+	if err != nil {
+		logging.Error("Failed loading permissions", logging.KeyUser, u.Id, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	var channelPoints *channelPointsSettings
+	if u.IsTwitch() && h.eventSub != nil {
+		channelPoints = &channelPointsSettings{Rewards: game.Rewards}
+		channelPoints.Enabled, err = h.eventSub.RedemptionsSubscribed(u.Id)
+		if err != nil {
+			//Twitch being unavailable shouldn't break the settings page.
+			logging.Warn("Failed checking EventSub subscriptions", logging.KeyUser, u.Id, logging.KeyError, err)
+		}
+	}
+
 	translation, locale := determineTranslation(r)
 
 	pageData := settingsPageData{
@@ -41,32 +172,262 @@ func (h *SettingsHandler) ssrSettings(w http.ResponseWriter, r *http.Request, u
 		Locale:                    locale,
 		Mods:                      mods,
 		SyncTwitchUrl:             h.generateUrl("/settings/sync"),
+		APITokens:                 apiTokens,
+		Scopes:                    auth.Scopes,
+		Webhooks:                  webhooks,
+		Deliveries:                deliveries,
+		ChatBotEnabled:            chatBotEnabled,
+		ChatBotCommand:            chatbot.Command,
+		ChannelPoints:             channelPoints,
+		Allowlist:                 allowlist,
+		Blocklist:                 blocklist,
+		Permissions:               permissions,
+		Actions:                   game.Actions,
+		Roles:                     game.Roles,
+		settingsFeedback:          feedback,
+	}
+	if h.webhooks != nil {
+		pageData.WebhookEvents = h.webhooks.Events
 	}
 
 	templateErr := pageTemplates.ExecuteTemplate(w, "settings-page", pageData)
 	if templateErr != nil {
-		log.Println(templateErr.Error())
+		logging.Error("Failed templating settings page", logging.KeyUser, u.Id, logging.KeyError, templateErr)
 	}
 }
 
 func (h *SettingsHandler) syncTwitchModSettings(w http.ResponseWriter, r *http.Request, u auth.User) {
+	if !u.IsTwitch() {
+		userFacingError(w, "Moderators can only be synced for Twitch accounts")
+		return
+	}
+
+	if err := h.moderation.SyncChannel(&u); err != nil {
+		logging.Error("Failed syncing channel", logging.KeyUser, u.Id, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+func (h *SettingsHandler) createAPIToken(w http.ResponseWriter, r *http.Request, u auth.User) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plainToken, _, err := h.authService.CreateAPIToken(&u, r.Form.Get("name"), r.Form["scope"])
+	if err != nil {
+		h.renderSettings(w, r, u, settingsFeedback{APITokenError: err.Error()})
+		return
+	}
+
+	logging.Info("API token created", logging.KeyUser, u.Id, "scopes", r.Form["scope"])
+	h.renderSettings(w, r, u, settingsFeedback{NewAPIToken: plainToken})
+}
+
+func (h *SettingsHandler) deleteAPIToken(w http.ResponseWriter, r *http.Request, u auth.User) {
+	tokenId := httprouter.ParamsFromContext(r.Context()).ByName("tokenId")
+	if err := h.authService.APITokens.Delete(u.Id, tokenId); err != nil {
+		logging.Error("Failed deleting API token", logging.KeyUser, u.Id, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+func (h *SettingsHandler) createWebhook(w http.ResponseWriter, r *http.Request, u auth.User) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newWebhook, err := h.webhooks.Create(u.Id, r.Form.Get("url"), r.Form["event"])
+	if err != nil {
+		h.renderSettings(w, r, u, settingsFeedback{WebhookError: err.Error()})
+		return
+	}
+
+	logging.Info("Webhook created", logging.KeyUser, u.Id, "webhook", newWebhook.Id, "events", newWebhook.Events)
+	h.renderSettings(w, r, u, settingsFeedback{NewWebhook: newWebhook})
+}
+
+func (h *SettingsHandler) deleteWebhook(w http.ResponseWriter, r *http.Request, u auth.User) {
+	webhookId := httprouter.ParamsFromContext(r.Context()).ByName("webhookId")
+	if err := h.webhooks.Store.Delete(u.Id, webhookId); err != nil {
+		logging.Error("Failed deleting webhook", logging.KeyUser, u.Id, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+func (h *SettingsHandler) redirectToSettings(w http.ResponseWriter, r *http.Request, u auth.User) {
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+func (h *SettingsHandler) enableChatBot(w http.ResponseWriter, r *http.Request, u auth.User) {
+	h.setChatBotEnabled(w, r, u, true)
+}
+
+func (h *SettingsHandler) disableChatBot(w http.ResponseWriter, r *http.Request, u auth.User) {
+	h.setChatBotEnabled(w, r, u, false)
+}
+
+func (h *SettingsHandler) setChatBotEnabled(w http.ResponseWriter, r *http.Request, u auth.User, enabled bool) {
+	if !u.IsTwitch() {
+		userFacingError(w, "The chat bot is only available for Twitch accounts")
+		return
+	}
+
+	if err := h.db.SetChatBotEnabled(u.Id, enabled); err != nil {
+		logging.Error("Failed changing chat bot settings", logging.KeyUser, u.Id, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	logging.Info("Chat bot settings changed", logging.KeyUser, u.Id, "enabled", enabled)
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+func (h *SettingsHandler) enableChannelPoints(w http.ResponseWriter, r *http.Request, u auth.User) {
+	if !u.IsTwitch() {
+		userFacingError(w, "Channel points are only available for Twitch accounts")
+		return
+	}
+
+	if err := h.eventSub.SubscribeRedemptions(u.Id); err != nil {
+		logging.Error("Failed subscribing to redemptions", logging.KeyUser, u.Id, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	logging.Info("Subscribed to redemptions", logging.KeyUser, u.Id)
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+func (h *SettingsHandler) disableChannelPoints(w http.ResponseWriter, r *http.Request, u auth.User) {
+	if err := h.eventSub.UnsubscribeRedemptions(u.Id); err != nil {
+		logging.Error("Failed unsubscribing from redemptions", logging.KeyUser, u.Id, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	logging.Info("Unsubscribed from redemptions", logging.KeyUser, u.Id)
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+// channelList returns the list named in the path, as the allowlist and the
+// blocklist share their handlers.
+func channelList(r *http.Request) (database.ChannelList, bool) {
+	list := database.ChannelList(httprouter.ParamsFromContext(r.Context()).ByName("list"))
+	return list, list == database.ListAllow || list == database.ListBlock
+}
+
+func (h *SettingsHandler) addToChannelList(w http.ResponseWriter, r *http.Request, u auth.User) {
+	if !u.IsTwitch() {
+		userFacingError(w, "Allowlists and blocklists are only available for Twitch accounts")
+		return
+	}
+
+	list, valid := channelList(r)
+	if !valid {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	login := strings.ToLower(strings.TrimSpace(r.Form.Get("login")))
+	if login == "" {
+		h.renderSettings(w, r, u, settingsFeedback{ChannelListError: "no Twitch user given"})
+		return
+	}
+
+	//Users are stored by ID, since Twitch users may change their login.
 	tokens, err := h.tokens.Get(&u)
+	if err != nil || tokens == nil {
+		generalUserFacingError(w)
+		return
+	}
+	users, err := h.twitch.GetUsers(tokens, url.Values{"login": {login}})
 	if err != nil {
+		logging.Error("Failed looking up Twitch user", logging.KeyUser, u.Id, logging.KeyError, err)
 		generalUserFacingError(w)
 		return
 	}
+	if len(users.Data) != 1 {
+		h.renderSettings(w, r, u, settingsFeedback{ChannelListError: fmt.Sprintf("Twitch user '%s' doesn't exist", login)})
+		return
+	}
 
-	mods, getModsErr := h.twitch.GetAllModerators(tokens, u.Id)
-	if getModsErr != nil {
+	user := database.UserDigest{Id: users.Data[0].Id, Name: users.Data[0].DisplayName}
+	if err := h.db.AddToChannelList(u.Id, list, user); err != nil {
+		logging.Error("Failed adding user to channel list", logging.KeyUser, u.Id, "list", list, logging.KeyError, err)
 		generalUserFacingError(w)
 		return
 	}
 
-	setModErr := h.db.SetModsForChannel(u.Id, mods)
-	if setModErr != nil {
+	//Running lobbies drop their cached blocklist lookups.
+	state.UpdateChannel(u.Id)
+
+	logging.Info("User added to channel list", logging.KeyUser, u.Id, "list", list, "listedUser", user.Id)
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+func (h *SettingsHandler) removeFromChannelList(w http.ResponseWriter, r *http.Request, u auth.User) {
+	list, valid := channelList(r)
+	if !valid {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := httprouter.ParamsFromContext(r.Context()).ByName("userId")
+	if err := h.db.RemoveFromChannelList(u.Id, list, userId); err != nil {
+		logging.Error("Failed removing user from channel list", logging.KeyUser, u.Id, "list", list, logging.KeyError, err)
 		generalUserFacingError(w)
 		return
 	}
 
+	state.UpdateChannel(u.Id)
+
+	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
+}
+
+// setPermissions saves the permissions submitted via the settings page. The
+// form contains the allowed roles for each action, where a missing action
+// means that only the creator may perform it.
+func (h *SettingsHandler) setPermissions(w http.ResponseWriter, r *http.Request, u auth.User) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	raw := make(map[string][]string, len(game.Actions))
+	for _, action := range game.Actions {
+		raw[string(action)] = r.Form[string(action)]
+	}
+	permissions, err := game.ParsePermissions(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.SetPermissions(u.Id, permissions.Serialize()); err != nil {
+		logging.Error("Failed saving permissions", logging.KeyUser, u.Id, logging.KeyError, err)
+		generalUserFacingError(w)
+		return
+	}
+
+	//Running lobbies apply the new permissions right away.
+	state.UpdateChannel(u.Id)
+
+	logging.Info("Permissions changed", logging.KeyUser, u.Id)
 	http.Redirect(w, r, h.generateUrl("/settings"), http.StatusFound)
 }
@@ -2,11 +2,16 @@ package frontend
 
 import (
 	"bytes"
+	"net/url"
 	"testing"
 
 	"github.com/scribble-rs/scribble.rs/api"
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
 	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"github.com/scribble-rs/scribble.rs/translations"
+	"github.com/scribble-rs/scribble.rs/webhook"
 )
 
 func Test_templateLobbyPage(t *testing.T) {
@@ -59,7 +64,7 @@ func Test_templateRobotPage(t *testing.T) {
 }
 
 func Test_templateLobbyCreatePage(t *testing.T) {
-	createPageData := createDefaultLobbyCreatePageData()
+	createPageData := createDefaultLobbyCreatePageData(&auth.User{Id: "1234", Name: "Owner"})
 	createPageData.Translation = translations.DefaultTranslation
 
 	var buffer bytes.Buffer
@@ -69,3 +74,168 @@ func Test_templateLobbyCreatePage(t *testing.T) {
 		t.Errorf("Error templating: %s", templatingError)
 	}
 }
+
+func Test_templateGalleryPage(t *testing.T) {
+	var buffer bytes.Buffer
+	templatingError := pageTemplates.ExecuteTemplate(&buffer,
+		"gallery-page", &galleryPageData{
+			BasePageConfig: currentBasePageConfig,
+			Translation:    translations.DefaultTranslation,
+			Locale:         "en-US",
+			LobbyID:        "TEST",
+			Entries: []*game.GalleryEntry{
+				{ID: "a", LobbyID: "TEST", Word: "abc", DrawerName: "Drawer"},
+			},
+		})
+	if templatingError != nil {
+		t.Errorf("Error templating: %s", templatingError)
+	}
+}
+
+func Test_templateDrawingPage(t *testing.T) {
+	var buffer bytes.Buffer
+	templatingError := pageTemplates.ExecuteTemplate(&buffer,
+		"drawing-page", &drawingPageData{
+			BasePageConfig: currentBasePageConfig,
+			Translation:    translations.DefaultTranslation,
+			Locale:         "en-US",
+			Entry:          &game.GalleryEntry{ID: "a", LobbyID: "TEST", Word: "abc", DrawerName: "Drawer"},
+		})
+	if templatingError != nil {
+		t.Errorf("Error templating: %s", templatingError)
+	}
+}
+
+func Test_templateAdminPage(t *testing.T) {
+	var buffer bytes.Buffer
+	templatingError := pageTemplates.ExecuteTemplate(&buffer,
+		"admin-page", &adminPageData{
+			AuthenticatedBasePageData: NewAuthenticatedBasePageData("", &auth.User{Id: "1", Name: "Admin"}),
+			Locale:                    "en-US",
+			Lobbies: []*game.LobbySummary{{
+				LobbyID: "abc",
+				Players: []game.PlayerSummary{{UserID: "2", Name: "Player"}},
+			}},
+			RemoteLobbies: []database.LobbyRegistration{{LobbyId: "def", InstanceId: "other"}},
+			RecentErrors:  []logging.Entry{{Message: "Failed", Fields: map[string]interface{}{"error": "oops"}}},
+		})
+	if templatingError != nil {
+		t.Errorf("Error templating: %s", templatingError)
+	}
+}
+
+func Test_templateOverlayPage(t *testing.T) {
+	for widget := range overlayWidgets {
+		var buffer bytes.Buffer
+		templatingError := pageTemplates.ExecuteTemplate(&buffer,
+			"overlay-page", &overlayPageData{
+				BasePageConfig: &BasePageConfig{
+					RootPath: "root",
+				},
+				LobbyID:     "abc",
+				Widget:      widget,
+				Theme:       parseOverlayTheme(url.Values{"color": {"ff0000"}}),
+				Translation: translations.DefaultTranslation,
+			})
+		if templatingError != nil {
+			t.Errorf("Error templating %s overlay: %s", widget, templatingError)
+		}
+	}
+}
+
+func Test_parseOverlayTheme(t *testing.T) {
+	theme := parseOverlayTheme(url.Values{
+		"color":      {"ff0000"},
+		"accent":     {"gold"},
+		"background": {"red;}body{display:none"},
+		"font":       {"Comic Sans MS"},
+		"size":       {"1000"},
+	})
+
+	if theme.Color != "#ff0000" {
+		t.Errorf("expected hex color to be prefixed, but got %s", theme.Color)
+	}
+	if theme.Accent != "gold" {
+		t.Errorf("expected named color to be kept, but got %s", theme.Accent)
+	}
+	if theme.Background != "transparent" {
+		t.Errorf("expected invalid color to be ignored, but got %s", theme.Background)
+	}
+	if theme.Font != "Comic Sans MS" {
+		t.Errorf("expected font to be kept, but got %s", theme.Font)
+	}
+	if theme.FontSize != 32 {
+		t.Errorf("expected out of range size to be ignored, but got %d", theme.FontSize)
+	}
+}
+
+func Test_templateLoginPage(t *testing.T) {
+	var buffer bytes.Buffer
+	templatingError := pageTemplates.ExecuteTemplate(&buffer,
+		"login-page", &loginPageData{
+			BasePageConfig: *currentBasePageConfig,
+			Translation:    translations.DefaultTranslation,
+			Locale:         "en-US",
+			Intended:       "/lobbies",
+			TwitchLoginURI: "https://id.twitch.tv/oauth2/authorize",
+			OIDCLoginURI:   "/login/oidc",
+			GuestLoginURI:  "/login/guest/callback",
+			Error:          "the nickname must not be empty",
+		})
+	if templatingError != nil {
+		t.Errorf("Error templating: %s", templatingError)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`action="/login/guest/callback"`)) {
+		t.Error("Guest login form missing")
+	}
+}
+
+func Test_templateSettingsPage(t *testing.T) {
+	var buffer bytes.Buffer
+	templatingError := pageTemplates.ExecuteTemplate(&buffer,
+		"settings-page", &settingsPageData{
+			AuthenticatedBasePageData: NewAuthenticatedBasePageData("", &auth.User{Id: "1", Name: "User", Provider: auth.ProviderTwitch}),
+			Translation:               translations.DefaultTranslation,
+			Locale:                    "en-US",
+			Mods:                      &[]database.UserDigest{},
+			APITokens:                 []*auth.APIToken{{Id: "token", Name: "Bot", Scopes: auth.Scopes}},
+			Scopes:                    auth.Scopes,
+			Webhooks:                  []*webhook.Webhook{{Id: "webhook", URL: "https://example.com", Events: game.EventTypes}},
+			Deliveries: []*webhook.Delivery{
+				{Id: "1", Event: game.EventGameOver, Attempt: 1, StatusCode: 503, Error: "unexpected status"},
+				{Id: "1", Event: game.EventGameOver, Attempt: 2, StatusCode: 200},
+			},
+			WebhookEvents:  game.EventTypes,
+			ChatBotEnabled: true,
+			ChannelPoints:  &channelPointsSettings{Rewards: game.Rewards},
+			Blocklist:      []database.UserDigest{{Id: "42", Name: "Troll"}},
+			Permissions:    game.Permissions{game.ActionKick: {game.RoleVIP}},
+			Actions:        game.Actions,
+			Roles:          game.Roles,
+			settingsFeedback: settingsFeedback{
+				NewAPIToken: "srs_secret",
+				NewWebhook:  &webhook.Webhook{Secret: "webhook_secret"},
+			},
+		})
+	if templatingError != nil {
+		t.Errorf("Error templating: %s", templatingError)
+	}
+	for _, secret := range []string{"srs_secret", "webhook_secret"} {
+		if !bytes.Contains(buffer.Bytes(), []byte(secret)) {
+			t.Errorf("New secret %s isn't shown", secret)
+		}
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`action="/settings/chatbot/disable"`)) {
+		t.Error("Enabled chat bot can't be disabled")
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(game.RewardBonusHint)) {
+		t.Error("Channel point rewards aren't listed")
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`action="/settings/lists/block/42/delete"`)) {
+		t.Error("Blocked user can't be removed")
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`name="kick" value="vip" checked`)) ||
+		bytes.Contains(buffer.Bytes(), []byte(`name="kick" value="mod" checked`)) {
+		t.Error("Configured permissions aren't shown")
+	}
+}
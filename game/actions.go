@@ -0,0 +1,175 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+)
+
+// actionEvents are the events requesting an Action.
+var actionEvents = map[string]Action{
+	"start":               ActionStart,
+	"skip":                ActionSkip,
+	"pause":               ActionPause,
+	"kick":                ActionKick,
+	"mute":                ActionMute,
+	"clear-drawing-board": ActionClearCanvas,
+}
+
+// handleActionEvent performs the action requested by the event if the user
+// is allowed to. Unauthorized requests are ignored, as clients only offer
+// allowed actions. The return value indicates whether the event requested
+// an action at all. The lobby has to be locked.
+func (lobby *Lobby) handleActionEvent(user *auth.User, received *GameEvent) (bool, error) {
+	action, isAction := actionEvents[received.Type]
+	if !isAction {
+		return false, nil
+	}
+
+	if !lobby.isAllowed(user, action) {
+		return true, nil
+	}
+
+	switch action {
+	case ActionStart:
+		lobby.start()
+	case ActionSkip:
+		lobby.skip(user)
+	case ActionPause:
+		lobby.togglePause(user)
+	case ActionClearCanvas:
+		lobby.clearCanvas()
+	case ActionKick, ActionMute:
+		targetID, isString := (received.Data).(string)
+		if !isString {
+			return true, fmt.Errorf("invalid data in %s event: %v", received.Type, received.Data)
+		}
+
+		if action == ActionKick {
+			handleKickEvent(lobby, user, targetID)
+		} else {
+			lobby.toggleMute(user, targetID)
+		}
+	}
+
+	return true, nil
+}
+
+// start starts the game anew, unless it's already ongoing.
+func (lobby *Lobby) start() {
+	if lobby.State == Ongoing {
+		return
+	}
+
+	//We are reseting each players score, since players could
+	//technically be player a second game after the last one
+	//has already ended.
+	for _, otherPlayer := range lobby.players {
+		otherPlayer.Score = 0
+		otherPlayer.LastScore = 0
+		//Since nobody has any points in the beginning, everyone has practically
+		//the same rank, therefore y'll winners for now.
+		otherPlayer.Rank = 1
+	}
+
+	lobby.resetViewerScores()
+
+	//Cause advanceLobby to start at round 1, starting the game anew.
+	lobby.Round = 0
+
+	lobby.emitEvent(EventGameStarted, &GameStartedEvent{
+		Rounds:  lobby.Rounds,
+		Players: summarizePlayers(lobby.players),
+	})
+	advanceLobby(lobby)
+}
+
+// skip ends the current turn, for example if the drawer is AFK.
+func (lobby *Lobby) skip(user *auth.User) {
+	if lobby.State != Ongoing || (lobby.Phase != PhaseChoosing && lobby.Phase != PhaseDrawing) {
+		return
+	}
+
+	lobby.TriggerUpdateEvent("system-message", fmt.Sprintf("%s skipped the turn.", user.Name))
+	advanceLobby(lobby)
+}
+
+// togglePause stops or resumes the time of the current turn. Turns can only
+// be paused while the drawer chooses or draws, as the intermission is short
+// anyway.
+func (lobby *Lobby) togglePause(user *auth.User) {
+	if lobby.paused {
+		lobby.paused = false
+		lobby.RoundEndTime = lobby.getTimeAsMillis() + lobby.pausedTimeLeft
+		lobby.scheduleTick()
+		lobby.recordObservedProgress()
+		lobby.TriggerUpdateEvent("resumed", int(lobby.pausedTimeLeft))
+		lobby.TriggerUpdateEvent("system-message", fmt.Sprintf("%s resumed the turn.", user.Name))
+		return
+	}
+
+	if lobby.State != Ongoing || (lobby.Phase != PhaseChoosing && lobby.Phase != PhaseDrawing) {
+		return
+	}
+
+	if lobby.turnTimer != nil {
+		lobby.turnTimer.Stop()
+		lobby.turnTimer = nil
+	}
+	lobby.paused = true
+	lobby.pausedTimeLeft = lobby.RoundEndTime - lobby.getTimeAsMillis()
+	lobby.recordObservedProgress()
+	lobby.TriggerUpdateEvent("paused", int(lobby.pausedTimeLeft))
+	lobby.TriggerUpdateEvent("system-message", fmt.Sprintf("%s paused the turn.", user.Name))
+}
+
+// timeLeft returns the milliseconds left in the current turn.
+func (lobby *Lobby) timeLeft() int64 {
+	if lobby.paused {
+		return lobby.pausedTimeLeft
+	}
+	return lobby.RoundEndTime - lobby.getTimeAsMillis()
+}
+
+// clearCanvas clears the canvas on behalf of someone other than the drawer,
+// for example to remove an inappropriate drawing.
+func (lobby *Lobby) clearCanvas() {
+	if len(lobby.currentDrawing) == 0 {
+		return
+	}
+
+	lobby.ClearDrawing()
+	lobby.resetStrokes()
+	lobby.TriggerUpdateEvent("clear-drawing-board", nil)
+}
+
+// toggleMute hides or shows the chat messages of the given player.
+func (lobby *Lobby) toggleMute(user *auth.User, targetID string) {
+	target := lobby.getPlayerByID(targetID)
+	if target == nil || target.ID == user.Id || lobby.isProtected(user, target) {
+		return
+	}
+
+	target.Muted = !target.Muted
+	if target.Muted {
+		lobby.TriggerUpdateEvent("system-message", fmt.Sprintf("%s has been muted.", target.Name))
+	} else {
+		lobby.TriggerUpdateEvent("system-message", fmt.Sprintf("%s has been unmuted.", target.Name))
+	}
+	lobby.triggerPlayersUpdate()
+}
+
+// isProtected indicates whether the target is protected from being kicked
+// or muted by the user. Only the creator can kick or mute mods.
+func (lobby *Lobby) isProtected(user *auth.User, target *Player) bool {
+	return lobby.IsCreator(target.user) || (lobby.IsMod(target.user) && !lobby.IsCreator(user))
+}
+
+func (lobby *Lobby) getPlayerByID(id string) *Player {
+	for _, player := range lobby.players {
+		if player.ID == id {
+			return player
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package game
+
+// LobbySummary is a snapshot of a lobby, containing everything administrators
+// need in order to judge what's going on.
+type LobbySummary struct {
+	LobbyID       string          `json:"lobbyId"`
+	OwnerID       string          `json:"ownerId"`
+	OwnerName     string          `json:"ownerName"`
+	Public        bool            `json:"public"`
+	State         gameState       `json:"state"`
+	Phase         TurnPhase       `json:"phase"`
+	Round         int             `json:"round"`
+	Rounds        int             `json:"rounds"`
+	Players       []PlayerSummary `json:"players"`
+	ObserverCount int             `json:"observerCount"`
+}
+
+// PlayerSummary identifies a player by their user, as opposed to the player
+// ID, which is only known inside the lobby.
+type PlayerSummary struct {
+	UserID    string `json:"userId"`
+	Name      string `json:"name"`
+	Score     int    `json:"score"`
+	Connected bool   `json:"connected"`
+}
+
+// Summarize creates a LobbySummary. The owner is the user that created the
+// lobby, as that is the channel the lobby belongs to.
+func (lobby *Lobby) Summarize() *LobbySummary {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	summary := &LobbySummary{
+		LobbyID:       lobby.LobbyID,
+		Public:        lobby.Public,
+		State:         lobby.State,
+		Phase:         lobby.Phase,
+		Round:         lobby.Round,
+		Rounds:        lobby.Rounds,
+		Players:       summarizePlayers(lobby.players),
+		ObserverCount: lobby.GetConnectedObserverCount(),
+	}
+	if lobby.creator != nil {
+		summary.OwnerID = lobby.creator.user.Id
+		summary.OwnerName = lobby.creator.user.Name
+	}
+
+	return summary
+}
+
+// KickUser kicks the player of the given user, bypassing the permission
+// checks that apply to players kicking each other. This is reserved for
+// instance admins, see Kick otherwise. If the user isn't part of the lobby,
+// false is returned.
+func (lobby *Lobby) KickUser(userID string) bool {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	for index, player := range lobby.players {
+		if player.user.Id == userID {
+			sendKickEvent(lobby, player)
+			kickPlayer(lobby, player, index)
+			return true
+		}
+	}
+
+	return false
+}
+
+// SendSystemMessage shows the given message to all players and observers.
+func (lobby *Lobby) SendSystemMessage(message string) {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	lobby.TriggerUpdateEvent("system-message", message)
+}
@@ -0,0 +1,317 @@
+package game
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// BinaryProtocol is the websocket sub-protocol a client can request in order
+// to send and receive drawing events in a compact binary format instead of
+// JSON. All other events are still sent as JSON text messages.
+//
+// Each binary message starts with a message type byte:
+//
+//	0x01 draw:    the contained records are drawn on top of the canvas.
+//	0x02 drawing: the canvas is cleared and the records are drawn. This is
+//	              the binary counterpart of the "drawing" event.
+//
+// The message type is followed by any number of records, each starting with
+// a record type byte:
+//
+//	0x01 stroke: strokeId (uvarint), color, lineWidth (uvarint),
+//	             pointCount (uvarint, >= 2), x (varint), y (varint),
+//	             followed by pointCount-1 pairs of dx (varint), dy (varint).
+//	0x02 fill:   strokeId (uvarint), color, x (varint), y (varint).
+//
+// Coordinates and line widths are rounded to whole units of the base canvas
+// size. Colors are a single index into BinaryPalette or binaryCustomColor
+// followed by the red, green and blue bytes. A stroke with n points
+// represents n-1 connected "line" events. Clients only ever send "draw"
+// messages.
+const BinaryProtocol = "scribblers-binary-v1"
+
+const (
+	binaryDrawMessage    byte = 0x01
+	binaryDrawingMessage byte = 0x02
+
+	binaryStrokeRecord byte = 0x01
+	binaryFillRecord   byte = 0x02
+
+	binaryCustomColor byte = 0xFF
+)
+
+// BinaryPalette contains the colors offered by the official client. These can
+// be sent as a single byte in the binary protocol.
+var BinaryPalette = []RGBColor{
+	{R: 0xff, G: 0xff, B: 0xff}, {R: 0xc1, G: 0xc1, B: 0xc1}, {R: 0xef, G: 0x13, B: 0x0b},
+	{R: 0xff, G: 0x71, B: 0x00}, {R: 0xff, G: 0xe4, B: 0x00}, {R: 0x00, G: 0xcc, B: 0x00},
+	{R: 0x00, G: 0xb2, B: 0xff}, {R: 0x23, G: 0x1f, B: 0xd3}, {R: 0xa3, G: 0x00, B: 0xba},
+	{R: 0xd3, G: 0x7c, B: 0xaa}, {R: 0xa0, G: 0x52, B: 0x2d}, {R: 0x59, G: 0x2f, B: 0x2a},
+	{R: 0xec, G: 0xbc, B: 0xb4}, {R: 0x00, G: 0x00, B: 0x00}, {R: 0x4c, G: 0x4c, B: 0x4c},
+	{R: 0x74, G: 0x0b, B: 0x07}, {R: 0xc2, G: 0x38, B: 0x00}, {R: 0xe8, G: 0xa2, B: 0x00},
+	{R: 0x00, G: 0x55, B: 0x10}, {R: 0x00, G: 0x56, B: 0x9e}, {R: 0x0e, G: 0x08, B: 0x65},
+	{R: 0x55, G: 0x00, B: 0x69}, {R: 0xa7, G: 0x55, B: 0x74}, {R: 0x63, G: 0x30, B: 0x0d},
+	{R: 0x49, G: 0x2f, B: 0x31}, {R: 0xd1, G: 0xa3, B: 0xa4},
+}
+
+var errBinaryMessageTruncated = errors.New("binary message is truncated")
+
+// EncodeBinaryEvent encodes line, fill and drawing events for clients using
+// the BinaryProtocol. The boolean indicates whether the event has a binary
+// representation at all. If it doesn't, it has to be sent as JSON.
+func EncodeBinaryEvent(event interface{}) ([]byte, bool) {
+	switch typed := event.(type) {
+	case *LineEvent:
+		return encodeBinaryMessage(binaryDrawMessage, []interface{}{typed}), true
+	case *FillEvent:
+		return encodeBinaryMessage(binaryDrawMessage, []interface{}{typed}), true
+	case GameEvent:
+		return encodeBinaryGameEvent(&typed)
+	case *GameEvent:
+		return encodeBinaryGameEvent(typed)
+	}
+
+	return nil, false
+}
+
+func encodeBinaryGameEvent(event *GameEvent) ([]byte, bool) {
+	if event.Type != "drawing" {
+		return nil, false
+	}
+
+	elements, isDrawing := event.Data.([]interface{})
+	if !isDrawing {
+		return nil, false
+	}
+
+	return encodeBinaryMessage(binaryDrawingMessage, elements), true
+}
+
+// strokeBatch collects connected lines, so they can be sent as one record.
+type strokeBatch struct {
+	strokeID  uint32
+	color     RGBColor
+	lineWidth uint64
+	points    []int64
+}
+
+func encodeBinaryMessage(messageType byte, elements []interface{}) []byte {
+	buffer := make([]byte, 0, 16+len(elements)*4)
+	buffer = append(buffer, messageType)
+
+	var batch *strokeBatch
+	flush := func() {
+		if batch != nil {
+			buffer = appendStrokeRecord(buffer, batch)
+			batch = nil
+		}
+	}
+
+	for _, element := range elements {
+		switch typed := element.(type) {
+		case *LineEvent:
+			line := typed.Data
+			fromX, fromY := quantize(line.FromX), quantize(line.FromY)
+			lineWidth := uint64(quantize(line.LineWidth))
+			if batch != nil && batch.strokeID == line.StrokeID && batch.color == line.Color &&
+				batch.lineWidth == lineWidth &&
+				batch.points[len(batch.points)-2] == fromX && batch.points[len(batch.points)-1] == fromY {
+				batch.points = append(batch.points, quantize(line.ToX), quantize(line.ToY))
+				continue
+			}
+
+			flush()
+			batch = &strokeBatch{
+				strokeID:  line.StrokeID,
+				color:     line.Color,
+				lineWidth: lineWidth,
+				points:    []int64{fromX, fromY, quantize(line.ToX), quantize(line.ToY)},
+			}
+		case *FillEvent:
+			flush()
+			buffer = append(buffer, binaryFillRecord)
+			buffer = appendUvarint(buffer, uint64(typed.Data.StrokeID))
+			buffer = appendColor(buffer, typed.Data.Color)
+			buffer = appendVarint(buffer, quantize(typed.Data.X))
+			buffer = appendVarint(buffer, quantize(typed.Data.Y))
+		}
+	}
+	flush()
+
+	return buffer
+}
+
+func appendStrokeRecord(buffer []byte, batch *strokeBatch) []byte {
+	buffer = append(buffer, binaryStrokeRecord)
+	buffer = appendUvarint(buffer, uint64(batch.strokeID))
+	buffer = appendColor(buffer, batch.color)
+	buffer = appendUvarint(buffer, batch.lineWidth)
+	buffer = appendUvarint(buffer, uint64(len(batch.points)/2))
+	buffer = appendVarint(buffer, batch.points[0])
+	buffer = appendVarint(buffer, batch.points[1])
+	for i := 2; i < len(batch.points); i += 2 {
+		buffer = appendVarint(buffer, batch.points[i]-batch.points[i-2])
+		buffer = appendVarint(buffer, batch.points[i+1]-batch.points[i-1])
+	}
+	return buffer
+}
+
+func appendColor(buffer []byte, color RGBColor) []byte {
+	for index, paletteColor := range BinaryPalette {
+		if paletteColor == color {
+			return append(buffer, byte(index))
+		}
+	}
+
+	return append(buffer, binaryCustomColor, color.R, color.G, color.B)
+}
+
+func appendUvarint(buffer []byte, value uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	return append(buffer, scratch[:binary.PutUvarint(scratch[:], value)]...)
+}
+
+func appendVarint(buffer []byte, value int64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	return append(buffer, scratch[:binary.PutVarint(scratch[:], value)]...)
+}
+
+func quantize(value float32) int64 {
+	return int64(math.Round(float64(value)))
+}
+
+// DecodeBinaryMessage decodes a "draw" message sent by a client using the
+// BinaryProtocol. The resulting events are of type "line" or "fill" and
+// contain *Line or *Fill data respectively.
+func DecodeBinaryMessage(data []byte) ([]*GameEvent, error) {
+	if len(data) == 0 {
+		return nil, errBinaryMessageTruncated
+	}
+
+	if data[0] != binaryDrawMessage {
+		return nil, fmt.Errorf("unsupported binary message type %d", data[0])
+	}
+
+	reader := &binaryReader{data: data[1:]}
+	var events []*GameEvent
+	for len(reader.data) > 0 {
+		recordType := reader.byte()
+		strokeID := reader.uvarint()
+		if strokeID > math.MaxUint32 {
+			return nil, fmt.Errorf("stroke id %d is out of range", strokeID)
+		}
+		color := reader.color()
+
+		switch recordType {
+		case binaryStrokeRecord:
+			lineWidth := reader.uvarint()
+			pointCount := reader.uvarint()
+			if pointCount < 2 {
+				return nil, fmt.Errorf("stroke must consist of at least two points, but had %d", pointCount)
+			}
+			//Each delta takes at least two bytes, so we can reject bogus
+			//counts before allocating anything.
+			if reader.err == nil && pointCount-1 > uint64(len(reader.data))/2 {
+				return nil, errBinaryMessageTruncated
+			}
+
+			x, y := reader.varint(), reader.varint()
+			for i := uint64(1); i < pointCount && reader.err == nil; i++ {
+				toX, toY := x+reader.varint(), y+reader.varint()
+				events = append(events, &GameEvent{Type: "line", Data: &Line{
+					FromX:     float32(x),
+					FromY:     float32(y),
+					ToX:       float32(toX),
+					ToY:       float32(toY),
+					Color:     color,
+					LineWidth: float32(lineWidth),
+					StrokeID:  uint32(strokeID),
+				}})
+				x, y = toX, toY
+			}
+		case binaryFillRecord:
+			x, y := reader.varint(), reader.varint()
+			events = append(events, &GameEvent{Type: "fill", Data: &Fill{
+				X:        float32(x),
+				Y:        float32(y),
+				Color:    color,
+				StrokeID: uint32(strokeID),
+			}})
+		default:
+			return nil, fmt.Errorf("unsupported binary record type %d", recordType)
+		}
+
+		if reader.err != nil {
+			return nil, reader.err
+		}
+	}
+
+	return events, nil
+}
+
+// binaryReader reads from a binary message, remembering the first error, so
+// that it only has to be checked once per record.
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *binaryReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = errBinaryMessageTruncated
+		return 0
+	}
+
+	value := r.data[0]
+	r.data = r.data[1:]
+	return value
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	value, read := binary.Uvarint(r.data)
+	if read <= 0 {
+		r.err = errBinaryMessageTruncated
+		return 0
+	}
+
+	r.data = r.data[read:]
+	return value
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+
+	value, read := binary.Varint(r.data)
+	if read <= 0 {
+		r.err = errBinaryMessageTruncated
+		return 0
+	}
+
+	r.data = r.data[read:]
+	return value
+}
+
+func (r *binaryReader) color() RGBColor {
+	index := r.byte()
+	if index == binaryCustomColor {
+		return RGBColor{R: r.byte(), G: r.byte(), B: r.byte()}
+	}
+
+	if r.err == nil && int(index) >= len(BinaryPalette) {
+		r.err = fmt.Errorf("color index %d is out of range", index)
+		return RGBColor{}
+	}
+
+	return BinaryPalette[index]
+}
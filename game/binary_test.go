@@ -0,0 +1,133 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func createTestStroke(strokeID uint32, points int) []interface{} {
+	elements := make([]interface{}, 0, points)
+	for i := 0; i < points; i++ {
+		elements = append(elements, &LineEvent{Type: "line", Data: &Line{
+			FromX:     float32(100 + i*3),
+			FromY:     float32(200 - i*2),
+			ToX:       float32(100 + (i+1)*3),
+			ToY:       float32(200 - (i+1)*2),
+			Color:     RGBColor{R: 0xef, G: 0x13, B: 0x0b},
+			LineWidth: 8,
+			StrokeID:  strokeID,
+		}})
+	}
+	return elements
+}
+
+func Test_binaryRoundTrip(t *testing.T) {
+	elements := createTestStroke(7, 5)
+	elements = append(elements, &FillEvent{Type: "fill", Data: &Fill{
+		X:        -5,
+		Y:        900,
+		Color:    RGBColor{R: 1, G: 2, B: 3},
+		StrokeID: 8,
+	}})
+
+	encoded := encodeBinaryMessage(binaryDrawMessage, elements)
+	decoded, err := DecodeBinaryMessage(encoded)
+	if err != nil {
+		t.Fatalf("error decoding message: %s", err)
+	}
+
+	if len(decoded) != len(elements) {
+		t.Fatalf("expected %d events, but got %d", len(elements), len(decoded))
+	}
+
+	for index, event := range decoded[:5] {
+		expected := elements[index].(*LineEvent).Data
+		line, isLine := event.Data.(*Line)
+		if event.Type != "line" || !isLine {
+			t.Fatalf("event %d should've been a line, but was %v", index, event)
+		}
+		if *line != *expected {
+			t.Errorf("line %d was %v, but should've been %v", index, *line, *expected)
+		}
+	}
+
+	fill, isFill := decoded[5].Data.(*Fill)
+	if decoded[5].Type != "fill" || !isFill {
+		t.Fatalf("last event should've been a fill, but was %v", decoded[5])
+	}
+	if *fill != *elements[5].(*FillEvent).Data {
+		t.Errorf("fill was %v, but should've been %v", *fill, *elements[5].(*FillEvent).Data)
+	}
+}
+
+func Test_binaryBatchesConnectedLines(t *testing.T) {
+	connected := encodeBinaryMessage(binaryDrawMessage, createTestStroke(1, 10))
+	separate := 0
+	for _, element := range createTestStroke(1, 10) {
+		separate += len(encodeBinaryMessage(binaryDrawMessage, []interface{}{element}))
+	}
+
+	if len(connected) >= separate/2 {
+		t.Errorf("connected stroke took %d bytes, separate lines took %d bytes", len(connected), separate)
+	}
+}
+
+func Test_binaryEncodesOnlyDrawingEvents(t *testing.T) {
+	if _, isBinary := EncodeBinaryEvent(GameEvent{Type: "message", Data: "hello"}); isBinary {
+		t.Error("message event shouldn't have a binary representation")
+	}
+
+	data, isBinary := EncodeBinaryEvent(&GameEvent{Type: "drawing", Data: createTestStroke(1, 2)})
+	if !isBinary {
+		t.Fatal("drawing event should have a binary representation")
+	}
+	if data[0] != binaryDrawingMessage {
+		t.Errorf("drawing event had message type %d", data[0])
+	}
+}
+
+func Test_binaryDecodeInvalid(t *testing.T) {
+	valid := encodeBinaryMessage(binaryDrawMessage, createTestStroke(1, 3))
+	invalidMessages := map[string][]byte{
+		"empty":             {},
+		"drawing message":   {binaryDrawingMessage},
+		"truncated":         valid[:len(valid)-1],
+		"unknown record":    {binaryDrawMessage, 0x09, 0x01, 0x00},
+		"color index":       {binaryDrawMessage, binaryFillRecord, 0x01, 0x80, 0x00, 0x00},
+		"single point":      {binaryDrawMessage, binaryStrokeRecord, 0x01, 0x00, 0x08, 0x01, 0x00, 0x00},
+		"bogus point count": {binaryDrawMessage, binaryStrokeRecord, 0x01, 0x00, 0x08, 0xFF, 0xFF, 0x03, 0x00, 0x00},
+	}
+
+	for name, message := range invalidMessages {
+		t.Run(name, func(t *testing.T) {
+			if _, err := DecodeBinaryMessage(message); err == nil {
+				t.Error("expected an error, but got none")
+			}
+		})
+	}
+}
+
+func BenchmarkEncode_JSONDrawing(b *testing.B) {
+	event := &GameEvent{Type: "drawing", Data: createTestStroke(1, 100)}
+	var size int
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(event)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/msg")
+}
+
+func BenchmarkEncode_BinaryDrawing(b *testing.B) {
+	event := &GameEvent{Type: "drawing", Data: createTestStroke(1, 100)}
+	var size int
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, _ := EncodeBinaryEvent(event)
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/msg")
+}
@@ -1,8 +1,11 @@
 package game
 
 import (
+	"crypto/subtle"
 	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/clock"
 	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"sync"
 	"time"
 
@@ -27,17 +30,29 @@ type Lobby struct {
 	// screw with the score calculation of the current turn.
 	DrawingTimeNew int
 
-	RequireFollow     bool
-	RequireSubscribed bool
+	// SaveDrawings defines whether the drawings of finished turns are
+	// persisted, allowing their permalinks to outlive the lobby.
+	SaveDrawings bool
 
 	CustomWords []string
 	words       []string
+	// suggestedWords have been suggested by viewers via channel points.
+	// One of them is offered to each drawer until none are left.
+	suggestedWords []string
+	// playerQueue are the IDs of users that redeemed a seat via channel
+	// points, allowing them to join even if the lobby is full.
+	playerQueue []string
 
 	// players references all participants of the Lobby.
 	players []*Player
 
 	// observers references all observers of the Lobby
 	observers []*Observer
+	// viewers are the scores of participating observers by user ID.
+	viewers map[string]*Viewer
+	// observedTurns are the recent turns as seen by observers, see
+	// observedTurn.
+	observedTurns []*observedTurn
 
 	// Whether the game has started, is ongoing or already over.
 	State gameState
@@ -50,6 +65,9 @@ type Lobby struct {
 	// are set to the same player. While the owner can change throughout the
 	// game, the creator can't.
 	creator *Player
+	// observerToken allows observers to skip the ObserverDelay, which is
+	// meant for the creator's own stream overlay.
+	observerToken string
 	// CurrentWord represents the word that was last selected. If no word has
 	// been selected yet or the round is already over, this should be empty.
 	CurrentWord string
@@ -71,24 +89,57 @@ type Lobby struct {
 	// RoundEndTime represents the time at which the current round will end.
 	// This is a UTC unix-timestamp in milliseconds.
 	RoundEndTime int64
-
-	timeLeftTicker        *time.Ticker
+	// drawingStartedAt is the time at which the drawer chose the word. It's
+	// only used for metrics.
+	drawingStartedAt time.Time
+
+	// Phase is the current part of the turn lifecycle.
+	Phase TurnPhase
+	// intermission is the time between two turns. See TurnIntermission.
+	intermission time.Duration
+	// eventListener is notified about events. See EventListener.
+	eventListener func(event *Event)
+	// intermissionTimer starts the next turn once the intermission is over.
+	intermissionTimer clock.Timer
+	// nextDrawer and nextTurnStartsRound describe the turn that will be
+	// started after the intermission.
+	nextDrawer          *Player
+	nextTurnStartsRound bool
+
+	// turnTimer ticks every second while a turn is ongoing, revealing hints
+	// and ending the turn once the time is up.
+	turnTimer             clock.Timer
 	scoreEarnedByGuessers int
+	// paused indicates that the turnTimer has been stopped. pausedTimeLeft
+	// are the milliseconds left in the turn once it's resumed.
+	paused         bool
+	pausedTimeLeft int64
+	// relayed are the drawing events yet to be relayed to everyone except
+	// relaySender, see relayDrawing. relayTimer flushes them.
+	relayed     []interface{}
+	relaySender *Player
+	relayTimer  clock.Timer
 	// currentDrawing represents the state of the current canvas. The elements
 	// consist of LineEvent and FillEvent. Please do not modify the contents
 	// of this array an only move AppendLine and AppendFill on the respective
 	// lobby object.
 	currentDrawing []interface{}
+	// gallery contains the drawings of all finished turns.
+	gallery []*GalleryEntry
 
 	// These variables are used to define the ranges of connected drawing events.
 	// For example a line that has been drawn or a fill that has been executed.
-	// Since we can't trust the client to tell us this, we use the time passed
-	// between draw events as an indicator of which draw events make up one line.
+	// Clients can tag their draw events with a stroke ID, which tells us
+	// exactly which draw events make up one line. For clients that don't,
+	// we use the time passed between draw events as an indicator instead.
 	// An alternative approach could be using the coordinates and see if they are
 	// connected, but that could technically undo a whole drawing.
 
-	lastDrawEvent                 time.Time
-	connectedDrawEventsIndexStack []int
+	lastDrawEvent time.Time
+	strokes       []stroke
+	// undoneStrokes are the strokes that can be restored via "redo". Drawing
+	// anything new discards them.
+	undoneStrokes []undoneStroke
 
 	lowercaser cases.Caser
 
@@ -98,15 +149,73 @@ type Lobby struct {
 
 	KickedUsers []auth.User
 
+	// permissions are configured by the creator's channel. See
+	// Lobby.isAllowed.
+	permissions Permissions
+	// mods caches the IDs of the moderators of the creator's channel, as
+	// they are needed for most permission checks. It's loaded on first use
+	// and reset by InvalidateMods.
+	mods map[string]bool
+	// vips caches the IDs of the VIPs of the creator's channel, just like
+	// mods.
+	vips map[string]bool
+	// banned caches whether users are banned or blocked from the creator's
+	// channel, as participating observers are checked on every message.
+	// It's reset by InvalidateMods.
+	banned map[string]bool
+
 	mutex *sync.Mutex
+	// clock is used for all timing of the game. If nil, clock.Real is used.
+	clock clock.Clock
 
 	WriteJSON func(player *SocketConnection, object interface{}) error
 }
 
+func (lobby *Lobby) getClock() clock.Clock {
+	if lobby.clock == nil {
+		return clock.Real
+	}
+	return lobby.clock
+}
+
 func (lobby Lobby) String() string {
 	return lobby.LobbyID
 }
 
+// Logger returns a logger that attaches the lobby ID to all entries.
+func (lobby *Lobby) Logger() *logging.Logger {
+	return logging.With(logging.KeyLobby, lobby.LobbyID)
+}
+
+// PlayerLogger returns a logger that attaches both the lobby ID and the user
+// ID of the given player to all entries.
+func (lobby *Lobby) PlayerLogger(player *Player) *logging.Logger {
+	return lobby.Logger().With(logging.KeyUser, player.user.Id)
+}
+
+// GetCreator returns the user that opened the lobby. The lobby belongs to
+// their channel.
+func (lobby *Lobby) GetCreator() *auth.User {
+	return lobby.creator.GetUser()
+}
+
+// IsCreator checks whether the given user opened the lobby.
+func (lobby *Lobby) IsCreator(user *auth.User) bool {
+	return user != nil && lobby.creator != nil && lobby.creator.user.Id == user.Id
+}
+
+// GetObserverToken returns the token that allows observing the lobby without
+// the ObserverDelay. It must only be handed to the creator.
+func (lobby *Lobby) GetObserverToken() string {
+	return lobby.observerToken
+}
+
+// IsObserverToken checks whether the given token matches the lobbies observer
+// token.
+func (lobby *Lobby) IsObserverToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(lobby.observerToken)) == 1
+}
+
 // EditableLobbySettings represents all lobby settings that are editable by
 // the lobby owner after the lobby has already been opened.
 type EditableLobbySettings struct {
@@ -127,6 +236,14 @@ type EditableLobbySettings struct {
 	// Rounds defines how many iterations a lobby does before the game ends.
 	// One iteration means every participant does one drawing.
 	Rounds int `json:"rounds"`
+	// ObserverDelay is the minimum amount of seconds that events are held
+	// back from observers, preventing stream sniping.
+	ObserverDelay int `json:"observerDelay"`
+	// ObserverParticipation allows authenticated observers to chat with each
+	// other and to guess for a separate score.
+	ObserverParticipation bool `json:"observerParticipation"`
+
+	JoinRules
 }
 
 type gameState string
@@ -141,6 +258,30 @@ const (
 	GameOver gameState = "gameOver"
 )
 
+// TurnPhase is the part of the turn lifecycle the lobby is currently in.
+// Transitions are triggered by player actions or by timers, but never by
+// waiting while holding the lobby lock.
+type TurnPhase string
+
+const (
+	// PhaseUnstarted means that no turn has been started yet.
+	PhaseUnstarted TurnPhase = "unstarted"
+	// PhaseChoosing means that the drawer has to choose a word.
+	PhaseChoosing TurnPhase = "choosing"
+	// PhaseDrawing means that the word has been chosen and can be guessed.
+	PhaseDrawing TurnPhase = "drawing"
+	// PhaseIntermission means that the turn is over and the results are
+	// shown until the next turn starts.
+	PhaseIntermission TurnPhase = "intermission"
+	// PhaseGameOver means that the last turn of the last round is over.
+	PhaseGameOver TurnPhase = "gameOver"
+)
+
+// TurnIntermission is the time between the end of a turn and the start of
+// the next one, giving players time to look at the results. Changes only
+// affect lobbies created afterwards.
+var TurnIntermission = 5 * time.Second
+
 // WordHint describes a character of the word that is to be guessed, whether
 // the character should be shown and whether it should be underlined on the
 // UI.
@@ -164,6 +305,10 @@ type Line struct {
 	ToY       float32  `json:"toY"`
 	Color     RGBColor `json:"color"`
 	LineWidth float32  `json:"lineWidth"`
+	// StrokeID optionally identifies the stroke this line belongs to. All
+	// lines of one stroke share the same ID, which allows undoing the
+	// whole stroke at once.
+	StrokeID uint32 `json:"strokeId,omitempty"`
 }
 
 // Fill represents the usage of the fill bucket.
@@ -171,37 +316,148 @@ type Fill struct {
 	X     float32  `json:"x"`
 	Y     float32  `json:"y"`
 	Color RGBColor `json:"color"`
+	// StrokeID optionally identifies this fill. Since a fill is always a
+	// stroke on its own, the ID mustn't be shared with any other event.
+	StrokeID uint32 `json:"strokeId,omitempty"`
 }
 
+// SocketConnection is the websocket connection of a player or an observer.
+// Messages aren't written directly, but queued via Send and written by a
+// separate goroutine. This way, slow clients can't block the lobby.
 type SocketConnection struct {
-	ws          *websocket.Conn
+	ws *websocket.Conn
+	// writer drains the outbound queue of the current websocket connection.
+	writer *socketWriter
+	// delayed holds messages back before passing them to the writer. It is
+	// only set if delay is greater than zero.
+	delayed *delayBuffer
+	// socketMutex guards ws, writer and delayed, as connections are swapped
+	// without holding the lobby mutex.
 	socketMutex *sync.Mutex
-	Connected   bool `json:"connected"`
+	// delay applies to all messages sent via Send, see SetDelay.
+	delay time.Duration
+	// binaryProtocol indicates whether the client negotiated BinaryProtocol
+	// and therefore wants to receive drawing events in binary form.
+	binaryProtocol bool
+	Connected      bool `json:"connected"`
+}
+
+// UsesBinaryProtocol indicates whether drawing events should be sent to this
+// connection using the BinaryProtocol.
+func (s *SocketConnection) UsesBinaryProtocol() bool {
+	return s.binaryProtocol
+}
+
+// SetBinaryProtocol defines whether the BinaryProtocol is used for this
+// connection. This has to be set whenever a new websocket is established.
+func (s *SocketConnection) SetBinaryProtocol(binaryProtocol bool) {
+	s.binaryProtocol = binaryProtocol
+}
+
+// SetDelay makes all messages sent via Send arrive late by the given
+// duration. This prevents observers from leaking a stream's content before
+// the stream shows it. The delay has to be set before setting the websocket.
+func (s *SocketConnection) SetDelay(delay time.Duration) {
+	s.delay = delay
 }
 
 // GetWebsocket simply returns the players websocket connection. This method
 // exists to encapsulate the websocket field and prevent accidental sending
 // the websocket data via the network.
 func (s *SocketConnection) GetWebsocket() *websocket.Conn {
+	s.socketMutex.Lock()
+	defer s.socketMutex.Unlock()
+
 	return s.ws
 }
 
-// SetWebsocket sets the given connection as the players websocket connection.
+// SetWebsocket sets the given connection as the players websocket connection
+// and starts writing queued messages to it. A previous connection is closed
+// after all messages that have been queued for it have been written. Passing
+// nil simply closes the current connection.
 func (s *SocketConnection) SetWebsocket(socket *websocket.Conn) {
+	s.socketMutex.Lock()
+	defer s.socketMutex.Unlock()
+
+	if s.writer != nil {
+		s.writer.close()
+		s.writer = nil
+		s.delayed = nil
+	}
+
 	s.ws = socket
+	if socket != nil {
+		s.writer = newSocketWriter(socket)
+		go s.writer.run()
+
+		if s.delay > 0 {
+			s.delayed = newDelayBuffer(s.writer, s.delay)
+			go s.delayed.run()
+		}
+	}
+}
+
+// closeWebsocket closes the current connection after all queued messages
+// have been written. Contrary to SetWebsocket(nil), the connection is kept,
+// so that the disconnect is still handled once the client is gone.
+func (s *SocketConnection) closeWebsocket() {
+	s.socketMutex.Lock()
+	defer s.socketMutex.Unlock()
+
+	if s.writer != nil {
+		s.writer.close()
+	}
+}
+
+// Send queues a message for the current websocket connection. The message is
+// written asynchronously, so a nil error doesn't guarantee delivery. If the
+// queue is full, the client is considered too slow and gets disconnected.
+// If a delay has been set, the message is held back accordingly.
+func (s *SocketConnection) Send(messageType int, data []byte) error {
+	s.socketMutex.Lock()
+	writer, delayed := s.writer, s.delayed
+	s.socketMutex.Unlock()
+
+	if writer == nil || !s.Connected {
+		return ErrNotConnected
+	}
+
+	message := outboundMessage{messageType: messageType, data: data}
+	if delayed != nil {
+		return delayed.push(message)
+	}
+	return writer.enqueue(message)
 }
 
-// GetWebsocketMutex returns a mutex for locking the websocket connection.
-// Since gorilla websockets shits it self when two calls happen at
-// the same time, we need a mutex per player, since each player has their
-// own socket. This getter extends to prevent accidentally sending the mutex
-// via the network.
-func (s *SocketConnection) GetWebsocketMutex() *sync.Mutex {
-	return s.socketMutex
+// SendImmediately works like Send, but ignores the delay. This is meant for
+// events that reduce what's being shown, such as kicks, which would
+// otherwise arrive after the content they are meant to remove.
+func (s *SocketConnection) SendImmediately(messageType int, data []byte) error {
+	s.socketMutex.Lock()
+	writer := s.writer
+	s.socketMutex.Unlock()
+
+	if writer == nil || !s.Connected {
+		return ErrNotConnected
+	}
+
+	return writer.enqueue(outboundMessage{messageType: messageType, data: data})
 }
 
+// Observer is a spectator of a Lobby. By default, observers are anonymous
+// and see the game the same way guessing players do. Casters additionally
+// see the current word and the messages of players that have already
+// guessed it.
 type Observer struct {
 	*SocketConnection
+	// user is nil for anonymous observers.
+	user   *auth.User
+	caster bool
+}
+
+// IsCaster indicates whether the observer is allowed to see the word.
+func (observer *Observer) IsCaster() bool {
+	return observer.caster
 }
 
 // Player represents a participant in a Lobby.
@@ -225,33 +481,14 @@ type Player struct {
 	Rank      int         `json:"rank"`
 	State     PlayerState `json:"state"`
 	Mod       bool        `json:"mod"`
+	// Muted players can still guess, but nobody else sees their messages.
+	Muted bool `json:"muted"`
 }
 
 func (player Player) String() string {
 	return player.user.String()
 }
 
-// GetWebsocket simply returns the players websocket connection. This method
-// exists to encapsulate the websocket field and prevent accidental sending
-// the websocket data via the network.
-func (player *Player) GetWebsocket() *websocket.Conn {
-	return player.ws
-}
-
-// SetWebsocket sets the given connection as the players websocket connection.
-func (player *Player) SetWebsocket(socket *websocket.Conn) {
-	player.ws = socket
-}
-
-// GetWebsocketMutex returns a mutex for locking the websocket connection.
-// Since gorilla websockets shits it self when two calls happen at
-// the same time, we need a mutex per player, since each player has their
-// own socket. This getter extends to prevent accidentally sending the mutex
-// via the network.
-func (player *Player) GetWebsocketMutex() *sync.Mutex {
-	return player.socketMutex
-}
-
 // GetUser returns the players current user session.
 func (player *Player) GetUser() *auth.User {
 	return player.user
@@ -340,6 +577,19 @@ func (lobby *Lobby) GetConnectedPlayerCount() int {
 	return count
 }
 
+// GetConnectedObserverCount returns the amount of observers that have
+// currently established a socket connection.
+func (lobby *Lobby) GetConnectedObserverCount() int {
+	var count int
+	for _, observer := range lobby.observers {
+		if observer.Connected {
+			count++
+		}
+	}
+
+	return count
+}
+
 func (lobby *Lobby) HasConnectedPlayers() bool {
 	lobby.mutex.Lock()
 	defer lobby.mutex.Unlock()
@@ -373,10 +623,10 @@ func (lobby Lobby) GetObservers() []*Observer {
 // players. Whether a slot is available is determined by the player count and
 // whether a player is disconnect or furthermore how long they have been
 // disconnected for. Therefore the result of this function will differ from
-// Lobby.GetConnectedPlayerCount.
+// Lobby.GetConnectedPlayerCount. The lobby has to be locked.
 func (lobby *Lobby) GetOccupiedPlayerSlots() int {
 	var occupiedPlayerSlots int
-	now := time.Now()
+	now := lobby.getClock().Now()
 	for _, player := range lobby.players {
 		if player.Connected {
 			occupiedPlayerSlots++
@@ -427,17 +677,51 @@ func (lobby Lobby) HasBeenKicked(user *auth.User) bool {
 	return false
 }
 
+// CanCast checks whether the given user may observe the lobby as a caster,
+// see ActionCast. The lobby has to be locked.
+func (lobby *Lobby) CanCast(user *auth.User) bool {
+	return lobby.isAllowed(user, ActionCast)
+}
+
+// IsMod checks whether the user moderates the creator's channel, as of the
+// last sync. The lobby has to be locked.
 func (lobby *Lobby) IsMod(user *auth.User) bool {
-	mods, err := lobby.db.GetModsForChannel(lobby.creator.user.Id)
-	if err != nil {
-		return false
-	}
+	if lobby.mods == nil {
+		if lobby.db == nil {
+			return false
+		}
 
-	for _, u := range *mods {
-		if u.Id == user.Id {
-			return true
+		mods, err := lobby.db.GetModsForChannel(lobby.creator.user.Id)
+		if err != nil {
+			//Not caching anything, so that the next check tries again.
+			lobby.Logger().Warn("Failed loading mods", logging.KeyError, err)
+			return false
+		}
+
+		lobby.mods = make(map[string]bool, len(*mods))
+		for _, mod := range *mods {
+			lobby.mods[mod.Id] = true
 		}
 	}
 
-	return false
+	return lobby.mods[user.Id]
+}
+
+// InvalidateMods makes the lobby reload the moderators and VIPs of the
+// creator's channel, for example after they have been synced from Twitch.
+func (lobby *Lobby) InvalidateMods() {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	lobby.mods = nil
+	lobby.vips = nil
+	lobby.banned = nil
+	for _, player := range lobby.players {
+		//The creator is always marked as mod, see CreateLobby.
+		if player != lobby.creator {
+			player.Mod = lobby.IsMod(player.user)
+		}
+	}
+	lobby.triggerPlayersUpdate()
+	lobby.sendAllowedActions()
 }
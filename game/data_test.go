@@ -4,6 +4,9 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/clock"
 )
 
 func TestOccupiedPlayerCount(t *testing.T) {
@@ -15,7 +18,9 @@ func TestOccupiedPlayerCount(t *testing.T) {
 	}
 
 	//While disconnect, there's no disconnect time, which we count as occupied.
-	lobby.players = append(lobby.players, &Player{})
+	lobby.players = append(lobby.players, &Player{
+		SocketConnection: &SocketConnection{},
+	})
 	if lobby.GetOccupiedPlayerSlots() != 1 {
 		t.Errorf("Occupied player count expected to be 1, but was %d", lobby.GetOccupiedPlayerSlots())
 	}
@@ -36,6 +41,7 @@ func TestOccupiedPlayerCount(t *testing.T) {
 	}
 
 	now := time.Now()
+	disconnectedPlayer.Connected = false
 	disconnectedPlayer.disconnectTime = &now
 	if lobby.GetOccupiedPlayerSlots() != 3 {
 		t.Errorf("Occupied player count expected to be 3, but was %d", lobby.GetOccupiedPlayerSlots())
@@ -48,3 +54,49 @@ func TestOccupiedPlayerCount(t *testing.T) {
 	}
 
 }
+
+func TestSlotReservationExpires(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	lobby := &Lobby{
+		mutex: &sync.Mutex{},
+		clock: fakeClock,
+	}
+
+	disconnectTime := fakeClock.Now()
+	lobby.players = append(lobby.players, &Player{
+		SocketConnection: &SocketConnection{},
+		disconnectTime:   &disconnectTime,
+	})
+
+	fakeClock.Advance(slotReservationTime - time.Second)
+	if lobby.GetOccupiedPlayerSlots() != 1 {
+		t.Errorf("Slot should still be reserved, but occupied count was %d", lobby.GetOccupiedPlayerSlots())
+	}
+
+	fakeClock.Advance(time.Second)
+	if lobby.GetOccupiedPlayerSlots() != 0 {
+		t.Errorf("Slot reservation should've expired, but occupied count was %d", lobby.GetOccupiedPlayerSlots())
+	}
+}
+
+func Test_InvalidateMods(t *testing.T) {
+	lobby := createTestLobby()
+	lobby.MaxPlayers = 2
+	mod := lobby.JoinPlayer(&auth.User{Id: "mod", Name: "Mod", Provider: auth.ProviderGuest})
+
+	lobby.mods = map[string]bool{"mod": true}
+	if !lobby.IsMod(mod.user) || lobby.IsMod(&auth.User{Id: "player"}) {
+		t.Fatal("Expected cached mods to be used")
+	}
+	mod.Mod = true
+	lobby.creator.Mod = true
+
+	//Without a database, nobody is a mod after reloading.
+	lobby.InvalidateMods()
+	if lobby.IsMod(mod.user) || mod.Mod {
+		t.Error("Expected mods to be reloaded")
+	}
+	if !lobby.creator.Mod {
+		t.Error("Expected the creator to stay marked as mod")
+	}
+}
@@ -0,0 +1,102 @@
+package game
+
+import "time"
+
+// Types of the events passed to EventListener.
+const (
+	EventLobbyOpened  = "lobby-opened"
+	EventGameStarted  = "game-started"
+	EventTurnOver     = "turn-over"
+	EventGameOver     = "game-over"
+	EventPlayerKicked = "player-kicked"
+)
+
+// EventTypes are all types of events passed to EventListener.
+var EventTypes = []string{EventLobbyOpened, EventGameStarted, EventTurnOver, EventGameOver, EventPlayerKicked}
+
+// EventListener is notified about noteworthy events of all lobbies, for
+// example in order to deliver webhooks. It is called while the lobby is
+// locked and therefore mustn't block. Changes only affect lobbies created
+// afterwards.
+var EventListener func(event *Event)
+
+// Event describes something that happened in a lobby. Unlike the events sent
+// to the players, it only contains data that is safe to share with third
+// parties.
+type Event struct {
+	Type    string `json:"type"`
+	LobbyID string `json:"lobbyId"`
+	// ChannelID is the ID of the user that created the lobby.
+	ChannelID string      `json:"channelId"`
+	Time      time.Time   `json:"time"`
+	Data      interface{} `json:"data,omitempty"`
+	// ObserverDelay is the lobby's ObserverDelay in seconds. Results shown
+	// on stream earlier than that spoil them for the viewers.
+	ObserverDelay int `json:"observerDelay"`
+}
+
+// LobbyOpenedEvent is the data of EventLobbyOpened.
+type LobbyOpenedEvent struct {
+	EditableLobbySettings
+	Wordpack string `json:"wordpack"`
+}
+
+// GameStartedEvent is the data of EventGameStarted.
+type GameStartedEvent struct {
+	Rounds  int             `json:"rounds"`
+	Players []PlayerSummary `json:"players"`
+}
+
+// TurnOverEventData is the data of EventTurnOver.
+type TurnOverEventData struct {
+	Round int    `json:"round"`
+	Word  string `json:"word"`
+	// Drawer is the name of the player that was drawing.
+	Drawer  string          `json:"drawer"`
+	Players []PlayerSummary `json:"players"`
+}
+
+// GameOverEventData is the data of EventGameOver.
+type GameOverEventData struct {
+	// Winners are all players sharing the first rank.
+	Winners []PlayerSummary `json:"winners"`
+	Players []PlayerSummary `json:"players"`
+}
+
+// emitEvent passes the event to the listener of the lobby, if there is one.
+// The lobby has to be locked.
+func (lobby *Lobby) emitEvent(eventType string, data interface{}) {
+	if lobby.eventListener == nil {
+		return
+	}
+
+	event := &Event{
+		Type:          eventType,
+		LobbyID:       lobby.LobbyID,
+		Time:          lobby.getClock().Now(),
+		Data:          data,
+		ObserverDelay: lobby.ObserverDelay,
+	}
+	if lobby.creator != nil {
+		event.ChannelID = lobby.creator.user.Id
+	}
+	lobby.eventListener(event)
+}
+
+// summarizePlayers requires the lobby to be locked.
+func summarizePlayers(players []*Player) []PlayerSummary {
+	summaries := make([]PlayerSummary, 0, len(players))
+	for _, player := range players {
+		summaries = append(summaries, summarizePlayer(player))
+	}
+	return summaries
+}
+
+func summarizePlayer(player *Player) PlayerSummary {
+	return PlayerSummary{
+		UserID:    player.user.Id,
+		Name:      player.Name,
+		Score:     player.Score,
+		Connected: player.Connected,
+	}
+}
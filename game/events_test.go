@@ -0,0 +1,95 @@
+package game
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/clock"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+func Test_lobbyOpenedEvent(t *testing.T) {
+	var events []*Event
+	EventListener = func(event *Event) {
+		events = append(events, event)
+	}
+	defer func() {
+		EventListener = nil
+	}()
+
+	_, lobby, err := CreateLobby(nil, &auth.User{Id: "1234", Name: "Owner"}, "english", true, 120, 4, 12, 0, nil, JoinRules{}, false)
+	if err != nil {
+		t.Fatalf("Couldn't create lobby: %s", err)
+	}
+
+	if len(events) != 1 || events[0].Type != EventLobbyOpened || events[0].ChannelID != "1234" || events[0].LobbyID != lobby.LobbyID {
+		t.Fatalf("Expected lobby-opened event, got %+v", events)
+	}
+	if data := events[0].Data.(*LobbyOpenedEvent); data.Rounds != 4 || data.Wordpack != "english" {
+		t.Errorf("Unexpected event data %+v", data)
+	}
+}
+
+func Test_gameEvents(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	var events []*Event
+	lobby := &Lobby{
+		mutex: &sync.Mutex{},
+		EditableLobbySettings: &EditableLobbySettings{
+			DrawingTime: 120,
+			Rounds:      1,
+		},
+		intermission: 5 * time.Second,
+		words:        []string{"abc", "abc", "abc", "abc", "abc", "abc"},
+		lowercaser:   cases.Lower(language.English),
+		clock:        fakeClock,
+		eventListener: func(event *Event) {
+			events = append(events, event)
+		},
+	}
+	lobby.WriteJSON = func(conn *SocketConnection, object interface{}) error {
+		return nil
+	}
+
+	a := lobby.JoinPlayer(&auth.User{Id: "1234", Name: "TwitchNameA"})
+	a.Connected = true
+	lobby.Owner = a
+	lobby.creator = a
+	b := lobby.JoinPlayer(&auth.User{Id: "1235", Name: "TwitchNameB"})
+	b.Connected = true
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "start"}, a); err != nil {
+		t.Fatalf("Couldn't start lobby: %s", err)
+	}
+	//Both players draw once, letting the time run out.
+	for _, drawer := range []*Player{a, b} {
+		if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, drawer); err != nil {
+			t.Fatalf("Couldn't choose word: %s", err)
+		}
+		fakeClock.Advance(125 * time.Second)
+	}
+	lobby.KickUser(b.user.Id)
+
+	expectedTypes := []string{EventGameStarted, EventTurnOver, EventTurnOver, EventGameOver, EventPlayerKicked}
+	if len(events) != len(expectedTypes) {
+		t.Fatalf("Expected events %v, got %d events", expectedTypes, len(events))
+	}
+	for index, event := range events {
+		if event.Type != expectedTypes[index] || event.ChannelID != "1234" {
+			t.Errorf("Expected %s event for channel 1234, got %+v", expectedTypes[index], event)
+		}
+	}
+
+	if turnOver := events[1].Data.(*TurnOverEventData); turnOver.Word != "abc" || turnOver.Drawer != "TwitchNameA" {
+		t.Errorf("Unexpected turn-over data %+v", turnOver)
+	}
+	if gameOver := events[3].Data.(*GameOverEventData); len(gameOver.Winners) != 2 || len(gameOver.Players) != 2 {
+		t.Errorf("Expected both players to win without any guesses, got %+v", gameOver)
+	}
+	if kicked := events[4].Data.(PlayerSummary); kicked.UserID != "1235" {
+		t.Errorf("Unexpected kicked player %+v", kicked)
+	}
+}
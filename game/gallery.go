@@ -0,0 +1,145 @@
+package game
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+// GalleryEntry is the drawing of a finished turn, including the word that was
+// drawn and who drew it. Entries are kept in the lobby until it is cleaned
+// up and can optionally be persisted, see Lobby.SaveDrawings.
+type GalleryEntry struct {
+	ID         string        `json:"id"`
+	LobbyID    string        `json:"lobbyId"`
+	Round      int           `json:"round"`
+	Word       string        `json:"word"`
+	DrawerID   string        `json:"drawerId"`
+	DrawerName string        `json:"drawerName"`
+	Drawing    []interface{} `json:"drawing"`
+	CreatedAt  time.Time     `json:"createdAt"`
+}
+
+// GalleryEntryFromDrawing converts a persisted drawing back into a
+// GalleryEntry, so that it can be served the same way as in-memory entries.
+func GalleryEntryFromDrawing(drawing *database.Drawing) (*GalleryEntry, error) {
+	var elements []interface{}
+	if err := json.Unmarshal(drawing.Drawing, &elements); err != nil {
+		return nil, err
+	}
+
+	return &GalleryEntry{
+		ID:         drawing.Id,
+		LobbyID:    drawing.LobbyId,
+		Round:      drawing.Round,
+		Word:       drawing.Word,
+		DrawerID:   drawing.DrawerId,
+		DrawerName: drawing.DrawerName,
+		Drawing:    elements,
+		CreatedAt:  drawing.CreatedAt,
+	}, nil
+}
+
+// GetGallery returns all drawings of finished turns in the order they were
+// drawn. Drawings younger than the ObserverDelay would reveal the word ahead
+// of the delayed stream, so they are only returned to the creator and to
+// callers supplying the observer token.
+func (lobby *Lobby) GetGallery(user *auth.User, observerToken string) []*GalleryEntry {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	cutoff := lobby.galleryCutoff(user, observerToken)
+	gallery := make([]*GalleryEntry, 0, len(lobby.gallery))
+	for _, entry := range lobby.gallery {
+		if !entry.CreatedAt.After(cutoff) {
+			gallery = append(gallery, entry)
+		}
+	}
+	return gallery
+}
+
+// GetGalleryEntry returns the drawing with the given ID or nil, if this lobby
+// doesn't contain such a drawing or it isn't visible yet, see GetGallery.
+func (lobby *Lobby) GetGalleryEntry(id string, user *auth.User, observerToken string) *GalleryEntry {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	cutoff := lobby.galleryCutoff(user, observerToken)
+	for _, entry := range lobby.gallery {
+		if entry.ID == id && !entry.CreatedAt.After(cutoff) {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// galleryCutoff returns the point in time after which archived drawings
+// aren't visible to the given caller yet. The lobby has to be locked.
+func (lobby *Lobby) galleryCutoff(user *auth.User, observerToken string) time.Time {
+	now := lobby.getClock().Now()
+	if lobby.IsCreator(user) || lobby.IsObserverToken(observerToken) {
+		return now
+	}
+
+	return now.Add(-time.Duration(lobby.ObserverDelay) * time.Second)
+}
+
+// archiveDrawing adds the current drawing to the gallery. This has to be
+// called before the turn state is reset, as we need the word and the drawer.
+func (lobby *Lobby) archiveDrawing() {
+	//Kicked drawers and turns without a single stroke don't make for
+	//anything worth looking at.
+	if lobby.drawer == nil || lobby.CurrentWord == "" || len(lobby.currentDrawing) == 0 {
+		return
+	}
+
+	//The backing array of the current drawing is reused by undo, so we
+	//can't just keep a reference to it.
+	drawing := make([]interface{}, len(lobby.currentDrawing))
+	copy(drawing, lobby.currentDrawing)
+
+	entry := &GalleryEntry{
+		ID:         uuid.Must(uuid.NewV4()).String(),
+		LobbyID:    lobby.LobbyID,
+		Round:      lobby.Round,
+		Word:       lobby.CurrentWord,
+		DrawerID:   lobby.drawer.ID,
+		DrawerName: lobby.drawer.Name,
+		Drawing:    drawing,
+		CreatedAt:  lobby.getClock().Now(),
+	}
+	lobby.gallery = append(lobby.gallery, entry)
+
+	if lobby.SaveDrawings && lobby.db != nil {
+		//We don't want to block the lobby on the database.
+		go lobby.persistGalleryEntry(entry, lobby.creator.ID)
+	}
+}
+
+func (lobby *Lobby) persistGalleryEntry(entry *GalleryEntry, channelId string) {
+	drawing, err := json.Marshal(entry.Drawing)
+	if err != nil {
+		lobby.Logger().Error("Failed marshalling drawing", "drawing_id", entry.ID, logging.KeyError, err)
+		return
+	}
+
+	err = lobby.db.AddDrawing(&database.Drawing{
+		Id:         entry.ID,
+		LobbyId:    entry.LobbyID,
+		ChannelId:  channelId,
+		Round:      entry.Round,
+		Word:       entry.Word,
+		DrawerId:   entry.DrawerID,
+		DrawerName: entry.DrawerName,
+		Drawing:    drawing,
+		CreatedAt:  entry.CreatedAt,
+	})
+	if err != nil {
+		lobby.Logger().Error("Failed persisting drawing", "drawing_id", entry.ID, logging.KeyError, err)
+	}
+}
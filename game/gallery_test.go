@@ -0,0 +1,93 @@
+package game
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/clock"
+)
+
+func Test_archiveDrawing(t *testing.T) {
+	lobby := &Lobby{
+		LobbyID: "lobby",
+		mutex:   &sync.Mutex{},
+		EditableLobbySettings: &EditableLobbySettings{
+			DrawingTime: 10,
+			Rounds:      10,
+		},
+	}
+	drawer := lobby.JoinPlayer(&auth.User{Id: "1234", Name: "Drawer"})
+	lobby.creator = drawer
+
+	//Nothing to archive, since nobody is drawing yet.
+	lobby.archiveDrawing()
+	if len(lobby.GetGallery(nil, "")) != 0 {
+		t.Fatalf("gallery should've been empty, but had %d entries", len(lobby.GetGallery(nil, "")))
+	}
+
+	lobby.drawer = drawer
+	lobby.CurrentWord = "abc"
+	lobby.Round = 2
+	lobby.AppendLine(&LineEvent{Type: "line", Data: &Line{FromX: 1, ToX: 2}})
+
+	//Empty drawings aren't archived, so this is the first entry.
+	lobby.archiveDrawing()
+	lobby.ClearDrawing()
+
+	gallery := lobby.GetGallery(nil, "")
+	if len(gallery) != 1 {
+		t.Fatalf("gallery should've had 1 entry, but had %d", len(gallery))
+	}
+
+	entry := gallery[0]
+	if entry.Word != "abc" || entry.Round != 2 || entry.DrawerID != drawer.ID || entry.LobbyID != lobby.LobbyID {
+		t.Errorf("gallery entry contained unexpected data: %+v", entry)
+	}
+
+	if len(entry.Drawing) != 1 {
+		t.Errorf("drawing should've survived clearing the canvas, but had %d elements", len(entry.Drawing))
+	}
+
+	if lobby.GetGalleryEntry(entry.ID, nil, "") != entry {
+		t.Error("gallery entry should've been found by its ID")
+	}
+}
+
+func Test_GetGallery_observerDelay(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	lobby := &Lobby{
+		LobbyID:       "lobby",
+		mutex:         &sync.Mutex{},
+		clock:         fakeClock,
+		observerToken: "token",
+		EditableLobbySettings: &EditableLobbySettings{
+			DrawingTime:   10,
+			Rounds:        10,
+			ObserverDelay: 30,
+		},
+	}
+	creator := &auth.User{Id: "creator", Name: "Creator"}
+	lobby.creator = lobby.JoinPlayer(creator)
+	viewer := &auth.User{Id: "viewer", Name: "Viewer"}
+
+	lobby.drawer = lobby.creator
+	lobby.CurrentWord = "abc"
+	lobby.AppendLine(&LineEvent{Type: "line", Data: &Line{FromX: 1, ToX: 2}})
+	lobby.archiveDrawing()
+	entry := lobby.gallery[0]
+
+	//The word would be spoiled for everyone watching the delayed stream.
+	if len(lobby.GetGallery(viewer, "")) != 0 || lobby.GetGalleryEntry(entry.ID, nil, "wrong") != nil {
+		t.Error("drawing shouldn't have been visible before the ObserverDelay passed")
+	}
+	if len(lobby.GetGallery(creator, "")) != 1 || lobby.GetGalleryEntry(entry.ID, nil, "token") != entry {
+		t.Error("drawing should've been visible to the creator and with the observer token")
+	}
+
+	fakeClock.Advance(30 * time.Second)
+	if len(lobby.GetGallery(viewer, "")) != 1 || lobby.GetGalleryEntry(entry.ID, nil, "") != entry {
+		t.Error("drawing should've been visible after the ObserverDelay passed")
+	}
+}
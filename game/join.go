@@ -1,18 +1,67 @@
 package game
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
 	"github.com/scribble-rs/scribble.rs/twitch"
 )
 
+// ErrTwitchRequired is returned when a user that didn't log in via Twitch
+// tries to create a lobby restricted by JoinRules.
+var ErrTwitchRequired = errors.New("lobbies with join requirements require a Twitch login")
+
+// JoinRule determines how the requirements of JoinRules are combined.
+type JoinRule string
+
+const (
+	// JoinRuleAll requires users to fulfil all requirements.
+	JoinRuleAll JoinRule = "all"
+	// JoinRuleAny requires users to fulfil at least one requirement.
+	JoinRuleAny JoinRule = "any"
+)
+
+// JoinRules restrict which users may join a lobby as players. Only Twitch
+// users can fulfil requirements. Users on the blocklist of the channel can
+// never join, regardless of these rules.
+type JoinRules struct {
+	RequireFollow bool `json:"requireFollow"`
+	// MinFollowDays is the amount of days users have to be following. It
+	// only applies if RequireFollow is set.
+	MinFollowDays     int  `json:"minFollowDays"`
+	RequireSubscribed bool `json:"requireSubscribed"`
+	// MinSubTier is the lowest accepted subscription tier between 1 and 3.
+	// It only applies if RequireSubscribed is set.
+	MinSubTier int  `json:"minSubTier"`
+	RequireVIP bool `json:"requireVip"`
+	// RequireAllowlist requires users to be on the allowlist of the channel.
+	RequireAllowlist bool `json:"requireAllowlist"`
+	// Rule defaults to JoinRuleAll if empty.
+	Rule JoinRule `json:"joinRule"`
+}
+
+// Restricted indicates whether any requirement is set.
+func (rules JoinRules) Restricted() bool {
+	return rules.RequireFollow || rules.RequireSubscribed || rules.RequireVIP || rules.RequireAllowlist
+}
+
 type Service struct {
 	Twitch *twitch.Client
 	Tokens twitch.TokenStore
 }
 
+// requirement checks whether a user fulfils one of the JoinRules. If not,
+// the reason describes what the user would have to do.
+type requirement func() (fulfilled bool, reason string, err error)
+
 func (g *Service) CanJoin(user *auth.User, lobby *Lobby) (bool, string, error) {
-	if !lobby.HasFreePlayerSlot() {
+	//Viewers that redeemed a seat may join regardless.
+	if !lobby.HasFreePlayerSlot() && !lobby.isQueued(user) {
 		return false, "lobby is full", nil
 	}
 
@@ -20,62 +69,55 @@ func (g *Service) CanJoin(user *auth.User, lobby *Lobby) (bool, string, error) {
 		return false, "kicked", nil
 	}
 
-	userTokens, err := g.Tokens.Get(user)
-	if err != nil {
-		return false, "", err
-	}
-
-	if lobby.RequireFollow {
-		if userTokens == nil {
-			return false, "", fmt.Errorf(
-				"no tokens for user %s (%s), can't check follow status",
-				user.Name,
-				user.Id,
-			)
+	channel := lobby.GetCreator()
+	if lobby.db != nil {
+		blocked, err := lobby.db.IsOnChannelList(channel.Id, database.ListBlock, user.Id)
+		if err != nil {
+			return false, "", err
+		} else if blocked {
+			return false, "blocked by " + channel.Name, nil
 		}
 
-		followEntry, err := g.Twitch.CheckUserFollows(userTokens, user.Id, lobby.Owner.ID)
+		//Synced bans don't require a request to Twitch, but might be
+		//outdated, so they are checked again below.
+		banned, err := lobby.db.IsBannedFromChannel(channel.Id, user.Id)
 		if err != nil {
 			return false, "", err
-		}
-		if followEntry == nil {
-			return false, "must be following " + lobby.Owner.Name, nil
+		} else if banned {
+			return false, "banned", nil
 		}
 	}
 
-	if lobby.RequireSubscribed {
-		if userTokens == nil {
-			return false, "", fmt.Errorf(
-				"no tokens for user %s (%s), can't check follow status",
-				user.Name,
-				user.Id,
-			)
+	//Follows, subscriptions and bans can only be checked for Twitch users.
+	if !user.IsTwitch() {
+		if lobby.JoinRules.Restricted() {
+			return false, "requires a Twitch login", nil
 		}
+		return true, "", nil
+	}
 
-		subEntry, err := g.Twitch.CheckUserSubscription(userTokens, user.Id, lobby.Owner.ID)
-		if err != nil {
-			return false, "", err
-		}
-		if subEntry == nil {
-			return false, "must be subscribed to " + lobby.Owner.Name, nil
-		}
+	allowed, reason, err := combineRequirements(lobby.JoinRules.Rule, g.requirements(user, channel, lobby))
+	if err != nil || !allowed {
+		return false, reason, err
 	}
 
-	owner := lobby.Owner.GetUser()
-	ownerTokens, err := g.Tokens.Get(owner)
+	if !channel.IsTwitch() {
+		return true, "", nil
+	}
+	channelTokens, err := g.Tokens.Get(channel)
 	if err != nil {
 		return false, "", err
-	} else if ownerTokens == nil {
+	} else if channelTokens == nil {
 		return false, "", fmt.Errorf(
 			"no tokens for lobby owner %s (%s), can't check ban status for %s (%s)",
-			owner.Name,
-			owner.Id,
+			channel.Name,
+			channel.Id,
 			user.Name,
 			user.Id,
 		)
 	}
 
-	banEntry, err := g.Twitch.CheckUserBanned(ownerTokens, user.Id, lobby.Owner.ID)
+	banEntry, err := g.Twitch.CheckUserBanned(channelTokens, user.Id, channel.Id)
 	if err != nil {
 		return false, "", err
 	} else if banEntry != nil {
@@ -84,3 +126,156 @@ func (g *Service) CanJoin(user *auth.User, lobby *Lobby) (bool, string, error) {
 
 	return true, "", nil
 }
+
+// combineRequirements evaluates the requirements according to the rule. For
+// JoinRuleAny, errors are only returned if no requirement is fulfilled, as
+// one of the others might still let the user in.
+func combineRequirements(rule JoinRule, requirements []requirement) (bool, string, error) {
+	if len(requirements) == 0 {
+		return true, "", nil
+	}
+
+	var reasons []string
+	var firstErr error
+	for _, check := range requirements {
+		fulfilled, reason, err := check()
+		if rule == JoinRuleAny {
+			if err == nil && fulfilled {
+				return true, "", nil
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if reason != "" {
+				reasons = append(reasons, reason)
+			}
+			continue
+		}
+
+		if err != nil {
+			return false, "", err
+		} else if !fulfilled {
+			return false, reason, nil
+		}
+	}
+
+	if rule == JoinRuleAny {
+		if firstErr != nil {
+			return false, "", firstErr
+		}
+		return false, strings.Join(reasons, " or "), nil
+	}
+	return true, "", nil
+}
+
+// followedLongEnough checks whether the follow is at least the given amount
+// of days old, according to the lobby's clock.
+func (lobby *Lobby) followedLongEnough(followEntry *twitch.FollowEntry, days int) bool {
+	return lobby.getClock().Now().Sub(followEntry.FollowedAt) >= time.Duration(days)*24*time.Hour
+}
+
+func (g *Service) requirements(user *auth.User, channel *auth.User, lobby *Lobby) []requirement {
+	rules := lobby.JoinRules
+	var requirements []requirement
+
+	userTokens := func() (*twitch.TokenSet, error) {
+		tokens, err := g.Tokens.Get(user)
+		if err == nil && tokens == nil {
+			err = fmt.Errorf("no tokens for user %s (%s), can't check requirements", user.Name, user.Id)
+		}
+		return tokens, err
+	}
+	//Followers and VIPs can only be listed by the channel itself.
+	channelTokens := func() (*twitch.TokenSet, error) {
+		tokens, err := g.Tokens.Get(channel)
+		if err == nil && tokens == nil {
+			err = fmt.Errorf("no tokens for lobby owner %s (%s), can't check requirements", channel.Name, channel.Id)
+		}
+		return tokens, err
+	}
+
+	if rules.RequireFollow {
+		requirements = append(requirements, func() (bool, string, error) {
+			tokens, err := channelTokens()
+			if err != nil {
+				return false, "", err
+			}
+
+			followEntry, err := g.Twitch.CheckUserFollows(tokens, user.Id, channel.Id)
+			if err != nil {
+				return false, "", err
+			}
+
+			reason := "must be following " + channel.Name
+			if rules.MinFollowDays > 0 {
+				reason = fmt.Sprintf("must be following %s for at least %d days", channel.Name, rules.MinFollowDays)
+			}
+			if followEntry == nil || !lobby.followedLongEnough(followEntry, rules.MinFollowDays) {
+				return false, reason, nil
+			}
+			return true, "", nil
+		})
+	}
+
+	if rules.RequireSubscribed {
+		requirements = append(requirements, func() (bool, string, error) {
+			tokens, err := userTokens()
+			if err != nil {
+				return false, "", err
+			}
+
+			subEntry, err := g.Twitch.CheckUserSubscription(tokens, user.Id, channel.Id)
+			if err != nil {
+				return false, "", err
+			}
+
+			reason := "must be subscribed to " + channel.Name
+			if rules.MinSubTier > 1 {
+				reason = fmt.Sprintf("must be subscribed to %s with tier %d or higher", channel.Name, rules.MinSubTier)
+			}
+			if subEntry == nil {
+				return false, reason, nil
+			}
+			//Tiers are sent as 1000, 2000 and 3000.
+			tier, err := strconv.Atoi(subEntry.Tier)
+			if err != nil {
+				return false, "", err
+			}
+			if tier/1000 < rules.MinSubTier {
+				return false, reason, nil
+			}
+			return true, "", nil
+		})
+	}
+
+	if rules.RequireVIP {
+		requirements = append(requirements, func() (bool, string, error) {
+			tokens, err := channelTokens()
+			if err != nil {
+				return false, "", err
+			}
+
+			vipEntry, err := g.Twitch.CheckUserVIP(tokens, user.Id, channel.Id)
+			if err != nil {
+				return false, "", err
+			}
+			return vipEntry != nil, "must be a VIP of " + channel.Name, nil
+		})
+	}
+
+	if rules.RequireAllowlist {
+		requirements = append(requirements, func() (bool, string, error) {
+			if lobby.db == nil {
+				return false, "", errors.New("allowlists require a database")
+			}
+
+			allowed, err := lobby.db.IsOnChannelList(channel.Id, database.ListAllow, user.Id)
+			if err != nil {
+				return false, "", err
+			}
+			return allowed, "must be on the allowlist of " + channel.Name, nil
+		})
+	}
+
+	return requirements
+}
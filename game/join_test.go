@@ -0,0 +1,69 @@
+package game
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/clock"
+	"github.com/scribble-rs/scribble.rs/twitch"
+)
+
+func Test_combineRequirements(t *testing.T) {
+	fulfilled := func() (bool, string, error) { return true, "", nil }
+	follow := func() (bool, string, error) { return false, "must be following", nil }
+	subscribe := func() (bool, string, error) { return false, "must be subscribed", nil }
+	failing := func() (bool, string, error) { return false, "", errors.New("twitch unavailable") }
+
+	tests := []struct {
+		name         string
+		rule         JoinRule
+		requirements []requirement
+		wantAllowed  bool
+		wantReason   string
+		wantErr      bool
+	}{
+		{"no requirements", JoinRuleAll, nil, true, "", false},
+		{"all fulfilled", JoinRuleAll, []requirement{fulfilled, fulfilled}, true, "", false},
+		{"default rule is all", "", []requirement{fulfilled, follow}, false, "must be following", false},
+		{"all with first unfulfilled", JoinRuleAll, []requirement{subscribe, follow}, false, "must be subscribed", false},
+		{"all with error", JoinRuleAll, []requirement{fulfilled, failing}, false, "", true},
+		{"any fulfilled", JoinRuleAny, []requirement{follow, fulfilled}, true, "", false},
+		{"any fulfilled despite error", JoinRuleAny, []requirement{failing, fulfilled}, true, "", false},
+		{"any unfulfilled", JoinRuleAny, []requirement{follow, subscribe}, false, "must be following or must be subscribed", false},
+		{"any unfulfilled with error", JoinRuleAny, []requirement{follow, failing}, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, reason, err := combineRequirements(tt.rule, tt.requirements)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("combineRequirements() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if allowed != tt.wantAllowed || reason != tt.wantReason {
+				t.Errorf("combineRequirements() = %v '%s', want %v '%s'", allowed, reason, tt.wantAllowed, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_followedLongEnough(t *testing.T) {
+	followedAt := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(followedAt.Add(3*24*time.Hour - time.Second))
+	lobby := &Lobby{clock: fakeClock}
+	followEntry := &twitch.FollowEntry{FollowedAt: followedAt}
+
+	if !lobby.followedLongEnough(followEntry, 0) {
+		t.Error("Any follow should've been enough without a minimum")
+	}
+	if lobby.followedLongEnough(followEntry, 3) {
+		t.Error("Follow shouldn't have been old enough a second before the third day passed")
+	}
+
+	fakeClock.Advance(time.Second)
+	if !lobby.followedLongEnough(followEntry, 3) {
+		t.Error("Follow should've been old enough once the third day passed")
+	}
+	if lobby.followedLongEnough(followEntry, 4) {
+		t.Error("Follow shouldn't have been old enough for four days")
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/clock"
 	"github.com/scribble-rs/scribble.rs/database"
-	"log"
 	"math"
 	"math/rand"
 	"sort"
@@ -32,6 +32,10 @@ var (
 		MaxRounds:      20,
 		MinMaxPlayers:  2,
 		MaxMaxPlayers:  24,
+		//The delay is given in seconds.
+		MinObserverDelay: 0,
+		MaxObserverDelay: 600,
+		MaxFollowDays:    3650,
 	}
 	SupportedLanguages = map[string]string{
 		"english_gb": "English (GB)",
@@ -57,12 +61,15 @@ const (
 // SettingBounds defines the lower and upper bounds for the user-specified
 // lobby creation input.
 type SettingBounds struct {
-	MinDrawingTime int64 `json:"minDrawingTime"`
-	MaxDrawingTime int64 `json:"maxDrawingTime"`
-	MinRounds      int64 `json:"minRounds"`
-	MaxRounds      int64 `json:"maxRounds"`
-	MinMaxPlayers  int64 `json:"minMaxPlayers"`
-	MaxMaxPlayers  int64 `json:"maxMaxPlayers"`
+	MinDrawingTime   int64 `json:"minDrawingTime"`
+	MaxDrawingTime   int64 `json:"maxDrawingTime"`
+	MinRounds        int64 `json:"minRounds"`
+	MaxRounds        int64 `json:"maxRounds"`
+	MinMaxPlayers    int64 `json:"minMaxPlayers"`
+	MaxMaxPlayers    int64 `json:"maxMaxPlayers"`
+	MinObserverDelay int64 `json:"minObserverDelay"`
+	MaxObserverDelay int64 `json:"maxObserverDelay"`
+	MaxFollowDays    int64 `json:"maxFollowDays"`
 }
 
 // LineEvent is basically the same as GameEvent, but with a specific Data type.
@@ -106,13 +113,18 @@ func (lobby *Lobby) HandleEvent(raw []byte, received *GameEvent, player *Player)
 		handleMessage(dataAsString, player, lobby)
 	} else if received.Type == "line" {
 		if lobby.canDraw(player) {
-			line := &Line{}
-			//It's cheaper to restructure the already unmarshalled map data
-			//instead of calling json.unmarshal again with a more specific
-			//type. Benchmarks can be found in json_test.go.
-			decodeError := mapstructure.Decode(received.Data, line)
-			if decodeError != nil {
-				return fmt.Errorf("error decoding data: %s", decodeError)
+			//Events decoded from the binary protocol already contain typed
+			//data.
+			line, isLine := received.Data.(*Line)
+			if !isLine {
+				line = &Line{}
+				//It's cheaper to restructure the already unmarshalled map data
+				//instead of calling json.unmarshal again with a more specific
+				//type. Benchmarks can be found in json_test.go.
+				decodeError := mapstructure.Decode(received.Data, line)
+				if decodeError != nil {
+					return fmt.Errorf("error decoding data: %s", decodeError)
+				}
 			}
 
 			//In case the line is too big, we overwrite the data of the event.
@@ -123,52 +135,54 @@ func (lobby *Lobby) HandleEvent(raw []byte, received *GameEvent, player *Player)
 				line.LineWidth = MinBrushSize
 			}
 
-			now := time.Now()
-			if now.Sub(lobby.lastDrawEvent) > 150*time.Millisecond || lobby.wasLastDrawEventFill() {
-				lobby.connectedDrawEventsIndexStack = append(lobby.connectedDrawEventsIndexStack, len(lobby.currentDrawing))
+			if strokeError := lobby.trackStroke(line.StrokeID, false); strokeError != nil {
+				return strokeError
 			}
-			lobby.lastDrawEvent = now
 
 			lineEvent := &LineEvent{Type: "line", Data: line}
 			lobby.AppendLine(lineEvent)
 
-			//We directly forward the event, as it seems to be valid.
-			lobby.sendDataToEveryoneExceptSender(player, lineEvent)
+			//We forward the event, as it seems to be valid.
+			lobby.relayDrawing(player, lineEvent)
 		}
 	} else if received.Type == "fill" {
 		if lobby.canDraw(player) {
-			//It's cheaper to restructure the already unmarshalled map data
-			//instead of calling json.unmarshal again with a more specific
-			//type. Benchmarks can be found in json_test.go.
-			fill := &Fill{}
-			decodeError := mapstructure.Decode(received.Data, fill)
-			if decodeError != nil {
-				return fmt.Errorf("error decoding data: %s", decodeError)
+			fill, isFill := received.Data.(*Fill)
+			if !isFill {
+				//It's cheaper to restructure the already unmarshalled map data
+				//instead of calling json.unmarshal again with a more specific
+				//type. Benchmarks can be found in json_test.go.
+				fill = &Fill{}
+				decodeError := mapstructure.Decode(received.Data, fill)
+				if decodeError != nil {
+					return fmt.Errorf("error decoding data: %s", decodeError)
+				}
 			}
 
-			//A fill always
-			lobby.connectedDrawEventsIndexStack = append(lobby.connectedDrawEventsIndexStack, len(lobby.currentDrawing))
-			lobby.lastDrawEvent = time.Now()
+			if strokeError := lobby.trackStroke(fill.StrokeID, true); strokeError != nil {
+				return strokeError
+			}
 
-			lobby.AppendFill(&FillEvent{Type: "fill", Data: fill})
+			fillEvent := &FillEvent{Type: "fill", Data: fill}
+			lobby.AppendFill(fillEvent)
 
-			//We directly forward the event, as it seems to be valid.
-			lobby.sendDataToEveryoneExceptSender(player, received)
+			//We forward the event, as it seems to be valid.
+			lobby.relayDrawing(player, fillEvent)
 		}
-	} else if received.Type == "clear-drawing-board" {
-		if lobby.canDraw(player) && len(lobby.currentDrawing) > 0 {
+	} else if received.Type == "clear-drawing-board" && lobby.canDraw(player) {
+		//Others may clear the canvas as well, see ActionClearCanvas.
+		if len(lobby.currentDrawing) > 0 {
 			lobby.ClearDrawing()
-			lobby.connectedDrawEventsIndexStack = nil
+			lobby.resetStrokes()
 			lobby.sendDataToEveryoneExceptSender(player, received)
 		}
 	} else if received.Type == "undo" {
-		if lobby.canDraw(player) && len(lobby.currentDrawing) > 0 && len(lobby.connectedDrawEventsIndexStack) > 0 {
-			undoFrom := lobby.connectedDrawEventsIndexStack[len(lobby.connectedDrawEventsIndexStack)-1]
-			lobby.connectedDrawEventsIndexStack = lobby.connectedDrawEventsIndexStack[:len(lobby.connectedDrawEventsIndexStack)-1]
-			if undoFrom < len(lobby.currentDrawing) {
-				lobby.currentDrawing = lobby.currentDrawing[:undoFrom]
-				lobby.TriggerUpdateEvent("drawing", lobby.currentDrawing)
-			}
+		if lobby.canDraw(player) && lobby.undoStroke() {
+			lobby.TriggerUpdateEvent("drawing", lobby.currentDrawing)
+		}
+	} else if received.Type == "redo" {
+		if lobby.canDraw(player) && lobby.redoStroke() {
+			lobby.TriggerUpdateEvent("drawing", lobby.currentDrawing)
 		}
 	} else if received.Type == "choose-word" {
 		chosenIndex, isInt := (received.Data).(int)
@@ -196,45 +210,26 @@ func (lobby *Lobby) HandleEvent(raw []byte, received *GameEvent, player *Player)
 			wordHintDataRevealed := &GameEvent{Type: "update-wordhint", Data: lobby.wordHintsShown}
 			for _, otherPlayer := range lobby.GetPlayers() {
 				if otherPlayer.State == Guessing {
-					lobby.WriteJSON(otherPlayer.SocketConnection, wordHintData)
+					lobby.send(otherPlayer.SocketConnection, wordHintData)
 				} else {
-					lobby.WriteJSON(otherPlayer.SocketConnection, wordHintDataRevealed)
+					lobby.send(otherPlayer.SocketConnection, wordHintDataRevealed)
 				}
 			}
 			for _, observer := range lobby.GetObservers() {
-				lobby.WriteJSON(observer.SocketConnection, wordHintData)
-			}
-		}
-	} else if received.Type == "kick" {
-		toKickID, isString := (received.Data).(string)
-		if !isString {
-			return fmt.Errorf("invalid data in kick event: %v", received.Data)
-		}
-
-		handleKickEvent(lobby, player, toKickID)
-	} else if received.Type == "start" {
-		if lobby.State != Ongoing && player == lobby.Owner {
-			//We are reseting each players score, since players could
-			//technically be player a second game after the last one
-			//has already ended.
-			for _, otherPlayer := range lobby.players {
-				otherPlayer.Score = 0
-				otherPlayer.LastScore = 0
-				//Since nobody has any points in the beginning, everyone has practically
-				//the same rank, therefore y'll winners for now.
-				otherPlayer.Rank = 1
+				if observer.caster {
+					lobby.send(observer.SocketConnection, wordHintDataRevealed)
+				} else {
+					lobby.send(observer.SocketConnection, wordHintData)
+				}
 			}
-
-			//Cause advanceLobby to start at round 1, starting the game anew.
-			lobby.Round = 0
-
-			advanceLobby(lobby)
 		}
+	} else if handled, err := lobby.handleActionEvent(player.user, received); handled {
+		return err
 	} else if received.Type == "request-drawing" {
 		//Since the client shouldn't be blocking to wait for the drawing, it's
 		//fine to emit the event if there's no drawing.
 		if len(lobby.currentDrawing) != 0 {
-			lobby.WriteJSON(player.SocketConnection, GameEvent{Type: "drawing", Data: lobby.currentDrawing})
+			lobby.send(player.SocketConnection, GameEvent{Type: "drawing", Data: lobby.currentDrawing})
 		}
 	}
 
@@ -271,7 +266,8 @@ func handleMessage(message string, sender *Player, lobby *Lobby) {
 		normSearched := simplifyText(lobby.CurrentWord)
 
 		if normSearched == normInput {
-			secondsLeft := int(lobby.RoundEndTime/1000 - time.Now().UTC().UnixNano()/1000000000)
+			secondsLeft := int(lobby.timeLeft() / 1000)
+			guessLatency.Observe(lobby.getClock().Now().Sub(lobby.drawingStartedAt).Seconds())
 
 			sender.LastScore = calculateGuesserScore(lobby.hintCount, lobby.hintsLeft, secondsLeft, lobby.DrawingTime)
 			sender.Score += sender.LastScore
@@ -285,7 +281,7 @@ func handleMessage(message string, sender *Player, lobby *Lobby) {
 				advanceLobby(lobby)
 			} else {
 				//Since the word has been guessed correctly, we reveal it.
-				lobby.WriteJSON(sender.SocketConnection, GameEvent{Type: "update-wordhint", Data: lobby.wordHintsShown})
+				lobby.send(sender.SocketConnection, GameEvent{Type: "update-wordhint", Data: lobby.wordHintsShown})
 				recalculateRanks(lobby)
 				lobby.triggerPlayersUpdate()
 			}
@@ -294,21 +290,13 @@ func handleMessage(message string, sender *Player, lobby *Lobby) {
 			//This allows other players to guess the word by watching what the
 			//other players are misstyping.
 			sendMessageToAll(trimmedMessage, sender, lobby)
-			lobby.WriteJSON(sender.SocketConnection, GameEvent{Type: "close-guess", Data: trimmedMessage})
+			lobby.send(sender.SocketConnection, GameEvent{Type: "close-guess", Data: trimmedMessage})
 		} else {
 			sendMessageToAll(trimmedMessage, sender, lobby)
 		}
 	}
 }
 
-func (lobby *Lobby) wasLastDrawEventFill() bool {
-	if len(lobby.currentDrawing) == 0 {
-		return false
-	}
-	_, isFillEvent := lobby.currentDrawing[len(lobby.currentDrawing)-1].(*FillEvent)
-	return isFillEvent
-}
-
 func calculateGuesserScore(hintCount, hintsLeft, secondsLeft, drawingTime int) int {
 	//The base score is based on the general time taken.
 	//The formula here represents an exponential decline based on the time taken.
@@ -343,11 +331,16 @@ func sendMessageToAll(message string, sender *Player, lobby *Lobby) {
 		AuthorID: sender.ID,
 		Content:  discordemojimap.Replace(message),
 	}}
+	//Muted players aren't told about being muted, so they can't evade it.
+	if sender.Muted {
+		lobby.send(sender.SocketConnection, messageEvent)
+		return
+	}
 	for _, player := range lobby.players {
-		lobby.WriteJSON(player.SocketConnection, messageEvent)
+		lobby.send(player.SocketConnection, messageEvent)
 	}
 	for _, observer := range lobby.observers {
-		lobby.WriteJSON(observer.SocketConnection, messageEvent)
+		lobby.send(observer.SocketConnection, messageEvent)
 	}
 }
 
@@ -357,22 +350,53 @@ func (lobby *Lobby) sendMessageToAllNonGuessing(message string, sender *Player)
 		AuthorID: sender.ID,
 		Content:  discordemojimap.Replace(message),
 	}}
+	if sender.Muted {
+		lobby.send(sender.SocketConnection, messageEvent)
+		return
+	}
 	for _, target := range lobby.players {
 		if target.State != Guessing {
-			lobby.WriteJSON(target.SocketConnection, messageEvent)
+			lobby.send(target.SocketConnection, messageEvent)
+		}
+	}
+	for _, observer := range lobby.observers {
+		if observer.caster {
+			lobby.send(observer.SocketConnection, messageEvent)
 		}
 	}
 }
 
-func handleKickEvent(lobby *Lobby, player *Player, toKickID string) {
-	//Kicking yourself isn't allowed
-	if toKickID == player.ID {
-		return
-	}
+var (
+	// ErrKickSelf is returned when users try to kick themselves.
+	ErrKickSelf = errors.New("you can't kick yourself")
+	// ErrProtectedPlayer is returned when trying to kick the creator, or a
+	// mod without being the creator.
+	ErrProtectedPlayer = errors.New("the player can't be kicked by you")
+	// ErrPlayerNotFound is returned if the user isn't playing in the lobby.
+	ErrPlayerNotFound = errors.New("the user isn't part of the lobby")
+)
 
-	//Only lobby creator or mods can kick
-	if player.ID != lobby.creator.ID && !lobby.IsMod(player.user) {
-		return
+// handleKickEvent kicks the player with the given ID. The user has to be
+// allowed to kick, see ActionKick.
+func handleKickEvent(lobby *Lobby, user *auth.User, toKickID string) {
+	//Clients don't offer forbidden kicks, so there's nobody to tell.
+	_ = lobby.kick(user, toKickID)
+}
+
+// Kick kicks the player with the given ID on behalf of the user, applying
+// the same checks as kicks via the websocket. The user has to be allowed to
+// kick, see ActionKick. Admins use KickUser instead.
+func (lobby *Lobby) Kick(user *auth.User, toKickID string) error {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	return lobby.kick(user, toKickID)
+}
+
+// kick is the implementation of Kick. The lobby has to be locked.
+func (lobby *Lobby) kick(user *auth.User, toKickID string) error {
+	if toKickID == user.Id {
+		return ErrKickSelf
 	}
 
 	playerToKickIndex := -1
@@ -383,50 +407,37 @@ func handleKickEvent(lobby *Lobby, player *Player, toKickID string) {
 		}
 	}
 
-	//If we haven't found the player, we can't kick them.
 	if playerToKickIndex == -1 {
-		return
+		return ErrPlayerNotFound
 	}
 
 	playerToKick := lobby.players[playerToKickIndex]
 
-	//Only the lobby creator can kick other mods
-	if lobby.IsMod(playerToKick.user) && player.ID != lobby.creator.ID {
-		return
-	}
-
-	kickEvent := &GameEvent{
-		Type: "kick",
-		Data: &Kick{
-			PlayerID:   playerToKick.ID,
-			PlayerName: playerToKick.Name,
-		},
-	}
-
-	//We send the kick event to all players
-	for _, otherPlayer := range lobby.players {
-		lobby.WriteJSON(otherPlayer.SocketConnection, kickEvent)
-	}
-	for _, observer := range lobby.observers {
-		lobby.WriteJSON(observer.SocketConnection, kickEvent)
+	if lobby.isProtected(user, playerToKick) {
+		return ErrProtectedPlayer
 	}
 
+	sendKickEvent(lobby, playerToKick)
 	kickPlayer(lobby, playerToKick, playerToKickIndex)
 
-	log.Printf("[INFO] %s kicked by %s from %s", player, playerToKick, lobby)
+	lobby.PlayerLogger(playerToKick).Info("Player kicked", "kicked_by", user.Id)
+	return nil
+}
+
+// sendKickEvent tells everyone, including the kicked player, about the kick.
+func sendKickEvent(lobby *Lobby, playerToKick *Player) {
+	lobby.TriggerUpdateEvent("kick", &Kick{
+		PlayerID:   playerToKick.ID,
+		PlayerName: playerToKick.Name,
+	})
 }
 
 // kickPlayer kicks the given player from the lobby, updating the lobby
 // state and sending all necessary events.
 func kickPlayer(lobby *Lobby, playerToKick *Player, playerToKickIndex int) {
-	//Avoiding nilpointer in case playerToKick disconnects during this event unluckily.
-	playerToKickSocket := playerToKick.ws
-	if playerToKickSocket != nil {
-		disconnectError := playerToKickSocket.Close()
-		if disconnectError != nil {
-			log.Printf("Error disconnecting kicked player:\n\t%s\n", disconnectError)
-		}
-	}
+	//The kick event has already been queued, so the player will still
+	//receive it before the connection is closed.
+	playerToKick.closeWebsocket()
 
 	//If the owner is kicked, we choose the next best person as the owner.
 	if lobby.Owner == playerToKick {
@@ -438,14 +449,29 @@ func kickPlayer(lobby *Lobby, playerToKick *Player, playerToKickIndex int) {
 					PlayerID:   potentialOwner.ID,
 					PlayerName: potentialOwner.Name,
 				})
+				lobby.sendAllowedActions()
 				break
 			}
 		}
 	}
 
 	lobby.KickedUsers = append(lobby.KickedUsers, *playerToKick.user)
+	lobby.emitEvent(EventPlayerKicked, summarizePlayer(playerToKick))
 
-	if lobby.drawer == playerToKick {
+	if lobby.Phase == PhaseIntermission {
+		//The turn has already been scored, so we only have to make sure that
+		//the kicked player won't be drawing next. Advancing is left to the
+		//intermission timer.
+		lobby.players = append(lobby.players[:playerToKickIndex], lobby.players[playerToKickIndex+1:]...)
+		if lobby.drawer == playerToKick {
+			lobby.drawer = nil
+		}
+		if lobby.nextDrawer == playerToKick {
+			lobby.nextDrawer = nil
+		}
+		recalculateRanks(lobby)
+		lobby.triggerPlayersUpdate()
+	} else if lobby.drawer == playerToKick {
 		newDrawer, roundOver := determineNextDrawer(lobby)
 		lobby.players = append(lobby.players[:playerToKickIndex], lobby.players[playerToKickIndex+1:]...)
 		lobby.TriggerUpdateEvent("drawer-kicked", nil)
@@ -480,15 +506,19 @@ type OwnerChangeEvent struct {
 	PlayerName string `json:"playerName"`
 }
 
-// advanceLobbyPredefineDrawer is required in cases where the drawer is removed game
+// advanceLobbyPredefineDrawer ends the current turn. If a word had been
+// chosen, the results are shown during an intermission, after which the next
+// turn is started by a timer. This is required in cases where the drawer is
+// removed from the game, as the next drawer can't be determined anymore.
 func advanceLobbyPredefineDrawer(lobby *Lobby, roundOver bool, newDrawer *Player) {
-	if lobby.timeLeftTicker != nil {
-		//We want to create a new ticker later on. By setting the current
-		//ticker to nil, we'll cause the ticker routine to stop the ticker
-		//and then stop itself. Later on we create a new routine.
-		//This way we won't have race conditions or wrongly executed logic.
-		lobby.timeLeftTicker = nil
+	if lobby.turnTimer != nil {
+		//Even if the timer has already fired, its function will notice that
+		//it has been replaced and won't execute any logic.
+		lobby.turnTimer.Stop()
+		lobby.turnTimer = nil
 	}
+	lobby.stopIntermissionTimer()
+	lobby.paused = false
 
 	//The drawer can potentially be null if kicked or the game just started.
 	if lobby.drawer != nil {
@@ -512,9 +542,13 @@ func advanceLobbyPredefineDrawer(lobby *Lobby, roundOver bool, newDrawer *Player
 		}
 	}
 
-	if lobby.CurrentWord != "" {
+	lobby.archiveDrawing()
+
+	wordWasChosen := lobby.CurrentWord != ""
+	if wordWasChosen {
 		sendTurnOver(lobby, lobby.CurrentWord)
-		time.Sleep(5 * time.Second)
+		turnDuration.Observe(lobby.getClock().Now().Sub(lobby.drawingStartedAt).Seconds())
+		lobby.endObservedTurn()
 	}
 
 	lobby.CurrentWord = ""
@@ -538,11 +572,56 @@ func advanceLobbyPredefineDrawer(lobby *Lobby, roundOver bool, newDrawer *Player
 
 	recalculateRanks(lobby)
 
+	//If no word was chosen, there are no results worth looking at.
+	if !wordWasChosen || lobby.intermission <= 0 {
+		startNextTurn(lobby, roundOver, newDrawer)
+		return
+	}
+
+	lobby.Phase = PhaseIntermission
+	lobby.nextDrawer = newDrawer
+	lobby.nextTurnStartsRound = roundOver
+
+	var timer clock.Timer
+	timer = lobby.getClock().AfterFunc(lobby.intermission, func() {
+		lobby.mutex.Lock()
+		defer lobby.mutex.Unlock()
+
+		//The timer might have been replaced while we were waiting for the
+		//lock, for example because the game has been restarted.
+		if lobby.intermissionTimer != timer {
+			return
+		}
+		lobby.intermissionTimer = nil
+
+		newDrawer, roundOver := lobby.nextDrawer, lobby.nextTurnStartsRound
+		lobby.nextDrawer = nil
+		//The designated drawer might've been kicked or disconnected during
+		//the intermission.
+		if newDrawer == nil || !newDrawer.Connected {
+			newDrawer, roundOver = determineNextDrawer(lobby)
+		}
+		startNextTurn(lobby, roundOver, newDrawer)
+	})
+	lobby.intermissionTimer = timer
+}
+
+func (lobby *Lobby) stopIntermissionTimer() {
+	if lobby.intermissionTimer != nil {
+		lobby.intermissionTimer.Stop()
+		lobby.intermissionTimer = nil
+	}
+}
+
+// startNextTurn either lets the given player choose a word or ends the game
+// if the last round is over.
+func startNextTurn(lobby *Lobby, roundOver bool, newDrawer *Player) {
 	if roundOver {
 		//Game over
 		if lobby.Round == lobby.Rounds {
 			lobby.drawer = nil
 			lobby.State = GameOver
+			lobby.Phase = PhaseGameOver
 
 			for _, player := range lobby.players {
 				readyData := generatePlayerReadyData(lobby, player)
@@ -550,13 +629,25 @@ func advanceLobbyPredefineDrawer(lobby *Lobby, roundOver bool, newDrawer *Player
 				//game-over event is only sent to already connected players.
 				readyData.CurrentDrawing = nil
 
-				lobby.WriteJSON(player.SocketConnection, GameEvent{
+				lobby.send(player.SocketConnection, GameEvent{
 					Type: "game-over",
 					Data: &GameOverEvent{
 						PlayerReady: readyData,
 					}})
 			}
 
+			players := summarizePlayers(lobby.players)
+			winners := make([]PlayerSummary, 0, 1)
+			for index, player := range lobby.players {
+				if player.Rank == 1 {
+					winners = append(winners, players[index])
+				}
+			}
+			lobby.emitEvent(EventGameOver, &GameOverEventData{
+				Winners: winners,
+				Players: players,
+			})
+
 			//Omit rest of events, since we don't need to advance.
 			return
 		}
@@ -565,24 +656,24 @@ func advanceLobbyPredefineDrawer(lobby *Lobby, roundOver bool, newDrawer *Player
 	}
 
 	lobby.ClearDrawing()
-	lobby.connectedDrawEventsIndexStack = nil
+	lobby.resetStrokes()
 	lobby.drawer = newDrawer
 	lobby.drawer.State = Drawing
 	lobby.State = Ongoing
+	lobby.Phase = PhaseChoosing
 	lobby.wordChoice = GetRandomWords(3, lobby)
 
 	//We use milliseconds for higher accuracy
-	lobby.RoundEndTime = time.Now().UTC().UnixNano()/1000000 + int64(lobby.DrawingTime)*1000
-	lobby.timeLeftTicker = time.NewTicker(1 * time.Second)
-	go startTurnTimeTicker(lobby, lobby.timeLeftTicker)
+	lobby.RoundEndTime = lobby.getTimeAsMillis() + int64(lobby.DrawingTime)*1000
+	lobby.scheduleTick()
 
 	lobby.TriggerUpdateEvent("next-turn", &NextTurn{
 		Round:        lobby.Round,
 		Players:      lobby.players,
-		RoundEndTime: int(lobby.RoundEndTime - getTimeAsMillis()),
+		RoundEndTime: int(lobby.RoundEndTime - lobby.getTimeAsMillis()),
 	})
 
-	lobby.WriteJSON(lobby.drawer.SocketConnection, &GameEvent{Type: "your-turn", Data: lobby.wordChoice})
+	lobby.send(lobby.drawer.SocketConnection, &GameEvent{Type: "your-turn", Data: lobby.wordChoice})
 }
 
 type TurnOverEvent struct {
@@ -609,6 +700,16 @@ func sendTurnOver(lobby *Lobby, word string) {
 		Word:   word,
 		Result: TurnResult,
 	})
+
+	eventData := &TurnOverEventData{
+		Round:   lobby.Round,
+		Word:    word,
+		Players: summarizePlayers(lobby.players),
+	}
+	if lobby.drawer != nil {
+		eventData.Drawer = lobby.drawer.Name
+	}
+	lobby.emitEvent(EventTurnOver, eventData)
 }
 
 // advanceLobby will either start the game or jump over to the next turn.
@@ -659,38 +760,36 @@ func determineNextDrawer(lobby *Lobby) (*Player, bool) {
 	return lobby.players[0], true
 }
 
-// startTurnTimeTicker executes a loop that listens to the lobbies
-// timeLeftTicker and executes a tickLogic on each tick. This method
-// blocks until the turn ends.
-func startTurnTimeTicker(lobby *Lobby, ticker *time.Ticker) {
-	for {
-		<-ticker.C
-		if !lobby.tickLogic(ticker) {
-			break
+// scheduleTick runs tickLogic after a second and keeps doing so until the
+// turn ends. Scheduling a tick replaces the previous one, as only the most
+// recently scheduled turnTimer is allowed to run. The lobby has to be locked.
+func (lobby *Lobby) scheduleTick() {
+	var timer clock.Timer
+	timer = lobby.getClock().AfterFunc(time.Second, func() {
+		lobby.mutex.Lock()
+		defer lobby.mutex.Unlock()
+
+		//Since we have a lock on the lobby, we can find out if the timer is
+		//still valid. If not, the turn has already ended.
+		if lobby.turnTimer != timer {
+			return
 		}
-	}
+
+		if lobby.tickLogic() {
+			lobby.scheduleTick()
+		}
+	})
+	lobby.turnTimer = timer
 }
 
 // tickLogic checks whether the lobby needs to proceed to the next round and
 // updates the available word hints if required. The return value indicates
-// whether additional ticks are necessary or not. The ticker is automatically
-// stopped if no additional ticks are required.
-func (lobby *Lobby) tickLogic(expectedTicker *time.Ticker) bool {
-	lobby.mutex.Lock()
-	defer lobby.mutex.Unlock()
-
-	//Since we have a lock on the lobby, we can find out if the ticker we are
-	//listening to is still valid. If not, we want to kill the outer routine.
-	if lobby.timeLeftTicker != expectedTicker {
-		expectedTicker.Stop()
-		return false
-	}
-
-	currentTime := getTimeAsMillis()
+// whether additional ticks are necessary or not. The lobby has to be locked.
+func (lobby *Lobby) tickLogic() bool {
+	currentTime := lobby.getTimeAsMillis()
 	if currentTime >= lobby.RoundEndTime {
-		expectedTicker.Stop()
 		advanceLobby(lobby)
-		//Kill outer goroutine and therefore avoid executing hint logic.
+		//Avoid executing hint logic, as the turn is over.
 		return false
 	}
 
@@ -704,35 +803,45 @@ func (lobby *Lobby) tickLogic(expectedTicker *time.Ticker) bool {
 		revealHintAtXOrLower := revealHintEveryXMilliseconds * int64(lobby.hintsLeft)
 		timeLeft := lobby.RoundEndTime - currentTime
 		if timeLeft <= revealHintAtXOrLower {
-			lobby.hintsLeft--
-
-			//We are trying til we find a yet unshown wordhint. Since we have
-			//thread safety and have already checked that there's a hint
-			//left, this loop can never spin forever.
-			for {
-				randomIndex := rand.Int() % len(lobby.wordHints)
-				if lobby.wordHints[randomIndex].Character == 0 {
-					lobby.wordHints[randomIndex].Character = []rune(lobby.CurrentWord)[randomIndex]
-					wordHintData := &GameEvent{Type: "update-wordhint", Data: lobby.wordHints}
-					for _, otherPlayer := range lobby.GetPlayers() {
-						if otherPlayer.State == Guessing {
-							lobby.WriteJSON(otherPlayer.SocketConnection, wordHintData)
-						}
-					}
-					for _, observer := range lobby.GetObservers() {
-						lobby.WriteJSON(observer.SocketConnection, wordHintData)
-					}
-					break
-				}
-			}
+			lobby.revealHint()
 		}
 	}
 
 	return true
 }
 
-func getTimeAsMillis() int64 {
-	return time.Now().UTC().UnixNano() / 1000000
+// revealHint reveals a random character of the current word to everyone
+// still guessing. The lobby has to be locked and a hint has to be left.
+func (lobby *Lobby) revealHint() {
+	lobby.hintsLeft--
+	lobby.recordObservedProgress()
+
+	//We are trying til we find a yet unshown wordhint. Since we have
+	//thread safety and have already checked that there's a hint
+	//left, this loop can never spin forever.
+	for {
+		randomIndex := rand.Int() % len(lobby.wordHints)
+		if lobby.wordHints[randomIndex].Character == 0 {
+			lobby.wordHints[randomIndex].Character = []rune(lobby.CurrentWord)[randomIndex]
+			wordHintData := &GameEvent{Type: "update-wordhint", Data: lobby.wordHints}
+			for _, otherPlayer := range lobby.GetPlayers() {
+				if otherPlayer.State == Guessing {
+					lobby.send(otherPlayer.SocketConnection, wordHintData)
+				}
+			}
+			//Some observers already see the whole word.
+			for _, observer := range lobby.GetObservers() {
+				if !lobby.seesWord(observer) {
+					lobby.send(observer.SocketConnection, wordHintData)
+				}
+			}
+			break
+		}
+	}
+}
+
+func (lobby *Lobby) getTimeAsMillis() int64 {
+	return lobby.getClock().Now().UTC().UnixNano() / 1000000
 }
 
 type TurnOver struct {
@@ -785,6 +894,8 @@ func recalculateRanks(lobby *Lobby) {
 func (lobby *Lobby) selectWord(wordChoiceIndex int) {
 	lobby.CurrentWord = lobby.wordChoice[wordChoiceIndex]
 	lobby.wordChoice = nil
+	lobby.Phase = PhaseDrawing
+	lobby.drawingStartedAt = lobby.getClock().Now()
 
 	//Depending on how long the word is, a fixed amount of hints
 	//would be too easy or too hard.
@@ -831,28 +942,30 @@ func (lobby *Lobby) selectWord(wordChoiceIndex int) {
 			})
 		}
 	}
+
+	lobby.startObservedTurn()
 }
 
 func (lobby *Lobby) sendDataToEveryoneExceptSender(sender *Player, data interface{}) {
 	for _, otherPlayer := range lobby.GetPlayers() {
 		if otherPlayer != sender {
-			lobby.WriteJSON(otherPlayer.SocketConnection, data)
+			lobby.send(otherPlayer.SocketConnection, data)
 		}
 	}
 
 	for _, observer := range lobby.GetObservers() {
-		lobby.WriteJSON(observer.SocketConnection, data)
+		lobby.send(observer.SocketConnection, data)
 	}
 }
 
 func (lobby *Lobby) TriggerUpdateEvent(eventType string, data interface{}) {
 	event := &GameEvent{Type: eventType, Data: data}
 	for _, otherPlayer := range lobby.GetPlayers() {
-		lobby.WriteJSON(otherPlayer.SocketConnection, event)
+		lobby.send(otherPlayer.SocketConnection, event)
 	}
 
 	for _, observer := range lobby.GetObservers() {
-		lobby.WriteJSON(observer.SocketConnection, event)
+		lobby.send(observer.SocketConnection, event)
 	}
 }
 
@@ -862,7 +975,21 @@ func (lobby *Lobby) triggerPlayersUpdate() {
 
 // CreateLobby creates a new lobby including the initial player (owner) and
 // optionally returns an error, if any occurred during creation.
-func CreateLobby(db *database.DB, user *auth.User, chosenLanguage string, publicLobby bool, drawingTime, rounds, maxPlayers, customWordsChance int, customWords []string, followersOnly bool, subsOnly bool) (*Player, *Lobby, error) {
+func CreateLobby(db *database.DB, user *auth.User, chosenLanguage string, publicLobby bool, drawingTime, rounds, maxPlayers, customWordsChance int, customWords []string, joinRules JoinRules, saveDrawings bool) (*Player, *Lobby, error) {
+	if joinRules.Restricted() && !user.IsTwitch() {
+		return nil, nil, ErrTwitchRequired
+	}
+
+	//Tests don't necessarily have a database.
+	permissions := Permissions{}
+	if db != nil {
+		var err error
+		permissions, err = LoadPermissions(db, user.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	lobby := &Lobby{
 		LobbyID: uuid.Must(uuid.NewV4()).String(),
 		EditableLobbySettings: &EditableLobbySettings{
@@ -871,14 +998,19 @@ func CreateLobby(db *database.DB, user *auth.User, chosenLanguage string, public
 			MaxPlayers:        maxPlayers,
 			CustomWordsChance: customWordsChance,
 			Public:            publicLobby,
+			JoinRules:         joinRules,
 		},
-		CustomWords:       customWords,
-		currentDrawing:    make([]interface{}, 0),
-		State:             Unstarted,
-		db:                db,
-		mutex:             &sync.Mutex{},
-		RequireFollow:     followersOnly,
-		RequireSubscribed: subsOnly,
+		CustomWords:    customWords,
+		currentDrawing: make([]interface{}, 0),
+		State:          Unstarted,
+		Phase:          PhaseUnstarted,
+		intermission:   TurnIntermission,
+		eventListener:  EventListener,
+		db:             db,
+		mutex:          &sync.Mutex{},
+		observerToken:  uuid.Must(uuid.NewV4()).String(),
+		SaveDrawings:   saveDrawings,
+		permissions:    permissions,
 	}
 
 	if len(customWords) > 1 {
@@ -905,6 +1037,11 @@ func CreateLobby(db *database.DB, user *auth.User, chosenLanguage string, public
 	lobby.Owner = player
 	lobby.creator = player
 
+	lobby.emitEvent(EventLobbyOpened, &LobbyOpenedEvent{
+		EditableLobbySettings: *lobby.EditableLobbySettings,
+		Wordpack:              lobby.Wordpack,
+	})
+
 	return player, lobby, nil
 }
 
@@ -925,6 +1062,8 @@ type PlayerReady struct {
 	PlayerID     string `json:"playerId"`
 	PlayerName   string `json:"playerName"`
 	AllowDrawing bool   `json:"allowDrawing"`
+	// AllowedActions are the actions the player may perform.
+	AllowedActions []Action `json:"allowedActions"`
 
 	ObserverReady
 }
@@ -932,24 +1071,30 @@ type PlayerReady struct {
 type ObserverReady struct {
 	VotekickEnabled    bool          `json:"votekickEnabled"`
 	GameState          gameState     `json:"gameState"`
+	Phase              TurnPhase     `json:"phase"`
 	OwnerID            string        `json:"ownerId"`
 	Round              int           `json:"round"`
 	Rounds             int           `json:"rounds"`
 	RoundEndTime       int           `json:"roundEndTime"`
+	Paused             bool          `json:"paused"`
 	DrawingTimeSetting int           `json:"drawingTimeSetting"`
 	WordHints          []*WordHint   `json:"wordHints"`
 	Players            []*Player     `json:"players"`
 	CurrentDrawing     []interface{} `json:"currentDrawing"`
+	// ObserverChat is only sent to observers.
+	ObserverChat *ObserverChat `json:"observerChat,omitempty"`
 }
 
 func generatePlayerReadyData(lobby *Lobby, player *Player) *PlayerReady {
 	ready := &PlayerReady{
-		PlayerID:     player.ID,
-		AllowDrawing: player.State == Drawing,
-		PlayerName:   player.Name,
+		PlayerID:       player.ID,
+		AllowDrawing:   player.State == Drawing,
+		PlayerName:     player.Name,
+		AllowedActions: lobby.allowedActions(player.user),
 
 		ObserverReady: ObserverReady{
 			GameState:          lobby.State,
+			Phase:              lobby.Phase,
 			OwnerID:            lobby.Owner.ID,
 			Round:              lobby.Round,
 			Rounds:             lobby.Rounds,
@@ -960,33 +1105,42 @@ func generatePlayerReadyData(lobby *Lobby, player *Player) *PlayerReady {
 		},
 	}
 
-	if lobby.State != Ongoing {
+	if lobby.State != Ongoing || lobby.Phase == PhaseIntermission {
 		//Clients should interpret 0 as "time over", unless the gamestate isn't "ongoing"
 		ready.RoundEndTime = 0
 	} else {
-		ready.RoundEndTime = int(lobby.RoundEndTime - getTimeAsMillis())
+		ready.RoundEndTime = int(lobby.timeLeft())
+		ready.Paused = lobby.paused
 	}
 
 	return ready
 }
 
-func generateObserverReadyData(lobby *Lobby) *ObserverReady {
+func generateObserverReadyData(lobby *Lobby, observer *Observer) *ObserverReady {
+	wordHints := lobby.wordHints
+	if lobby.seesWord(observer) {
+		wordHints = lobby.wordHintsShown
+	}
+
 	ready := &ObserverReady{
 		GameState:          lobby.State,
+		Phase:              lobby.Phase,
 		OwnerID:            lobby.Owner.ID,
 		Round:              lobby.Round,
 		Rounds:             lobby.Rounds,
 		DrawingTimeSetting: lobby.DrawingTime,
-		WordHints:          lobby.GetAvailableWordHints(Standby),
+		WordHints:          wordHints,
 		Players:            lobby.players,
 		CurrentDrawing:     lobby.currentDrawing,
+		ObserverChat:       lobby.generateObserverChat(observer),
 	}
 
-	if lobby.State != Ongoing {
+	if lobby.State != Ongoing || lobby.Phase == PhaseIntermission {
 		//Clients should interpret 0 as "time over", unless the gamestate isn't "ongoing"
 		ready.RoundEndTime = 0
 	} else {
-		ready.RoundEndTime = int(lobby.RoundEndTime - getTimeAsMillis())
+		ready.RoundEndTime = int(lobby.timeLeft())
+		ready.Paused = lobby.paused
 	}
 
 	return ready
@@ -994,29 +1148,29 @@ func generateObserverReadyData(lobby *Lobby) *ObserverReady {
 
 func (lobby *Lobby) OnObserverConnectUnsynchronized(observer *Observer) {
 	observer.Connected = true
-	lobby.WriteJSON(observer.SocketConnection, GameEvent{Type: "ready", Data: generateObserverReadyData(lobby)})
+	lobby.send(observer.SocketConnection, GameEvent{Type: "ready", Data: generateObserverReadyData(lobby, observer)})
 }
 
 func (lobby *Lobby) OnObserverDisconnect(observer *Observer) {
 	//We want to avoid calling the handler twice.
-	if observer.ws == nil {
+	if observer.GetWebsocket() == nil {
 		return
 	}
 
 	observer.Connected = false
-	observer.ws = nil
+	observer.SetWebsocket(nil)
 }
 
 func (lobby *Lobby) OnPlayerConnectUnsynchronized(player *Player) {
 	player.Connected = true
 	recalculateRanks(lobby)
-	lobby.WriteJSON(player.SocketConnection, GameEvent{Type: "ready", Data: generatePlayerReadyData(lobby, player)})
+	lobby.send(player.SocketConnection, GameEvent{Type: "ready", Data: generatePlayerReadyData(lobby, player)})
 
 	//This state is reached if the player reconnects before having chosen a word.
 	//This can happen if the player refreshes his browser page or the socket
 	//loses connection and reconnects quickly.
-	if lobby.drawer == player && lobby.CurrentWord == "" {
-		lobby.WriteJSON(lobby.drawer.SocketConnection, &GameEvent{Type: "your-turn", Data: lobby.wordChoice})
+	if lobby.drawer == player && lobby.Phase == PhaseChoosing {
+		lobby.send(lobby.drawer.SocketConnection, &GameEvent{Type: "your-turn", Data: lobby.wordChoice})
 	}
 
 	event := &GameEvent{Type: "update-players", Data: lobby.players}
@@ -1025,28 +1179,28 @@ func (lobby *Lobby) OnPlayerConnectUnsynchronized(player *Player) {
 		//to the ready event being sent. Therefeore it'd be wasteful to send
 		//that player and update event for players.
 		if otherPlayer != player {
-			lobby.WriteJSON(otherPlayer.SocketConnection, event)
+			lobby.send(otherPlayer.SocketConnection, event)
 		}
 	}
 	for _, observer := range lobby.GetObservers() {
-		lobby.WriteJSON(observer.SocketConnection, event)
+		lobby.send(observer.SocketConnection, event)
 	}
 }
 
 func (lobby *Lobby) OnPlayerDisconnect(player *Player) {
 	//We want to avoid calling the handler twice.
-	if player.ws == nil {
+	if player.GetWebsocket() == nil {
 		return
 	}
 
-	disconnectTime := time.Now()
+	disconnectTime := lobby.getClock().Now()
 
 	//It is important to properly disconnect the player before aqcuiring the mutex
 	//in order to avoid false assumptions about the players connection state
 	//and avoid attempting to send events.
-	log.Printf("[INFO] %s disconnected from %s", player, lobby)
+	lobby.PlayerLogger(player).Info("Player disconnected")
 	player.Connected = false
-	player.ws = nil
+	player.SetWebsocket(nil)
 
 	lobby.mutex.Lock()
 	defer lobby.mutex.Unlock()
@@ -1080,12 +1234,18 @@ func (lobby *Lobby) JoinPlayer(user *auth.User) *Player {
 	player := createPlayer(user, lobby.IsMod(user))
 
 	lobby.players = append(lobby.players, player)
+	lobby.dequeuePlayer(user)
 
 	return player
 }
 
-func (lobby *Lobby) JoinObserver() *Observer {
+// JoinObserver creates a new observer and adds it to the lobby. The user may
+// be nil for anonymous observers. Whether the observer may act as a caster
+// has to be checked beforehand, see CanCast.
+func (lobby *Lobby) JoinObserver(user *auth.User, caster bool) *Observer {
 	observer := CreateObserver()
+	observer.user = user
+	observer.caster = caster
 
 	lobby.observers = append(lobby.observers, observer)
 
@@ -1123,6 +1283,9 @@ func (lobby *Lobby) Shutdown() {
 
 	shutdownEvent := GameEvent{Type: "shutdown"}
 	for _, player := range lobby.players {
-		lobby.WriteJSON(player.SocketConnection, shutdownEvent)
+		lobby.send(player.SocketConnection, shutdownEvent)
+		//Closing waits for the queue to be written, so the event still
+		//arrives.
+		player.closeWebsocket()
 	}
 }
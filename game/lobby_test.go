@@ -4,6 +4,11 @@ import (
 	"github.com/scribble-rs/scribble.rs/auth"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/clock"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
 )
 
 func Test_RemoveAccents(t *testing.T) {
@@ -146,13 +151,17 @@ func Test_wordSelectionEvent(t *testing.T) {
 		},
 		words: []string{firstWordChoice, "def", "ghi"},
 	}
-	wordHintEvents := make(map[string]*GameEvent)
+	wordHintEvents := make(map[*SocketConnection]*GameEvent)
 	lobby.WriteJSON = func(player *SocketConnection, object interface{}) error {
-		_, ok := object.(*GameEvent)
+		gameEvent, ok := object.(*GameEvent)
 		if !ok {
 			panic("Unsupported event data type")
 		}
 
+		if gameEvent.Type == "update-wordhint" {
+			wordHintEvents[player] = gameEvent
+		}
+
 		return nil
 	}
 	drawer := lobby.JoinPlayer(&auth.User{Id: "1234", Name: "Drawer"})
@@ -178,7 +187,7 @@ func Test_wordSelectionEvent(t *testing.T) {
 		t.Errorf("Couldn't choose word: %s", choiceError)
 	}
 
-	wordHintsForDrawerEvent := wordHintEvents[drawer.ID]
+	wordHintsForDrawerEvent := wordHintEvents[drawer.SocketConnection]
 	wordHintsForDrawer := wordHintsForDrawerEvent.Data.([]*WordHint)
 	if len(wordHintsForDrawer) != 3 {
 		t.Errorf("Word hints for drawer were of incorrect length; %d != %d", len(wordHintsForDrawer), 3)
@@ -199,7 +208,7 @@ func Test_wordSelectionEvent(t *testing.T) {
 		}
 	}
 
-	wordHintsForGuesserEvent := wordHintEvents[guesser.ID]
+	wordHintsForGuesserEvent := wordHintEvents[guesser.SocketConnection]
 	wordHintsForGuesser := wordHintsForGuesserEvent.Data.([]*WordHint)
 	if len(wordHintsForGuesser) != 3 {
 		t.Errorf("Word hints for guesser were of incorrect length; %d != %d", len(wordHintsForGuesser), 3)
@@ -279,3 +288,376 @@ func Test_kickDrawer(t *testing.T) {
 		t.Errorf("Drawer should've been c, but was %s", lobby.drawer.Name)
 	}
 }
+
+// createTimedLobby creates a started lobby with two players, where time only
+// passes when advancing the returned clock.
+func createTimedLobby(t *testing.T, words ...string) (*Lobby, *clock.Fake, *Player, *Player, *[]string) {
+	t.Helper()
+
+	fakeClock := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	lobby := &Lobby{
+		mutex: &sync.Mutex{},
+		EditableLobbySettings: &EditableLobbySettings{
+			DrawingTime: 120,
+			Rounds:      10,
+		},
+		intermission: 5 * time.Second,
+		words:        words,
+		lowercaser:   cases.Lower(language.English),
+		clock:        fakeClock,
+	}
+	var events []string
+	lobby.WriteJSON = func(conn *SocketConnection, object interface{}) error {
+		if event, isEvent := object.(*GameEvent); isEvent {
+			events = append(events, event.Type)
+		}
+		return nil
+	}
+
+	a := lobby.JoinPlayer(&auth.User{Id: "1234", Name: "TwitchNameA"})
+	a.Connected = true
+	lobby.Owner = a
+	lobby.creator = a
+	b := lobby.JoinPlayer(&auth.User{Id: "1235", Name: "TwitchNameB"})
+	b.Connected = true
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "start"}, a); err != nil {
+		t.Fatalf("Couldn't start lobby: %s", err)
+	}
+
+	return lobby, fakeClock, a, b, &events
+}
+
+// createTestLobby creates an unstarted lobby with a single slot, which is
+// taken by the owner, who is also the creator.
+func createTestLobby() *Lobby {
+	lobby := &Lobby{
+		mutex: &sync.Mutex{},
+		EditableLobbySettings: &EditableLobbySettings{
+			DrawingTime: 120,
+			Rounds:      1,
+			MaxPlayers:  1,
+		},
+		words:      []string{"abc", "def", "ghi", "jkl", "mno", "pqr"},
+		lowercaser: cases.Lower(language.English),
+	}
+	lobby.WriteJSON = func(conn *SocketConnection, object interface{}) error {
+		return nil
+	}
+	owner := lobby.JoinPlayer(&auth.User{Id: "owner", Name: "Owner", Provider: auth.ProviderGuest})
+	lobby.Owner = owner
+	lobby.creator = owner
+	return lobby
+}
+
+func countRevealedHints(lobby *Lobby) int {
+	var revealed int
+	for _, hint := range lobby.wordHints {
+		if hint.Character != 0 {
+			revealed++
+		}
+	}
+	return revealed
+}
+
+func Test_turnTimeline(t *testing.T) {
+	lobby, fakeClock, a, b, _ := createTimedLobby(t, "abcdefgh", "abcdefgh", "abcdefgh", "abcdefgh", "abcdefgh", "abcdefgh")
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, a); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+
+	//Eight characters result in two hints, one being revealed every 40
+	//seconds of the 120 seconds drawing time.
+	expectations := []struct {
+		advance time.Duration
+		hints   int
+		phase   TurnPhase
+	}{
+		{advance: 39 * time.Second, hints: 0, phase: PhaseDrawing},
+		{advance: time.Second, hints: 1, phase: PhaseDrawing},
+		{advance: 39 * time.Second, hints: 1, phase: PhaseDrawing},
+		{advance: time.Second, hints: 2, phase: PhaseDrawing},
+		{advance: 39 * time.Second, hints: 2, phase: PhaseDrawing},
+		{advance: time.Second, hints: 0, phase: PhaseIntermission},
+		{advance: 4 * time.Second, hints: 0, phase: PhaseIntermission},
+		{advance: time.Second, hints: 0, phase: PhaseChoosing},
+	}
+
+	var elapsed time.Duration
+	for _, expected := range expectations {
+		fakeClock.Advance(expected.advance)
+		elapsed += expected.advance
+
+		if revealed := countRevealedHints(lobby); revealed != expected.hints {
+			t.Errorf("After %s, %d hints should've been revealed, but were %d", elapsed, expected.hints, revealed)
+		}
+		if lobby.Phase != expected.phase {
+			t.Errorf("After %s, phase should've been %s, but was %s", elapsed, expected.phase, lobby.Phase)
+		}
+	}
+
+	if lobby.drawer != b {
+		t.Errorf("Drawer should've been b, but was %v", lobby.drawer)
+	}
+	if lobby.Round != 1 {
+		t.Errorf("Round should've still been 1, but was %d", lobby.Round)
+	}
+}
+
+func Test_turnTimeoutWithoutChosenWord(t *testing.T) {
+	lobby, fakeClock, a, b, events := createTimedLobby(t, "abc", "abc", "abc", "abc", "abc", "abc")
+
+	fakeClock.Advance(119 * time.Second)
+	if lobby.drawer != a {
+		t.Errorf("Drawer should've still been a, but was %v", lobby.drawer)
+	}
+
+	//Since no word has been chosen, there's nothing to show and the next
+	//turn starts without an intermission.
+	fakeClock.Advance(time.Second)
+	if lobby.drawer != b || lobby.Phase != PhaseChoosing {
+		t.Errorf("Drawer should've been b while choosing, but was %v in phase %s", lobby.drawer, lobby.Phase)
+	}
+
+	for _, eventType := range *events {
+		if eventType == "turn-over" {
+			t.Error("No turn-over event should've been sent")
+		}
+	}
+}
+
+func Test_turnIntermission(t *testing.T) {
+	lobby, fakeClock, a, b, events := createTimedLobby(t, "abc", "def", "ghi", "jkl", "mno", "pqr")
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, a); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+	if lobby.Phase != PhaseDrawing {
+		t.Fatalf("Phase should've been %s, but was %s", PhaseDrawing, lobby.Phase)
+	}
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "message", Data: lobby.CurrentWord}, b); err != nil {
+		t.Fatalf("Couldn't guess word: %s", err)
+	}
+
+	if lobby.Phase != PhaseIntermission {
+		t.Errorf("Phase should've been %s, but was %s", PhaseIntermission, lobby.Phase)
+	}
+	if lobby.canDraw(a) {
+		t.Error("Drawer shouldn't be able to draw during the intermission")
+	}
+
+	//The lobby isn't locked during the intermission, so chatting works.
+	lobby.Synchronized(func() {})
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "message", Data: "gg"}, b); err != nil {
+		t.Errorf("Couldn't send message: %s", err)
+	}
+
+	fakeClock.Advance(lobby.intermission)
+	if lobby.Phase != PhaseChoosing {
+		t.Fatalf("Next turn wasn't started after the intermission, phase was %s", lobby.Phase)
+	}
+	if lobby.drawer != b {
+		t.Errorf("Drawer should've been b, but was %v", lobby.drawer)
+	}
+	if lobby.intermissionTimer != nil {
+		t.Error("Intermission timer should've been reset")
+	}
+
+	nextTurnCount := 0
+	for _, eventType := range *events {
+		if eventType == "next-turn" {
+			nextTurnCount++
+		}
+	}
+	//Two turns for two players each.
+	if nextTurnCount != 4 {
+		t.Errorf("Expected four next-turn events, but got %d", nextTurnCount)
+	}
+}
+
+func Test_kickDuringIntermission(t *testing.T) {
+	lobby, fakeClock, a, b, _ := createTimedLobby(t, "abc", "def", "ghi", "jkl", "mno", "pqr")
+	c := lobby.JoinPlayer(&auth.User{Id: "1236", Name: "TwitchNameC"})
+	c.Connected = true
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, a); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+	fakeClock.Advance(120 * time.Second)
+	if lobby.Phase != PhaseIntermission {
+		t.Fatalf("Phase should've been %s, but was %s", PhaseIntermission, lobby.Phase)
+	}
+
+	//b would've been next, so c has to take over.
+	kickPlayer(lobby, b, 1)
+	if lobby.Phase != PhaseIntermission {
+		t.Errorf("Kicking shouldn't end the intermission, but phase was %s", lobby.Phase)
+	}
+
+	fakeClock.Advance(lobby.intermission)
+	if lobby.drawer != c {
+		t.Errorf("Drawer should've been c, but was %v", lobby.drawer)
+	}
+}
+
+func Test_disconnectDuringIntermission(t *testing.T) {
+	lobby, fakeClock, a, b, events := createTimedLobby(t, "abc", "def", "ghi", "jkl", "mno", "pqr")
+	c := lobby.JoinPlayer(&auth.User{Id: "1236", Name: "TwitchNameC"})
+	c.Connected = true
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, a); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+	fakeClock.Advance(120 * time.Second)
+
+	//The drawer reconnecting during the intermission isn't choosing yet.
+	*events = nil
+	lobby.OnPlayerConnectUnsynchronized(a)
+	for _, eventType := range *events {
+		if eventType == "your-turn" {
+			t.Error("Drawer shouldn't be asked to choose during the intermission")
+		}
+	}
+
+	//b would've been next, but left, so c has to take over.
+	b.Connected = false
+	fakeClock.Advance(lobby.intermission)
+	if lobby.drawer != c {
+		t.Errorf("Drawer should've been c, but was %v", lobby.drawer)
+	}
+}
+
+func Test_observerWordVisibility(t *testing.T) {
+	lobby, _, a, _, _ := createTimedLobby(t, "abc", "abc", "abc")
+	observer := lobby.JoinObserver(nil, false)
+	caster := lobby.JoinObserver(nil, true)
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, a); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+
+	for _, hint := range generateObserverReadyData(lobby, observer).WordHints {
+		if hint.Character != 0 {
+			t.Error("Word hints for observer contained visible character")
+		}
+	}
+
+	for index, hint := range generateObserverReadyData(lobby, caster).WordHints {
+		if hint.Character != rune("abc"[index]) {
+			t.Errorf("Character at index %d was %c instead of %c", index, hint.Character, "abc"[index])
+		}
+	}
+}
+
+func Test_observerParticipation(t *testing.T) {
+	lobby, _, a, b, _ := createTimedLobby(t, "abc", "abc", "abc")
+	anonymous := lobby.JoinObserver(nil, false)
+	viewer := lobby.JoinObserver(&auth.User{Id: "999", Name: "Viewer"}, false)
+
+	received := make(map[*SocketConnection][]string)
+	lobby.WriteJSON = func(conn *SocketConnection, object interface{}) error {
+		if event, isEvent := object.(*GameEvent); isEvent {
+			received[conn] = append(received[conn], event.Type)
+		}
+		return nil
+	}
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, a); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+
+	received = make(map[*SocketConnection][]string)
+	guess := &GameEvent{Type: "message", Data: "abc"}
+	if err := lobby.HandleObserverEvent(guess, viewer); err != ErrParticipationDisabled {
+		t.Errorf("expected ErrParticipationDisabled, but got %v", err)
+	}
+
+	lobby.ObserverParticipation = true
+	if err := lobby.HandleObserverEvent(guess, anonymous); err != ErrAnonymousObserver {
+		t.Errorf("expected ErrAnonymousObserver, but got %v", err)
+	}
+	if err := lobby.HandleObserverEvent(guess, viewer); err != nil {
+		t.Fatalf("error handling observer guess: %s", err)
+	}
+
+	if score := lobby.viewers["999"].Score; score <= 0 {
+		t.Errorf("expected viewer to score, but got %d", score)
+	}
+	if a.Score != 0 || b.Score != 0 {
+		t.Errorf("expected player scores to be untouched, but got %d and %d", a.Score, b.Score)
+	}
+	if len(received[b.SocketConnection]) != 0 {
+		t.Errorf("expected players not to receive observer events, but got %v", received[b.SocketConnection])
+	}
+	if !lobby.seesWord(viewer) || lobby.seesWord(anonymous) {
+		t.Error("expected only the guessing viewer to see the word")
+	}
+}
+
+func Test_delayedObserverGuess(t *testing.T) {
+	lobby, fakeClock, a, _, _ := createTimedLobby(t, "abc", "abc", "abc")
+	lobby.ObserverParticipation = true
+	viewer := lobby.JoinObserver(&auth.User{Id: "999", Name: "Viewer"}, false)
+	viewer.SetDelay(30 * time.Second)
+	kicked := lobby.JoinObserver(&auth.User{Id: "998", Name: "Kicked"}, false)
+	lobby.KickedUsers = append(lobby.KickedUsers, auth.User{Id: "998"})
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, a); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+
+	guess := &GameEvent{Type: "message", Data: "abc"}
+	if err := lobby.HandleObserverEvent(guess, kicked); err != ErrRestrictedObserver {
+		t.Errorf("expected ErrRestrictedObserver, but got %v", err)
+	}
+
+	//The viewer can't see the turn yet, so the word is just a message.
+	if err := lobby.HandleObserverEvent(guess, viewer); err != nil {
+		t.Fatalf("error handling observer guess: %s", err)
+	}
+	if score := lobby.viewers["999"].Score; score != 0 {
+		t.Errorf("expected guess before the turn was visible not to score, but got %d", score)
+	}
+
+	//Once visible, the guess is scored as of the moment the viewer sees.
+	fakeClock.Advance(30 * time.Second)
+	if err := lobby.HandleObserverEvent(guess, viewer); err != nil {
+		t.Fatalf("error handling observer guess: %s", err)
+	}
+	expected := calculateGuesserScore(lobby.hintCount, lobby.hintCount, lobby.DrawingTime, lobby.DrawingTime)
+	if score := lobby.viewers["999"].Score; score != expected {
+		t.Errorf("expected score %d, but got %d", expected, score)
+	}
+	if !lobby.seesWord(viewer) {
+		t.Error("expected the guessing viewer to see the word")
+	}
+}
+
+func Test_Kick(t *testing.T) {
+	lobby := createTestLobby()
+	lobby.MaxPlayers = 3
+	mod := lobby.JoinPlayer(&auth.User{Id: "mod", Name: "Mod", Provider: auth.ProviderGuest})
+	otherMod := lobby.JoinPlayer(&auth.User{Id: "other-mod", Name: "Other Mod", Provider: auth.ProviderGuest})
+	lobby.mods = map[string]bool{"mod": true, "other-mod": true}
+
+	if err := lobby.Kick(mod.user, "owner"); err != ErrProtectedPlayer {
+		t.Errorf("Expected the creator to be protected, got %v", err)
+	}
+	if err := lobby.Kick(mod.user, "other-mod"); err != ErrProtectedPlayer {
+		t.Errorf("Expected mods to be protected from other mods, got %v", err)
+	}
+	if err := lobby.Kick(mod.user, "mod"); err != ErrKickSelf {
+		t.Errorf("Expected self kicks to fail, got %v", err)
+	}
+	if len(lobby.KickedUsers) != 0 {
+		t.Fatalf("Expected nobody to be kicked, got %v", lobby.KickedUsers)
+	}
+
+	//Only the creator may kick mods.
+	if err := lobby.Kick(lobby.creator.user, otherMod.ID); err != nil {
+		t.Errorf("Expected the creator to kick the mod, got %v", err)
+	}
+	if err := lobby.Kick(lobby.creator.user, otherMod.ID); err != ErrPlayerNotFound {
+		t.Errorf("Expected the kicked mod to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package game
+
+import "github.com/scribble-rs/scribble.rs/metrics"
+
+var (
+	turnDuration = metrics.NewHistogram("scribblers_turn_duration_seconds",
+		"Time from choosing a word until the end of the turn.",
+		[]float64{5, 10, 20, 30, 45, 60, 90, 120, 180, 300})
+	guessLatency = metrics.NewHistogram("scribblers_guess_latency_seconds",
+		"Time from choosing a word until a player guessed it correctly.",
+		[]float64{1, 2, 5, 10, 20, 30, 45, 60, 90, 120})
+	writeErrors = metrics.NewCounter("scribblers_websocket_write_errors_total",
+		"Websocket connections dropped due to failed or overflowing writes.",
+		"reason")
+)
@@ -0,0 +1,280 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+// Role describes how a user relates to a lobby. Users usually have multiple
+// roles, for example a mod that is also playing.
+type Role string
+
+const (
+	// RoleCreator is the user that opened the lobby. The creator may always
+	// perform all actions, so that streamers can't lock themselves out.
+	RoleCreator Role = "creator"
+	// RoleOwner is the player currently owning the lobby. Initially that's
+	// the creator, but ownership is passed on if the owner is kicked.
+	RoleOwner Role = "owner"
+	// RoleMod applies to the moderators of the creator's channel.
+	RoleMod Role = "mod"
+	// RoleVIP applies to the VIPs of the creator's channel.
+	RoleVIP Role = "vip"
+	// RolePlayer applies to everyone playing in the lobby.
+	RolePlayer Role = "player"
+	// RoleObserver applies to everyone, as anyone may observe a lobby.
+	RoleObserver Role = "observer"
+)
+
+// Roles are all roles, ordered from most to least privileged.
+var Roles = []Role{RoleCreator, RoleOwner, RoleMod, RoleVIP, RolePlayer, RoleObserver}
+
+// Action is something that not everyone in a lobby may do.
+type Action string
+
+const (
+	ActionStart Action = "start"
+	// ActionSkip ends the current turn early.
+	ActionSkip Action = "skip"
+	// ActionPause stops the time of the current turn until resumed.
+	ActionPause        Action = "pause"
+	ActionKick         Action = "kick"
+	ActionEditSettings Action = "edit-settings"
+	// ActionMute hides the chat messages of a player from everyone else.
+	// Their guesses still count.
+	ActionMute Action = "mute"
+	// ActionClearCanvas allows clearing the canvas of someone else's turn.
+	// Drawers can always clear their own canvas.
+	ActionClearCanvas Action = "clear-canvas"
+	// ActionClose shuts the lobby down for good.
+	ActionClose Action = "close"
+	// ActionCast allows observing the lobby in the caster view, which
+	// reveals the word.
+	ActionCast Action = "cast"
+)
+
+// Actions are all actions that require a permission.
+var Actions = []Action{ActionStart, ActionSkip, ActionPause, ActionKick, ActionEditSettings, ActionMute, ActionClearCanvas, ActionClose, ActionCast}
+
+// Permissions map actions to the roles allowed to perform them. Channels
+// can change them for their lobbies in their settings.
+type Permissions map[Action][]Role
+
+// DefaultPermissions apply to actions a channel hasn't configured.
+var DefaultPermissions = Permissions{
+	ActionStart:        {RoleOwner},
+	ActionSkip:         {RoleOwner, RoleMod},
+	ActionPause:        {RoleOwner, RoleMod},
+	ActionKick:         {RoleMod},
+	ActionEditSettings: {RoleOwner},
+	ActionMute:         {RoleOwner, RoleMod},
+	ActionClearCanvas:  {RoleMod},
+	ActionClose:        {RoleOwner},
+	ActionCast:         {RoleOwner, RoleMod},
+}
+
+// Roles returns the roles allowed to perform the action, falling back to
+// DefaultPermissions. RoleCreator is always included.
+func (permissions Permissions) Roles(action Action) []Role {
+	roles, configured := permissions[action]
+	if !configured {
+		roles = DefaultPermissions[action]
+	}
+	return append([]Role{RoleCreator}, roles...)
+}
+
+// Allows indicates whether the role may perform the action.
+func (permissions Permissions) Allows(action Action, role Role) bool {
+	for _, allowed := range permissions.Roles(action) {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePermissions validates permissions in their stored form, as saved by
+// Permissions.Serialize.
+func ParsePermissions(raw map[string][]string) (Permissions, error) {
+	permissions := make(Permissions, len(raw))
+	for rawAction, rawRoles := range raw {
+		action := Action(rawAction)
+		if !isAction(action) {
+			return nil, fmt.Errorf("unknown action '%s'", rawAction)
+		}
+
+		roles := make([]Role, 0, len(rawRoles))
+		for _, rawRole := range rawRoles {
+			role := Role(rawRole)
+			if !isRole(role) {
+				return nil, fmt.Errorf("unknown role '%s'", rawRole)
+			}
+			//The creator is implied.
+			if role != RoleCreator {
+				roles = append(roles, role)
+			}
+		}
+		permissions[action] = roles
+	}
+
+	return permissions, nil
+}
+
+// Serialize returns the permissions in the form they are stored in.
+func (permissions Permissions) Serialize() map[string][]string {
+	raw := make(map[string][]string, len(permissions))
+	for action, roles := range permissions {
+		rawRoles := make([]string, len(roles))
+		for index, role := range roles {
+			rawRoles[index] = string(role)
+		}
+		raw[string(action)] = rawRoles
+	}
+	return raw
+}
+
+func isAction(action Action) bool {
+	for _, known := range Actions {
+		if known == action {
+			return true
+		}
+	}
+	return false
+}
+
+func isRole(role Role) bool {
+	for _, known := range Roles {
+		if known == role {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadPermissions returns the permissions configured by the channel.
+func LoadPermissions(db *database.DB, channelId string) (Permissions, error) {
+	raw, err := db.GetPermissions(channelId)
+	if err != nil || raw == nil {
+		return Permissions{}, err
+	}
+	return ParsePermissions(raw)
+}
+
+// SetPermissions replaces the permissions of the lobby, for example after
+// the creator changed them in their settings.
+func (lobby *Lobby) SetPermissions(permissions Permissions) {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	lobby.permissions = permissions
+	lobby.sendAllowedActions()
+}
+
+// ReloadPermissions loads the permissions of the creator's channel again,
+// for example after they have been changed on another instance.
+func (lobby *Lobby) ReloadPermissions() error {
+	//Tests don't necessarily have a database.
+	if lobby.db == nil {
+		return nil
+	}
+
+	permissions, err := LoadPermissions(lobby.db, lobby.GetCreator().Id)
+	if err != nil {
+		return err
+	}
+
+	lobby.SetPermissions(permissions)
+	return nil
+}
+
+// IsAllowed checks whether the user may perform the action in the lobby.
+func (lobby *Lobby) IsAllowed(user *auth.User, action Action) bool {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	return lobby.isAllowed(user, action)
+}
+
+// isAllowed is the authorization check for all actions. Roles are only
+// checked until one of them allows the action, as some require database
+// queries. The lobby has to be locked.
+func (lobby *Lobby) isAllowed(user *auth.User, action Action) bool {
+	if user == nil {
+		return false
+	}
+
+	for _, role := range lobby.permissions.Roles(action) {
+		if lobby.hasRole(user, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (lobby *Lobby) hasRole(user *auth.User, role Role) bool {
+	switch role {
+	case RoleCreator:
+		return lobby.IsCreator(user)
+	case RoleOwner:
+		return lobby.Owner != nil && lobby.Owner.user.Id == user.Id
+	case RoleMod:
+		return lobby.IsMod(user)
+	case RoleVIP:
+		return lobby.isVIP(user)
+	case RolePlayer:
+		return lobby.GetPlayer(user) != nil
+	case RoleObserver:
+		return true
+	}
+	return false
+}
+
+// isVIP checks whether the user is a VIP of the creator's channel, as of
+// the last sync. The lobby has to be locked.
+func (lobby *Lobby) isVIP(user *auth.User) bool {
+	if lobby.vips == nil {
+		if lobby.db == nil {
+			return false
+		}
+
+		vips, err := lobby.db.GetChannelList(lobby.creator.user.Id, database.ListVIP)
+		if err != nil {
+			//Not caching anything, so that the next check tries again.
+			lobby.Logger().Warn("Failed loading VIPs", logging.KeyError, err)
+			return false
+		}
+
+		lobby.vips = make(map[string]bool, len(vips))
+		for _, vip := range vips {
+			lobby.vips[vip.Id] = true
+		}
+	}
+
+	return lobby.vips[user.Id]
+}
+
+// allowedActions returns all actions the user may perform, so that clients
+// only offer those. The lobby has to be locked.
+func (lobby *Lobby) allowedActions(user *auth.User) []Action {
+	actions := make([]Action, 0, len(Actions))
+	for _, action := range Actions {
+		if lobby.isAllowed(user, action) {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// sendAllowedActions tells all players which actions they may perform. This
+// is necessary whenever roles or permissions change. The lobby has to be
+// locked.
+func (lobby *Lobby) sendAllowedActions() {
+	for _, player := range lobby.players {
+		if player.Connected {
+			lobby.send(player.SocketConnection, GameEvent{Type: "allowed-actions", Data: lobby.allowedActions(player.user)})
+		}
+	}
+}
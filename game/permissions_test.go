@@ -0,0 +1,104 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+)
+
+func Test_isAllowed(t *testing.T) {
+	lobby := createTestLobby()
+	creator := lobby.creator.user
+	player := lobby.JoinPlayer(&auth.User{Id: "player", Name: "Player", Provider: auth.ProviderGuest}).user
+	observer := &auth.User{Id: "observer", Name: "Observer", Provider: auth.ProviderGuest}
+
+	if !lobby.isAllowed(creator, ActionStart) || lobby.isAllowed(player, ActionStart) {
+		t.Error("Expected only the owner to be allowed to start by default")
+	}
+
+	//Passing on ownership passes on the owner's permissions, but the creator
+	//keeps theirs.
+	lobby.Owner = lobby.players[1]
+	if !lobby.isAllowed(player, ActionEditSettings) || !lobby.isAllowed(creator, ActionEditSettings) {
+		t.Error("Expected both the owner and the creator to be allowed to edit settings")
+	}
+	lobby.Owner = lobby.creator
+
+	lobby.permissions = Permissions{ActionKick: {RolePlayer}, ActionStart: {}}
+	if !lobby.isAllowed(player, ActionKick) || lobby.isAllowed(observer, ActionKick) {
+		t.Error("Expected players, but not observers, to be allowed to kick")
+	}
+	if !lobby.isAllowed(creator, ActionStart) {
+		t.Error("Expected the creator to always be allowed to start")
+	}
+	if lobby.isAllowed(nil, ActionClose) {
+		t.Error("Expected anonymous users to never be allowed anything")
+	}
+}
+
+func Test_isAllowedCast(t *testing.T) {
+	lobby := createTestLobby()
+	vip := &auth.User{Id: "vip", Name: "VIP", Provider: auth.ProviderGuest}
+
+	lobby.vips = map[string]bool{"vip": true}
+	if lobby.CanCast(vip) {
+		t.Error("Expected VIPs not to be allowed to cast by default")
+	}
+
+	lobby.permissions = Permissions{ActionCast: {RoleVIP}}
+	if !lobby.CanCast(vip) {
+		t.Error("Expected cached VIPs to be allowed to cast")
+	}
+
+	//Without a database, nobody is a VIP after reloading.
+	lobby.InvalidateMods()
+	if lobby.CanCast(vip) {
+		t.Error("Expected VIPs to be reloaded")
+	}
+}
+
+func Test_ParsePermissions(t *testing.T) {
+	permissions, err := ParsePermissions(map[string][]string{"skip": {"creator", "vip"}, "kick": {}})
+	if err != nil {
+		t.Fatalf("Couldn't parse permissions: %s", err)
+	}
+	if roles := permissions[ActionSkip]; len(roles) != 1 || roles[0] != RoleVIP {
+		t.Errorf("Expected the creator to be dropped, got %v", roles)
+	}
+	if roles := permissions.Roles(ActionKick); len(roles) != 1 || roles[0] != RoleCreator {
+		t.Errorf("Expected only the creator to be allowed to kick, got %v", roles)
+	}
+	if roles := permissions.Roles(ActionStart); len(roles) != 2 || roles[1] != RoleOwner {
+		t.Errorf("Expected unconfigured actions to fall back to the defaults, got %v", roles)
+	}
+
+	if _, err := ParsePermissions(map[string][]string{"ban": {"mod"}}); err == nil {
+		t.Error("Expected unknown action to be rejected")
+	}
+	if _, err := ParsePermissions(map[string][]string{"kick": {"admin"}}); err == nil {
+		t.Error("Expected unknown role to be rejected")
+	}
+}
+
+func Test_toggleMute(t *testing.T) {
+	lobby := createTestLobby()
+	lobby.MaxPlayers = 2
+	player := lobby.JoinPlayer(&auth.User{Id: "player", Name: "Player", Provider: auth.ProviderGuest})
+
+	lobby.permissions = Permissions{ActionMute: {RolePlayer}}
+	if handled, _ := lobby.handleActionEvent(player.user, &GameEvent{Type: "mute", Data: lobby.creator.ID}); !handled {
+		t.Fatal("Expected mute event to be handled")
+	}
+	if lobby.creator.Muted {
+		t.Error("Expected the creator to be protected from being muted")
+	}
+
+	lobby.handleActionEvent(lobby.creator.user, &GameEvent{Type: "mute", Data: player.ID})
+	if !player.Muted {
+		t.Fatal("Expected player to be muted")
+	}
+	lobby.handleActionEvent(lobby.creator.user, &GameEvent{Type: "mute", Data: player.ID})
+	if player.Muted {
+		t.Error("Expected player to be unmuted")
+	}
+}
@@ -0,0 +1,115 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+)
+
+// Channel point rewards are matched by their title, so streamers only have
+// to create rewards with one of these titles on Twitch.
+const (
+	// RewardJoin reserves a seat for the viewer, allowing them to join even
+	// if the lobby is full.
+	RewardJoin = "Scribble.rs: Join"
+	// RewardSuggestWord offers the text entered by the viewer to the next
+	// drawer. The reward has to require text input.
+	RewardSuggestWord = "Scribble.rs: Suggest word"
+	// RewardBonusHint reveals an additional character of the current word.
+	RewardBonusHint = "Scribble.rs: Bonus hint"
+)
+
+// Rewards are the titles of all supported channel point rewards.
+var Rewards = []string{RewardJoin, RewardSuggestWord, RewardBonusHint}
+
+const (
+	// maxSuggestedWords limits the words waiting to be offered to drawers,
+	// as only one is offered per turn.
+	maxSuggestedWords = 10
+	// maxSuggestedWordLength is generous, but prevents viewers from
+	// suggesting whole sentences.
+	maxSuggestedWordLength = 30
+)
+
+var (
+	ErrUnknownReward = errors.New("unknown reward")
+	// ErrRewardNotApplicable is returned if a reward can't be applied to the
+	// lobby in its current state, for example a hint while nobody draws.
+	ErrRewardNotApplicable = errors.New("reward can't be applied right now")
+)
+
+// Redeem applies the channel point reward with the given title, which has
+// been redeemed by the given viewer. Input is the text entered by the
+// viewer, if the reward requires any.
+func (lobby *Lobby) Redeem(reward string, user *auth.User, input string) error {
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	switch {
+	case strings.EqualFold(reward, RewardJoin):
+		return lobby.queuePlayer(user)
+	case strings.EqualFold(reward, RewardSuggestWord):
+		return lobby.suggestWord(user, input)
+	case strings.EqualFold(reward, RewardBonusHint):
+		return lobby.bonusHint(user)
+	}
+
+	return ErrUnknownReward
+}
+
+func (lobby *Lobby) queuePlayer(user *auth.User) error {
+	if lobby.GetPlayer(user) != nil || lobby.isQueued(user) || lobby.HasBeenKicked(user) {
+		return ErrRewardNotApplicable
+	}
+
+	lobby.playerQueue = append(lobby.playerQueue, user.Id)
+	lobby.TriggerUpdateEvent("system-message", fmt.Sprintf("%s redeemed a seat in this lobby.", user.Name))
+	return nil
+}
+
+// isQueued indicates whether the user has redeemed a seat and hasn't joined
+// yet.
+func (lobby *Lobby) isQueued(user *auth.User) bool {
+	for _, userID := range lobby.playerQueue {
+		if userID == user.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (lobby *Lobby) dequeuePlayer(user *auth.User) {
+	for index, userID := range lobby.playerQueue {
+		if userID == user.Id {
+			lobby.playerQueue = append(lobby.playerQueue[:index], lobby.playerQueue[index+1:]...)
+			return
+		}
+	}
+}
+
+func (lobby *Lobby) suggestWord(user *auth.User, input string) error {
+	word := lobby.lowercaser.String(strings.TrimSpace(input))
+	if word == "" || utf8.RuneCountInString(word) > maxSuggestedWordLength ||
+		len(lobby.suggestedWords) >= maxSuggestedWords {
+		return ErrRewardNotApplicable
+	}
+
+	lobby.suggestedWords = append(lobby.suggestedWords, word)
+	//The word itself isn't shown, as it might be chosen later on.
+	lobby.TriggerUpdateEvent("system-message", fmt.Sprintf("%s suggested a word.", user.Name))
+	return nil
+}
+
+func (lobby *Lobby) bonusHint(user *auth.User) error {
+	if lobby.Phase != PhaseDrawing || lobby.hintsLeft <= 0 || lobby.wordHints == nil {
+		return ErrRewardNotApplicable
+	}
+
+	lobby.TriggerUpdateEvent("system-message", fmt.Sprintf("%s redeemed a bonus hint.", user.Name))
+	lobby.revealHint()
+	return nil
+}
@@ -0,0 +1,81 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+)
+
+func Test_redeemJoin(t *testing.T) {
+	lobby := createTestLobby()
+	service := &Service{}
+	viewer := &auth.User{Id: "viewer", Name: "Viewer", Provider: auth.ProviderGuest}
+
+	if canJoin, _, _ := service.CanJoin(viewer, lobby); canJoin {
+		t.Fatal("Viewer shouldn't be able to join full lobby")
+	}
+
+	if err := lobby.Redeem("scribble.rs: join", viewer, ""); err != nil {
+		t.Fatalf("Couldn't redeem seat: %s", err)
+	}
+	if err := lobby.Redeem(RewardJoin, viewer, ""); err != ErrRewardNotApplicable {
+		t.Errorf("Expected seat to be redeemable only once, got %v", err)
+	}
+	if canJoin, reason, _ := service.CanJoin(viewer, lobby); !canJoin {
+		t.Fatalf("Viewer should be able to join with a redeemed seat, got '%s'", reason)
+	}
+
+	lobby.JoinPlayer(viewer)
+	if lobby.isQueued(viewer) {
+		t.Error("Seat should be used up after joining")
+	}
+}
+
+func Test_redeemSuggestWord(t *testing.T) {
+	lobby := createTestLobby()
+	viewer := &auth.User{Id: "viewer", Name: "Viewer"}
+
+	if err := lobby.Redeem(RewardSuggestWord, viewer, "  "); err != ErrRewardNotApplicable {
+		t.Errorf("Expected empty suggestion to be rejected, got %v", err)
+	}
+	if err := lobby.Redeem(RewardSuggestWord, viewer, " Banana "); err != nil {
+		t.Fatalf("Couldn't suggest word: %s", err)
+	}
+
+	words := GetRandomWords(3, lobby)
+	if len(words) != 3 || words[2] != "banana" {
+		t.Errorf("Expected suggestion to be offered, got %v", words)
+	}
+	if words := GetRandomWords(3, lobby); words[2] == "banana" {
+		t.Error("Suggestion should only be offered once")
+	}
+}
+
+func Test_redeemBonusHint(t *testing.T) {
+	lobby := createTestLobby()
+	viewer := &auth.User{Id: "viewer", Name: "Viewer"}
+
+	if err := lobby.Redeem(RewardBonusHint, viewer, ""); err != ErrRewardNotApplicable {
+		t.Errorf("Expected hint to be rejected while nobody draws, got %v", err)
+	}
+
+	lobby.wordChoice = []string{"abcdefgh"}
+	lobby.selectWord(0)
+	if err := lobby.Redeem(RewardBonusHint, viewer, ""); err != nil {
+		t.Fatalf("Couldn't redeem hint: %s", err)
+	}
+
+	revealed := 0
+	for _, hint := range lobby.wordHints {
+		if hint.Character != 0 {
+			revealed++
+		}
+	}
+	if revealed != 1 || lobby.hintsLeft != lobby.hintCount-1 {
+		t.Errorf("Expected one revealed hint, got %d and %d hints left", revealed, lobby.hintsLeft)
+	}
+
+	if err := lobby.Redeem("Hydrate", viewer, ""); err != ErrUnknownReward {
+		t.Errorf("Expected unknown reward, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package game
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/clock"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+// relayInterval is the time drawing events are collected before relaying
+// them. Drawers send an event for every mouse movement, so collecting them
+// saves encoding and sending each of them for each recipient.
+const relayInterval = 50 * time.Millisecond
+
+// DrawingBatch contains drawing events that have been encoded once for all
+// recipients.
+type DrawingBatch struct {
+	// JSON contains one message per event, as JSON clients only know single
+	// events. It's nil if no recipient uses JSON.
+	JSON [][]byte
+	// Binary contains all events in a single message. It's nil if no
+	// recipient uses the BinaryProtocol.
+	Binary []byte
+}
+
+// relayDrawing queues a line or fill event for everyone except the sender.
+// The lobby has to be locked.
+func (lobby *Lobby) relayDrawing(sender *Player, event interface{}) {
+	if lobby.relaySender != sender {
+		lobby.flushDrawing()
+	}
+	lobby.relaySender = sender
+	lobby.relayed = append(lobby.relayed, event)
+	if lobby.relayTimer != nil {
+		return
+	}
+
+	var timer clock.Timer
+	timer = lobby.getClock().AfterFunc(relayInterval, func() {
+		lobby.mutex.Lock()
+		defer lobby.mutex.Unlock()
+
+		//The events might've been flushed while we were waiting for the lock.
+		if lobby.relayTimer == timer {
+			lobby.flushDrawing()
+		}
+	})
+	lobby.relayTimer = timer
+}
+
+// flushDrawing relays all queued drawing events right away. This has to
+// happen before sending anything else, as events have to arrive in order.
+// The lobby has to be locked.
+func (lobby *Lobby) flushDrawing() {
+	if lobby.relayTimer != nil {
+		lobby.relayTimer.Stop()
+		lobby.relayTimer = nil
+	}
+	if len(lobby.relayed) == 0 {
+		return
+	}
+
+	events, sender := lobby.relayed, lobby.relaySender
+	lobby.relayed, lobby.relaySender = nil, nil
+
+	recipients := make([]*SocketConnection, 0, len(lobby.players)+len(lobby.observers))
+	for _, player := range lobby.players {
+		if player != sender && player.Connected {
+			recipients = append(recipients, player.SocketConnection)
+		}
+	}
+	for _, observer := range lobby.observers {
+		recipients = append(recipients, observer.SocketConnection)
+	}
+
+	batch := &DrawingBatch{}
+	for _, recipient := range recipients {
+		if recipient.UsesBinaryProtocol() {
+			if batch.Binary == nil {
+				batch.Binary = encodeBinaryMessage(binaryDrawMessage, events)
+			}
+		} else if batch.JSON == nil {
+			batch.JSON = make([][]byte, 0, len(events))
+			for _, event := range events {
+				data, err := json.Marshal(event)
+				if err != nil {
+					lobby.Logger().Error("Failed encoding drawing", logging.KeyError, err)
+					return
+				}
+				batch.JSON = append(batch.JSON, data)
+			}
+		}
+	}
+
+	for _, recipient := range recipients {
+		lobby.WriteJSON(recipient, batch)
+	}
+}
+
+// send passes the object to WriteJSON after relaying pending drawing
+// events. The lobby has to be locked.
+func (lobby *Lobby) send(connection *SocketConnection, object interface{}) error {
+	lobby.flushDrawing()
+	return lobby.WriteJSON(connection, object)
+}
@@ -0,0 +1,59 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_relayDrawing(t *testing.T) {
+	lobby, fakeClock, a, b, _ := createTimedLobby(t, "abc", "abc", "abc")
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, a); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+
+	var received []interface{}
+	lobby.WriteJSON = func(conn *SocketConnection, object interface{}) error {
+		if conn == b.SocketConnection {
+			received = append(received, object)
+		}
+		return nil
+	}
+
+	line := &GameEvent{Type: "line", Data: map[string]interface{}{"fromX": 1, "fromY": 1, "toX": 2, "toY": 2, "lineWidth": 8}}
+	for i := 0; i < 3; i++ {
+		if err := lobby.HandleEvent(nil, line, a); err != nil {
+			t.Fatalf("Couldn't draw: %s", err)
+		}
+	}
+	if len(received) != 0 {
+		t.Fatalf("Expected lines to be collected, but got %v", received)
+	}
+
+	fakeClock.Advance(relayInterval)
+	if len(received) != 1 {
+		t.Fatalf("Expected a single batch, but got %v", received)
+	}
+	if batch, isBatch := received[0].(*DrawingBatch); !isBatch || len(batch.JSON) != 3 || batch.Binary != nil {
+		t.Errorf("Expected batch with three JSON events, but got %v", received[0])
+	}
+
+	//Pending lines have to arrive before anything sent afterwards.
+	received = nil
+	if err := lobby.HandleEvent(nil, line, a); err != nil {
+		t.Fatalf("Couldn't draw: %s", err)
+	}
+	lobby.TriggerUpdateEvent("system-message", "hello")
+	if len(received) != 2 {
+		t.Fatalf("Expected batch and message, but got %v", received)
+	}
+	if _, isBatch := received[0].(*DrawingBatch); !isBatch {
+		t.Errorf("Expected batch to be sent first, but got %v", received[0])
+	}
+
+	fakeClock.Advance(time.Second)
+	for _, object := range received[2:] {
+		if _, isBatch := object.(*DrawingBatch); isBatch {
+			t.Error("Expected no batch to be sent twice")
+		}
+	}
+}
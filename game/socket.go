@@ -0,0 +1,241 @@
+package game
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+const (
+	// outboundQueueSize is the maximum amount of messages that may be waiting
+	// to be written to a single connection. Clients that fall further behind
+	// get disconnected.
+	outboundQueueSize = 256
+	// writeWait is the time allowed for writing a single message.
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed for the client to answer a ping.
+	pongWait = 60 * time.Second
+	// pingPeriod has to be shorter than pongWait, so that the client has time
+	// to answer before the connection is considered dead.
+	pingPeriod = pongWait * 9 / 10
+	// maxDelayedMessages limits the memory a single delayed connection may
+	// occupy. Drawings consist of many small messages, so this is rather
+	// generous.
+	maxDelayedMessages = 20000
+)
+
+var (
+	ErrNotConnected = errors.New("player not connected")
+	ErrSlowConsumer = errors.New("outbound queue is full, client is too slow")
+)
+
+type outboundMessage struct {
+	messageType int
+	data        []byte
+}
+
+// socketWriter is the only one writing to its websocket connection, as
+// gorilla websockets don't support concurrent writers.
+type socketWriter struct {
+	ws    *websocket.Conn
+	queue chan outboundMessage
+	// done is closed once the writer should stop. Messages that are already
+	// queued at that point will still be written, unless the connection has
+	// been aborted.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSocketWriter(socket *websocket.Conn) *socketWriter {
+	//Pongs are read by the reading goroutine, but since we are the ones
+	//sending the pings, the deadline is handled here as well.
+	socket.SetReadDeadline(time.Now().Add(pongWait))
+	socket.SetPongHandler(func(string) error {
+		return socket.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	return &socketWriter{
+		ws:    socket,
+		queue: make(chan outboundMessage, outboundQueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+func (w *socketWriter) enqueue(message outboundMessage) error {
+	select {
+	case <-w.done:
+		return ErrNotConnected
+	default:
+	}
+
+	select {
+	case w.queue <- message:
+		return nil
+	default:
+		logging.Warn("Disconnecting client, as it can't keep up with outgoing messages", "remote_addr", w.ws.RemoteAddr())
+		writeErrors.Inc("slow_consumer")
+		w.abort()
+		return ErrSlowConsumer
+	}
+}
+
+// close stops the writer after all queued messages have been written.
+func (w *socketWriter) close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+// abort closes the connection immediately, dropping all queued messages. The
+// reading goroutine will notice and handle the disconnect.
+func (w *socketWriter) abort() {
+	w.close()
+	w.ws.Close()
+}
+
+func (w *socketWriter) run() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		w.ws.Close()
+	}()
+
+	for {
+		select {
+		case message := <-w.queue:
+			if err := w.write(message); err != nil {
+				w.handleWriteError(err)
+				return
+			}
+		case <-ticker.C:
+			if err := w.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				w.handleWriteError(err)
+				return
+			}
+		case <-w.done:
+			w.drain()
+			return
+		}
+	}
+}
+
+func (w *socketWriter) write(message outboundMessage) error {
+	if err := w.ws.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return w.ws.WriteMessage(message.messageType, message.data)
+}
+
+// drain writes the remaining messages and says goodbye to the client. This
+// makes sure that events such as "kick" still arrive.
+func (w *socketWriter) drain() {
+	for {
+		select {
+		case message := <-w.queue:
+			if err := w.write(message); err != nil {
+				return
+			}
+		default:
+			w.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(writeWait))
+			return
+		}
+	}
+}
+
+func (w *socketWriter) handleWriteError(err error) {
+	select {
+	case <-w.done:
+		//Errors are expected after the connection has been aborted.
+	default:
+		logging.Warn("Failed writing to socket", "remote_addr", w.ws.RemoteAddr(), logging.KeyError, err)
+		writeErrors.Inc("write")
+		w.close()
+	}
+}
+
+type delayedMessage struct {
+	message   outboundMessage
+	releaseAt time.Time
+}
+
+// delayBuffer holds messages back for a fixed duration before passing them
+// to the writer. Since all messages are delayed equally, the order is kept.
+// The buffer stops once the writer is done.
+type delayBuffer struct {
+	writer *socketWriter
+	delay  time.Duration
+
+	mutex   *sync.Mutex
+	pending []delayedMessage
+	// wakeup signals that a message has been added to an empty buffer.
+	wakeup chan struct{}
+}
+
+func newDelayBuffer(writer *socketWriter, delay time.Duration) *delayBuffer {
+	return &delayBuffer{
+		writer: writer,
+		delay:  delay,
+		mutex:  &sync.Mutex{},
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+func (b *delayBuffer) push(message outboundMessage) error {
+	b.mutex.Lock()
+	if len(b.pending) >= maxDelayedMessages {
+		b.mutex.Unlock()
+		logging.Warn("Disconnecting delayed client, as too many messages are pending", "remote_addr", b.writer.ws.RemoteAddr())
+		writeErrors.Inc("slow_consumer")
+		b.writer.abort()
+		return ErrSlowConsumer
+	}
+	b.pending = append(b.pending, delayedMessage{message: message, releaseAt: time.Now().Add(b.delay)})
+	b.mutex.Unlock()
+
+	select {
+	case b.wakeup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (b *delayBuffer) run() {
+	for {
+		b.mutex.Lock()
+		if len(b.pending) == 0 {
+			b.mutex.Unlock()
+			select {
+			case <-b.wakeup:
+				continue
+			case <-b.writer.done:
+				return
+			}
+		}
+		next := b.pending[0]
+		b.mutex.Unlock()
+
+		if wait := time.Until(next.releaseAt); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-b.writer.done:
+				timer.Stop()
+				return
+			}
+		}
+
+		b.mutex.Lock()
+		b.pending[0] = delayedMessage{}
+		b.pending = b.pending[1:]
+		b.mutex.Unlock()
+
+		if err := b.writer.enqueue(next.message); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package game
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// createTestSocketConnection returns a connected SocketConnection and the
+// client side of its websocket.
+func createTestSocketConnection(t *testing.T) (*SocketConnection, *websocket.Conn) {
+	t.Helper()
+	return createDelayedTestSocketConnection(t, 0)
+}
+
+// createDelayedTestSocketConnection works like createTestSocketConnection,
+// but the connection holds back messages by the given delay.
+func createDelayedTestSocketConnection(t *testing.T, delay time.Duration) (*SocketConnection, *websocket.Conn) {
+	t.Helper()
+
+	serverSockets := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		socket, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("error upgrading connection: %s", err)
+			return
+		}
+		serverSockets <- socket
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("error dialing test server: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	connection := CreateObserver().SocketConnection
+	connection.SetDelay(delay)
+	connection.SetWebsocket(<-serverSockets)
+	connection.Connected = true
+	t.Cleanup(func() { connection.SetWebsocket(nil) })
+
+	return connection, client
+}
+
+func Test_socketSendKeepsOrder(t *testing.T) {
+	connection, client := createTestSocketConnection(t)
+
+	messages := []string{"first", "second", "third"}
+	for _, message := range messages {
+		if err := connection.Send(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatalf("error sending message: %s", err)
+		}
+	}
+
+	for _, expected := range messages {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("error reading message: %s", err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected message %s, but got %s", expected, data)
+		}
+	}
+}
+
+func Test_socketCloseWritesQueuedMessages(t *testing.T) {
+	connection, client := createTestSocketConnection(t)
+
+	if err := connection.Send(websocket.TextMessage, []byte("kick")); err != nil {
+		t.Fatalf("error sending message: %s", err)
+	}
+	connection.closeWebsocket()
+
+	if err := connection.Send(websocket.TextMessage, []byte("too late")); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected after closing, but got %v", err)
+	}
+
+	_, data, err := client.ReadMessage()
+	if err != nil || string(data) != "kick" {
+		t.Fatalf("expected queued message, but got %s (%v)", data, err)
+	}
+
+	if _, _, err := client.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected normal close, but got %v", err)
+	}
+}
+
+func Test_socketSlowConsumerGetsDisconnected(t *testing.T) {
+	connection, client := createTestSocketConnection(t)
+
+	//The client never reads, so the socket buffers fill up and the writer
+	//blocks, leaving the queue to overflow.
+	payload := make([]byte, 64*1024)
+	var err error
+	for i := 0; i < outboundQueueSize*4 && err == nil; i++ {
+		err = connection.Send(websocket.BinaryMessage, payload)
+	}
+
+	if err != ErrSlowConsumer {
+		t.Fatalf("expected ErrSlowConsumer, but got %v", err)
+	}
+
+	if err := connection.Send(websocket.TextMessage, []byte("gone")); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected after overflow, but got %v", err)
+	}
+
+	for {
+		if _, _, err := client.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
+
+func Test_socketDelayKeepsOrder(t *testing.T) {
+	delay := 200 * time.Millisecond
+	connection, client := createDelayedTestSocketConnection(t, delay)
+
+	start := time.Now()
+	messages := []string{"first", "second", "third"}
+	for _, message := range messages {
+		if err := connection.Send(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatalf("error sending message: %s", err)
+		}
+	}
+
+	for _, expected := range messages {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("error reading message: %s", err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected message %s, but got %s", expected, data)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("expected messages to be delayed by at least %s, but got them after %s", delay, elapsed)
+	}
+}
+
+func Test_socketSendImmediatelySkipsDelay(t *testing.T) {
+	connection, client := createDelayedTestSocketConnection(t, time.Hour)
+
+	if err := connection.Send(websocket.TextMessage, []byte("delayed")); err != nil {
+		t.Fatalf("error sending message: %s", err)
+	}
+	if err := connection.SendImmediately(websocket.TextMessage, []byte("kick")); err != nil {
+		t.Fatalf("error sending message: %s", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := client.ReadMessage()
+	if err != nil || string(data) != "kick" {
+		t.Fatalf("expected undelayed message, but got %s (%v)", data, err)
+	}
+}
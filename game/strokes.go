@@ -0,0 +1,128 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+// strokeTimeout is the maximum time between two line events without a stroke
+// ID for them to still be considered part of the same stroke.
+const strokeTimeout = 150 * time.Millisecond
+
+// stroke marks the start of a range of connected draw events in the current
+// drawing. The range ends where the next stroke starts.
+type stroke struct {
+	// startIndex is the index of the first draw event in currentDrawing.
+	startIndex int
+	// id is the client provided stroke ID. 0 means the client didn't tag the
+	// draw events and the stroke boundaries have been guessed.
+	id uint32
+}
+
+// undoneStroke holds the draw events of a stroke that has been undone.
+type undoneStroke struct {
+	id       uint32
+	elements []interface{}
+}
+
+// trackStroke has to be called for each draw event before it is appended to
+// the current drawing. It decides whether the event continues the last
+// stroke or starts a new one. An error is returned if the stroke ID is
+// invalid, in which case the event must be discarded.
+func (lobby *Lobby) trackStroke(strokeID uint32, isFill bool) error {
+	now := lobby.getClock().Now()
+	var lastStroke *stroke
+	if len(lobby.strokes) > 0 {
+		lastStroke = &lobby.strokes[len(lobby.strokes)-1]
+	}
+
+	if strokeID == 0 {
+		//Old clients don't send stroke IDs, so we have to guess based on
+		//the time passed since the last event.
+		if isFill || lastStroke == nil || lastStroke.id != 0 ||
+			now.Sub(lobby.lastDrawEvent) > strokeTimeout || lobby.wasLastDrawEventFill() {
+			lobby.strokes = append(lobby.strokes, stroke{startIndex: len(lobby.currentDrawing)})
+		}
+	} else if lastStroke != nil && lastStroke.id == strokeID {
+		//A fill is a stroke on its own, so it can neither be continued nor
+		//continue a line.
+		if isFill || lobby.wasLastDrawEventFill() {
+			return fmt.Errorf("stroke %d can't contain both lines and fills", strokeID)
+		}
+	} else {
+		//Allowing clients to continue older strokes would mix up the
+		//drawing order and therefore break undo.
+		for _, finished := range lobby.strokes {
+			if finished.id == strokeID {
+				return fmt.Errorf("stroke %d has already been finished", strokeID)
+			}
+		}
+		lobby.strokes = append(lobby.strokes, stroke{startIndex: len(lobby.currentDrawing), id: strokeID})
+	}
+
+	lobby.lastDrawEvent = now
+	//Drawing something new makes the undone strokes obsolete, as redoing
+	//them would draw on top of the new stroke.
+	lobby.undoneStrokes = nil
+
+	return nil
+}
+
+func (lobby *Lobby) wasLastDrawEventFill() bool {
+	if len(lobby.currentDrawing) == 0 {
+		return false
+	}
+	_, isFillEvent := lobby.currentDrawing[len(lobby.currentDrawing)-1].(*FillEvent)
+	return isFillEvent
+}
+
+// undoStroke removes the last stroke from the current drawing. The return
+// value indicates whether anything has been removed.
+func (lobby *Lobby) undoStroke() bool {
+	if len(lobby.strokes) == 0 {
+		return false
+	}
+
+	lastStroke := lobby.strokes[len(lobby.strokes)-1]
+	lobby.strokes = lobby.strokes[:len(lobby.strokes)-1]
+	if lastStroke.startIndex >= len(lobby.currentDrawing) {
+		return false
+	}
+
+	//The backing array will be overwritten by the next draw events, so we
+	//need a copy in order to be able to redo the stroke.
+	elements := make([]interface{}, len(lobby.currentDrawing)-lastStroke.startIndex)
+	copy(elements, lobby.currentDrawing[lastStroke.startIndex:])
+	lobby.currentDrawing = lobby.currentDrawing[:lastStroke.startIndex]
+	lobby.undoneStrokes = append(lobby.undoneStrokes, undoneStroke{
+		id:       lastStroke.id,
+		elements: elements,
+	})
+
+	return true
+}
+
+// redoStroke restores the last undone stroke. The return value indicates
+// whether there was anything to restore.
+func (lobby *Lobby) redoStroke() bool {
+	if len(lobby.undoneStrokes) == 0 {
+		return false
+	}
+
+	toRedo := lobby.undoneStrokes[len(lobby.undoneStrokes)-1]
+	lobby.undoneStrokes = lobby.undoneStrokes[:len(lobby.undoneStrokes)-1]
+	lobby.strokes = append(lobby.strokes, stroke{
+		startIndex: len(lobby.currentDrawing),
+		id:         toRedo.id,
+	})
+	lobby.currentDrawing = append(lobby.currentDrawing, toRedo.elements...)
+
+	return true
+}
+
+// resetStrokes forgets all strokes, including the ones that could've been
+// redone. This has to be called whenever the drawing is cleared.
+func (lobby *Lobby) resetStrokes() {
+	lobby.strokes = nil
+	lobby.undoneStrokes = nil
+}
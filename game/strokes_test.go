@@ -0,0 +1,111 @@
+package game
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+)
+
+func createDrawingLobby(t *testing.T) (*Lobby, *Player) {
+	lobby := &Lobby{
+		mutex: &sync.Mutex{},
+		EditableLobbySettings: &EditableLobbySettings{
+			DrawingTime: 10,
+			Rounds:      10,
+		},
+		words: []string{"abc", "def", "ghi"},
+	}
+	lobby.WriteJSON = func(conn *SocketConnection, object interface{}) error {
+		return nil
+	}
+
+	drawer := lobby.JoinPlayer(&auth.User{Id: "1234", Name: "Drawer"})
+	drawer.Connected = true
+	lobby.Owner = drawer
+	lobby.creator = drawer
+
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "start"}, drawer); err != nil {
+		t.Fatalf("Couldn't start lobby: %s", err)
+	}
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "choose-word", Data: 0}, drawer); err != nil {
+		t.Fatalf("Couldn't choose word: %s", err)
+	}
+
+	return lobby, drawer
+}
+
+func lineData(strokeID float64) map[string]interface{} {
+	data := map[string]interface{}{
+		"fromX":     1.0,
+		"fromY":     1.0,
+		"toX":       2.0,
+		"toY":       2.0,
+		"color":     map[string]interface{}{"r": 0, "g": 0, "b": 0},
+		"lineWidth": 8.0,
+	}
+	if strokeID != 0 {
+		data["strokeId"] = strokeID
+	}
+	return data
+}
+
+func Test_undoRedoWithStrokeIDs(t *testing.T) {
+	lobby, drawer := createDrawingLobby(t)
+
+	for _, strokeID := range []float64{5, 5, 5, 6, 6} {
+		if err := lobby.HandleEvent(nil, &GameEvent{Type: "line", Data: lineData(strokeID)}, drawer); err != nil {
+			t.Fatalf("Couldn't draw line: %s", err)
+		}
+	}
+
+	if len(lobby.strokes) != 2 {
+		t.Fatalf("expected 2 strokes, but got %d", len(lobby.strokes))
+	}
+
+	lobby.HandleEvent(nil, &GameEvent{Type: "undo"}, drawer)
+	if len(lobby.currentDrawing) != 3 {
+		t.Errorf("undo should've removed exactly one stroke; %d events left", len(lobby.currentDrawing))
+	}
+
+	lobby.HandleEvent(nil, &GameEvent{Type: "redo"}, drawer)
+	if len(lobby.currentDrawing) != 5 {
+		t.Errorf("redo should've restored the stroke; %d events present", len(lobby.currentDrawing))
+	}
+
+	//Continuing a finished stroke isn't allowed.
+	if err := lobby.HandleEvent(nil, &GameEvent{Type: "line", Data: lineData(5)}, drawer); err == nil {
+		t.Error("reusing the ID of a finished stroke should've failed")
+	}
+	if len(lobby.currentDrawing) != 5 {
+		t.Errorf("invalid line shouldn't have been added; %d events present", len(lobby.currentDrawing))
+	}
+
+	//Drawing something new discards the redo history.
+	lobby.HandleEvent(nil, &GameEvent{Type: "undo"}, drawer)
+	lobby.HandleEvent(nil, &GameEvent{Type: "line", Data: lineData(7)}, drawer)
+	lobby.HandleEvent(nil, &GameEvent{Type: "redo"}, drawer)
+	if len(lobby.currentDrawing) != 4 {
+		t.Errorf("redo after drawing shouldn't have restored anything; %d events present", len(lobby.currentDrawing))
+	}
+}
+
+func Test_undoWithoutStrokeIDs(t *testing.T) {
+	lobby, drawer := createDrawingLobby(t)
+
+	//Without IDs, events in quick succession count as one stroke.
+	for i := 0; i < 3; i++ {
+		if err := lobby.HandleEvent(nil, &GameEvent{Type: "line", Data: lineData(0)}, drawer); err != nil {
+			t.Fatalf("Couldn't draw line: %s", err)
+		}
+	}
+
+	if len(lobby.strokes) != 1 {
+		t.Fatalf("expected 1 stroke, but got %d", len(lobby.strokes))
+	}
+
+	lobby.HandleEvent(nil, &GameEvent{Type: "undo"}, drawer)
+	if len(lobby.currentDrawing) != 0 {
+		t.Errorf("undo should've removed the whole stroke; %d events left", len(lobby.currentDrawing))
+	}
+}
@@ -0,0 +1,368 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	discordemojimap "github.com/Bios-Marcel/discordemojimap/v2"
+	"github.com/agnivade/levenshtein"
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+//This file contains the observer participation. If enabled by the owner,
+//authenticated observers can chat with each other and guess the word. Their
+//messages are never shown to players, so that they can't spoil the word for
+//them. Correct guesses earn points on a separate viewer scoreboard.
+//
+//Since observers may watch with a delay, their guesses are checked against
+//the turn they are currently seeing, which is why the recent turns are
+//recorded as observedTurns.
+
+var (
+	ErrParticipationDisabled = errors.New("observer participation is disabled")
+	ErrAnonymousObserver     = errors.New("anonymous observers can't participate")
+	ErrRestrictedObserver    = errors.New("kicked or banned observers can't participate")
+)
+
+// Viewer is the score of a participating observer. Viewers are identified by
+// their user, so that their score survives reconnects.
+type Viewer struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	Score  int    `json:"score"`
+}
+
+// observedTurn records a turn, so that guesses of delayed observers can be
+// checked and scored as of the moment they are seeing.
+type observedTurn struct {
+	word           string
+	wordHintsShown []*WordHint
+	hintCount      int
+	drawingTime    int
+	// progress holds the time and hints left at the start of the turn and
+	// whenever they changed other than by the clock running.
+	progress []turnProgress
+	// endedAt is zero as long as the turn is running.
+	endedAt time.Time
+	// guessed holds the IDs of the viewers that have guessed the word.
+	guessed map[string]bool
+}
+
+type turnProgress struct {
+	at        time.Time
+	timeLeft  time.Duration
+	paused    bool
+	hintsLeft int
+}
+
+// seenBy indicates whether the observer knows the word of the turn.
+func (turn *observedTurn) seenBy(observer *Observer) bool {
+	if observer.caster {
+		return true
+	}
+	return observer.user != nil && turn.guessed[observer.user.Id]
+}
+
+// progressAt returns the seconds and hints that were left at the given time.
+func (turn *observedTurn) progressAt(at time.Time) (secondsLeft, hintsLeft int) {
+	progress := turn.progress[0]
+	for _, next := range turn.progress[1:] {
+		if next.at.After(at) {
+			break
+		}
+		progress = next
+	}
+
+	timeLeft := progress.timeLeft
+	if !progress.paused {
+		timeLeft -= at.Sub(progress.at)
+	}
+	if timeLeft < 0 {
+		timeLeft = 0
+	}
+	return int(timeLeft / time.Second), progress.hintsLeft
+}
+
+// ObserverChat is the participation state sent to observers on connect.
+type ObserverChat struct {
+	// Enabled is the lobbies ObserverParticipation setting.
+	Enabled bool `json:"enabled"`
+	// CanChat indicates whether the observer is authenticated and could
+	// therefore participate if enabled.
+	CanChat bool      `json:"canChat"`
+	Viewers []*Viewer `json:"viewers"`
+}
+
+// HandleObserverEvent handles events sent by observers. Besides chat
+// messages, only actions the observer is allowed to perform are accepted.
+func (lobby *Lobby) HandleObserverEvent(received *GameEvent, observer *Observer) error {
+	if received.Type == "keep-alive" {
+		return nil
+	}
+
+	lobby.mutex.Lock()
+	defer lobby.mutex.Unlock()
+
+	//Observers may be allowed to perform actions, for example mods
+	//watching the caster view.
+	if handled, err := lobby.handleActionEvent(observer.user, received); handled {
+		return err
+	}
+
+	if received.Type != "message" {
+		return fmt.Errorf("observers can't send %s events", received.Type)
+	}
+	if !lobby.ObserverParticipation {
+		return ErrParticipationDisabled
+	}
+	if observer.user == nil {
+		return ErrAnonymousObserver
+	}
+	if lobby.HasBeenKicked(observer.user) || lobby.isBanned(observer.user) {
+		return ErrRestrictedObserver
+	}
+
+	message, isString := (received.Data).(string)
+	if !isString {
+		return fmt.Errorf("invalid data received: '%s'", received.Data)
+	}
+
+	handleObserverMessage(lobby, observer, message)
+	return nil
+}
+
+func (lobby *Lobby) getViewer(user *auth.User) *Viewer {
+	if lobby.viewers == nil {
+		lobby.viewers = make(map[string]*Viewer)
+	}
+
+	viewer, exists := lobby.viewers[user.Id]
+	if !exists {
+		viewer = &Viewer{UserID: user.Id, Name: user.Name}
+		lobby.viewers[user.Id] = viewer
+	}
+	return viewer
+}
+
+// sortedViewers returns all viewers ordered by score, highest first.
+func (lobby *Lobby) sortedViewers() []*Viewer {
+	viewers := make([]*Viewer, 0, len(lobby.viewers))
+	for _, viewer := range lobby.viewers {
+		viewers = append(viewers, viewer)
+	}
+	sort.SliceStable(viewers, func(a, b int) bool {
+		if viewers[a].Score != viewers[b].Score {
+			return viewers[a].Score > viewers[b].Score
+		}
+		return viewers[a].Name < viewers[b].Name
+	})
+	return viewers
+}
+
+// seesWord indicates whether the observer is allowed to see the current word,
+// either by being a caster or by having guessed it.
+func (lobby *Lobby) seesWord(observer *Observer) bool {
+	if observer.caster {
+		return true
+	}
+
+	turn := lobby.currentObservedTurn()
+	return turn != nil && turn.seenBy(observer)
+}
+
+// isBanned checks whether the user is banned or blocked from the creator's
+// channel. The lobby has to be locked.
+func (lobby *Lobby) isBanned(user *auth.User) bool {
+	if lobby.db == nil {
+		return false
+	}
+	if banned, cached := lobby.banned[user.Id]; cached {
+		return banned
+	}
+
+	channelID := lobby.creator.user.Id
+	blocked, err := lobby.db.IsOnChannelList(channelID, database.ListBlock, user.Id)
+	if err != nil {
+		//Not caching anything, so that the next check tries again.
+		lobby.Logger().Warn("Failed checking blocklist", logging.KeyError, err)
+		return false
+	}
+	banned := blocked
+	if !banned {
+		banned, err = lobby.db.IsBannedFromChannel(channelID, user.Id)
+		if err != nil {
+			lobby.Logger().Warn("Failed checking bans", logging.KeyError, err)
+			return false
+		}
+	}
+
+	if lobby.banned == nil {
+		lobby.banned = make(map[string]bool)
+	}
+	lobby.banned[user.Id] = banned
+	return banned
+}
+
+func (lobby *Lobby) generateObserverChat(observer *Observer) *ObserverChat {
+	return &ObserverChat{
+		Enabled: lobby.ObserverParticipation,
+		CanChat: observer.user != nil,
+		Viewers: lobby.sortedViewers(),
+	}
+}
+
+// startObservedTurn has to be called whenever a new word is chosen. Turns
+// that no observer can be seeing anymore are dropped.
+func (lobby *Lobby) startObservedTurn() {
+	now := lobby.getClock().Now()
+	oldest := now.Add(-time.Duration(LobbySettingBounds.MaxObserverDelay) * time.Second)
+	recent := lobby.observedTurns[:0]
+	for _, turn := range lobby.observedTurns {
+		if turn.endedAt.IsZero() || turn.endedAt.After(oldest) {
+			recent = append(recent, turn)
+		}
+	}
+
+	lobby.observedTurns = append(recent, &observedTurn{
+		word:           lobby.CurrentWord,
+		wordHintsShown: lobby.wordHintsShown,
+		hintCount:      lobby.hintCount,
+		drawingTime:    lobby.DrawingTime,
+		progress: []turnProgress{{
+			at:        now,
+			timeLeft:  time.Duration(lobby.timeLeft()) * time.Millisecond,
+			paused:    lobby.paused,
+			hintsLeft: lobby.hintsLeft,
+		}},
+		guessed: make(map[string]bool),
+	})
+}
+
+// recordObservedProgress has to be called whenever a hint is revealed or
+// the turn is paused or resumed.
+func (lobby *Lobby) recordObservedProgress() {
+	turn := lobby.currentObservedTurn()
+	if turn == nil {
+		return
+	}
+
+	turn.progress = append(turn.progress, turnProgress{
+		at:        lobby.getClock().Now(),
+		timeLeft:  time.Duration(lobby.timeLeft()) * time.Millisecond,
+		paused:    lobby.paused,
+		hintsLeft: lobby.hintsLeft,
+	})
+}
+
+// endObservedTurn has to be called whenever a turn with a word ends.
+func (lobby *Lobby) endObservedTurn() {
+	if turn := lobby.currentObservedTurn(); turn != nil {
+		turn.endedAt = lobby.getClock().Now()
+	}
+}
+
+// currentObservedTurn returns the running turn, if there is one.
+func (lobby *Lobby) currentObservedTurn() *observedTurn {
+	if len(lobby.observedTurns) == 0 {
+		return nil
+	}
+
+	turn := lobby.observedTurns[len(lobby.observedTurns)-1]
+	if !turn.endedAt.IsZero() {
+		return nil
+	}
+	return turn
+}
+
+// visibleTurn returns the turn the observer is currently seeing, which
+// may have ended already due to the observer's delay. Between turns, there
+// is none.
+func (lobby *Lobby) visibleTurn(observer *Observer) *observedTurn {
+	viewTime := lobby.getClock().Now().Add(-observer.delay)
+	for index := len(lobby.observedTurns) - 1; index >= 0; index-- {
+		turn := lobby.observedTurns[index]
+		if turn.progress[0].at.After(viewTime) {
+			continue
+		}
+		if !turn.endedAt.IsZero() && !turn.endedAt.After(viewTime) {
+			return nil
+		}
+		return turn
+	}
+	return nil
+}
+
+// resetViewerScores has to be called whenever a new game is started.
+func (lobby *Lobby) resetViewerScores() {
+	for _, viewer := range lobby.viewers {
+		viewer.Score = 0
+	}
+	lobby.sendToObservers(&GameEvent{Type: "update-viewers", Data: lobby.sortedViewers()})
+}
+
+func (lobby *Lobby) sendToObservers(event *GameEvent) {
+	for _, observer := range lobby.observers {
+		lobby.send(observer.SocketConnection, event)
+	}
+}
+
+func handleObserverMessage(lobby *Lobby, observer *Observer, message string) {
+	//Same limit as for players, see handleMessage.
+	if len(message) > 10000 {
+		return
+	}
+
+	trimmedMessage := strings.TrimSpace(message)
+	if trimmedMessage == "" {
+		return
+	}
+
+	viewer := lobby.getViewer(observer.user)
+	messageEvent := &GameEvent{Type: "observer-message", Data: Message{
+		Author:   viewer.Name,
+		AuthorID: viewer.UserID,
+		Content:  discordemojimap.Replace(trimmedMessage),
+	}}
+
+	//Without a word, there's nothing to spoil.
+	turn := lobby.visibleTurn(observer)
+	if turn == nil {
+		lobby.sendToObservers(messageEvent)
+		return
+	}
+
+	//Viewers that know the word may only talk to those that know it as well.
+	if turn.seenBy(observer) {
+		for _, otherObserver := range lobby.observers {
+			if turn.seenBy(otherObserver) {
+				lobby.send(otherObserver.SocketConnection, messageEvent)
+			}
+		}
+		return
+	}
+
+	normInput := simplifyText(lobby.lowercaser.String(trimmedMessage))
+	normSearched := simplifyText(turn.word)
+	if normInput == normSearched {
+		secondsLeft, hintsLeft := turn.progressAt(lobby.getClock().Now().Add(-observer.delay))
+		viewer.Score += calculateGuesserScore(turn.hintCount, hintsLeft, secondsLeft, turn.drawingTime)
+		turn.guessed[viewer.UserID] = true
+
+		lobby.sendToObservers(&GameEvent{Type: "observer-correct-guess", Data: viewer})
+		lobby.sendToObservers(&GameEvent{Type: "update-viewers", Data: lobby.sortedViewers()})
+		//Since the word has been guessed correctly, we reveal it. This
+		//happens right away, as the observer is still seeing this turn.
+		lobby.send(observer.SocketConnection, &GameEvent{Type: "reveal-word", Data: turn.wordHintsShown})
+		return
+	}
+
+	lobby.sendToObservers(messageEvent)
+	if levenshtein.ComputeDistance(normInput, normSearched) == 1 {
+		lobby.send(observer.SocketConnection, &GameEvent{Type: "close-guess", Data: trimmedMessage})
+	}
+}
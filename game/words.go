@@ -49,9 +49,13 @@ func readWordListInternal(
 		//might be unnecessary \r characters.
 		//While regex isn't super, this doesn't really matter as the word lists
 		//are cached and only the first start of the first lobby will be slower.
-		words = regexp.MustCompile("\r?\n").Split(wordListFile, -1)
-		for wordIndex, word := range words {
-			words[wordIndex] = lowercaser.String(word)
+		lines := regexp.MustCompile("\r?\n").Split(wordListFile, -1)
+		words = make([]string, 0, len(lines))
+		for _, line := range lines {
+			//Trailing newlines would otherwise result in empty words.
+			if line != "" {
+				words = append(words, lowercaser.String(line))
+			}
 		}
 		wordListCache[languageIdentifier] = words
 	}
@@ -88,8 +92,16 @@ func readWordList(lowercaser cases.Caser, chosenLanguage string) ([]string, erro
 // GetRandomWords gets a custom amount of random words for the passed Lobby.
 // The words will be chosen from the custom words and the default
 // dictionary, depending on the settings specified by the lobbies creator.
+// Words suggested by viewers always take one of the slots.
 func GetRandomWords(wordCount int, lobby *Lobby) []string {
-	return getRandomWordsCustomRng(wordCount, lobby, func() int { return rand.Intn(100) + 1 })
+	rng := func() int { return rand.Intn(100) + 1 }
+	if len(lobby.suggestedWords) > 0 {
+		suggested := lobby.suggestedWords[0]
+		lobby.suggestedWords = lobby.suggestedWords[1:]
+		return append(getRandomWordsCustomRng(wordCount-1, lobby, rng), suggested)
+	}
+
+	return getRandomWordsCustomRng(wordCount, lobby, rng)
 }
 
 // getRandomWordsCustomRng allows passing a custom generator for random
@@ -0,0 +1,301 @@
+// Package logging provides leveled logging with key value pairs. The output
+// is either human readable text or JSON, one entry per line. Entries
+// concerning lobbies, users or events should always use the keys defined
+// here, so that log pipelines can filter by them.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// These keys are used consistently across all packages.
+const (
+	KeyLobby = "lobby_id"
+	KeyUser  = "user_id"
+	KeyEvent = "event_type"
+	KeyError = "error"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (level Level) String() string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel parses the names returned by Level.String, ignoring case.
+func ParseLevel(value string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level '%s'", value)
+}
+
+type Format int
+
+const (
+	FormatText Format = iota
+	FormatJSON
+)
+
+// ParseFormat accepts either "text" or "json", ignoring case.
+func ParseFormat(value string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+
+	return FormatText, fmt.Errorf("unknown log format '%s'", value)
+}
+
+type output struct {
+	mutex  *sync.Mutex
+	writer io.Writer
+	level  Level
+	format Format
+}
+
+// out is shared by all loggers, so that Configure affects loggers created
+// beforehand as well.
+var out = &output{
+	mutex:  &sync.Mutex{},
+	writer: os.Stderr,
+	level:  LevelInfo,
+	format: FormatText,
+}
+
+// Configure sets where and how entries are written and which entries are
+// dropped. It is meant to be called once on startup.
+func Configure(writer io.Writer, level Level, format Format) {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	out.writer = writer
+	out.level = level
+	out.format = format
+}
+
+// Logger writes entries with a fixed set of key value pairs attached. The
+// zero value is a logger without any pairs.
+type Logger struct {
+	keyvals []interface{}
+}
+
+// With returns a logger that attaches the given key value pairs to every
+// entry.
+func With(keyvals ...interface{}) *Logger {
+	return (&Logger{}).With(keyvals...)
+}
+
+// With returns a copy of the logger with the given key value pairs added.
+func (logger *Logger) With(keyvals ...interface{}) *Logger {
+	combined := make([]interface{}, 0, len(logger.keyvals)+len(keyvals))
+	combined = append(combined, logger.keyvals...)
+	combined = append(combined, keyvals...)
+	return &Logger{keyvals: combined}
+}
+
+func (logger *Logger) Debug(message string, keyvals ...interface{}) {
+	logger.log(LevelDebug, message, keyvals)
+}
+
+func (logger *Logger) Info(message string, keyvals ...interface{}) {
+	logger.log(LevelInfo, message, keyvals)
+}
+
+func (logger *Logger) Warn(message string, keyvals ...interface{}) {
+	logger.log(LevelWarn, message, keyvals)
+}
+
+func (logger *Logger) Error(message string, keyvals ...interface{}) {
+	logger.log(LevelError, message, keyvals)
+}
+
+// Fatal writes an error entry and exits the process.
+func (logger *Logger) Fatal(message string, keyvals ...interface{}) {
+	logger.log(LevelError, message, keyvals)
+	os.Exit(1)
+}
+
+var root = &Logger{}
+
+func Debug(message string, keyvals ...interface{}) { root.log(LevelDebug, message, keyvals) }
+func Info(message string, keyvals ...interface{})  { root.log(LevelInfo, message, keyvals) }
+func Warn(message string, keyvals ...interface{})  { root.log(LevelWarn, message, keyvals) }
+func Error(message string, keyvals ...interface{}) { root.log(LevelError, message, keyvals) }
+
+func Fatal(message string, keyvals ...interface{}) {
+	root.log(LevelError, message, keyvals)
+	os.Exit(1)
+}
+
+func (logger *Logger) log(level Level, message string, keyvals []interface{}) {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	if level < out.level {
+		return
+	}
+
+	all := make([]interface{}, 0, len(logger.keyvals)+len(keyvals))
+	all = append(all, logger.keyvals...)
+	all = append(all, keyvals...)
+	//A missing value is most likely a mistake, but the entry is still
+	//more useful than nothing.
+	if len(all)%2 != 0 {
+		all = append(all, "MISSING")
+	}
+
+	now := time.Now().UTC()
+	if level == LevelError {
+		recordError(now, message, all)
+	}
+
+	var buffer bytes.Buffer
+	if out.format == FormatJSON {
+		writeJSON(&buffer, now, level, message, all)
+	} else {
+		writeText(&buffer, now, level, message, all)
+	}
+	out.writer.Write(buffer.Bytes())
+}
+
+func writeText(buffer *bytes.Buffer, now time.Time, level Level, message string, keyvals []interface{}) {
+	buffer.WriteString(now.Format(time.RFC3339))
+	buffer.WriteByte(' ')
+	buffer.WriteString(strings.ToUpper(level.String()))
+	buffer.WriteByte(' ')
+	buffer.WriteString(message)
+	for index := 0; index < len(keyvals); index += 2 {
+		buffer.WriteByte(' ')
+		buffer.WriteString(fmt.Sprint(keyvals[index]))
+		buffer.WriteByte('=')
+		value := fmt.Sprint(normalize(keyvals[index+1]))
+		if value == "" || strings.ContainsAny(value, " \"=\n\t") {
+			value = strconv.Quote(value)
+		}
+		buffer.WriteString(value)
+	}
+	buffer.WriteByte('\n')
+}
+
+func writeJSON(buffer *bytes.Buffer, now time.Time, level Level, message string, keyvals []interface{}) {
+	//Writing the fields by hand keeps them in order, which json.Marshal on
+	//a map wouldn't.
+	buffer.WriteString(`{"time":`)
+	writeJSONValue(buffer, now.Format(time.RFC3339Nano))
+	buffer.WriteString(`,"level":`)
+	writeJSONValue(buffer, level.String())
+	buffer.WriteString(`,"msg":`)
+	writeJSONValue(buffer, message)
+	for index := 0; index < len(keyvals); index += 2 {
+		buffer.WriteByte(',')
+		writeJSONValue(buffer, fmt.Sprint(keyvals[index]))
+		buffer.WriteByte(':')
+		writeJSONValue(buffer, normalize(keyvals[index+1]))
+	}
+	buffer.WriteString("}\n")
+}
+
+func writeJSONValue(buffer *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buffer.Write(encoded)
+}
+
+// recentErrorCount is the amount of error entries kept for RecentErrors.
+const recentErrorCount = 100
+
+// Entry is a single log entry as returned by RecentErrors.
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields"`
+}
+
+// recentErrors is a ring buffer, nextError is the index that is overwritten
+// next. Both are guarded by the output mutex.
+var (
+	recentErrors = make([]Entry, 0, recentErrorCount)
+	nextError    int
+)
+
+func recordError(now time.Time, message string, keyvals []interface{}) {
+	fields := make(map[string]interface{}, len(keyvals)/2)
+	for index := 0; index < len(keyvals); index += 2 {
+		fields[fmt.Sprint(keyvals[index])] = normalize(keyvals[index+1])
+	}
+
+	entry := Entry{Time: now, Message: message, Fields: fields}
+	if len(recentErrors) < recentErrorCount {
+		recentErrors = append(recentErrors, entry)
+	} else {
+		recentErrors[nextError] = entry
+	}
+	nextError = (nextError + 1) % recentErrorCount
+}
+
+// RecentErrors returns the latest error entries, newest first. Entries are
+// recorded regardless of the configured level and output.
+func RecentErrors() []Entry {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	entries := make([]Entry, 0, len(recentErrors))
+	for offset := 1; offset <= len(recentErrors); offset++ {
+		index := (nextError - offset + recentErrorCount) % recentErrorCount
+		entries = append(entries, recentErrors[index])
+	}
+
+	return entries
+}
+
+// normalize turns errors and values with a String method into strings, as
+// their structure is usually meaningless in logs.
+func normalize(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case nil:
+		return nil
+	case error:
+		return typed.Error()
+	case fmt.Stringer:
+		return typed.String()
+	default:
+		return value
+	}
+}
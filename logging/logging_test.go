@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func captureOutput(t *testing.T, level Level, format Format) *bytes.Buffer {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	Configure(&buffer, level, format)
+	t.Cleanup(func() { Configure(os.Stderr, LevelInfo, FormatText) })
+	return &buffer
+}
+
+func Test_textFormat(t *testing.T) {
+	buffer := captureOutput(t, LevelDebug, FormatText)
+
+	With(KeyLobby, "abc").Warn("player kicked", KeyUser, "42", "reason", "too slow", KeyError, errors.New("oops"))
+
+	line := buffer.String()
+	expectedSuffix := ` WARN player kicked lobby_id=abc user_id=42 reason="too slow" error=oops` + "\n"
+	if !strings.HasSuffix(line, expectedSuffix) {
+		t.Errorf("unexpected output: %s", line)
+	}
+}
+
+func Test_jsonFormat(t *testing.T) {
+	buffer := captureOutput(t, LevelDebug, FormatJSON)
+
+	With(KeyLobby, "abc").With(KeyEvent, "message").Error("failed", "count", 3)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("output isn't valid JSON: %s (%s)", buffer.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"level":  "error",
+		"msg":    "failed",
+		KeyLobby: "abc",
+		KeyEvent: "message",
+		"count":  float64(3),
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("expected %s to be %v, but was %v", key, value, entry[key])
+		}
+	}
+}
+
+func Test_levelFiltering(t *testing.T) {
+	buffer := captureOutput(t, LevelWarn, FormatText)
+
+	Debug("debug")
+	Info("info")
+	Warn("warn")
+	Error("error")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "WARN warn") || !strings.Contains(lines[1], "ERROR error") {
+		t.Errorf("unexpected output:\n%s", buffer.String())
+	}
+}
+
+func Test_parseLevel(t *testing.T) {
+	for input, expected := range map[string]Level{
+		"debug":   LevelDebug,
+		"INFO":    LevelInfo,
+		"warning": LevelWarn,
+		" error ": LevelError,
+	} {
+		level, err := ParseLevel(input)
+		if err != nil || level != expected {
+			t.Errorf("expected %s to be parsed as %s, but got %s (%v)", input, expected, level, err)
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func Test_recentErrors(t *testing.T) {
+	captureOutput(t, LevelError, FormatText)
+
+	for i := 0; i < recentErrorCount+5; i++ {
+		With(KeyLobby, "abc").Error("failed", "attempt", i)
+	}
+	Warn("not an error")
+
+	entries := RecentErrors()
+	if len(entries) != recentErrorCount {
+		t.Fatalf("expected %d entries, but got %d", recentErrorCount, len(entries))
+	}
+	if entries[0].Fields["attempt"] != recentErrorCount+4 || entries[len(entries)-1].Fields["attempt"] != 5 {
+		t.Errorf("entries aren't ordered newest first: %v ... %v", entries[0], entries[len(entries)-1])
+	}
+	if entries[0].Fields[KeyLobby] != "abc" || entries[0].Message != "failed" {
+		t.Errorf("unexpected entry %v", entries[0])
+	}
+}
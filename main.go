@@ -4,11 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/chatbot"
 	config2 "github.com/scribble-rs/scribble.rs/config"
 	"github.com/scribble-rs/scribble.rs/database"
 	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/metrics"
+	"github.com/scribble-rs/scribble.rs/moderation"
 	"github.com/scribble-rs/scribble.rs/twitch"
-	"log"
+	"github.com/scribble-rs/scribble.rs/webhook"
 	"math/rand"
 	"net/http"
 	"os"
@@ -32,32 +36,29 @@ func determinePort(portHTTPFlag int) int {
 	portHTTP := -1
 	if portHTTPFlag != -1 {
 		portHTTP = portHTTPFlag
-		log.Printf("Listening on port %d sourced from portHTTP flag.\n", portHTTP)
+		logging.Info("Using port from portHTTP flag", "port", portHTTP)
 	} else {
 		//Support for heroku, as heroku expects applications to use a specific port.
 		envPort, portVarAvailable := os.LookupEnv("PORT")
 		if portVarAvailable {
-			log.Printf("'PORT' environment variable found: '%s'\n", envPort)
 			parsed, parseError := strconv.ParseInt(strings.TrimSpace(envPort), 10, 32)
 			if parseError == nil {
 				portHTTP = int(parsed)
-				log.Printf("Listening on port %d sourced from 'PORT' environment variable\n", portHTTP)
+				logging.Info("Using port from 'PORT' environment variable", "port", portHTTP)
 			} else {
-				log.Printf("Error parsing 'PORT' variable: %s\n", parseError)
-				log.Println("Falling back to default port.")
+				logging.Warn("Invalid 'PORT' variable, falling back to default port", "value", envPort, logging.KeyError, parseError)
 			}
 		}
 	}
 
 	if portHTTP != -1 && portHTTP < 0 || portHTTP > 65535 {
-		log.Println("Port has to be between 0 and 65535.")
-		log.Println("Falling back to default port.")
+		logging.Warn("Port has to be between 0 and 65535, falling back to default port", "port", portHTTP)
 		portHTTP = -1
 	}
 
 	if portHTTP < 0 {
 		portHTTP = defaultPort
-		log.Printf("Listening on default port %d\n", portHTTP)
+		logging.Info("Using default port", "port", portHTTP)
 	}
 
 	return portHTTP
@@ -69,11 +70,14 @@ func main() {
 	portHTTPFlag := flag.Int("portHTTP", -1, "defines the port to be used for http mode")
 	flag.Parse()
 
+	config := config2.FromEnv()
+	logging.Configure(os.Stderr, config.LogLevel, config.LogFormat)
+
 	if *cpuprofile != "" {
-		log.Println("Starting CPU profiling ....")
+		logging.Info("Starting CPU profiling")
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
-			log.Fatal(err)
+			logging.Fatal("Failed creating CPU profile", logging.KeyError, err)
 		}
 		pprof.StartCPUProfile(f)
 	}
@@ -83,13 +87,35 @@ func main() {
 	//Setting the seed in order for the petnames to be random.
 	rand.Seed(time.Now().UnixNano())
 
-	config := config2.FromEnv()
+	game.TurnIntermission = config.TurnIntermission
+
+	db, _ := database.FromDatabaseUrl(config.DatabaseUrl)
 
 	tokens := twitch.NewMemoryTokenStore()
+	if config.InstanceUrl != "" {
+		//Other instances need to know our lobbies and the tokens of users
+		//that logged in via this instance.
+		registry, err := state.NewPostgresRegistry(db, config.InstanceId, config.InstanceUrl)
+		if err != nil {
+			logging.Fatal("Failed setting up lobby registry", logging.KeyError, err)
+		}
+		state.SetRegistry(registry)
+		state.LaunchRegistryRoutine()
+		tokens = &database.TokenStore{DB: db, EncryptionKey: []byte(config.TokenEncryptionKey)}
+		logging.Info("Running as one of multiple instances", "instance_id", config.InstanceId, "instance_url", config.InstanceUrl)
+	}
 
 	authService := &auth.Service{
 		JwtKey:        []byte(config.JwtKey),
 		JwtCookieName: config.JwtCookieName,
+		AdminIds:      config.AdminIds,
+		//Sessions are always persisted, as users would otherwise be
+		//logged out on every restart.
+		Sessions:        &database.SessionStore{DB: db},
+		SessionLifetime: config.SessionLifetime,
+		SecureCookies:   config.SecureCookies,
+		HttpOnlyCookies: config.HttpOnlyCookies,
+		APITokens:       &database.APITokenStore{DB: db},
 	}
 
 	twitchClient := &twitch.Client{
@@ -97,18 +123,64 @@ func main() {
 		ClientSecret: config.TwitchClientSecret,
 		RedirectURI:  config.TwitchRedirectURI,
 	}
+	//Tokens of streamers are used long after they logged in, for example in
+	//order to check the join rules of their lobbies.
+	tokens = &twitch.RefreshingTokenStore{TokenStore: tokens, Client: twitchClient}
 
 	gameService := &game.Service{
 		Twitch: twitchClient,
 		Tokens: tokens,
 	}
 
-	db, _ := database.FromDatabaseUrl(config.DatabaseUrl)
+	var eventSub *twitch.EventSub
+	if config.EventSubSecret != "" {
+		eventSub = &twitch.EventSub{
+			Client:      twitchClient,
+			Secret:      config.EventSubSecret,
+			CallbackURL: config.GenerateUrl("/api/v1/eventsub"),
+		}
+	}
+
+	providers := []auth.Provider{&twitch.Provider{Client: twitchClient, Tokens: tokens, EventSub: eventSub}}
+	if config.OIDCIssuer != "" {
+		oidcProvider, err := auth.NewOIDCProvider(config.OIDCIssuer, config.OIDCClientId, config.OIDCClientSecret)
+		if err != nil {
+			logging.Fatal("Failed setting up OpenID Connect", logging.KeyError, err)
+		}
+		providers = append(providers, oidcProvider)
+	}
+	if config.GuestLogin {
+		providers = append(providers, auth.GuestProvider{})
+	}
+
+	webhooks := webhook.NewService(&database.WebhookStore{DB: db}, game.EventTypes, config.WebhookPrivateIPs)
+	chatBot := &chatbot.Bot{
+		Twitch:      twitchClient,
+		Tokens:      tokens,
+		Settings:    db,
+		GenerateUrl: config.GenerateUrl,
+		Login:       config.TwitchBotLogin,
+		Token:       config.TwitchBotToken,
+	}
+	chatBot.Launch()
+	game.EventListener = func(event *game.Event) {
+		webhooks.Dispatch(event.ChannelID, event.Type, event)
+		chatBot.HandleEvent(event)
+	}
+
+	moderationSync := &moderation.Sync{
+		Twitch:   twitchClient,
+		Tokens:   tokens,
+		DB:       db,
+		Interval: config.ModSyncInterval,
+	}
+	moderationSync.Launch()
 
 	router := httprouter.New()
 
-	api.SetupRoutes(router, authService, db)
-	frontend.SetupRoutes(config.GenerateUrl, router, authService, twitchClient, db, gameService, tokens)
+	api.SetupRoutes(router, authService, db, gameService, eventSub, moderationSync)
+	router.Handler("GET", "/metrics", metrics.Handler(config.MetricsToken))
+	frontend.SetupRoutes(config.GenerateUrl, router, authService, twitchClient, db, gameService, tokens, providers, webhooks, chatBot, eventSub, moderationSync)
 	state.LaunchCleanupRoutine()
 
 	signalChan := make(chan os.Signal, 1)
@@ -116,15 +188,16 @@ func main() {
 	go func() {
 		defer os.Exit(0)
 
-		log.Printf("Received %s, gracefully shutting down.\n", <-signalChan)
+		logging.Info("Gracefully shutting down", "signal", <-signalChan)
 
 		state.ShutdownLobbiesGracefully()
 		if *cpuprofile != "" {
 			pprof.StopCPUProfile()
-			log.Println("Finished CPU profiling.")
+			logging.Info("Finished CPU profiling")
 		}
 	}()
 
-	log.Println("Started.")
-	log.Fatalln(http.ListenAndServe(fmt.Sprintf(":%d", portHTTP), router))
+	logging.Info("Started")
+	err := http.ListenAndServe(fmt.Sprintf(":%d", portHTTP), authService.RenewSessions(api.RouteToLobbyOwner(router)))
+	logging.Fatal("Server stopped", logging.KeyError, err)
 }
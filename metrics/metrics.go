@@ -0,0 +1,305 @@
+// Package metrics collects counters and histograms and exposes them in the
+// Prometheus text format. Only the small subset of the format required by
+// scribble.rs is implemented, which saves us from pulling in the official
+// client library.
+package metrics
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// LatencyBuckets are suitable for network calls, such as database
+	// queries and HTTP requests. The values are in seconds.
+	LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMutex = &sync.Mutex{}
+	registered    = make(map[string]metric)
+)
+
+func register(name string, m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, exists := registered[name]; exists {
+		panic("metric registered twice: " + name)
+	}
+	registered[name] = m
+}
+
+// WriteTo writes all registered metrics, sorted by name.
+func WriteTo(w io.Writer) {
+	registryMutex.Lock()
+	names := make([]string, 0, len(registered))
+	for name := range registered {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, registered[name])
+	}
+	registryMutex.Unlock()
+
+	buffered := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buffered)
+	}
+	buffered.Flush()
+}
+
+// Handler serves all registered metrics. If token isn't empty, requests have
+// to pass it as a bearer token.
+func Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "invalid or missing bearer token", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// labeled holds one value per combination of label values.
+type labeled struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+
+	mutex  *sync.Mutex
+	values map[string][]string
+}
+
+func newLabeled(name, help, metricType string, labelNames []string) labeled {
+	return labeled{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		mutex:      &sync.Mutex{},
+		values:     make(map[string][]string),
+	}
+}
+
+// key returns the map key for the given label values. The values are
+// remembered, so that they can be written later on.
+func (l *labeled) key(labelValues []string) string {
+	if len(labelValues) != len(l.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", l.name, len(l.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	if _, exists := l.values[key]; !exists {
+		l.values[key] = append([]string(nil), labelValues...)
+	}
+	return key
+}
+
+func (l *labeled) sortedKeys() []string {
+	keys := make([]string, 0, len(l.values))
+	for key := range l.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (l *labeled) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", l.name, l.help, l.name, l.metricType)
+}
+
+// formatLabels formats the label values of the given key, optionally
+// followed by an additional label, such as the "le" label of histograms.
+func (l *labeled) formatLabels(key string, extraName, extraValue string) string {
+	var builder strings.Builder
+	for index, value := range l.values[key] {
+		if builder.Len() > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(l.labelNames[index])
+		builder.WriteString(`="`)
+		builder.WriteString(escapeLabelValue(value))
+		builder.WriteByte('"')
+	}
+	if extraName != "" {
+		if builder.Len() > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(extraName)
+		builder.WriteString(`="`)
+		builder.WriteString(extraValue)
+		builder.WriteByte('"')
+	}
+
+	if builder.Len() == 0 {
+		return ""
+	}
+	return "{" + builder.String() + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Counter is a value that only ever increases, partitioned by labels.
+type Counter struct {
+	labeled
+	counts map[string]uint64
+}
+
+// NewCounter registers a new counter. The label values passed to Inc have to
+// match the given label names.
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	counter := &Counter{
+		labeled: newLabeled(name, help, "counter", labelNames),
+		counts:  make(map[string]uint64),
+	}
+	register(name, counter)
+	return counter
+}
+
+// Inc increments the counter for the given label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values.
+func (c *Counter) Add(delta uint64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counts[c.key(labelValues)] += delta
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %d\n", c.name, c.formatLabels(key, "", ""), c.counts[key])
+	}
+}
+
+// Histogram counts observations in configurable buckets, partitioned by
+// labels.
+type Histogram struct {
+	labeled
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	// bucketCounts aren't cumulative, they are accumulated when writing.
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+// NewHistogram registers a new histogram. The buckets are the upper bounds
+// and have to be sorted in ascending order.
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	histogram := &Histogram{
+		labeled: newLabeled(name, help, "histogram", labelNames),
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	register(name, histogram)
+	return histogram
+}
+
+// Observe records a single value for the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := h.key(labelValues)
+	series, exists := h.series[key]
+	if !exists {
+		series = &histogramSeries{bucketCounts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+
+	series.count++
+	series.sum += value
+	if index := sort.SearchFloat64s(h.buckets, value); index < len(h.buckets) {
+		series.bucketCounts[index]++
+	}
+}
+
+// ObserveSince records the seconds passed since the given time. This is
+// meant to be used with defer.
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range h.sortedKeys() {
+		series := h.series[key]
+
+		var cumulative uint64
+		for index, upperBound := range h.buckets {
+			cumulative += series.bucketCounts[index]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(key, "le", formatFloat(upperBound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(key, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.formatLabels(key, "", ""), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.formatLabels(key, "", ""), series.count)
+	}
+}
+
+// GaugeFunc is a value that can go up and down. It is calculated whenever
+// the metrics are collected.
+type GaugeFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is determined by calling the
+// given function.
+func NewGaugeFunc(name, help string, value func() float64) *GaugeFunc {
+	gauge := &GaugeFunc{name: name, help: help, value: value}
+	register(name, gauge)
+	return gauge
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.value()))
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_counterFormat(t *testing.T) {
+	counter := NewCounter("test_events_total", "Events seen by the test.", "type")
+	counter.Inc("b")
+	counter.Add(2, "a")
+	counter.Inc(`quote"d`)
+
+	var output strings.Builder
+	counter.write(&output)
+
+	expected := `# HELP test_events_total Events seen by the test.
+# TYPE test_events_total counter
+test_events_total{type="a"} 2
+test_events_total{type="b"} 1
+test_events_total{type="quote\"d"} 1
+`
+	if output.String() != expected {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+}
+
+func Test_histogramFormat(t *testing.T) {
+	histogram := NewHistogram("test_duration_seconds", "Durations seen by the test.", []float64{1, 5})
+	histogram.Observe(0.5)
+	histogram.Observe(1)
+	histogram.Observe(3)
+	histogram.Observe(10)
+
+	var output strings.Builder
+	histogram.write(&output)
+
+	expected := `# HELP test_duration_seconds Durations seen by the test.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="5"} 3
+test_duration_seconds_bucket{le="+Inf"} 4
+test_duration_seconds_sum 14.5
+test_duration_seconds_count 4
+`
+	if output.String() != expected {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+}
+
+func Test_handlerRequiresToken(t *testing.T) {
+	NewGaugeFunc("test_answer", "The answer.", func() float64 { return 42 })
+
+	for name, testCase := range map[string]struct {
+		token          string
+		authorization  string
+		expectedStatus int
+	}{
+		"no token configured": {"", "", http.StatusOK},
+		"token missing":       {"secret", "", http.StatusUnauthorized},
+		"token wrong":         {"secret", "Bearer nope", http.StatusUnauthorized},
+		"token correct":       {"secret", "Bearer secret", http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if testCase.authorization != "" {
+				request.Header.Set("Authorization", testCase.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			Handler(testCase.token).ServeHTTP(recorder, request)
+
+			if recorder.Code != testCase.expectedStatus {
+				t.Fatalf("expected status %d, but got %d", testCase.expectedStatus, recorder.Code)
+			}
+			if recorder.Code == http.StatusOK && !strings.Contains(recorder.Body.String(), "test_answer 42\n") {
+				t.Errorf("gauge missing from output:\n%s", recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package moderation keeps the moderators, VIPs and bans of Twitch channels
+// up to date, so that lobbies don't depend on streamers syncing them
+// manually. Channels are synced periodically as long as they have recent
+// lobbies, and whenever Twitch notifies us about changed moderators.
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/logging"
+	"github.com/scribble-rs/scribble.rs/state"
+	"github.com/scribble-rs/scribble.rs/twitch"
+)
+
+// recentLobbyAge is the age up to which lobbies cause their channel to be
+// synced. Lobbies are usually closed long before.
+const recentLobbyAge = 24 * time.Hour
+
+// syncTask identifies the periodic sync, which only one of multiple
+// instances runs at a time.
+const syncTask = "moderation_sync"
+
+var errMissingScope = fmt.Errorf("the channel's tokens lack the %s scope", twitch.ModerationScope)
+
+// Sync copies the moderators, VIPs and bans of channels from Twitch into
+// the database and makes the channel's lobbies reload them.
+type Sync struct {
+	Twitch *twitch.Client
+	Tokens twitch.TokenStore
+	DB     *database.DB
+	// Interval is the time between syncing all channels with recent
+	// lobbies. Zero disables the periodic sync.
+	Interval time.Duration
+}
+
+// Launch starts syncing periodically in the background. With multiple
+// instances, each sync only runs on one of them, as the lobbies of all
+// instances are updated via state.UpdateChannel.
+func (s *Sync) Launch() {
+	if s.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			//Half the interval leaves room for the instances' tickers
+			//drifting apart, without syncing twice per interval.
+			claimed, err := s.DB.ClaimTaskRun(syncTask, s.Interval/2)
+			if err != nil {
+				logging.Error("Failed claiming channel sync", logging.KeyError, err)
+			} else if claimed {
+				s.SyncRecentChannels()
+			}
+		}
+	}()
+}
+
+// SyncRecentChannels syncs all channels with recent lobbies. Failures are
+// only logged, as a single channel shouldn't prevent syncing the others.
+func (s *Sync) SyncRecentChannels() {
+	channels, err := s.DB.GetRecentTwitchChannels(time.Now().Add(-recentLobbyAge))
+	if err != nil {
+		logging.Error("Failed listing channels to sync", logging.KeyError, err)
+		return
+	}
+
+	for index := range channels {
+		channel := &channels[index]
+		if err := s.SyncChannel(channel); err != nil {
+			logging.Warn("Failed syncing channel", logging.KeyUser, channel.Id, logging.KeyError, err)
+		}
+	}
+	logging.Info("Synced channels", "count", len(channels))
+}
+
+// SyncChannel syncs a single channel using its stored tokens. VIPs are
+// only synced if the channel has granted twitch.VIPScope.
+func (s *Sync) SyncChannel(channel *auth.User) error {
+	tokens, err := s.tokens(channel)
+	if err != nil {
+		return err
+	}
+
+	mods, err := s.Twitch.GetAllModerators(tokens, channel.Id)
+	if err != nil {
+		return err
+	}
+	if err := s.DB.SetModsForChannel(channel.Id, mods); err != nil {
+		return err
+	}
+
+	bans, err := s.Twitch.GetAllBannedUsers(tokens, channel.Id)
+	if err != nil {
+		return err
+	}
+	if err := s.DB.SetBansForChannel(channel.Id, bans); err != nil {
+		return err
+	}
+
+	if tokens.HasScope(twitch.VIPScope) {
+		vips, err := s.Twitch.GetAllVIPs(tokens, channel.Id)
+		if err != nil {
+			return err
+		}
+		vipDigests := make([]database.UserDigest, len(vips))
+		for i, vip := range vips {
+			vipDigests[i] = database.UserDigest{Id: vip.UserId, Name: vip.UserName}
+		}
+		if err := s.DB.SetChannelList(channel.Id, database.ListVIP, vipDigests); err != nil {
+			return err
+		}
+	}
+
+	state.UpdateChannel(channel.Id)
+	return nil
+}
+
+// tokens returns the channel's tokens. Expired tokens are refreshed by the
+// token store.
+func (s *Sync) tokens(channel *auth.User) (*twitch.TokenSet, error) {
+	tokens, err := s.Tokens.Get(channel)
+	if err != nil {
+		return nil, err
+	} else if tokens == nil {
+		return nil, errors.New("no tokens stored for channel")
+	} else if !tokens.HasScope(twitch.ModerationScope) {
+		return nil, errMissingScope
+	}
+
+	return tokens, nil
+}
@@ -1,16 +1,22 @@
 package state
 
 import (
-	"log"
 	"sync"
 	"time"
 
+	"github.com/scribble-rs/scribble.rs/clock"
 	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
 )
 
 var (
 	globalStateMutex               = &sync.Mutex{}
 	lobbies          []*game.Lobby = nil
+	// stateClock decides when empty lobbies are old enough to be removed.
+	stateClock clock.Clock = clock.Real
+	// registry records the lobbies of this instance, so that other
+	// instances can find them.
+	registry Registry = localRegistry{}
 )
 
 // LaunchCleanupRoutine starts a task to clean up empty lobbies. An empty
@@ -46,7 +52,7 @@ func cleanupRoutineLogic() {
 		}
 
 		disconnectTime := lobby.LastPlayerDisconnectTime
-		if disconnectTime == nil || time.Since(*disconnectTime) >= 75*time.Second {
+		if disconnectTime == nil || stateClock.Now().Sub(*disconnectTime) >= 75*time.Second {
 			removeLobbyByIndex(index)
 		}
 	}
@@ -55,9 +61,13 @@ func cleanupRoutineLogic() {
 // AddLobby adds a lobby to the instance, making it visible for GetLobby calls.
 func AddLobby(lobby *game.Lobby) {
 	globalStateMutex.Lock()
-	defer globalStateMutex.Unlock()
-
 	lobbies = append(lobbies, lobby)
+	registry := registry
+	globalStateMutex.Unlock()
+
+	if err := registry.Claim(lobby); err != nil {
+		lobby.Logger().Error("Failed claiming lobby", logging.KeyError, err)
+	}
 }
 
 // GetLobby returns a Lobby that has a matching ID or no Lobby if none could
@@ -87,6 +97,7 @@ func ShutdownLobbiesGracefully() {
 		//reconnect will end up running into the global statelock. Therefore,
 		//reconnecting wouldn't be possible.
 		lobby.Shutdown()
+		releaseLobby(registry, lobby.LobbyID)
 	}
 
 	//Instead of removing one by one, we nil the array, since that's faster.
@@ -120,6 +131,81 @@ func GetPublicLobbies() []*game.Lobby {
 	return publicLobbies
 }
 
+// GetLobbies returns all lobbies of this instance, no matter whether they are
+// public or not.
+func GetLobbies() []*game.Lobby {
+	lobbies, _ := copyLobbies()
+	return lobbies
+}
+
+// UpdateChannel makes the lobbies of the channel reload its permissions,
+// mods and VIPs. This applies to the lobbies on all instances.
+func UpdateChannel(channelID string) {
+	reloadChannel(channelID)
+	if err := currentRegistry().ChannelChanged(channelID); err != nil {
+		logging.Error("Failed notifying instances about channel change", logging.KeyUser, channelID, logging.KeyError, err)
+	}
+}
+
+// BroadcastSystemMessage sends the message to all lobbies on all instances.
+// The message has been sent to the local lobbies, even if an error is
+// returned.
+func BroadcastSystemMessage(message string) error {
+	sendSystemMessage(message)
+	return currentRegistry().Broadcast(message)
+}
+
+func sendSystemMessage(message string) {
+	for _, lobby := range GetLobbies() {
+		lobby.SendSystemMessage(message)
+	}
+}
+
+// reloadChannel reloads the channel of all local lobbies created by the
+// channel. An empty channel ID reloads all lobbies.
+func reloadChannel(channelID string) {
+	for _, lobby := range GetLobbies() {
+		if channelID != "" && lobby.GetCreator().Id != channelID {
+			continue
+		}
+
+		if err := lobby.ReloadPermissions(); err != nil {
+			lobby.Logger().Error("Failed reloading permissions", logging.KeyError, err)
+		}
+		lobby.InvalidateMods()
+	}
+}
+
+// CloseLobby shuts down a lobby, notifying all its players and removing it
+// afterwards. If the lobby doesn't exist, false is returned.
+func CloseLobby(id string) bool {
+	lobby := takeLobby(id)
+	if lobby == nil {
+		return false
+	}
+
+	//Shutting down locks the lobby, which mustn't block access to all
+	//other lobbies.
+	lobby.Shutdown()
+	return true
+}
+
+// takeLobby removes the lobby with the given id and returns it, or nil if
+// it doesn't exist.
+func takeLobby(id string) *game.Lobby {
+	globalStateMutex.Lock()
+	defer globalStateMutex.Unlock()
+
+	for index, lobby := range lobbies {
+		if lobby.LobbyID == id {
+			removeLobbyByIndex(index)
+			return lobby
+		}
+	}
+
+	return nil
+}
+
 // RemoveLobby deletes a lobby, not allowing anyone to connect to it again.
 func RemoveLobby(id string) {
 	globalStateMutex.Lock()
@@ -154,7 +240,10 @@ func removeLobbyByIndex(indexToDelete int) {
 	lobbies[len(lobbies)-1] = nil
 	lobbies = lobbies[:len(lobbies)-1]
 
-	log.Printf("Closing lobby %s. There are currently %d open lobbies left.\n", lobbyID, len(lobbies))
+	//The registry might be slow, so we don't want to block the state.
+	go releaseLobby(registry, lobbyID)
+
+	logging.Info("Closing lobby", logging.KeyLobby, lobbyID, "lobbies_left", len(lobbies))
 }
 
 // pageStats represents dynamic information about the website.
@@ -168,16 +257,16 @@ type pageStats struct {
 // Stats delivers information about the state of the service. Currently this
 // is lobby and player counts.
 func Stats() *pageStats {
-	globalStateMutex.Lock()
-	defer globalStateMutex.Unlock()
+	//The lobbies are locked one by one, without blocking the state.
+	lobbies, _ := copyLobbies()
 
 	var playerCount, occupiedPlayerSlotCount, connectedPlayerCount uint64
-	//While one would expect locking the lobby here, it's not very
-	//important to get 100% consistent results here.
 	for _, lobby := range lobbies {
-		playerCount += uint64(len(lobby.GetPlayers()))
-		occupiedPlayerSlotCount += uint64(lobby.GetOccupiedPlayerSlots())
-		connectedPlayerCount += uint64(lobby.GetConnectedPlayerCount())
+		lobby.Synchronized(func() {
+			playerCount += uint64(len(lobby.GetPlayers()))
+			occupiedPlayerSlotCount += uint64(lobby.GetOccupiedPlayerSlots())
+			connectedPlayerCount += uint64(lobby.GetConnectedPlayerCount())
+		})
 	}
 
 	return &pageStats{
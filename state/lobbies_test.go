@@ -1,8 +1,12 @@
 package state
 
 import (
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/clock"
 	"github.com/scribble-rs/scribble.rs/game"
 )
 
@@ -31,3 +35,155 @@ func TestAddAndRemove(t *testing.T) {
 		t.Error("Lobbies should have been empty after removal.")
 	}
 }
+
+func TestCleanupEmptyLobby(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	stateClock = fakeClock
+	defer func() {
+		stateClock = clock.Real
+	}()
+
+	_, lobby, err := game.CreateLobby(nil, &auth.User{Id: "1234", Name: "Owner"}, "english", true, 120, 4, 12, 0, nil, game.JoinRules{}, false)
+	if err != nil {
+		t.Fatalf("Couldn't create lobby: %s", err)
+	}
+	//The owner never connected, so the lobby counts as empty.
+	disconnectTime := fakeClock.Now()
+	lobby.LastPlayerDisconnectTime = &disconnectTime
+	AddLobby(lobby)
+	defer RemoveLobby(lobby.LobbyID)
+
+	fakeClock.Advance(74 * time.Second)
+	cleanupRoutineLogic()
+	if GetLobby(lobby.LobbyID) == nil {
+		t.Error("Lobby shouldn't have been cleaned up yet.")
+	}
+
+	fakeClock.Advance(time.Second)
+	cleanupRoutineLogic()
+	if GetLobby(lobby.LobbyID) != nil {
+		t.Error("Lobby should've been cleaned up.")
+	}
+}
+
+// recordingRegistry remembers which lobbies are currently claimed.
+type recordingRegistry struct {
+	localRegistry
+	mutex     *sync.Mutex
+	claimed   map[string]bool
+	broadcast []string
+}
+
+func (r *recordingRegistry) Claim(lobby *game.Lobby) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.claimed[lobby.LobbyID] = true
+	return nil
+}
+
+func (r *recordingRegistry) Release(lobbyID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.claimed, lobbyID)
+	return nil
+}
+
+func (r *recordingRegistry) Broadcast(message string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.broadcast = append(r.broadcast, message)
+	return nil
+}
+
+func (r *recordingRegistry) isClaimed(lobbyID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.claimed[lobbyID]
+}
+
+func TestRegistryKeepsTrackOfLobbies(t *testing.T) {
+	recorder := &recordingRegistry{mutex: &sync.Mutex{}, claimed: make(map[string]bool)}
+	SetRegistry(recorder)
+	defer SetRegistry(nil)
+
+	lobby := &game.Lobby{LobbyID: "registered"}
+	AddLobby(lobby)
+	if !recorder.isClaimed(lobby.LobbyID) {
+		t.Error("Lobby should've been claimed.")
+	}
+
+	RemoveLobby(lobby.LobbyID)
+	//Releasing happens in the background.
+	deadline := time.Now().Add(time.Second)
+	for recorder.isClaimed(lobby.LobbyID) {
+		if time.Now().After(deadline) {
+			t.Fatal("Lobby should've been released.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCloseLobby(t *testing.T) {
+	_, lobby, err := game.CreateLobby(nil, &auth.User{Id: "1234", Name: "Owner"}, "english", true, 120, 4, 12, 0, nil, game.JoinRules{}, false)
+	if err != nil {
+		t.Fatalf("Couldn't create lobby: %s", err)
+	}
+	var sentEvents []string
+	lobby.WriteJSON = func(_ *game.SocketConnection, object interface{}) error {
+		sentEvents = append(sentEvents, object.(game.GameEvent).Type)
+		return nil
+	}
+	AddLobby(lobby)
+
+	if lobbies := GetLobbies(); len(lobbies) != 1 || lobbies[0] != lobby {
+		t.Fatalf("Expected only the new lobby, but got %v", lobbies)
+	}
+
+	if !CloseLobby(lobby.LobbyID) {
+		t.Error("Lobby should've been closed.")
+	}
+	if GetLobby(lobby.LobbyID) != nil {
+		t.Error("Lobby shouldn't have been found after closing.")
+	}
+	if len(sentEvents) != 1 || sentEvents[0] != "shutdown" {
+		t.Errorf("Expected a single shutdown event, but got %v", sentEvents)
+	}
+
+	if CloseLobby(lobby.LobbyID) {
+		t.Error("Closing a lobby twice shouldn't succeed.")
+	}
+}
+
+func TestBroadcastSystemMessage(t *testing.T) {
+	recorder := &recordingRegistry{mutex: &sync.Mutex{}, claimed: make(map[string]bool)}
+	SetRegistry(recorder)
+	defer SetRegistry(nil)
+
+	_, lobby, err := game.CreateLobby(nil, &auth.User{Id: "1234", Name: "Owner"}, "english", true, 120, 4, 12, 0, nil, game.JoinRules{}, false)
+	if err != nil {
+		t.Fatalf("Couldn't create lobby: %s", err)
+	}
+	var sentEvents []*game.GameEvent
+	lobby.WriteJSON = func(_ *game.SocketConnection, object interface{}) error {
+		sentEvents = append(sentEvents, object.(*game.GameEvent))
+		return nil
+	}
+	AddLobby(lobby)
+	defer RemoveLobby(lobby.LobbyID)
+
+	if err := BroadcastSystemMessage("Restarting soon"); err != nil {
+		t.Fatalf("Couldn't broadcast: %s", err)
+	}
+
+	if len(sentEvents) != 1 || sentEvents[0].Type != "system-message" || sentEvents[0].Data != "Restarting soon" {
+		t.Errorf("Expected the message to be sent to the local lobby, but got %v", sentEvents)
+	}
+	//The other instances are only notified, as they send the message themselves.
+	if len(recorder.broadcast) != 1 || recorder.broadcast[0] != "Restarting soon" {
+		t.Errorf("Expected the message to be broadcast to other instances, but got %v", recorder.broadcast)
+	}
+}
@@ -0,0 +1,40 @@
+package state
+
+import (
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/metrics"
+)
+
+func init() {
+	metrics.NewGaugeFunc("scribblers_lobbies_active", "Lobbies currently open on this instance.", func() float64 {
+		return countInLobbies(func(*game.Lobby) int { return 1 })
+	})
+	metrics.NewGaugeFunc("scribblers_lobbies_public", "Public lobbies currently open on this instance.", func() float64 {
+		return countInLobbies(func(lobby *game.Lobby) int {
+			if lobby.IsPublic() {
+				return 1
+			}
+			return 0
+		})
+	})
+	metrics.NewGaugeFunc("scribblers_players_connected", "Players with an established websocket connection.", func() float64 {
+		return countInLobbies((*game.Lobby).GetConnectedPlayerCount)
+	})
+	metrics.NewGaugeFunc("scribblers_observers_connected", "Observers with an established websocket connection.", func() float64 {
+		return countInLobbies((*game.Lobby).GetConnectedObserverCount)
+	})
+}
+
+func countInLobbies(count func(lobby *game.Lobby) int) float64 {
+	globalStateMutex.Lock()
+	defer globalStateMutex.Unlock()
+
+	var total int
+	//While one would expect locking the lobby here, it's not very
+	//important to get 100% consistent results here.
+	for _, lobby := range lobbies {
+		total += count(lobby)
+	}
+
+	return float64(total)
+}
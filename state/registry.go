@@ -0,0 +1,340 @@
+package state
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/database"
+	"github.com/scribble-rs/scribble.rs/game"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+// Registry keeps track of which instance owns which lobby. This allows
+// running multiple instances behind the same load balancer. A lobby always
+// lives in the memory of the instance that created it, other instances have
+// to forward requests concerning that lobby.
+type Registry interface {
+	// Claim records that this instance owns the given lobby.
+	Claim(lobby *game.Lobby) error
+	// Release removes the lobby from the registry.
+	Release(lobbyID string) error
+	// Refresh updates the registrations of all lobbies owned by this
+	// instance. Registrations that aren't refreshed regularly expire, so
+	// that lobbies of crashed instances disappear.
+	Refresh(lobbies []*game.Lobby) error
+	// Locate returns the registration of a lobby owned by another instance.
+	// If the lobby is unknown, nil is returned.
+	Locate(lobbyID string) (*database.LobbyRegistration, error)
+	// RemotePublicLobbies returns the public lobbies of all other instances.
+	RemotePublicLobbies() ([]database.LobbyRegistration, error)
+	// ChannelChanged tells all other instances that the permissions, mods
+	// or VIPs of a channel changed, see UpdateChannel.
+	ChannelChanged(channelID string) error
+	// RemoteLobbies returns all lobbies of all other instances, including
+	// private ones.
+	RemoteLobbies() ([]database.LobbyRegistration, error)
+	// Broadcast makes all other instances send the system message to their
+	// lobbies, see BroadcastSystemMessage.
+	Broadcast(message string) error
+}
+
+// localRegistry is used when running a single instance. Since there are no
+// other instances, there's nothing to record.
+type localRegistry struct{}
+
+func (localRegistry) Claim(*game.Lobby) error     { return nil }
+func (localRegistry) Release(string) error        { return nil }
+func (localRegistry) Refresh([]*game.Lobby) error { return nil }
+func (localRegistry) ChannelChanged(string) error { return nil }
+func (localRegistry) Broadcast(string) error      { return nil }
+
+func (localRegistry) Locate(string) (*database.LobbyRegistration, error) {
+	return nil, nil
+}
+
+func (localRegistry) RemotePublicLobbies() ([]database.LobbyRegistration, error) {
+	return nil, nil
+}
+
+func (localRegistry) RemoteLobbies() ([]database.LobbyRegistration, error) {
+	return nil, nil
+}
+
+const (
+	// registryChannel is the Postgres notification channel used for
+	// invalidating cached lobby locations. The payload is the lobby ID.
+	registryChannel = "lobby_registry"
+	// channelsChannel is the Postgres notification channel used for
+	// telling other instances to reload the permissions, mods and VIPs of a
+	// channel. The payload is the sending instance's ID and the channel ID,
+	// separated by a colon.
+	channelsChannel = "lobby_channels"
+	// messagesChannel is the Postgres notification channel used for system
+	// messages to the lobbies of all instances. The payload is the sending
+	// instance's ID and the message, separated by a colon.
+	messagesChannel = "lobby_messages"
+	// registrationTimeout is the time after which registrations that
+	// haven't been refreshed are ignored.
+	registrationTimeout = time.Minute
+	// registryRefreshInterval has to be considerably shorter than the
+	// registrationTimeout.
+	registryRefreshInterval = 20 * time.Second
+	// locationCacheTime limits how long a cached location is trusted, in
+	// case a notification got lost.
+	locationCacheTime = 30 * time.Second
+)
+
+// PostgresRegistry records lobby ownership in the database. Lookups are
+// cached and invalidated via LISTEN/NOTIFY whenever ownership changes.
+type PostgresRegistry struct {
+	db          *database.DB
+	instanceID  string
+	instanceURL string
+
+	cacheMutex *sync.Mutex
+	cache      map[string]cachedLocation
+}
+
+type cachedLocation struct {
+	// registration is nil if the lobby is unknown.
+	registration *database.LobbyRegistration
+	expiresAt    time.Time
+}
+
+// NewPostgresRegistry creates a registry for the given instance. The
+// instanceURL has to be reachable by all other instances, as it is used for
+// forwarding requests.
+func NewPostgresRegistry(db *database.DB, instanceID, instanceURL string) (*PostgresRegistry, error) {
+	notifications, err := db.Listen(registryChannel)
+	if err != nil {
+		return nil, err
+	}
+	channelNotifications, err := db.Listen(channelsChannel)
+	if err != nil {
+		return nil, err
+	}
+	messageNotifications, err := db.Listen(messagesChannel)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &PostgresRegistry{
+		db:          db,
+		instanceID:  instanceID,
+		instanceURL: instanceURL,
+		cacheMutex:  &sync.Mutex{},
+		cache:       make(map[string]cachedLocation),
+	}
+	go registry.invalidate(notifications)
+	go registry.reloadChannels(channelNotifications)
+	go registry.sendMessages(messageNotifications)
+
+	return registry, nil
+}
+
+func (r *PostgresRegistry) invalidate(notifications <-chan string) {
+	for lobbyID := range notifications {
+		r.cacheMutex.Lock()
+		if lobbyID == "" {
+			//We might have missed notifications while reconnecting.
+			r.cache = make(map[string]cachedLocation)
+		} else {
+			delete(r.cache, lobbyID)
+		}
+		r.cacheMutex.Unlock()
+	}
+}
+
+func (r *PostgresRegistry) reloadChannels(notifications <-chan string) {
+	for payload := range notifications {
+		if payload == "" {
+			//We might have missed notifications while reconnecting.
+			reloadChannel("")
+			continue
+		}
+
+		instanceID, channelID, valid := strings.Cut(payload, ":")
+		//Our own lobbies have been reloaded by UpdateChannel already.
+		if valid && instanceID != r.instanceID {
+			reloadChannel(channelID)
+		}
+	}
+}
+
+func (r *PostgresRegistry) sendMessages(notifications <-chan string) {
+	for payload := range notifications {
+		//Messages missed while reconnecting are lost, as they aren't useful
+		//anymore once they're late.
+		instanceID, message, valid := strings.Cut(payload, ":")
+		//Our own lobbies have been sent the message by BroadcastSystemMessage.
+		if valid && instanceID != r.instanceID {
+			sendSystemMessage(message)
+		}
+	}
+}
+
+func (r *PostgresRegistry) registrationFor(lobby *game.Lobby) *database.LobbyRegistration {
+	var registration *database.LobbyRegistration
+	lobby.Synchronized(func() {
+		registration = &database.LobbyRegistration{
+			LobbyId:     lobby.LobbyID,
+			InstanceId:  r.instanceID,
+			InstanceUrl: r.instanceURL,
+			Public:      lobby.IsPublic(),
+			PlayerCount: lobby.GetOccupiedPlayerSlots(),
+			MaxPlayers:  lobby.MaxPlayers,
+			Round:       lobby.Round,
+			Rounds:      lobby.Rounds,
+			DrawingTime: lobby.DrawingTime,
+			CustomWords: len(lobby.CustomWords) > 0,
+			Wordpack:    lobby.Wordpack,
+			UpdatedAt:   stateClock.Now(),
+		}
+	})
+	return registration
+}
+
+func (r *PostgresRegistry) Claim(lobby *game.Lobby) error {
+	if err := r.db.UpsertLobbyRegistration(r.registrationFor(lobby)); err != nil {
+		return err
+	}
+
+	return r.db.Notify(registryChannel, lobby.LobbyID)
+}
+
+func (r *PostgresRegistry) Release(lobbyID string) error {
+	if err := r.db.DeleteLobbyRegistration(lobbyID); err != nil {
+		return err
+	}
+
+	return r.db.Notify(registryChannel, lobbyID)
+}
+
+func (r *PostgresRegistry) Refresh(lobbies []*game.Lobby) error {
+	for _, lobby := range lobbies {
+		if err := r.db.UpsertLobbyRegistration(r.registrationFor(lobby)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PostgresRegistry) Locate(lobbyID string) (*database.LobbyRegistration, error) {
+	now := stateClock.Now()
+
+	r.cacheMutex.Lock()
+	cached, isCached := r.cache[lobbyID]
+	r.cacheMutex.Unlock()
+	if isCached && now.Before(cached.expiresAt) {
+		return cached.registration, nil
+	}
+
+	registration, err := r.db.GetLobbyRegistration(lobbyID, now.Add(-registrationTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	//If we are the owner but don't know the lobby, it has been closed and
+	//the registration is a leftover.
+	if registration != nil && registration.InstanceId == r.instanceID {
+		registration = nil
+	}
+
+	r.cacheMutex.Lock()
+	r.cache[lobbyID] = cachedLocation{
+		registration: registration,
+		expiresAt:    now.Add(locationCacheTime),
+	}
+	r.cacheMutex.Unlock()
+
+	return registration, nil
+}
+
+func (r *PostgresRegistry) ChannelChanged(channelID string) error {
+	return r.db.Notify(channelsChannel, r.instanceID+":"+channelID)
+}
+
+func (r *PostgresRegistry) RemotePublicLobbies() ([]database.LobbyRegistration, error) {
+	return r.db.GetPublicLobbyRegistrations(r.instanceID, stateClock.Now().Add(-registrationTimeout))
+}
+
+func (r *PostgresRegistry) RemoteLobbies() ([]database.LobbyRegistration, error) {
+	return r.db.GetLobbyRegistrations(r.instanceID, stateClock.Now().Add(-registrationTimeout))
+}
+
+func (r *PostgresRegistry) Broadcast(message string) error {
+	return r.db.Notify(messagesChannel, r.instanceID+":"+message)
+}
+
+// SetRegistry replaces the default single instance registry. This has to be
+// called before any lobby is added. Passing nil restores the default.
+func SetRegistry(newRegistry Registry) {
+	globalStateMutex.Lock()
+	defer globalStateMutex.Unlock()
+
+	if newRegistry == nil {
+		registry = localRegistry{}
+	} else {
+		registry = newRegistry
+	}
+}
+
+// LaunchRegistryRoutine starts a task that regularly refreshes the
+// registrations of all lobbies owned by this instance. This also keeps the
+// public lobby listings of other instances up to date.
+func LaunchRegistryRoutine() {
+	go func() {
+		refreshTicker := time.NewTicker(registryRefreshInterval)
+		for {
+			<-refreshTicker.C
+			lobbies, registry := copyLobbies()
+			if err := registry.Refresh(lobbies); err != nil {
+				logging.Error("Failed refreshing lobby registry", logging.KeyError, err)
+			}
+		}
+	}()
+}
+
+// LocateLobby returns the registration of a lobby owned by another instance.
+// If no other instance owns the lobby, nil is returned.
+func LocateLobby(lobbyID string) (*database.LobbyRegistration, error) {
+	return currentRegistry().Locate(lobbyID)
+}
+
+// GetRemotePublicLobbies returns the public lobbies of all other instances.
+// See GetPublicLobbies for the lobbies of this instance.
+func GetRemotePublicLobbies() ([]database.LobbyRegistration, error) {
+	return currentRegistry().RemotePublicLobbies()
+}
+
+// GetRemoteLobbies returns all lobbies of all other instances. See
+// GetLobbies for the lobbies of this instance.
+func GetRemoteLobbies() ([]database.LobbyRegistration, error) {
+	return currentRegistry().RemoteLobbies()
+}
+
+func currentRegistry() Registry {
+	globalStateMutex.Lock()
+	defer globalStateMutex.Unlock()
+
+	return registry
+}
+
+// copyLobbies returns the lobbies and the registry they should be refreshed
+// in. Copying allows talking to the registry without holding the lock.
+func copyLobbies() ([]*game.Lobby, Registry) {
+	globalStateMutex.Lock()
+	defer globalStateMutex.Unlock()
+
+	copied := make([]*game.Lobby, len(lobbies))
+	copy(copied, lobbies)
+	return copied, registry
+}
+
+func releaseLobby(registry Registry, lobbyID string) {
+	if err := registry.Release(lobbyID); err != nil {
+		logging.Error("Failed releasing lobby", logging.KeyLobby, lobbyID, logging.KeyError, err)
+	}
+}
@@ -4,10 +4,15 @@ func initEnglishTranslation() Translation {
 	translation := createTranslation()
 
 	translation.put("open-observe", "Open observer mode")
+	translation.put("open-caster-view", "Open caster view (reveals the word)")
 
 	translation.put("login-required", "Login required")
-	translation.put("login-required-hint", "In order to prevent abuse, you must authenticate using Twitch to play.")
+	translation.put("login-required-hint", "In order to prevent abuse, you must authenticate to play.")
 	translation.put("login-with-twitch", "Authenticate with Twitch")
+	translation.put("login-with-oidc", "Authenticate with single sign-on")
+	translation.put("login-as-guest", "Play as guest")
+	translation.put("guest-nickname", "Nickname")
+	translation.put("guest-login-hint", "Guests can't join lobbies restricted to followers or subscribers.")
 
 	translation.put("requires-js", "This website requires JavaScript to run properly.")
 
@@ -25,6 +30,13 @@ func initEnglishTranslation() Translation {
 	translation.put("toggle-fullscreen", "Toggle fullscreen")
 	translation.put("show-help", "Show help")
 	translation.put("kick-a-player", "Kick a player")
+	translation.put("kick", "Kick")
+	translation.put("mute", "Mute")
+	translation.put("unmute", "Unmute")
+	translation.put("skip-turn", "Skip the current turn")
+	translation.put("pause-turn", "Pause or resume the current turn")
+	translation.put("clear-canvas-of-drawer", "Clear the canvas of the drawer")
+	translation.put("paused", "Paused")
 
 	translation.put("last-turn", "(Last turn: %s)")
 
@@ -43,10 +55,20 @@ func initEnglishTranslation() Translation {
 	translation.put("max-players-setting", "Maximum Players")
 	translation.put("public-lobby-setting", "Public Lobby")
 	translation.put("followers-only-setting", "Users must follow")
+	translation.put("min-follow-days-setting", "Minimum Days Following")
 	translation.put("subs-only-setting", "Users must subscribe")
+	translation.put("min-sub-tier-setting", "Minimum Subscription Tier")
+	translation.put("vips-only-setting", "Users must be VIPs")
+	translation.put("allowlist-only-setting", "Users must be on your allowlist")
+	translation.put("join-rule-setting", "Users must fulfil")
+	translation.put("join-rule-all", "All requirements")
+	translation.put("join-rule-any", "Any requirement")
+	translation.put("save-drawings-setting", "Keep drawings after the lobby closes")
 	translation.put("custom-words", "Custom Words")
 	translation.put("custom-words-info", "Enter your additional words, separating them by commas")
 	translation.put("custom-words-chance-setting", "Custom Words Chance")
+	translation.put("observer-delay-setting", "Observer Delay (seconds)")
+	translation.put("observer-participation-setting", "Observers Can Chat And Guess")
 	translation.put("players-per-ip-limit-setting", "Players per IP Limit")
 	translation.put("enable-votekick-setting", "Allow Votekick")
 	translation.put("save-settings", "Save settings")
@@ -73,6 +95,9 @@ func initEnglishTranslation() Translation {
 	translation.put("game-over-win", "Congratulations, you've won!")
 	translation.put("game-over-tie", "It's a tie!")
 	translation.put("game-over", "You placed %s. with %s points")
+	translation.put("gallery", "Gallery")
+	translation.put("gallery-empty", "There are no drawings yet.")
+	translation.put("permalink", "Permalink")
 
 	translation.put("change-active-color", "Change your active color")
 	translation.put("use-pencil", "Use pencil")
@@ -81,6 +106,7 @@ func initEnglishTranslation() Translation {
 	translation.put("change-pencil-size-to", "Change the pencil / eraser size to %s")
 	translation.put("clear-canvas", "Clear the canvas")
 	translation.put("undo", "Revert the last change you made (Doesn't work after \""+translation.Get("clear-canvas")+"\")")
+	translation.put("redo", "Restore the last change you reverted")
 
 	translation.put("connection-lost", "Connection lost!")
 	translation.put("connection-lost-text", "Attempting to reconnect"+
@@ -0,0 +1,184 @@
+package twitch
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChatAddress is the IRC server of the Twitch chat, which requires TLS.
+const ChatAddress = "irc.chat.twitch.tv:6697"
+
+const chatLoginTimeout = 10 * time.Second
+
+var (
+	ErrChatLoginFailed = errors.New("chat login failed")
+	// ErrChatReconnect is returned by ChatConn.Read if the server is about
+	// to restart. The connection has to be reestablished.
+	ErrChatReconnect = errors.New("chat server requested a reconnect")
+)
+
+// DialChat connects to the Twitch chat. The connection has to be passed to
+// NewChatConn in order to log in.
+func DialChat() (net.Conn, error) {
+	return tls.DialWithDialer(&net.Dialer{Timeout: chatLoginTimeout}, "tcp", ChatAddress, &tls.Config{})
+}
+
+// ChatConn is a logged in connection to the Twitch chat. Reading isn't
+// synchronized and should happen in a single goroutine, while messages can
+// be sent concurrently.
+type ChatConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex *sync.Mutex
+}
+
+// ChatMessage is a message sent to a channel the connection has joined.
+type ChatMessage struct {
+	// Channel is the login of the channel, without the leading '#'.
+	Channel string
+	// User is the login of the author.
+	User string
+	Text string
+}
+
+// NewChatConn logs into the chat using an OAuth access token with the
+// chat:read and chat:edit scopes of the given user.
+func NewChatConn(conn net.Conn, login, accessToken string) (*ChatConn, error) {
+	chat := &ChatConn{
+		conn:       conn,
+		reader:     bufio.NewReader(conn),
+		writeMutex: &sync.Mutex{},
+	}
+
+	if err := chat.send("PASS oauth:" + accessToken); err != nil {
+		return nil, err
+	}
+	if err := chat.send("NICK " + strings.ToLower(login)); err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(chatLoginTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		line, err := chat.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		_, command, params := parseIRCLine(line)
+		switch command {
+		//RPL_WELCOME
+		case "001":
+			return chat, nil
+		case "NOTICE":
+			return nil, fmt.Errorf("%w: %s", ErrChatLoginFailed, params[len(params)-1])
+		}
+	}
+}
+
+func (c *ChatConn) send(line string) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	//Line breaks would allow sending arbitrary commands.
+	line = strings.NewReplacer("\r", " ", "\n", " ").Replace(line)
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+func (c *ChatConn) Join(channel string) error {
+	return c.send("JOIN #" + strings.ToLower(channel))
+}
+
+func (c *ChatConn) Part(channel string) error {
+	return c.send("PART #" + strings.ToLower(channel))
+}
+
+// Say sends a message to a channel that has been joined before.
+func (c *ChatConn) Say(channel, message string) error {
+	return c.send("PRIVMSG #" + strings.ToLower(channel) + " :" + message)
+}
+
+// Read returns the next message sent to any of the joined channels. Pings
+// are answered automatically, other commands are ignored.
+func (c *ChatConn) Read() (*ChatMessage, error) {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		prefix, command, params := parseIRCLine(line)
+		switch command {
+		case "PING":
+			if err := c.send("PONG :" + params[len(params)-1]); err != nil {
+				return nil, err
+			}
+		case "RECONNECT":
+			return nil, ErrChatReconnect
+		case "PRIVMSG":
+			if len(params) < 2 {
+				continue
+			}
+			return &ChatMessage{
+				Channel: strings.TrimPrefix(params[0], "#"),
+				User:    strings.SplitN(prefix, "!", 2)[0],
+				Text:    params[1],
+			}, nil
+		}
+	}
+}
+
+func (c *ChatConn) Close() error {
+	return c.conn.Close()
+}
+
+// parseIRCLine splits a line into the prefix (without ':'), the command and
+// its parameters. Message tags are dropped, as we don't request them.
+func parseIRCLine(line string) (string, string, []string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") {
+		if index := strings.IndexByte(line, ' '); index != -1 {
+			line = line[index+1:]
+		}
+	}
+
+	var prefix string
+	if strings.HasPrefix(line, ":") {
+		index := strings.IndexByte(line, ' ')
+		if index == -1 {
+			return line[1:], "", []string{""}
+		}
+		prefix, line = line[1:index], line[index+1:]
+	}
+
+	var trailing *string
+	if index := strings.Index(line, " :"); index != -1 {
+		rest := line[index+2:]
+		trailing, line = &rest, line[:index]
+	} else if strings.HasPrefix(line, ":") {
+		rest := line[1:]
+		trailing, line = &rest, ""
+	}
+
+	fields := strings.Fields(line)
+	var command string
+	if len(fields) > 0 {
+		command, fields = fields[0], fields[1:]
+	}
+	if trailing != nil {
+		fields = append(fields, *trailing)
+	}
+	//Callers may always access the last parameter.
+	if len(fields) == 0 {
+		fields = []string{""}
+	}
+
+	return prefix, command, fields
+}
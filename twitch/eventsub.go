@@ -0,0 +1,464 @@
+package twitch
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+// EventSubRedemptionAdd is sent whenever a viewer redeems a custom channel
+// point reward. Subscribing requires the broadcaster to have granted the
+// channel:read:redemptions scope.
+const EventSubRedemptionAdd = "channel.channel_points_custom_reward_redemption.add"
+
+// EventSubModeratorAdd and EventSubModeratorRemove are sent whenever the
+// broadcaster changes their moderators. Subscribing requires the broadcaster
+// to have granted ModerationScope.
+const (
+	EventSubModeratorAdd    = "channel.moderator.add"
+	EventSubModeratorRemove = "channel.moderator.remove"
+)
+
+// RedemptionScope has to be granted by broadcasters before their
+// redemptions can be subscribed to.
+const RedemptionScope = "channel:read:redemptions"
+
+const (
+	eventSubMessageNotification = "notification"
+	eventSubMessageVerification = "webhook_callback_verification"
+	eventSubMessageRevocation   = "revocation"
+
+	// eventSubMaxAge is the age after which messages are rejected, as Twitch
+	// recommends, in order to prevent replay attacks.
+	eventSubMaxAge = 10 * time.Minute
+	// eventSubMaxBodySize is way more than any notification we subscribe to.
+	eventSubMaxBodySize = 1 << 16
+)
+
+var ErrInvalidEventSubSignature = errors.New("invalid EventSub signature")
+
+type EventSubTransport struct {
+	Method   string `json:"method"`
+	Callback string `json:"callback"`
+	// Secret is only sent when subscribing, Twitch never returns it.
+	Secret string `json:"secret,omitempty"`
+}
+
+type EventSubSubscription struct {
+	Id        string            `json:"id"`
+	Status    string            `json:"status"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport EventSubTransport `json:"transport"`
+	CreatedAt string            `json:"created_at"`
+}
+
+type GetEventSubSubscriptionsResult struct {
+	Data       []EventSubSubscription `json:"data"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+}
+
+// Redemption is the event of EventSubRedemptionAdd.
+type Redemption struct {
+	Id                   string `json:"id"`
+	BroadcasterUserId    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+	UserId               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	UserName             string `json:"user_name"`
+	// UserInput is the text entered by the viewer, if the reward asks for
+	// any.
+	UserInput string `json:"user_input"`
+	Status    string `json:"status"`
+	Reward    struct {
+		Id     string `json:"id"`
+		Title  string `json:"title"`
+		Cost   int    `json:"cost"`
+		Prompt string `json:"prompt"`
+	} `json:"reward"`
+	RedeemedAt string `json:"redeemed_at"`
+}
+
+// ModeratorChange is the event of EventSubModeratorAdd and
+// EventSubModeratorRemove.
+type ModeratorChange struct {
+	BroadcasterUserId    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+	UserId               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	UserName             string `json:"user_name"`
+}
+
+func (c Client) GetAppAccessToken() (*TokenSet, error) {
+	params := url.Values{}
+	params.Set("client_id", c.ClientId)
+	params.Set("client_secret", c.ClientSecret)
+	params.Set("grant_type", "client_credentials")
+
+	request, newRequestError := http.NewRequest("POST", "https://id.twitch.tv/oauth2/token?"+params.Encode(), bytes.NewBuffer([]byte("")))
+	if newRequestError != nil {
+		return nil, newRequestError
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err := c.doAndParseJson(request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &TokenSet{
+		AccessToken:          result.AccessToken,
+		FetchedAt:            now,
+		AccessTokenExpiresAt: now.Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// CreateEventSubSubscription subscribes to an event. EventSub webhooks
+// require an app access token.
+func (c Client) CreateEventSubSubscription(appTokens *TokenSet, subscriptionType string, condition map[string]string, transport EventSubTransport) (*EventSubSubscription, error) {
+	body, err := json.Marshal(map[string]any{
+		"type":      subscriptionType,
+		"version":   "1",
+		"condition": condition,
+		"transport": transport,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	request, newRequestError := http.NewRequest("POST", "https://api.twitch.tv/helix/eventsub/subscriptions", bytes.NewBuffer(body))
+	if newRequestError != nil {
+		return nil, newRequestError
+	}
+
+	request.Header.Set("Authorization", "Bearer "+appTokens.AccessToken)
+	request.Header.Set("Content-Type", "application/json")
+
+	var result GetEventSubSubscriptionsResult
+	err = c.doAndParseJson(request, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Data) == 0 {
+		return nil, errors.New("no subscription received")
+	}
+
+	return &result.Data[0], nil
+}
+
+func (c Client) GetAllEventSubSubscriptions(appTokens *TokenSet, subscriptionType string) ([]EventSubSubscription, error) {
+	res := make([]EventSubSubscription, 0)
+	cursor := ""
+
+	for {
+		r, err := c.GetEventSubSubscriptions(appTokens, subscriptionType, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, r.Data...)
+
+		if r.Pagination.Cursor == "" {
+			break
+		}
+		cursor = r.Pagination.Cursor
+	}
+
+	return res, nil
+}
+
+func (c Client) GetEventSubSubscriptions(appTokens *TokenSet, subscriptionType string, cursor string) (*GetEventSubSubscriptionsResult, error) {
+	params := url.Values{}
+	params.Add("type", subscriptionType)
+
+	if cursor != "" {
+		params.Add("after", cursor)
+	}
+
+	request, newRequestError := http.NewRequest("GET", "https://api.twitch.tv/helix/eventsub/subscriptions?"+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	if newRequestError != nil {
+		return nil, newRequestError
+	}
+
+	request.Header.Set("Authorization", "Bearer "+appTokens.AccessToken)
+
+	var result GetEventSubSubscriptionsResult
+	err := c.doAndParseJson(request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (c Client) DeleteEventSubSubscription(appTokens *TokenSet, id string) error {
+	params := url.Values{}
+	params.Add("id", id)
+
+	request, newRequestError := http.NewRequest("DELETE", "https://api.twitch.tv/helix/eventsub/subscriptions?"+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	if newRequestError != nil {
+		return newRequestError
+	}
+
+	request.Header.Set("Authorization", "Bearer "+appTokens.AccessToken)
+
+	return c.doAndParseJson(request, nil)
+}
+
+// SignEventSubMessage calculates the signature Twitch sends in the
+// Twitch-Eventsub-Message-Signature header.
+func SignEventSubMessage(secret, messageId, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(messageId))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// EventSub manages the EventSub webhooks of broadcasters and receives their
+// notifications. All subscriptions share the same callback and secret.
+type EventSub struct {
+	Client *Client
+	// Secret has to be between 10 and 100 characters.
+	Secret      string
+	CallbackURL string
+
+	mutex     sync.Mutex
+	appTokens *TokenSet
+	// seen are the IDs of recently received messages, as Twitch may send
+	// the same message more than once.
+	seen map[string]time.Time
+}
+
+func (e *EventSub) getAppTokens() (*TokenSet, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.appTokens == nil || time.Now().Add(time.Minute).After(e.appTokens.AccessTokenExpiresAt) {
+		tokens, err := e.Client.GetAppAccessToken()
+		if err != nil {
+			return nil, err
+		}
+		e.appTokens = tokens
+	}
+
+	return e.appTokens, nil
+}
+
+// subscriptions returns the subscriptions of the broadcaster to the given
+// type that use our callback.
+func (e *EventSub) subscriptions(subscriptionType, broadcasterId string) (*TokenSet, []EventSubSubscription, error) {
+	appTokens, err := e.getAppTokens()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subscriptions, err := e.Client.GetAllEventSubSubscriptions(appTokens, subscriptionType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var result []EventSubSubscription
+	for _, subscription := range subscriptions {
+		if subscription.Condition["broadcaster_user_id"] == broadcasterId && subscription.Transport.Callback == e.CallbackURL {
+			result = append(result, subscription)
+		}
+	}
+	return appTokens, result, nil
+}
+
+// RedemptionsSubscribed indicates whether the redemptions of the
+// broadcaster are subscribed to and haven't been revoked.
+func (e *EventSub) RedemptionsSubscribed(broadcasterId string) (bool, error) {
+	_, subscriptions, err := e.subscriptions(EventSubRedemptionAdd, broadcasterId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.Status == "enabled" || subscription.Status == "webhook_callback_verification_pending" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SubscribeRedemptions subscribes to the redemptions of the broadcaster.
+// Existing subscriptions are replaced, as they might have been revoked.
+func (e *EventSub) SubscribeRedemptions(broadcasterId string) error {
+	return e.subscribe(EventSubRedemptionAdd, broadcasterId)
+}
+
+func (e *EventSub) UnsubscribeRedemptions(broadcasterId string) error {
+	return e.unsubscribe(EventSubRedemptionAdd, broadcasterId)
+}
+
+// SubscribeModerators subscribes to the moderators being added or removed
+// by the broadcaster. Existing subscriptions are replaced.
+func (e *EventSub) SubscribeModerators(broadcasterId string) error {
+	for _, subscriptionType := range []string{EventSubModeratorAdd, EventSubModeratorRemove} {
+		if err := e.subscribe(subscriptionType, broadcasterId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *EventSub) subscribe(subscriptionType, broadcasterId string) error {
+	if err := e.unsubscribe(subscriptionType, broadcasterId); err != nil {
+		return err
+	}
+
+	appTokens, err := e.getAppTokens()
+	if err != nil {
+		return err
+	}
+
+	_, err = e.Client.CreateEventSubSubscription(appTokens, subscriptionType,
+		map[string]string{"broadcaster_user_id": broadcasterId},
+		EventSubTransport{Method: "webhook", Callback: e.CallbackURL, Secret: e.Secret})
+	return err
+}
+
+func (e *EventSub) unsubscribe(subscriptionType, broadcasterId string) error {
+	appTokens, subscriptions, err := e.subscriptions(subscriptionType, broadcasterId)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		if err := e.Client.DeleteEventSubSubscription(appTokens, subscription.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifySignature checks the signature and age of a message. Unlike Verify,
+// the message isn't recorded, so it may still be passed to the Handler.
+func (e *EventSub) VerifySignature(header http.Header, body []byte) error {
+	messageId := header.Get("Twitch-Eventsub-Message-Id")
+	timestamp := header.Get("Twitch-Eventsub-Message-Timestamp")
+	expected := SignEventSubMessage(e.Secret, messageId, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get("Twitch-Eventsub-Message-Signature"))) {
+		return ErrInvalidEventSubSignature
+	}
+
+	sentAt, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil || time.Since(sentAt) > eventSubMaxAge {
+		return ErrInvalidEventSubSignature
+	}
+
+	return nil
+}
+
+// Verify checks the signature and age of a message. Messages that have
+// already been verified before are reported as duplicates.
+func (e *EventSub) Verify(header http.Header, body []byte) (duplicate bool, err error) {
+	if err := e.VerifySignature(header, body); err != nil {
+		return false, err
+	}
+
+	messageId := header.Get("Twitch-Eventsub-Message-Id")
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.seen == nil {
+		e.seen = make(map[string]time.Time)
+	}
+	for id, seenAt := range e.seen {
+		if time.Since(seenAt) > eventSubMaxAge {
+			delete(e.seen, id)
+		}
+	}
+	if _, duplicate := e.seen[messageId]; duplicate {
+		return true, nil
+	}
+	e.seen[messageId] = time.Now()
+
+	return false, nil
+}
+
+// Handler receives the messages sent to the CallbackURL. Notifications
+// about redemptions are passed to onRedemption and changed moderators to
+// onModeratorChange. Neither may block for long, as Twitch expects an answer
+// within a few seconds.
+func (e *EventSub) Handler(onRedemption func(*Redemption), onModeratorChange func(*ModeratorChange)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, eventSubMaxBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		duplicate, err := e.Verify(r.Header, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if duplicate {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var message struct {
+			Challenge    string               `json:"challenge"`
+			Subscription EventSubSubscription `json:"subscription"`
+			Event        json.RawMessage      `json:"event"`
+		}
+		if err := json.Unmarshal(body, &message); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.Header.Get("Twitch-Eventsub-Message-Type") {
+		case eventSubMessageVerification:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(message.Challenge))
+			return
+		case eventSubMessageRevocation:
+			logging.Warn("EventSub subscription revoked",
+				logging.KeyUser, message.Subscription.Condition["broadcaster_user_id"],
+				"type", message.Subscription.Type,
+				"status", message.Subscription.Status)
+		case eventSubMessageNotification:
+			switch message.Subscription.Type {
+			case EventSubRedemptionAdd:
+				var redemption Redemption
+				if err := json.Unmarshal(message.Event, &redemption); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				onRedemption(&redemption)
+			case EventSubModeratorAdd, EventSubModeratorRemove:
+				var change ModeratorChange
+				if err := json.Unmarshal(message.Event, &change); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				onModeratorChange(&change)
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
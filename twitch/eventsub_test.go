@@ -0,0 +1,78 @@
+package twitch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEventSubRequest(secret, messageType, messageId, timestamp, body string) *http.Request {
+	request := httptest.NewRequest("POST", "/eventsub", strings.NewReader(body))
+	request.Header.Set("Twitch-Eventsub-Message-Id", messageId)
+	request.Header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+	request.Header.Set("Twitch-Eventsub-Message-Type", messageType)
+	request.Header.Set("Twitch-Eventsub-Message-Signature", SignEventSubMessage(secret, messageId, timestamp, []byte(body)))
+	return request
+}
+
+func Test_eventSubHandler(t *testing.T) {
+	var redemptions []*Redemption
+	var moderatorChanges []*ModeratorChange
+	eventSub := &EventSub{Secret: "0123456789"}
+	handler := eventSub.Handler(func(redemption *Redemption) {
+		redemptions = append(redemptions, redemption)
+	}, func(change *ModeratorChange) {
+		moderatorChanges = append(moderatorChanges, change)
+	})
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newEventSubRequest("0123456789", "webhook_callback_verification", "1", now, `{"challenge":"pogchamp"}`))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "pogchamp" {
+		t.Errorf("Expected challenge to be echoed, got %d '%s'", recorder.Code, recorder.Body.String())
+	}
+
+	notification := `{"subscription":{"type":"channel.channel_points_custom_reward_redemption.add"},
+		"event":{"broadcaster_user_name":"Streamer","user_id":"42","user_input":"banana","reward":{"title":"Scribble.rs: Suggest word"}}}`
+	rejected := map[string]*http.Request{
+		"wrong secret":      newEventSubRequest("wrong secret", "notification", "2", now, notification),
+		"outdated message":  newEventSubRequest("0123456789", "notification", "2", time.Now().Add(-time.Hour).Format(time.RFC3339Nano), notification),
+		"missing timestamp": newEventSubRequest("0123456789", "notification", "2", "", notification),
+	}
+	for name, request := range rejected {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("Expected %s to be rejected, got %d", name, recorder.Code)
+		}
+	}
+
+	//Twitch may deliver a message multiple times.
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newEventSubRequest("0123456789", "notification", "2", now, notification))
+		if recorder.Code != http.StatusNoContent {
+			t.Errorf("Expected notification to be accepted, got %d", recorder.Code)
+		}
+	}
+
+	if len(redemptions) != 1 {
+		t.Fatalf("Expected exactly one redemption, got %d", len(redemptions))
+	}
+	if redemption := redemptions[0]; redemption.BroadcasterUserName != "Streamer" || redemption.UserInput != "banana" ||
+		redemption.Reward.Title != "Scribble.rs: Suggest word" {
+		t.Errorf("Unexpected redemption %+v", redemption)
+	}
+
+	moderatorAdded := `{"subscription":{"type":"channel.moderator.add"},"event":{"broadcaster_user_id":"1","user_id":"42"}}`
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newEventSubRequest("0123456789", "notification", "3", now, moderatorAdded))
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("Expected notification to be accepted, got %d", recorder.Code)
+	}
+	if len(moderatorChanges) != 1 || moderatorChanges[0].BroadcasterUserId != "1" || moderatorChanges[0].UserId != "42" {
+		t.Errorf("Unexpected moderator changes %+v", moderatorChanges)
+	}
+}
@@ -0,0 +1,7 @@
+package twitch
+
+import "github.com/scribble-rs/scribble.rs/metrics"
+
+var requestDuration = metrics.NewHistogram("scribblers_twitch_request_duration_seconds",
+	"Duration of requests to the Twitch API. The count is the number of requests.",
+	metrics.LatencyBuckets, "endpoint", "status")
@@ -0,0 +1,67 @@
+package twitch
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/scribble-rs/scribble.rs/auth"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+// Provider logs users in via Twitch. The tokens of the user are kept, so that
+// follows, subscriptions and moderators can be looked up later on.
+type Provider struct {
+	Client *Client
+	Tokens TokenStore
+	// EventSub is optional. If set, broadcasters that granted
+	// ModerationScope are subscribed to moderator changes whenever they
+	// log in, as that's also how scopes are granted.
+	EventSub *EventSub
+}
+
+func (p *Provider) Name() string {
+	return auth.ProviderTwitch
+}
+
+// AuthURI requests the scopes needed for joining lobbies. Further scopes are
+// requested once they are needed.
+func (p *Provider) AuthURI(w http.ResponseWriter, redirectURI, state string) (string, error) {
+	return p.Client.GetAuthURI(redirectURI, state, &[]string{"user:read:subscriptions"}), nil
+}
+
+func (p *Provider) Callback(w http.ResponseWriter, r *http.Request, redirectURI string) (*auth.Login, error) {
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return nil, errors.New("no Twitch code present in auth callback")
+	}
+
+	twitchUser, userTokens, err := p.Client.GetUserFromCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &auth.User{
+		Id:       twitchUser.Id,
+		Name:     twitchUser.DisplayName,
+		Provider: auth.ProviderTwitch,
+	}
+	return &auth.Login{
+		User:  user,
+		State: r.URL.Query().Get("state"),
+		Persisted: func() error {
+			if err := p.Tokens.Set(user, userTokens); err != nil {
+				return err
+			}
+
+			if p.EventSub != nil && userTokens.HasScope(ModerationScope) {
+				//Talking to Twitch takes a while, so we don't hold up the login.
+				go func() {
+					if err := p.EventSub.SubscribeModerators(user.Id); err != nil {
+						logging.Warn("Failed subscribing to moderator changes", logging.KeyUser, user.Id, logging.KeyError, err)
+					}
+				}()
+			}
+			return nil
+		},
+	}, nil
+}
@@ -14,6 +14,12 @@ type TokenSet struct {
 	Scopes               []string
 }
 
+// Expired indicates whether the access token has to be refreshed before
+// using it.
+func (t *TokenSet) Expired() bool {
+	return time.Now().Add(time.Minute).After(t.AccessTokenExpiresAt)
+}
+
 func (t *TokenSet) HasScope(scope string) bool {
 	if len(t.Scopes) == 0 {
 		return false
@@ -33,6 +39,29 @@ type TokenStore interface {
 	Set(user *auth.User, tokens *TokenSet) error
 }
 
+// RefreshingTokenStore refreshes expired tokens when getting them and
+// stores the new ones.
+type RefreshingTokenStore struct {
+	TokenStore
+	Client *Client
+}
+
+func (s *RefreshingTokenStore) Get(user *auth.User) (*TokenSet, error) {
+	tokens, err := s.TokenStore.Get(user)
+	if err != nil || tokens == nil || tokens.RefreshToken == "" || !tokens.Expired() {
+		return tokens, err
+	}
+
+	refreshed, err := s.Client.RefreshTokenSet(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.TokenStore.Set(user, refreshed); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
 func NewMemoryTokenStore() TokenStore {
 	return &memoryTokenStore{
 		tokens: []MemoryTokenStoreEntry{},
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/scribble-rs/scribble.rs/logging"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -32,6 +34,20 @@ type Client struct {
 	ClientId     string
 	ClientSecret string
 	RedirectURI  string
+	// apiURL replaces helixURL, so that requests can be tested against a
+	// local server.
+	apiURL string
+}
+
+// helixURL is the base of all API requests.
+const helixURL = "https://api.twitch.tv/helix"
+
+// endpoint returns the URL of the given API endpoint.
+func (c Client) endpoint(path string) string {
+	if c.apiURL != "" {
+		return c.apiURL + path
+	}
+	return helixURL + path
 }
 
 type HttpError struct {
@@ -79,7 +95,7 @@ func (c Client) GetUserFromCode(code string) (*User, *TokenSet, error) {
 }
 
 func (c Client) GetUsers(tokens *TokenSet, query url.Values) (*GetUsersResult, error) {
-	request, newRequestError := http.NewRequest("GET", "https://api.twitch.tv/helix/users?"+query.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	request, newRequestError := http.NewRequest("GET", c.endpoint("/users?")+query.Encode(), bytes.NewBuffer(make([]byte, 0)))
 	if newRequestError != nil {
 		return nil, newRequestError
 	}
@@ -144,7 +160,7 @@ func (c Client) GetBannedUsers(tokens *TokenSet, broadcasterId string, cursor st
 		params.Add("after", cursor)
 	}
 
-	request, newRequestError := http.NewRequest("GET", "https://api.twitch.tv/helix/moderation/banned?"+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	request, newRequestError := http.NewRequest("GET", c.endpoint("/moderation/banned?")+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
 	if newRequestError != nil {
 		return nil, newRequestError
 	}
@@ -188,20 +204,29 @@ type CheckUserSubscriptionResult struct {
 	Data []SubscriptionEntry `json:"data"`
 }
 
+// FollowersScope has to be granted by the broadcaster or one of their
+// moderators to check whether a user follows the channel.
+const FollowersScope = "moderator:read:followers"
+
 type FollowEntry struct {
-	FromId     string `json:"from_id"`
-	FromLogin  string `json:"from_login"`
-	FromName   string `json:"from_name"`
-	ToId       string `json:"to_id"`
-	ToLogin    string `json:"to_login"`
-	ToName     string `json:"to_name"`
-	FollowedAt string `json:"followed_at"`
+	UserId     string    `json:"user_id"`
+	UserLogin  string    `json:"user_login"`
+	UserName   string    `json:"user_name"`
+	FollowedAt time.Time `json:"followed_at"`
 }
 
-type UserFollowsResult struct {
-	Data []FollowEntry `json:"data"`
+type GetChannelFollowersResult struct {
+	Data       []FollowEntry `json:"data"`
+	Total      int           `json:"total"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
 }
 
+// ModerationScope has to be granted by broadcasters to list their
+// moderators and bans.
+const ModerationScope = "moderation:read"
+
 func (c Client) GetAllModerators(tokens *TokenSet, broadcasterId string) ([]ModeratorEntry, error) {
 	res := make([]ModeratorEntry, 0)
 	cursor := ""
@@ -233,7 +258,7 @@ func (c Client) GetModerators(tokens *TokenSet, broadcasterId string, cursor str
 		params.Add("after", cursor)
 	}
 
-	request, newRequestError := http.NewRequest("GET", "https://api.twitch.tv/helix/moderation/moderators?"+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	request, newRequestError := http.NewRequest("GET", c.endpoint("/moderation/moderators?")+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
 	if newRequestError != nil {
 		return nil, newRequestError
 	}
@@ -254,7 +279,7 @@ func (c Client) CheckUserSubscription(tokens *TokenSet, userId string, broadcast
 	params.Set("user_id", userId)
 	params.Set("broadcaster_id", broadcasterId)
 
-	request, newRequestError := http.NewRequest("GET", "https://api.twitch.tv/helix/subscriptions/user"+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	request, newRequestError := http.NewRequest("GET", c.endpoint("/subscriptions/user?")+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
 	if newRequestError != nil {
 		return nil, newRequestError
 	}
@@ -280,30 +305,29 @@ func (c Client) CheckUserSubscription(tokens *TokenSet, userId string, broadcast
 	return &result.Data[0], nil
 }
 
+// CheckUserFollows returns the follow of the user, including when they
+// started following, or nil if they don't follow the channel. The tokens
+// have to belong to the broadcaster or one of their moderators and require
+// the FollowersScope.
 func (c *Client) CheckUserFollows(tokens *TokenSet, userId string, broadcasterId string) (*FollowEntry, error) {
 	params := url.Values{}
-	params.Set("from_id", userId)
-	params.Set("to_id", broadcasterId)
+	params.Set("user_id", userId)
+	params.Set("broadcaster_id", broadcasterId)
 
-	request, newRequestError := http.NewRequest("GET", "https://api.twitch.tv/helix/users/follows?"+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	request, newRequestError := http.NewRequest("GET", c.endpoint("/channels/followers?")+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
 	if newRequestError != nil {
 		return nil, newRequestError
 	}
 
 	request.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
 
-	var result UserFollowsResult
+	var result GetChannelFollowersResult
 	err := c.doAndParseJson(request, &result)
 	if err != nil {
-		// No follow results in 404 error, not an empty ok response
-		httpError, ok := err.(*HttpError)
-		if ok && httpError.StatusCode == 404 {
-			return nil, nil
-		}
-
 		return nil, err
 	}
 
+	//Not following results in an empty list, not in an error.
 	if len(result.Data) == 0 {
 		return nil, nil
 	}
@@ -316,7 +340,7 @@ func (c *Client) CheckUserBanned(tokens *TokenSet, userId string, broadcasterId
 	params.Set("user_id", userId)
 	params.Set("broadcaster_id", broadcasterId)
 
-	request, newRequestError := http.NewRequest("GET", "https://api.twitch.tv/helix/moderation/banned?"+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	request, newRequestError := http.NewRequest("GET", c.endpoint("/moderation/banned?")+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
 	if newRequestError != nil {
 		return nil, newRequestError
 	}
@@ -336,14 +360,118 @@ func (c *Client) CheckUserBanned(tokens *TokenSet, userId string, broadcasterId
 	return &result.Data[0], nil
 }
 
+type VIPEntry struct {
+	UserId    string `json:"user_id"`
+	UserLogin string `json:"user_login"`
+	UserName  string `json:"user_name"`
+}
+
+type GetVIPsResult struct {
+	Data       []VIPEntry `json:"data"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+}
+
+// VIPScope has to be granted by broadcasters to list their VIPs.
+const VIPScope = "channel:read:vips"
+
+func (c *Client) GetAllVIPs(tokens *TokenSet, broadcasterId string) ([]VIPEntry, error) {
+	res := make([]VIPEntry, 0)
+	cursor := ""
+
+	for {
+		r, err := c.GetVIPs(tokens, broadcasterId, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, r.Data...)
+
+		if r.Pagination.Cursor == "" {
+			break
+		}
+		cursor = r.Pagination.Cursor
+	}
+
+	return res, nil
+}
+
+func (c *Client) GetVIPs(tokens *TokenSet, broadcasterId string, cursor string) (*GetVIPsResult, error) {
+	params := url.Values{}
+	params.Add("broadcaster_id", broadcasterId)
+	params.Add("first", "100")
+
+	if cursor != "" {
+		params.Add("after", cursor)
+	}
+
+	request, newRequestError := http.NewRequest("GET", c.endpoint("/channels/vips?")+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	if newRequestError != nil {
+		return nil, newRequestError
+	}
+
+	request.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	var result GetVIPsResult
+	err := c.doAndParseJson(request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// CheckUserVIP requires the broadcaster's tokens with the VIPScope.
+func (c *Client) CheckUserVIP(tokens *TokenSet, userId string, broadcasterId string) (*VIPEntry, error) {
+	params := url.Values{}
+	params.Set("user_id", userId)
+	params.Set("broadcaster_id", broadcasterId)
+
+	request, newRequestError := http.NewRequest("GET", c.endpoint("/channels/vips?")+params.Encode(), bytes.NewBuffer(make([]byte, 0)))
+	if newRequestError != nil {
+		return nil, newRequestError
+	}
+
+	request.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	var result GetVIPsResult
+	err := c.doAndParseJson(request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Data) == 0 {
+		return nil, nil
+	}
+
+	return &result.Data[0], nil
+}
+
 func (c Client) GetTokenSetFromCode(code string) (*TokenSet, error) {
 	params := url.Values{}
-	params.Set("client_id", c.ClientId)
-	params.Set("client_secret", c.ClientSecret)
 	params.Set("code", code)
 	params.Set("grant_type", "authorization_code")
 	params.Set("redirect_uri", c.RedirectURI)
 
+	return c.requestTokenSet(params)
+}
+
+// RefreshTokenSet exchanges the refresh token for a new token set, as
+// access tokens expire after a few hours. This allows acting on behalf of
+// users that haven't visited in a while.
+func (c Client) RefreshTokenSet(tokens *TokenSet) (*TokenSet, error) {
+	params := url.Values{}
+	params.Set("refresh_token", tokens.RefreshToken)
+	params.Set("grant_type", "refresh_token")
+
+	return c.requestTokenSet(params)
+}
+
+func (c Client) requestTokenSet(params url.Values) (*TokenSet, error) {
+	params.Set("client_id", c.ClientId)
+	params.Set("client_secret", c.ClientSecret)
+
 	request, newRequestError := http.NewRequest("POST", "https://id.twitch.tv/oauth2/token?"+params.Encode(), bytes.NewBuffer([]byte("")))
 	if newRequestError != nil {
 		return nil, newRequestError
@@ -385,24 +513,36 @@ func (c Client) doAndParseJson(r *http.Request, result any) error {
 
 	r.Header.Set("Client-Id", c.ClientId)
 
+	start := time.Now()
 	response, doError := client.Do(r)
 	if doError != nil {
+		requestDuration.ObserveSince(start, r.URL.Path, "error")
+		logging.Warn("Twitch request failed", "endpoint", r.URL.Path, logging.KeyError, doError)
 		return doError
 	}
 	defer response.Body.Close()
+	requestDuration.ObserveSince(start, r.URL.Path, strconv.Itoa(response.StatusCode))
 
 	bodyString, readError := io.ReadAll(response.Body)
 	if readError != nil {
 		return readError
 	}
 
-	if response.StatusCode != 200 {
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		//Some endpoints use 404 as a regular answer, so this isn't
+		//necessarily an error.
+		logging.Debug("Twitch request unsuccessful", "endpoint", r.URL.Path, "status", response.StatusCode)
 		return &HttpError{
 			StatusCode: response.StatusCode,
 			Status:     response.Status,
 		}
 	}
 
+	//Some endpoints, such as deletions, don't answer with a body.
+	if result == nil {
+		return nil
+	}
+
 	decodeError := json.Unmarshal(bodyString, result)
 	if decodeError != nil {
 		return decodeError
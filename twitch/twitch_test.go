@@ -0,0 +1,45 @@
+package twitch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_CheckUserFollows(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/channels/followers" || r.URL.Query().Get("broadcaster_id") != "1" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Unexpected authorization '%s'", r.Header.Get("Authorization"))
+		}
+
+		if r.URL.Query().Get("user_id") == "follower" {
+			w.Write([]byte(`{"total":1,"data":[{"user_id":"follower","user_login":"follower","user_name":"Follower","followed_at":"2022-05-24T22:22:08Z"}],"pagination":{}}`))
+		} else {
+			w.Write([]byte(`{"total":0,"data":[],"pagination":{}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{apiURL: server.URL}
+	tokens := &TokenSet{AccessToken: "secret"}
+
+	follow, err := client.CheckUserFollows(tokens, "follower", "1")
+	if err != nil {
+		t.Fatalf("Couldn't check follow: %s", err)
+	}
+	if follow == nil || !follow.FollowedAt.Equal(time.Date(2022, 5, 24, 22, 22, 8, 0, time.UTC)) {
+		t.Errorf("Expected follow since 2022-05-24T22:22:08Z, got %v", follow)
+	}
+
+	follow, err = client.CheckUserFollows(tokens, "viewer", "1")
+	if err != nil {
+		t.Fatalf("Couldn't check follow: %s", err)
+	}
+	if follow != nil {
+		t.Errorf("Expected empty list to mean not following, got %v", follow)
+	}
+}
@@ -0,0 +1,430 @@
+// Package webhook delivers events to URLs configured by users. Deliveries
+// are JSON POST requests signed via HMAC-SHA256 using a secret shared with
+// the receiver. Failed deliveries are retried with an exponential backoff and
+// every attempt is recorded in the delivery log.
+//
+// Receivers should verify the "X-Scribblers-Signature" header, which has the
+// form "sha256=<hex encoded HMAC of the body>". The "X-Scribblers-Delivery"
+// header stays the same across retries and can be used for deduplication.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/scribble-rs/scribble.rs/clock"
+	"github.com/scribble-rs/scribble.rs/logging"
+)
+
+const (
+	// MaxWebhooks is the maximum amount of webhooks a single user can have.
+	MaxWebhooks = 5
+	// MaxAttempts is the amount of times a delivery is attempted before
+	// giving up.
+	MaxAttempts = 5
+	// retryBackoff is the delay before the first retry, which doubles with
+	// every further attempt.
+	retryBackoff    = 10 * time.Second
+	deliveryTimeout = 10 * time.Second
+	maxURLLength    = 500
+	// queueSize limits the deliveries waiting for a worker. Deliveries
+	// exceeding the limit are dropped, so that slow receivers can't cause
+	// the server to run out of memory.
+	queueSize = 1000
+	workers   = 4
+)
+
+var (
+	ErrTooManyWebhooks = fmt.Errorf("a user can't have more than %d webhooks", MaxWebhooks)
+	errPrivateNetwork  = errors.New("webhooks can't be delivered to private networks")
+)
+
+// Webhook is the subscription of a user to the events of their channel,
+// meaning the lobbies they've created.
+type Webhook struct {
+	Id     string
+	UserId string
+	URL    string
+	// Secret is used for signing the deliveries.
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+}
+
+func (w *Webhook) Subscribed(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delivery is a single attempt of delivering an event to a webhook.
+type Delivery struct {
+	// Id is the same for all attempts of delivering the same event.
+	Id        string
+	WebhookId string
+	Event     string
+	Attempt   int
+	// StatusCode is 0 if no response has been received.
+	StatusCode int
+	Error      string
+	CreatedAt  time.Time
+}
+
+func (d *Delivery) Succeeded() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
+
+type Store interface {
+	Create(webhook *Webhook) error
+	// List returns the webhooks of the given user, oldest first.
+	List(userId string) ([]*Webhook, error)
+	// Delete deletes the webhook, if it belongs to the given user.
+	Delete(userId, id string) error
+	AddDelivery(delivery *Delivery) error
+	// ListDeliveries returns the latest deliveries to the webhooks of the
+	// given user, newest first.
+	ListDeliveries(userId string, limit int) ([]*Delivery, error)
+}
+
+// Service manages webhooks and delivers events to them.
+type Service struct {
+	Store Store
+	// Events are the event types that can be subscribed to.
+	Events []string
+
+	client *http.Client
+	clock  clock.Clock
+	queue  chan *job
+}
+
+// job is a pending attempt of a delivery.
+type job struct {
+	webhook  *Webhook
+	delivery *Delivery
+	body     []byte
+}
+
+// NewService creates a Service and launches its delivery workers. Unless
+// allowPrivateNetworks is set, deliveries to loopback and private addresses
+// are refused, as users could otherwise probe the servers network.
+func NewService(store Store, events []string, allowPrivateNetworks bool) *Service {
+	dialer := &net.Dialer{Timeout: deliveryTimeout}
+	if !allowPrivateNetworks {
+		dialer.Control = refusePrivateNetworks
+	}
+
+	service := &Service{
+		Store:  store,
+		Events: events,
+		client: &http.Client{
+			Timeout:   deliveryTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			//Redirects could otherwise be used to bypass the address checks.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		clock: clock.Real,
+		queue: make(chan *job, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go service.work()
+	}
+
+	return service
+}
+
+// refusePrivateNetworks is checked after the hostname has been resolved, so
+// that DNS can't be used to bypass it.
+func refusePrivateNetworks(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errPrivateNetwork
+	}
+
+	return nil
+}
+
+// Create creates a webhook for the given user. The secret of the returned
+// webhook has to be shown to the user, so they can verify deliveries.
+func (s *Service) Create(userId, rawURL string, events []string) (*Webhook, error) {
+	if len(rawURL) > maxURLLength {
+		return nil, fmt.Errorf("the URL must not be longer than %d characters", maxURLLength)
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return nil, errors.New("the URL must be an absolute http or https URL")
+	}
+	if len(events) == 0 {
+		return nil, errors.New("at least one event is required")
+	}
+	for _, event := range events {
+		if !contains(s.Events, event) {
+			return nil, fmt.Errorf("unknown event '%s'", event)
+		}
+	}
+
+	existing, err := s.Store.List(userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxWebhooks {
+		return nil, ErrTooManyWebhooks
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	webhook := &Webhook{
+		Id:        uuid.Must(uuid.NewV4()).String(),
+		UserId:    userId,
+		URL:       parsedURL.String(),
+		Secret:    hex.EncodeToString(secret),
+		Events:    events,
+		CreatedAt: s.clock.Now(),
+	}
+	if err := s.Store.Create(webhook); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign calculates the signature of the given body, as sent in the
+// "X-Scribblers-Signature" header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatch delivers the payload to all webhooks of the given user that are
+// subscribed to the event. It doesn't block, as the deliveries happen in
+// the background. Note that deliveries may arrive out of order.
+func (s *Service) Dispatch(userId, event string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logging.Error("Failed encoding webhook payload", "event", event, logging.KeyError, err)
+		return
+	}
+
+	go func() {
+		webhooks, err := s.Store.List(userId)
+		if err != nil {
+			logging.Error("Failed listing webhooks", logging.KeyUser, userId, logging.KeyError, err)
+			return
+		}
+
+		for _, webhook := range webhooks {
+			if !webhook.Subscribed(event) {
+				continue
+			}
+
+			s.enqueue(&job{
+				webhook: webhook,
+				delivery: &Delivery{
+					Id:        uuid.Must(uuid.NewV4()).String(),
+					WebhookId: webhook.Id,
+					Event:     event,
+					Attempt:   1,
+				},
+				body: body,
+			})
+		}
+	}()
+}
+
+func (s *Service) enqueue(job *job) {
+	select {
+	case s.queue <- job:
+	default:
+		logging.Warn("Dropped webhook delivery, as the queue is full",
+			logging.KeyUser, job.webhook.UserId, "webhook", job.webhook.Id, "event", job.delivery.Event)
+	}
+}
+
+func (s *Service) work() {
+	for job := range s.queue {
+		s.deliver(job)
+	}
+}
+
+// deliver attempts a delivery and schedules a retry if it fails.
+func (s *Service) deliver(job *job) {
+	delivery := *job.delivery
+	delivery.CreatedAt = s.clock.Now()
+
+	statusCode, err := s.post(job)
+	delivery.StatusCode = statusCode
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	logger := logging.With(logging.KeyUser, job.webhook.UserId, "webhook", job.webhook.Id, "delivery", delivery.Id)
+	if err := s.Store.AddDelivery(&delivery); err != nil {
+		logger.Error("Failed recording webhook delivery", logging.KeyError, err)
+	}
+
+	if delivery.Succeeded() || !retryable(statusCode) || errors.Is(err, errPrivateNetwork) {
+		return
+	}
+	if delivery.Attempt >= MaxAttempts {
+		logger.Warn("Giving up on webhook delivery", "status", statusCode, logging.KeyError, err)
+		return
+	}
+
+	backoff := retryBackoff << (delivery.Attempt - 1)
+	job.delivery = &Delivery{
+		Id:        delivery.Id,
+		WebhookId: delivery.WebhookId,
+		Event:     delivery.Event,
+		Attempt:   delivery.Attempt + 1,
+	}
+	s.clock.AfterFunc(backoff, func() {
+		s.enqueue(job)
+	})
+}
+
+// retryable indicates whether a delivery that failed with the given status
+// is worth retrying. Other client errors won't go away by themselves.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func (s *Service) post(job *job) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, job.webhook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Scribble.rs-Webhook")
+	request.Header.Set("X-Scribblers-Event", job.delivery.Event)
+	request.Header.Set("X-Scribblers-Delivery", job.delivery.Id)
+	request.Header.Set("X-Scribblers-Signature", Sign(job.webhook.Secret, job.body))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	//Reading the body allows reusing the connection.
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// maxMemoryDeliveries limits the delivery log of the memory store.
+const maxMemoryDeliveries = 100
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		webhooks: make(map[string]*Webhook),
+		mutex:    &sync.Mutex{},
+	}
+}
+
+type memoryStore struct {
+	webhooks   map[string]*Webhook
+	deliveries []*Delivery
+	mutex      *sync.Mutex
+}
+
+func (s *memoryStore) Create(webhook *Webhook) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.webhooks[webhook.Id] = webhook
+	return nil
+}
+
+func (s *memoryStore) List(userId string) ([]*Webhook, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var webhooks []*Webhook
+	for _, webhook := range s.webhooks {
+		if webhook.UserId == userId {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(a, b int) bool {
+		return webhooks[a].CreatedAt.Before(webhooks[b].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+func (s *memoryStore) Delete(userId, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if webhook, exists := s.webhooks[id]; exists && webhook.UserId == userId {
+		delete(s.webhooks, id)
+	}
+	return nil
+}
+
+func (s *memoryStore) AddDelivery(delivery *Delivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	copied := *delivery
+	s.deliveries = append(s.deliveries, &copied)
+	if len(s.deliveries) > maxMemoryDeliveries {
+		s.deliveries = s.deliveries[len(s.deliveries)-maxMemoryDeliveries:]
+	}
+	return nil
+}
+
+func (s *memoryStore) ListDeliveries(userId string, limit int) ([]*Delivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var deliveries []*Delivery
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		webhook, exists := s.webhooks[s.deliveries[i].WebhookId]
+		if exists && webhook.UserId == userId {
+			deliveries = append(deliveries, s.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
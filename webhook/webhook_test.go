@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scribble-rs/scribble.rs/clock"
+)
+
+type receivedDelivery struct {
+	header http.Header
+	body   string
+}
+
+// waitForDeliveries waits until the delivery log contains the given amount
+// of attempts, as deliveries happen in the background.
+func waitForDeliveries(t *testing.T, s *Service, userId string, count int) []*Delivery {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		deliveries, _ := s.Store.ListDeliveries(userId, 10)
+		if len(deliveries) >= count {
+			return deliveries
+		}
+	}
+
+	t.Fatalf("Expected %d deliveries", count)
+	return nil
+}
+
+func Test_dispatch(t *testing.T) {
+	received := make(chan receivedDelivery, 10)
+	failures := 1
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedDelivery{header: r.Header, body: string(body)}
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	fakeClock := clock.NewFake(time.Now())
+	s := NewService(NewMemoryStore(), []string{"game-over", "turn-over"}, true)
+	s.clock = fakeClock
+
+	webhook, err := s.Create("1", receiver.URL, []string{"game-over"})
+	if err != nil {
+		t.Fatalf("Couldn't create webhook: %s", err)
+	}
+
+	s.Dispatch("1", "turn-over", map[string]string{"word": "unsubscribed"})
+	s.Dispatch("2", "game-over", map[string]string{"word": "other channel"})
+	s.Dispatch("1", "game-over", map[string]string{"winner": "Marcel"})
+
+	first := <-received
+	if first.body != `{"winner":"Marcel"}` {
+		t.Errorf("Unexpected body '%s'", first.body)
+	}
+	if signature := first.header.Get("X-Scribblers-Signature"); signature != Sign(webhook.Secret, []byte(first.body)) {
+		t.Errorf("Invalid signature '%s'", signature)
+	}
+	if event := first.header.Get("X-Scribblers-Event"); event != "game-over" {
+		t.Errorf("Unexpected event '%s'", event)
+	}
+
+	//The failed attempt is retried after the backoff. As the retry is
+	//scheduled in the background, we keep advancing until it arrives.
+	var second receivedDelivery
+	for retried, start := false, time.Now(); !retried; {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Delivery wasn't retried")
+		}
+
+		fakeClock.Advance(retryBackoff)
+		select {
+		case second = <-received:
+			retried = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if second.header.Get("X-Scribblers-Delivery") != first.header.Get("X-Scribblers-Delivery") {
+		t.Error("Retries should keep the delivery ID")
+	}
+
+	deliveries := waitForDeliveries(t, s, "1", 2)
+	if len(deliveries) != 2 || deliveries[0].Attempt != 2 || !deliveries[0].Succeeded() ||
+		deliveries[1].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected delivery log %+v, %+v", deliveries[0], deliveries[1])
+	}
+	select {
+	case unexpected := <-received:
+		t.Errorf("Unexpected delivery '%s'", unexpected.body)
+	default:
+	}
+}
+
+func Test_privateNetworksRefused(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Delivery to loopback address shouldn't happen")
+	}))
+	defer receiver.Close()
+
+	s := NewService(NewMemoryStore(), []string{"game-over"}, false)
+	if _, err := s.Create("1", receiver.URL, []string{"game-over"}); err != nil {
+		t.Fatalf("Couldn't create webhook: %s", err)
+	}
+
+	s.Dispatch("1", "game-over", nil)
+	deliveries := waitForDeliveries(t, s, "1", 1)
+	if !strings.Contains(deliveries[0].Error, errPrivateNetwork.Error()) {
+		t.Errorf("Expected delivery to be refused, got '%s'", deliveries[0].Error)
+	}
+}
+
+func Test_createValidation(t *testing.T) {
+	s := NewService(NewMemoryStore(), []string{"game-over"}, true)
+
+	invalid := map[string]struct {
+		url    string
+		events []string
+	}{
+		"relative URL":  {"/hook", []string{"game-over"}},
+		"other scheme":  {"ftp://example.com", []string{"game-over"}},
+		"no events":     {"https://example.com", nil},
+		"unknown event": {"https://example.com", []string{"drawing"}},
+	}
+	for name, testCase := range invalid {
+		if _, err := s.Create("1", testCase.url, testCase.events); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+
+	for i := 0; i < MaxWebhooks; i++ {
+		if _, err := s.Create("1", "https://example.com", []string{"game-over"}); err != nil {
+			t.Fatalf("Couldn't create webhook: %s", err)
+		}
+	}
+	if _, err := s.Create("1", "https://example.com", []string{"game-over"}); err != ErrTooManyWebhooks {
+		t.Errorf("Expected ErrTooManyWebhooks, got %v", err)
+	}
+}